@@ -1,14 +1,15 @@
 package main
 
 import (
-	"STTAuth/internal/app"
-	"STTAuth/internal/config"
-	"STTAuth/internal/lib/logger/handlers/slogpretty"
+	"context"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/skinkvi/STTAuth/internal/app"
+	"github.com/skinkvi/STTAuth/internal/config"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/handlers/slogpretty"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
@@ -28,12 +29,6 @@ func main() {
 
 	log.Info("starting application", slog.Any("cfg", cfg))
 
-	application, err := app.New(log, cfg)
-	if err != nil {
-		log.Error("Failed to create application", slog.String("err", err.Error()))
-		os.Exit(1)
-	}
-
 	// Настройка сервера gRPC с TLS
 	creds, err := credentials.NewServerTLSFromFile("server.crt", "server.key")
 	if err != nil {
@@ -41,10 +36,15 @@ func main() {
 		os.Exit(1)
 	}
 
-	grpcServer := grpc.NewServer(grpc.Creds(creds))
-	application.GRPCSrv.SetServer(grpcServer)
+	// Опции передаем сразу в New, если подменить сервер потом то на нем не будет ни сервисов ни интерсепторов
+	application, err := app.New(log, cfg, grpc.Creds(creds))
+	if err != nil {
+		log.Error("Failed to create application", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
 
 	go application.GRPCSrv.MustRun()
+	go application.HTTPSrv.MustRun()
 
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -52,6 +52,13 @@ func main() {
 
 	<-stop
 
+	// Сначала останавливаем серверы, иначе текущие запросы упадут на закрытой базе
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.Timeout)
+	application.HTTPSrv.Stop(shutdownCtx)
+	cancel()
+
+	application.GRPCSrv.Stop()
+
 	err = application.Storage.Close()
 	if err != nil {
 		log.Error("Failed to close PostgreSQL connection", slog.String("err", err.Error()))
@@ -59,8 +66,6 @@ func main() {
 
 	log.Info("Postgres stopped")
 
-	application.GRPCSrv.Stop()
-
 	log.Info("application stopped")
 }
 
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps
+    ADD COLUMN register_mode TEXT NOT NULL DEFAULT 'open',
+    ADD COLUMN allowed_domains TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS app_members
+(
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (app_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_app_members_status ON app_members (app_id, status);
+
+CREATE TABLE IF NOT EXISTS invites
+(
+    code_hash TEXT PRIMARY KEY,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    uses INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invites;
+DROP TABLE IF EXISTS app_members;
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS register_mode,
+    DROP COLUMN IF EXISTS allowed_domains;
+-- +goose StatementEnd
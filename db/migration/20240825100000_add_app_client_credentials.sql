@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps
+    ADD COLUMN client_secret_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS client_secret_hash,
+    DROP COLUMN IF EXISTS scopes;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE oauth_codes
+    ADD COLUMN nonce TEXT NOT NULL DEFAULT '',
+    ADD COLUMN auth_time TIMESTAMPTZ NOT NULL DEFAULT NOW();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_codes
+    DROP COLUMN IF EXISTS nonce,
+    DROP COLUMN IF EXISTS auth_time;
+-- +goose StatementEnd
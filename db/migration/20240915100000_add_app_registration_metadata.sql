@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps
+    ADD COLUMN grant_types TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN token_endpoint_auth_method TEXT NOT NULL DEFAULT '',
+    ADD COLUMN registration_token_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS grant_types,
+    DROP COLUMN IF EXISTS token_endpoint_auth_method,
+    DROP COLUMN IF EXISTS registration_token_hash,
+    DROP COLUMN IF EXISTS created_at;
+-- +goose StatementEnd
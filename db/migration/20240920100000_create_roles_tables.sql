@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS roles
+(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    app_id INTEGER REFERENCES apps (id) ON DELETE CASCADE,
+    inherits_id INTEGER REFERENCES roles (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- У глобальных ролей app_id NULL, а NULL в обычном уникальном индексе не сравнивается
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name_app ON roles (name, COALESCE(app_id, 0));
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_roles_role ON user_roles (role_id);
+
+-- is_admin превращается в глобальную роль admin
+INSERT INTO roles (name) VALUES ('admin');
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, '*' FROM roles WHERE name = 'admin' AND app_id IS NULL;
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u, roles r WHERE u.is_admin AND r.name = 'admin' AND r.app_id IS NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET is_admin = TRUE
+WHERE id IN (
+    SELECT ur.user_id FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+    WHERE r.name = 'admin' AND r.app_id IS NULL
+);
+
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
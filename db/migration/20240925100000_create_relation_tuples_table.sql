@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS relation_tuples
+(
+    namespace TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    subject_namespace TEXT NOT NULL,
+    subject_object_id TEXT NOT NULL,
+    subject_relation TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation)
+);
+
+CREATE INDEX IF NOT EXISTS relation_tuples_subject_idx
+    ON relation_tuples (subject_namespace, subject_object_id, subject_relation);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS relation_tuples;
+-- +goose StatementEnd
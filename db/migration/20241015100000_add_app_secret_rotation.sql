@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps
+    ADD COLUMN previous_secret TEXT NOT NULL DEFAULT '',
+    ADD COLUMN previous_secret_expires_at TIMESTAMPTZ,
+    ADD COLUMN disabled_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS previous_secret,
+    DROP COLUMN IF EXISTS previous_secret_expires_at,
+    DROP COLUMN IF EXISTS disabled_at;
+-- +goose StatementEnd
@@ -1,30 +1,274 @@
 package app
 
 import (
-	grpcapp "STTAuth/internal/app/grpc"
-	"STTAuth/internal/config"
-	"STTAuth/internal/services/auth"
-	"STTAuth/internal/storage/postgre"
-
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"time"
 
 	_ "github.com/lib/pq"
+	grpcapp "github.com/skinkvi/STTAuth/internal/app/grpc"
+	httpapp "github.com/skinkvi/STTAuth/internal/app/http"
+	"github.com/skinkvi/STTAuth/internal/config"
+	authngrpc "github.com/skinkvi/STTAuth/internal/grpc/authn"
+	challengegrpc "github.com/skinkvi/STTAuth/internal/grpc/challenge"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/lib/ldapauth"
+	"github.com/skinkvi/STTAuth/internal/lib/notifier/lognotifier"
+	"github.com/skinkvi/STTAuth/internal/lib/notifier/smtpnotifier"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/lib/policy"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"github.com/skinkvi/STTAuth/internal/services/authz"
+	"github.com/skinkvi/STTAuth/internal/services/federation"
+	"github.com/skinkvi/STTAuth/internal/services/oauth"
+	"github.com/skinkvi/STTAuth/internal/storage/postgre"
+	"google.golang.org/grpc"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
+	HTTPSrv *httpapp.App
 	Storage *postgre.Storage
 }
 
-func New(log *slog.Logger, cfg *config.Config) (*App, error) {
+func New(log *slog.Logger, cfg *config.Config, opts ...grpc.ServerOption) (*App, error) {
 	storage, err := postgre.NewPostgreStorage(log, cfg.Storage.Postgres.URL)
 	if err != nil {
 		return nil, err
 	}
-	authService := auth.New(log, storage, storage, storage, cfg.TokenTTL)
-	grpcApp := grpcapp.New(log, authService, cfg.GRPC.Port)
+	policyEngine, err := policy.NewEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	directories, err := newDirectories(cfg.LDAP)
+	if err != nil {
+		return nil, err
+	}
+
+	authService := auth.New(log, auth.Deps{
+		UserSaver:       storage,
+		UserProvider:    storage,
+		AppProvider:     storage,
+		SessionSaver:    storage,
+		SessionProvider: storage,
+		Devices:         storage,
+		Notifier:        newNotifier(log, cfg.Notifier),
+		Members:         storage,
+		Clients:         storage,
+		Consents:        storage,
+		Roles:           storage,
+		Policies:        storage,
+		Orgs:            storage,
+		APIKeys:         storage,
+		Apps:            storage,
+		Identities:      storage,
+		PolicyEngine:    policyEngine,
+		Directories:     directories,
+	}, auth.Config{
+		TokenTTL:          cfg.TokenTTL,
+		DecisionTTL:       cfg.Authz.DecisionTTL,
+		UniformRegister:   cfg.Register.UniformResponse,
+		SessionlessCutoff: cfg.SessionlessTokenCutoff,
+	})
+
+	issuer, err := newChallengeIssuer(log, cfg.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	// Счетчики неудач общие для gRPC и HTTP формы входа
+	guard := pow.NewGuard(issuer, pow.NewFailureCounter(cfg.Challenge.Window), pow.Thresholds{
+		IP:      cfg.Challenge.IPThreshold,
+		Account: cfg.Challenge.AccountThreshold,
+	})
+
+	proxies, err := clientinfo.NewProxies(cfg.Proxy.TrustedCIDRs, cfg.Proxy.CountryHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		proxies.UnaryServerInterceptor(),
+		challengegrpc.UnaryServerInterceptor(log, guard),
+		authngrpc.UnaryServerInterceptor(log, authService, authngrpc.Requirements, authngrpc.RequireAuthenticated),
+	), grpc.ChainStreamInterceptor(
+		authngrpc.StreamServerInterceptor(log, authService, authngrpc.Requirements, authngrpc.RequireAuthenticated),
+	))
+
+	federationService := federation.New(log, newFederationProviders(cfg.Federation), storage, storage, storage, storage, authService)
+
+	signingKey, err := newSigningKey(log, cfg.OIDC)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthService := oauth.New(log, storage, storage, storage, authService, authService, authService, storage, storage, oauth.DeviceConfig{
+		VerificationURI: cfg.Device.VerificationURI,
+		TTL:             cfg.Device.TTL,
+		Interval:        cfg.Device.Interval,
+	}, oauth.ProviderConfig{
+		Issuer:     cfg.OIDC.Issuer,
+		SigningKey: signingKey,
+	}, oauth.RegistrationConfig{
+		InitialAccessTokens: cfg.ClientRegistration.InitialAccessTokens,
+	}, cfg.TokenTTL)
+
+	schema, err := newAuthzSchema(cfg.Authz)
+	if err != nil {
+		return nil, err
+	}
+	authzService := authz.New(log, schema, storage)
+
+	grpcApp := grpcapp.New(log, authService, federationService, oauthService, authzService, authService, issuer, cfg.GRPC.Port, opts...)
+	httpApp := httpapp.New(log, oauthService, guard, proxies, cfg.HTTP.Port, cfg.HTTP.Timeout)
 	return &App{
 		GRPCSrv: grpcApp,
+		HTTPSrv: httpApp,
 		Storage: storage,
 	}, nil
 }
+
+// newChallengeIssuer создает выдавальщик челленджей. Если секрет не задан то генерируем случайный,
+// но тогда при нескольких репликах челленджи между ними работать не будут
+func newChallengeIssuer(log *slog.Logger, cfg config.ChallengeConfig) (*pow.Issuer, error) {
+	secret := cfg.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+
+		log.Warn("challenge secret is not set, using random one")
+	}
+
+	return pow.NewIssuer(secret, cfg.Difficulty, cfg.TTL), nil
+}
+
+// newSigningKey читает ключ для подписи ID токенов. Если файл не задан то генерируем ключ,
+// как и с секретом челленджа это годится только для одной реплики
+func newSigningKey(log *slog.Logger, cfg config.OIDCConfig) (*rsa.PrivateKey, error) {
+	if cfg.SigningKeyFile == "" {
+		log.Warn("oidc signing key is not set, using random one")
+
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(cfg.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read oidc signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("oidc signing key: no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse oidc signing key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("oidc signing key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func newFederationProviders(cfg config.FederationConfig) map[string]federation.Provider {
+	providers := make(map[string]federation.Provider, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		providers[p.Name] = oidc.NewClient(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, &http.Client{Timeout: 10 * time.Second})
+	}
+	return providers
+}
+
+// newAuthzSchema собирает схему отношений из конфига и сразу проверяет ее
+func newAuthzSchema(cfg config.AuthzConfig) (authz.Schema, error) {
+	schema := authz.Schema{Namespaces: make(map[string]authz.Namespace, len(cfg.Namespaces))}
+	for _, n := range cfg.Namespaces {
+		ns := authz.Namespace{AppID: n.AppID, Relations: make(map[string]authz.Relation, len(n.Relations))}
+		for _, r := range n.Relations {
+			rel := authz.Relation{ComputedUsersets: r.Computed}
+			for _, ttu := range r.TupleToUserset {
+				rel.TupleToUsersets = append(rel.TupleToUsersets, authz.TupleToUserset{
+					Tupleset: ttu.Tupleset,
+					Relation: ttu.Relation,
+				})
+			}
+			ns.Relations[r.Name] = rel
+		}
+		schema.Namespaces[n.Name] = ns
+	}
+
+	if err := schema.Validate(); err != nil {
+		return authz.Schema{}, err
+	}
+
+	return schema, nil
+}
+
+// newDirectories раскладывает каталоги LDAP по приложениям которые через них входят
+func newDirectories(cfg config.LDAPConfig) (map[int]auth.Directory, error) {
+	directories := make(map[int]auth.Directory)
+	for _, d := range cfg.Directories {
+		// По имени каталога пользователи привязаны к аккаунтам, без него привязки разных каталогов смешаются
+		if d.Name == "" {
+			return nil, fmt.Errorf("ldap directory %s: name is required", d.URL)
+		}
+		dir := ldapauth.New(ldapauth.Config{
+			Name:           d.Name,
+			URL:            d.URL,
+			StartTLS:       d.StartTLS,
+			BindDN:         d.BindDN,
+			BindPassword:   d.BindPassword,
+			BaseDN:         d.BaseDN,
+			UserFilter:     d.UserFilter,
+			EmailAttribute: d.EmailAttribute,
+			GroupAttribute: d.GroupAttribute,
+			GroupRoles:     d.GroupRoles,
+		})
+		for _, appID := range d.AppIDs {
+			directories[appID] = dir
+		}
+	}
+	return directories, nil
+}
+
+func newNotifier(log *slog.Logger, cfg config.NotifierConfig) auth.Notifier {
+	switch cfg.Type {
+	case "smtp":
+		return smtpnotifier.New(smtpnotifier.Config{
+			Host:      cfg.SMTP.Host,
+			Port:      cfg.SMTP.Port,
+			Username:  cfg.SMTP.Username,
+			Password:  cfg.SMTP.Password,
+			From:      cfg.SMTP.From,
+			LockURL:   cfg.LockURL,
+			InviteURL: cfg.InviteURL,
+		})
+	default:
+		return lognotifier.New(log, cfg.LockURL, cfg.InviteURL)
+	}
+}
@@ -1,11 +1,17 @@
 package grpcapp
 
 import (
-	authgrpc "STTAuth/internal/grpc/auth"
 	"fmt"
 	"log/slog"
 	"net"
 
+	admingrpc "github.com/skinkvi/STTAuth/internal/grpc/admin"
+	authgrpc "github.com/skinkvi/STTAuth/internal/grpc/auth"
+	authzgrpc "github.com/skinkvi/STTAuth/internal/grpc/authz"
+	challengegrpc "github.com/skinkvi/STTAuth/internal/grpc/challenge"
+	devicegrpc "github.com/skinkvi/STTAuth/internal/grpc/device"
+	federationgrpc "github.com/skinkvi/STTAuth/internal/grpc/federation"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
 	"google.golang.org/grpc"
 )
 
@@ -18,11 +24,22 @@ type App struct {
 func New(
 	log *slog.Logger,
 	authService authgrpc.Auth,
+	federationService federationgrpc.Federation,
+	deviceService devicegrpc.Device,
+	authzService authzgrpc.Authz,
+	adminService admingrpc.Admin,
+	issuer *pow.Issuer,
 	port int,
+	opts ...grpc.ServerOption,
 ) *App {
-	gRPCServer := grpc.NewServer()
+	gRPCServer := grpc.NewServer(opts...)
 
 	authgrpc.Register(gRPCServer, authService)
+	challengegrpc.Register(gRPCServer, issuer)
+	federationgrpc.Register(gRPCServer, federationService)
+	devicegrpc.Register(gRPCServer, deviceService)
+	authzgrpc.Register(gRPCServer, authzService, authService)
+	admingrpc.Register(gRPCServer, adminService, authService)
 
 	return &App{
 		log:        log,
@@ -0,0 +1,83 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	oauthhttp "github.com/skinkvi/STTAuth/internal/http/oauth"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
+)
+
+// App это HTTP сервер для браузерных протоколов (OAuth 2.0), gRPC для них не подходит
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(
+	log *slog.Logger,
+	oauthService oauthhttp.OAuth,
+	guard *pow.Guard,
+	proxies *clientinfo.Proxies,
+	port int,
+	timeout time.Duration,
+) *App {
+	mux := http.NewServeMux()
+
+	oauthhttp.Register(mux, oauthService, guard)
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           proxies.Middleware(mux),
+			ReadHeaderTimeout: timeout,
+			ReadTimeout:       timeout,
+			WriteTimeout:      timeout,
+		},
+		port: port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(slog.String("op", op), slog.Int("port", a.port))
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("http server is running", slog.String("addr", listener.Addr().String()))
+
+	if err := a.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop(ctx context.Context) {
+	const op = "httpapp.Stop"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("stopping http server", slog.Int("port", a.port))
+
+	// Как и GracefulStop у gRPC дожидается текущих запросов
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		log.Error("falied to stop http server", slog.String("err", err.Error()))
+	}
+}
@@ -15,8 +15,24 @@ type Config struct {
 			URL string `yaml:"url"`
 		} `yaml:"postgres"`
 	} `yaml:"storage"`
-	TokenTTL time.Duration `yaml:"token_ttl" env-required:"true"`
-	GRPC     GRPCConfig    `yaml:"grpc"`
+	TokenTTL   time.Duration    `yaml:"token_ttl" env-required:"true"`
+	GRPC       GRPCConfig       `yaml:"grpc"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Notifier   NotifierConfig   `yaml:"notifier"`
+	Register   RegisterConfig   `yaml:"register"`
+	Challenge  ChallengeConfig  `yaml:"challenge"`
+	Federation FederationConfig `yaml:"federation"`
+	LDAP       LDAPConfig       `yaml:"ldap"`
+	Device     DeviceConfig     `yaml:"device"`
+	OIDC       OIDCConfig       `yaml:"oidc"`
+	// ClientRegistration это динамическая регистрация OAuth клиентов
+	ClientRegistration ClientRegistrationConfig `yaml:"client_registration"`
+	Authz              AuthzConfig              `yaml:"authz"`
+	// SessionlessTokenCutoff это конец переезда на сессии: токены без sid выпущенные раньше еще
+	// принимаются, но не дольше чем на token_ttl после этого момента. Если не задано, не принимаются совсем
+	SessionlessTokenCutoff time.Time `yaml:"sessionless_token_cutoff"`
+
+	Proxy ProxyConfig `yaml:"proxy"`
 }
 
 type GRPCConfig struct {
@@ -24,6 +40,140 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+// ProxyConfig это reverse proxy перед сервисом. Заголовки прокси, адрес клиента из X-Forwarded-For
+// или X-Real-IP и страну по GeoIP в CountryHeader, принимаем только от адресов из TrustedCIDRs.
+// Пустой список значит что прокси нет
+type ProxyConfig struct {
+	TrustedCIDRs  []string `yaml:"trusted_cidrs"`
+	CountryHeader string   `yaml:"country_header" env-default:"X-Country-Code"`
+}
+
+// HTTPConfig это HTTP сервер для OAuth 2.0 эндпоинтов
+type HTTPConfig struct {
+	Port    int           `yaml:"port" env-default:"8080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+// RegisterConfig настройки регистрации. UniformResponse прячет от клиента занят email или нет
+type RegisterConfig struct {
+	UniformResponse bool `yaml:"uniform_response" env-default:"false"`
+}
+
+// ChallengeConfig настройки proof-of-work челленджа для Login, Register и формы входа /authorize. Secret должен быть
+// одинаковым на всех репликах, иначе челлендж выданный одной не пройдет проверку на другой
+type ChallengeConfig struct {
+	Secret           string        `yaml:"secret" env:"CHALLENGE_SECRET"`
+	Difficulty       int           `yaml:"difficulty" env-default:"20"`
+	TTL              time.Duration `yaml:"ttl" env-default:"5m"`
+	Window           time.Duration `yaml:"window" env-default:"15m"`
+	IPThreshold      int           `yaml:"ip_threshold" env-default:"30"`
+	AccountThreshold int           `yaml:"account_threshold" env-default:"10"`
+}
+
+// FederationConfig это список внешних OpenID Connect провайдеров через которых можно войти
+type FederationConfig struct {
+	Providers []FederationProvider `yaml:"providers"`
+}
+
+type FederationProvider struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// LDAPConfig это каталоги LDAP / Active Directory. Приложения из AppIDs проверяют пароль
+// в каталоге а не в нашей базе. Новые пользователи при первом входе заводятся у нас автоматически,
+// а существующие аккаунты с тем же email админ привязывает явно через LinkDirectoryAccount
+type LDAPConfig struct {
+	Directories []LDAPDirectory `yaml:"directories"`
+}
+
+type LDAPDirectory struct {
+	Name           string `yaml:"name"`
+	URL            string `yaml:"url"`
+	StartTLS       bool   `yaml:"start_tls"`
+	BindDN         string `yaml:"bind_dn"`
+	BindPassword   string `yaml:"bind_password"`
+	BaseDN         string `yaml:"base_dn"`
+	UserFilter     string `yaml:"user_filter"`
+	EmailAttribute string `yaml:"email_attribute"`
+	GroupAttribute string `yaml:"group_attribute"`
+	// GroupRoles сопоставляет DN группы с ролью приложения, глобальные роли каталог не выдает
+	GroupRoles map[string]string `yaml:"group_roles"`
+	AppIDs     []int             `yaml:"app_ids"`
+}
+
+// DeviceConfig настройки входа для устройств без браузера (RFC 8628). На VerificationURI
+// пользователь вводит код с экрана устройства
+type DeviceConfig struct {
+	VerificationURI string        `yaml:"verification_uri" env-default:"http://localhost:3000/device"`
+	TTL             time.Duration `yaml:"ttl" env-default:"10m"`
+	Interval        time.Duration `yaml:"interval" env-default:"5s"`
+}
+
+// OIDCConfig настройки нашего OpenID Connect провайдера. Issuer это внешний адрес HTTP сервера.
+// SigningKeyFile это RSA ключ в PEM, без него ключ генерируется на старте и ID токены
+// перестают проверяться после рестарта
+type OIDCConfig struct {
+	Issuer         string `yaml:"issuer" env-default:"http://localhost:8080"`
+	SigningKeyFile string `yaml:"signing_key_file" env:"OIDC_SIGNING_KEY_FILE"`
+}
+
+// ClientRegistrationConfig настройки динамической регистрации клиентов (RFC 7591). Регистрировать
+// приложения может только тот кому выдали один из InitialAccessTokens, пустой список выключает регистрацию
+type ClientRegistrationConfig struct {
+	InitialAccessTokens []string `yaml:"initial_access_tokens" env:"CLIENT_REGISTRATION_TOKENS" env-separator:","`
+}
+
+// AuthzConfig настройки проверки разрешений. DecisionTTL это сколько сервисы могут кешировать
+// ответ CheckPermission, после отзыва роли старый ответ может жить еще столько же.
+// Namespaces это схема отношений для авторизации на кортежах
+type AuthzConfig struct {
+	DecisionTTL time.Duration     `yaml:"decision_ttl" env-default:"30s"`
+	Namespaces  []NamespaceConfig `yaml:"namespaces"`
+}
+
+// NamespaceConfig это namespace схемы. AppID это приложение которому он принадлежит: только его
+// сервисные токены могут писать, удалять и читать эти кортежи, без AppID с ним работают только админы
+type NamespaceConfig struct {
+	Name      string           `yaml:"name"`
+	AppID     int              `yaml:"app_id"`
+	Relations []RelationConfig `yaml:"relations"`
+}
+
+// RelationConfig это отношение и правила по которым оно выводится из других.
+// Computed это отношения того же объекта, TupleToUserset берет отношение у связанного объекта
+type RelationConfig struct {
+	Name           string                 `yaml:"name"`
+	Computed       []string               `yaml:"computed"`
+	TupleToUserset []TupleToUsersetConfig `yaml:"tuple_to_userset"`
+}
+
+type TupleToUsersetConfig struct {
+	Tupleset string `yaml:"tupleset"`
+	Relation string `yaml:"relation"`
+}
+
+// NotifierConfig отвечает за то как мы уведомляем пользователей. Type: log или smtp.
+// InviteURL это страница где пользователь принимает приглашение в организацию
+type NotifierConfig struct {
+	Type      string     `yaml:"type" env-default:"log"`
+	LockURL   string     `yaml:"lock_url"`
+	InviteURL string     `yaml:"invite_url" env-default:"http://localhost:3000/orgs/accept"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from"`
+}
+
 // Написано Must помогу что есть такая не гласная договоренность что функция не будет возвращать ошибку если ошиька произошла
 func MustLoad() *Config {
 	path := fetchConfigPath()
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+)
+
+// redactedValue подставляется в логах вместо паролей и секретов
+const redactedValue = "[REDACTED]"
+
+// Типы без методов, через них копия конфига уходит в лог обычной структурой.
+// Если логировать сам Config, slog снова вызовет LogValue и уйдет в рекурсию
+type (
+	configLog             Config
+	smtpConfigLog         SMTPConfig
+	challengeConfigLog    ChallengeConfig
+	federationProviderLog FederationProvider
+	ldapDirectoryLog      LDAPDirectory
+	clientRegistrationLog ClientRegistrationConfig
+)
+
+// LogValue отдает конфиг для лога без паролей, секретов и токенов. Конфиг логируется целиком
+// на старте, поэтому все новые секретные поля надо закрывать здесь
+func (c *Config) LogValue() slog.Value {
+	cp := *c
+	cp.Storage.Postgres.URL = redactURL(c.Storage.Postgres.URL)
+	cp.Notifier.SMTP = c.Notifier.SMTP.redacted()
+	cp.Challenge = c.Challenge.redacted()
+	cp.ClientRegistration = c.ClientRegistration.redacted()
+
+	cp.Federation.Providers = make([]FederationProvider, 0, len(c.Federation.Providers))
+	for _, provider := range c.Federation.Providers {
+		cp.Federation.Providers = append(cp.Federation.Providers, provider.redacted())
+	}
+	cp.LDAP.Directories = make([]LDAPDirectory, 0, len(c.LDAP.Directories))
+	for _, dir := range c.LDAP.Directories {
+		cp.LDAP.Directories = append(cp.LDAP.Directories, dir.redacted())
+	}
+
+	return slog.AnyValue(configLog(cp))
+}
+
+func (c SMTPConfig) LogValue() slog.Value {
+	return slog.AnyValue(smtpConfigLog(c.redacted()))
+}
+
+func (c SMTPConfig) redacted() SMTPConfig {
+	c.Password = redact(c.Password)
+	return c
+}
+
+func (c ChallengeConfig) LogValue() slog.Value {
+	return slog.AnyValue(challengeConfigLog(c.redacted()))
+}
+
+func (c ChallengeConfig) redacted() ChallengeConfig {
+	c.Secret = redact(c.Secret)
+	return c
+}
+
+func (p FederationProvider) LogValue() slog.Value {
+	return slog.AnyValue(federationProviderLog(p.redacted()))
+}
+
+func (p FederationProvider) redacted() FederationProvider {
+	p.ClientSecret = redact(p.ClientSecret)
+	return p
+}
+
+func (d LDAPDirectory) LogValue() slog.Value {
+	return slog.AnyValue(ldapDirectoryLog(d.redacted()))
+}
+
+func (d LDAPDirectory) redacted() LDAPDirectory {
+	d.BindPassword = redact(d.BindPassword)
+	return d
+}
+
+func (c ClientRegistrationConfig) LogValue() slog.Value {
+	return slog.AnyValue(clientRegistrationLog(c.redacted()))
+}
+
+func (c ClientRegistrationConfig) redacted() ClientRegistrationConfig {
+	tokens := slices.Clone(c.InitialAccessTokens)
+	for i := range tokens {
+		tokens[i] = redact(tokens[i])
+	}
+	c.InitialAccessTokens = tokens
+	return c
+}
+
+// redact оставляет пустое значение пустым, так по логу видно что секрет не задан
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// redactURL прячет пароль в адресе базы. Строку в формате key=value разобрать нельзя, ее прячем целиком
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return redact(raw)
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigLogValue_HidesSecrets(t *testing.T) {
+	cfg := &Config{Env: "prod"}
+	cfg.Storage.Postgres.URL = "postgres://sso:db-password@db:5432/STTDB"
+	cfg.Notifier.SMTP = SMTPConfig{Host: "smtp.example.com", Password: "smtp-password"}
+	cfg.Challenge.Secret = "challenge-secret"
+	cfg.Federation.Providers = []FederationProvider{{Name: "google", ClientID: "client", ClientSecret: "federation-secret"}}
+	cfg.LDAP.Directories = []LDAPDirectory{{Name: "school", BindPassword: "bind-password"}}
+	cfg.ClientRegistration.InitialAccessTokens = []string{"initial-token"}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("starting application", slog.Any("cfg", cfg))
+	out := buf.String()
+
+	for _, secret := range []string{"db-password", "smtp-password", "challenge-secret", "federation-secret", "bind-password", "initial-token"} {
+		assert.NotContains(t, out, secret)
+	}
+	assert.Contains(t, out, "smtp.example.com")
+	assert.Contains(t, out, "google")
+	assert.Contains(t, out, redactedValue)
+
+	// LogValue не должен менять сам конфиг
+	assert.Equal(t, "bind-password", cfg.LDAP.Directories[0].BindPassword)
+	assert.Equal(t, "initial-token", cfg.ClientRegistration.InitialAccessTokens[0])
+
+	buf.Reset()
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("smtp", slog.Any("smtp", cfg.Notifier.SMTP))
+	assert.NotContains(t, buf.String(), "smtp-password")
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AdminScope дает API ключу права админа в самом STTAuth. Без него ключ админа работает
+// как ключ обычного пользователя. Выпустить ключ с этим scope может только админ
+const AdminScope = "sso:admin"
+
+// APIKey это личный ключ пользователя для скриптов, вместо пароля. Сам ключ показывается
+// один раз при создании, в базе лежит его хеш. Prefix это открытое начало ключа, по нему
+// пользователь узнает ключ в списке
+type APIKey struct {
+	ID         int64
+	UserID     int64
+	AppID      int
+	Name       string
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+}
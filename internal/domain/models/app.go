@@ -1,7 +1,64 @@
 package models
 
+import (
+	"slices"
+	"time"
+)
+
+// Режимы регистрации в приложении
+const (
+	RegisterModeOpen     = "open"
+	RegisterModeInvite   = "invite"
+	RegisterModeDomain   = "domain"
+	RegisterModeApproval = "approval"
+)
+
 type App struct {
 	ID     int
 	Name   string
 	Secret string
+	// RegisterMode определяет кто может зарегистрироваться через это приложение
+	RegisterMode string
+	// AllowedDomains используется только в режиме RegisterModeDomain
+	AllowedDomains []string
+	// RedirectURIs это адреса на которые можно вернуть пользователя после OAuth авторизации.
+	// Сравниваются целиком, без шаблонов
+	RedirectURIs []string
+	// ClientSecretHash это bcrypt хеш секрета для client credentials. Secret выше это ключ подписи
+	// токенов, его клиенту отдавать нельзя, поэтому секреты разные
+	ClientSecretHash []byte
+	// Scopes это scope которые приложение может запросить
+	Scopes []string
+	// GrantTypes и TokenEndpointAuthMethod это метаданные из динамической регистрации (RFC 7591).
+	// У приложений заведенных руками они пустые
+	GrantTypes              []string
+	TokenEndpointAuthMethod string
+	// RegistrationTokenHash это sha256 от registration access token, им клиент управляет своей регистрацией
+	RegistrationTokenHash string
+	// PreviousSecret это ключ подписи до последней ротации. До PreviousSecretExpiresAt токены
+	// подписанные им еще принимаются, что бы ротация не разлогинила всех разом
+	PreviousSecret          string
+	PreviousSecretExpiresAt *time.Time
+	// DisabledAt не пустой у выключенного приложения: в него нельзя войти и его токены не принимаются
+	DisabledAt *time.Time
+	CreatedAt  time.Time
+}
+
+// VerificationSecrets это ключи которыми можно проверить подпись токена приложения: текущий
+// и предыдущий пока не закончилось окно ротации
+func (a App) VerificationSecrets(now time.Time) []string {
+	secrets := []string{a.Secret}
+	if a.PreviousSecret != "" && a.PreviousSecretExpiresAt != nil && now.Before(*a.PreviousSecretExpiresAt) {
+		secrets = append(secrets, a.PreviousSecret)
+	}
+	return secrets
+}
+
+// IdentityScopes это стандартные scope OpenID Connect. Их может запросить любое приложение,
+// объявлять их в Scopes не нужно
+var IdentityScopes = []string{"openid", "email", "profile"}
+
+// AllowsUserScope говорит может ли приложение запросить этот scope у пользователя
+func (a App) AllowsUserScope(scope string) bool {
+	return slices.Contains(IdentityScopes, scope) || slices.Contains(a.Scopes, scope)
 }
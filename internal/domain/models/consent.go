@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Consent это согласие пользователя отдать приложению доступ к scope. На пару пользователь
+// и приложение одна запись, новые scope дописываются в нее
+type Consent struct {
+	UserID    int64
+	AppID     int
+	AppName   string
+	Scopes    []string
+	GrantedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LoginAlert это уведомление о входе с нового устройства или из новой сети.
+// LockToken нужен для ссылки "это был не я", по ней аккаунт блокируется
+type LoginAlert struct {
+	UserID    int64
+	Email     string
+	AppID     int
+	AppName   string
+	IP        string
+	UserAgent string
+	At        time.Time
+	LockToken string
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Статусы кода из device authorization grant
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode это запрос устройства без браузера на вход (RFC 8628). device_code хранится хешем,
+// user_code пользователь вводит руками поэтому он короткий и хранится как есть
+type DeviceCode struct {
+	UserCode  string
+	AppID     int
+	Scope     string
+	Status    string
+	UserID    int64
+	Interval  time.Duration
+	ExpiresAt time.Time
+}
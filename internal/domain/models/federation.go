@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// FederationState это то что мы запоминаем между редиректом к внешнему провайдеру и возвратом от него
+type FederationState struct {
+	Provider     string
+	AppID        int
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// Identity связывает аккаунт у внешнего провайдера с нашим пользователем
+type Identity struct {
+	Provider string
+	Subject  string
+	UserID   int64
+	Email    string
+}
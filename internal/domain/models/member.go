@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Статусы участника приложения
+const (
+	MemberActive  = "active"
+	MemberPending = "pending"
+)
+
+// Member это пользователь зарегистрированный через конкретное приложение
+type Member struct {
+	AppID     int
+	UserID    int64
+	Email     string
+	Status    string
+	CreatedAt time.Time
+}
+
+type Invite struct {
+	Code      string
+	AppID     int
+	CreatedBy int64
+	MaxUses   int
+	ExpiresAt time.Time
+}
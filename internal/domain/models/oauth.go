@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// AuthCode это одноразовый код из OAuth authorization code flow. Сам код хранится только хешем
+type AuthCode struct {
+	AppID         int
+	UserID        int64
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	// Nonce и AuthTime нужны для ID токена если клиент запросил scope openid
+	Nonce     string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
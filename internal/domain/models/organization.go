@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Роли внутри организации. Владелец может все, админ приглашает и удаляет участников
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization это школа или компания которая покупает доступ для группы людей
+type Organization struct {
+	ID        int64
+	Name      string
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+// OrgMember это участник организации. OrgName заполняется когда список берется по пользователю
+type OrgMember struct {
+	OrgID    int64
+	OrgName  string
+	UserID   int64
+	Email    string
+	Role     string
+	JoinedAt time.Time
+}
+
+// OrgInvite это приглашение в организацию на email. Token есть только в момент создания,
+// в базе лежит его хеш
+type OrgInvite struct {
+	Token     string
+	OrgID     int64
+	OrgName   string
+	Email     string
+	Role      string
+	InvitedBy int64
+	ExpiresAt time.Time
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"path"
+	"strings"
+)
+
+// PermissionCheck это вопрос "может ли пользователь сделать Action над Resource в приложении".
+// Resource иерархический через "/", например matches или matches/42
+type PermissionCheck struct {
+	UserID   int64
+	AppID    int
+	Action   string
+	Resource string
+}
+
+// Decision это ответ на PermissionCheck. Reason объясняет почему, его удобно писать в аудит
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// PermissionGrants проверяет покрывает ли разрешение вида "resource:action" действие над ресурсом.
+// В обеих частях можно писать "*", а разрешение на ресурс действует и на все что под ним:
+// matches:read дает читать и matches/42
+func PermissionGrants(permission string, resource string, action string) bool {
+	if permission == PermissionAll {
+		return true
+	}
+
+	i := strings.LastIndex(permission, ":")
+	if i < 0 {
+		return false
+	}
+	pResource, pAction := permission[:i], permission[i+1:]
+
+	if pAction != "*" && pAction != action {
+		return false
+	}
+
+	if pResource == "*" || pResource == resource || strings.HasPrefix(resource, pResource+"/") {
+		return true
+	}
+	matched, err := path.Match(pResource, resource)
+	return err == nil && matched
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Где применяется политика: при входе в приложение или при проверке разрешений
+const (
+	PolicyTargetLogin = "login"
+	PolicyTargetCheck = "check"
+)
+
+// Policy это правило приложения на CEL. Доступ есть только если все включенные политики
+// приложения для Target вернули true, например:
+// user.email.endsWith("@club.ru") && now.getHours("Europe/Moscow") < 22
+type Policy struct {
+	ID         int64
+	AppID      int
+	Name       string
+	Target     string
+	Expression string
+	Enabled    bool
+	CreatedAt  time.Time
+}
+
+// PolicyDryRun это проверка политик без последствий. Если Expression пустой то проверяются
+// все политики приложения для Target, включая выключенные, иначе только это выражение
+type PolicyDryRun struct {
+	Expression string
+	UserID     int64
+	AppID      int
+	Target     string
+	Action     string
+	Resource   string
+	Client     ClientInfo
+	At         time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// RoleAdmin это встроенная глобальная роль. IsAdmin это проверка что у пользователя есть именно она
+const RoleAdmin = "admin"
+
+// PermissionAll это разрешение на все, его получает роль admin
+const PermissionAll = "*"
+
+// Role это набор разрешений. Роль с AppID действует только в этом приложении, без него во всех.
+// Inherits это id роли чьи разрешения эта роль получает в придачу к своим
+type Role struct {
+	ID          int64
+	Name        string
+	AppID       int
+	Inherits    int64
+	Permissions []string
+	CreatedAt   time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         string
+	UserID     int64
+	AppID      int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	RevokedAt  *time.Time
+}
+
+// ClientInfo это то что мы знаем о клиенте который к нам пришел (берется из метаданных gRPC)
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+	// Country это код страны ISO 3166-1 alpha-2 по GeoIP. Его проставляет доверенный прокси,
+	// без прокси страна пустая
+	Country string
+}
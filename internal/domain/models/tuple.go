@@ -0,0 +1,32 @@
+package models
+
+// NamespaceUser это namespace пользователей, субъект user:7 это пользователь с id 7
+const NamespaceUser = "user"
+
+// Subject это тот у кого есть отношение. Без Relation это конкретный объект (обычно user:7),
+// с Relation это множество, например club:1#member это все участники клуба 1
+type Subject struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Namespace + ":" + s.ObjectID
+	}
+	return s.Namespace + ":" + s.ObjectID + "#" + s.Relation
+}
+
+// RelationTuple это запись "у Subject есть Relation к объекту Namespace:ObjectID", например
+// club:1#moderator@user:7
+type RelationTuple struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+	Subject   Subject
+}
+
+func (t RelationTuple) String() string {
+	return t.Namespace + ":" + t.ObjectID + "#" + t.Relation + "@" + t.Subject.String()
+}
@@ -1,7 +1,37 @@
 package models
 
+import "time"
+
 type User struct {
 	ID       int64
 	Email    string
 	PassHash []byte
+	LockedAt *time.Time
+	// EmailVerifiedAt пустой пока email никто не подтвердил, сейчас его подтверждает только
+	// внешний провайдер при входе через федерацию
+	EmailVerifiedAt *time.Time
+}
+
+// UserInfo это пользователь как его видит админка, без хеша пароля
+type UserInfo struct {
+	ID       int64
+	Email    string
+	IsAdmin  bool
+	LockedAt *time.Time
+}
+
+// UserFilter это условия списка пользователей в админке. Пустые поля не фильтруют.
+// AfterID это курсор: отдаются пользователи с id больше него
+type UserFilter struct {
+	EmailPrefix string
+	Locked      *bool
+	AdminsOnly  bool
+	AfterID     int64
+	Limit       int
+}
+
+// UserUpdate это то что админ может поменять у пользователя, nil значит не менять
+type UserUpdate struct {
+	Email  *string
+	Locked *bool
 }
@@ -0,0 +1,170 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Apps это управление приложениями. Раньше их заводили миграцией, теперь это делается из админки
+type Apps interface {
+	CreateApp(ctx context.Context, app models.App) (models.App, error)
+	ListApps(ctx context.Context) ([]models.App, error)
+	RotateAppSecret(ctx context.Context, appID int, overlap time.Duration) (string, time.Time, error)
+	SetAppDisabled(ctx context.Context, appID int, disabled bool) error
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+// CreateApp возвращает ключ подписи один раз, потом его можно только сменить ротацией
+func (s *serverAPI) CreateApp(
+	ctx context.Context,
+	req *ssov1.CreateAppRequest,
+) (*ssov1.CreateAppResponce, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	app, err := s.admin.CreateApp(ctx, models.App{
+		Name:           req.GetName(),
+		RegisterMode:   req.GetRegisterMode(),
+		AllowedDomains: req.GetAllowedDomains(),
+		RedirectURIs:   req.GetRedirectUris(),
+		Scopes:         req.GetScopes(),
+	})
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.CreateAppResponce{
+		App:    toProtoApp(app),
+		Secret: app.Secret,
+	}, nil
+}
+
+func (s *serverAPI) ListApps(
+	ctx context.Context,
+	req *ssov1.ListAppsRequest,
+) (*ssov1.ListAppsResponce, error) {
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	apps, err := s.admin.ListApps(ctx)
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	resp := make([]*ssov1.App, 0, len(apps))
+	for _, app := range apps {
+		resp = append(resp, toProtoApp(app))
+	}
+
+	return &ssov1.ListAppsResponce{
+		Apps: resp,
+	}, nil
+}
+
+// RotateAppSecret без overlap_seconds оставляет старый ключ рабочим на время жизни токена
+func (s *serverAPI) RotateAppSecret(
+	ctx context.Context,
+	req *ssov1.RotateAppSecretRequest,
+) (*ssov1.RotateAppSecretResponce, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetOverlapSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "overlap_seconds must not be negative")
+	}
+
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	overlap := time.Duration(req.GetOverlapSeconds()) * time.Second
+	secret, previousExpiresAt, err := s.admin.RotateAppSecret(ctx, int(req.GetAppId()), overlap)
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.RotateAppSecretResponce{
+		Secret:            secret,
+		PreviousExpiresAt: previousExpiresAt.Unix(),
+	}, nil
+}
+
+func (s *serverAPI) SetAppDisabled(
+	ctx context.Context,
+	req *ssov1.SetAppDisabledRequest,
+) (*ssov1.SetAppDisabledResponce, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.SetAppDisabled(ctx, int(req.GetAppId()), req.GetDisabled()); err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.SetAppDisabledResponce{}, nil
+}
+
+func (s *serverAPI) DeleteApp(
+	ctx context.Context,
+	req *ssov1.DeleteAppRequest,
+) (*ssov1.DeleteAppResponce, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.DeleteApp(ctx, int(req.GetAppId())); err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.DeleteAppResponce{}, nil
+}
+
+func toProtoApp(app models.App) *ssov1.App {
+	resp := &ssov1.App{
+		Id:             int32(app.ID),
+		Name:           app.Name,
+		RegisterMode:   app.RegisterMode,
+		AllowedDomains: app.AllowedDomains,
+		RedirectUris:   app.RedirectURIs,
+		Scopes:         app.Scopes,
+		CreatedAt:      app.CreatedAt.Unix(),
+	}
+	if app.DisabledAt != nil {
+		resp.DisabledAt = app.DisabledAt.Unix()
+	}
+	return resp
+}
+
+func appError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidApp):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, auth.ErrAppExists):
+		return status.Error(codes.AlreadyExists, "app already exists")
+	case errors.Is(err, auth.ErrInvalidAppID):
+		return status.Error(codes.NotFound, "app not found")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
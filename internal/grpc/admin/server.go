@@ -0,0 +1,258 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Admin это управление пользователями и приложениями из админки вместо ручного SQL
+type Admin interface {
+	Apps
+	ListUsers(ctx context.Context, filter models.UserFilter, cursor string) ([]models.UserInfo, string, error)
+	GetUser(ctx context.Context, userID int64) (models.UserInfo, error)
+	UpdateUser(ctx context.Context, actorID int64, userID int64, update models.UserUpdate) (models.UserInfo, error)
+	SetAdmin(ctx context.Context, actorID int64, userID int64, isAdmin bool) error
+	DeleteUser(ctx context.Context, actorID int64, userID int64) error
+	LinkDirectoryAccount(ctx context.Context, actorID int64, userID int64, appID int, dn string) error
+}
+
+// Authenticator говорит кто из пользователей админ. Токен вызывающего проверяет интерцептор authn
+type Authenticator interface {
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAdminServer
+	admin Admin
+	auth  Authenticator
+}
+
+func Register(gRPC *grpc.Server, admin Admin, auth Authenticator) {
+	ssov1.RegisterAdminServer(gRPC, &serverAPI{admin: admin, auth: auth})
+}
+
+func (s *serverAPI) ListUsers(
+	ctx context.Context,
+	req *ssov1.ListUsersRequest,
+) (*ssov1.ListUsersResponce, error) {
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := models.UserFilter{
+		EmailPrefix: req.GetEmailPrefix(),
+		AdminsOnly:  req.GetAdminsOnly(),
+		Limit:       int(req.GetPageSize()),
+	}
+	if req.Locked != nil {
+		locked := req.GetLocked()
+		filter.Locked = &locked
+	}
+
+	users, next, err := s.admin.ListUsers(ctx, filter, req.GetCursor())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	resp := make([]*ssov1.User, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, toProtoUser(user))
+	}
+
+	return &ssov1.ListUsersResponce{
+		Users:      resp,
+		NextCursor: next,
+	}, nil
+}
+
+func (s *serverAPI) GetUser(
+	ctx context.Context,
+	req *ssov1.GetUserRequest,
+) (*ssov1.GetUserResponce, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	user, err := s.admin.GetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.GetUserResponce{
+		User: toProtoUser(user),
+	}, nil
+}
+
+// UpdateUser меняет только переданные поля
+func (s *serverAPI) UpdateUser(
+	ctx context.Context,
+	req *ssov1.UpdateUserRequest,
+) (*ssov1.UpdateUserResponce, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	claims, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var update models.UserUpdate
+	if req.Email != nil {
+		email := req.GetEmail()
+		update.Email = &email
+	}
+	if req.Locked != nil {
+		locked := req.GetLocked()
+		update.Locked = &locked
+	}
+
+	user, err := s.admin.UpdateUser(ctx, claims.UID, req.GetUserId(), update)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.UpdateUserResponce{
+		User: toProtoUser(user),
+	}, nil
+}
+
+func (s *serverAPI) SetAdmin(
+	ctx context.Context,
+	req *ssov1.SetAdminRequest,
+) (*ssov1.SetAdminResponce, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	claims, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.SetAdmin(ctx, claims.UID, req.GetUserId(), req.GetIsAdmin()); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.SetAdminResponce{}, nil
+}
+
+func (s *serverAPI) DeleteUser(
+	ctx context.Context,
+	req *ssov1.DeleteUserRequest,
+) (*ssov1.DeleteUserResponce, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	claims, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.DeleteUser(ctx, claims.UID, req.GetUserId()); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.DeleteUserResponce{}, nil
+}
+
+// LinkDirectoryAccount привязывает существующий аккаунт к записи LDAP каталога приложения.
+// Сам при входе через каталог сервис локальные аккаунты не привязывает
+func (s *serverAPI) LinkDirectoryAccount(
+	ctx context.Context,
+	req *ssov1.LinkDirectoryAccountRequest,
+) (*ssov1.LinkDirectoryAccountResponce, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetDn() == "" {
+		return nil, status.Error(codes.InvalidArgument, "dn is required")
+	}
+
+	claims, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.LinkDirectoryAccount(ctx, claims.UID, req.GetUserId(), int(req.GetAppId()), req.GetDn()); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.LinkDirectoryAccountResponce{}, nil
+}
+
+// authorize пускает только пользователей с глобальной ролью admin. Сервисным токенам
+// тут делать нечего, у них нет пользователя от имени которого пишется аудит. Вызывающего
+// берем из контекста, интерцептор уже проверил его токен и RequireAdmin, здесь это страховка
+func (s *serverAPI) authorize(ctx context.Context) (*jwtT.Claims, error) {
+	claims, err := authn.Principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsService() {
+		return nil, status.Error(codes.PermissionDenied, "user token required")
+	}
+
+	isAdmin, err := authn.IsAdmin(ctx, s.auth, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return claims, nil
+}
+
+func toProtoUser(user models.UserInfo) *ssov1.User {
+	resp := &ssov1.User{
+		Id:      user.ID,
+		Email:   user.Email,
+		IsAdmin: user.IsAdmin,
+	}
+	if user.LockedAt != nil {
+		resp.LockedAt = user.LockedAt.Unix()
+	}
+	return resp
+}
+
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, auth.ErrUserExists):
+		return status.Error(codes.AlreadyExists, "email is already taken")
+	case errors.Is(err, auth.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, "invalid cursor")
+	case errors.Is(err, auth.ErrInvalidEmail):
+		return status.Error(codes.InvalidArgument, "invalid email")
+	case errors.Is(err, auth.ErrSelfModification):
+		return status.Error(codes.FailedPrecondition, "admin can not do this with own account")
+	case errors.Is(err, auth.ErrLastOrgOwner):
+		return status.Error(codes.FailedPrecondition, "user is the last owner of an organization")
+	case errors.Is(err, auth.ErrNoDirectory):
+		return status.Error(codes.FailedPrecondition, "app does not use a directory")
+	case errors.Is(err, auth.ErrAlreadyLinked):
+		return status.Error(codes.AlreadyExists, "directory account is already linked")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
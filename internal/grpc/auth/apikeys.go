@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ключами пользователь управляет сам. Создать новый ключ можно только обычным токеном,
+// иначе утекший ключ мог бы плодить себе замену
+
+func (s *serverAPI) CreateAPIKey(
+	ctx context.Context,
+	req *ssov1.CreateAPIKeyRequest,
+) (*ssov1.CreateAPIKeyResponce, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+	if claims.APIKeyID != 0 {
+		return nil, status.Error(codes.PermissionDenied, "api key can not create api keys")
+	}
+
+	// Без app_id ключ выдается для того приложения в которое пользователь вошел
+	appID := int(req.GetAppId())
+	if appID == emptyValue {
+		appID = claims.AppID
+	}
+
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	token, key, err := s.auth.CreateAPIKey(ctx, claims.UID, appID, req.GetName(), req.GetScopes(), ttl)
+	if err != nil {
+		return nil, apiKeyError(err)
+	}
+
+	return &ssov1.CreateAPIKeyResponce{
+		ApiKey: token,
+		Key:    toProtoAPIKey(key),
+	}, nil
+}
+
+func (s *serverAPI) ListAPIKeys(
+	ctx context.Context,
+	req *ssov1.ListAPIKeysRequest,
+) (*ssov1.ListAPIKeysResponce, error) {
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := s.auth.ListAPIKeys(ctx, claims.UID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := make([]*ssov1.APIKey, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, toProtoAPIKey(key))
+	}
+
+	return &ssov1.ListAPIKeysResponce{
+		Keys: resp,
+	}, nil
+}
+
+func (s *serverAPI) RevokeAPIKey(
+	ctx context.Context,
+	req *ssov1.RevokeAPIKeyRequest,
+) (*ssov1.RevokeAPIKeyResponce, error) {
+	if req.GetKeyId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "key_id is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeAPIKey(ctx, claims.UID, req.GetKeyId()); err != nil {
+		return nil, apiKeyError(err)
+	}
+
+	return &ssov1.RevokeAPIKeyResponce{}, nil
+}
+
+func toProtoAPIKey(key models.APIKey) *ssov1.APIKey {
+	resp := &ssov1.APIKey{
+		Id:        key.ID,
+		AppId:     int32(key.AppID),
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt.Unix(),
+		CreatedAt: key.CreatedAt.Unix(),
+	}
+	if key.LastUsedAt != nil {
+		resp.LastUsedAt = key.LastUsedAt.Unix()
+	}
+	return resp
+}
+
+func apiKeyError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrAPIKeyNotFound):
+		return status.Error(codes.NotFound, "api key not found")
+	case errors.Is(err, auth.ErrTooManyAPIKeys):
+		return status.Error(codes.ResourceExhausted, "too many api keys")
+	case errors.Is(err, auth.ErrInvalidAppID):
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	case errors.Is(err, auth.ErrInvalidAPIKey), errors.Is(err, auth.ErrInvalidScope):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, auth.ErrNotMember), errors.Is(err, auth.ErrApprovalPending):
+		return status.Error(codes.PermissionDenied, "user is not registered in this app")
+	case errors.Is(err, auth.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// authorizeUser берет вызывающего из контекста, токен уже проверил интерцептор authn, и решает
+// над чьими данными он работает. Если user_id не передан или совпадает с владельцем токена
+// то это сам пользователь, иначе к чужим данным доступ есть только у админа
+func (s *serverAPI) authorizeUser(ctx context.Context, userID int64) (*jwtT.Claims, int64, error) {
+	claims, err := authn.Principal(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Сервисный токен принадлежит приложению, пользовательских данных за ним нет
+	if claims.IsService() {
+		return nil, 0, status.Error(codes.PermissionDenied, "user token required")
+	}
+
+	if userID == emptyValue || userID == claims.UID {
+		return claims, claims.UID, nil
+	}
+
+	isAdmin, err := authn.IsAdmin(ctx, s.auth, claims)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isAdmin {
+		return nil, 0, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return claims, userID, nil
+}
+
+// authorizeAdmin пропускает дальше только админов. Интерцептор это уже проверил по Requirements,
+// повторная проверка страхует от метода который забыли туда добавить
+func (s *serverAPI) authorizeAdmin(ctx context.Context) (*jwtT.Claims, error) {
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin, err := authn.IsAdmin(ctx, s.auth, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return claims, nil
+}
+
+// authorizeCheck решает кто может спрашивать о разрешениях. Сервисный токен приложения
+// спрашивает только про свое приложение, пользователь только про себя, админ про кого угодно
+func (s *serverAPI) authorizeCheck(ctx context.Context, checks []models.PermissionCheck) error {
+	claims, err := authn.Principal(ctx)
+	if err != nil {
+		return err
+	}
+
+	if claims.IsService() {
+		for _, check := range checks {
+			if check.AppID != claims.AppID {
+				return status.Error(codes.PermissionDenied, "service token is limited to its app")
+			}
+		}
+		return nil
+	}
+
+	for _, check := range checks {
+		if check.UserID != claims.UID {
+			_, err := s.authorizeAdmin(ctx)
+			return err
+		}
+	}
+
+	return nil
+}
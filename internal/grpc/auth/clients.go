@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) ClientCredentials(
+	ctx context.Context,
+	req *ssov1.ClientCredentialsRequest,
+) (*ssov1.ClientCredentialsResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetClientSecret() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_secret is required")
+	}
+
+	token, scopes, err := s.auth.ClientToken(ctx, int(req.GetAppId()), req.GetClientSecret(), req.GetScopes())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClient) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return nil, status.Error(codes.PermissionDenied, "scope is not allowed for app")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ClientCredentialsResponce{
+		Token:  token,
+		Scopes: scopes,
+	}, nil
+}
+
+func (s *serverAPI) RotateClientSecret(
+	ctx context.Context,
+	req *ssov1.RotateClientSecretRequest,
+) (*ssov1.RotateClientSecretResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.auth.RotateClientSecret(ctx, int(req.GetAppId()))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RotateClientSecretResponce{
+		ClientSecret: secret,
+	}, nil
+}
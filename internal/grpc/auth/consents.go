@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) ListConsents(
+	ctx context.Context,
+	req *ssov1.ListConsentsRequest,
+) (*ssov1.ListConsentsResponce, error) {
+	_, userID, err := s.authorizeUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	consents, err := s.auth.ListConsents(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &ssov1.ListConsentsResponce{
+		Consents: make([]*ssov1.Consent, 0, len(consents)),
+	}
+	for _, consent := range consents {
+		resp.Consents = append(resp.Consents, &ssov1.Consent{
+			AppId:     int32(consent.AppID),
+			AppName:   consent.AppName,
+			Scopes:    consent.Scopes,
+			GrantedAt: consent.GrantedAt.Unix(),
+			UpdatedAt: consent.UpdatedAt.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeConsent(
+	ctx context.Context,
+	req *ssov1.RevokeConsentRequest,
+) (*ssov1.RevokeConsentResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	_, userID, err := s.authorizeUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeConsent(ctx, userID, int(req.GetAppId())); err != nil {
+		if errors.Is(err, auth.ErrConsentNotFound) {
+			return nil, status.Error(codes.NotFound, "consent not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RevokeConsentResponce{}, nil
+}
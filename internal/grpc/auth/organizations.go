@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Организации работают от имени пользователя, права внутри организации проверяет сервис
+
+func (s *serverAPI) CreateOrganization(
+	ctx context.Context,
+	req *ssov1.CreateOrganizationRequest,
+) (*ssov1.CreateOrganizationResponce, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	orgID, err := s.auth.CreateOrganization(ctx, claims.UID, req.GetName())
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return &ssov1.CreateOrganizationResponce{
+		OrgId: orgID,
+	}, nil
+}
+
+func (s *serverAPI) ListOrganizations(
+	ctx context.Context,
+	req *ssov1.ListOrganizationsRequest,
+) (*ssov1.ListOrganizationsResponce, error) {
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs, err := s.auth.ListOrganizations(ctx, claims.UID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := make([]*ssov1.Organization, 0, len(orgs))
+	for _, org := range orgs {
+		resp = append(resp, &ssov1.Organization{
+			Id:       org.OrgID,
+			Name:     org.OrgName,
+			Role:     org.Role,
+			JoinedAt: org.JoinedAt.Unix(),
+		})
+	}
+
+	return &ssov1.ListOrganizationsResponce{
+		Organizations: resp,
+	}, nil
+}
+
+func (s *serverAPI) ListOrgMembers(
+	ctx context.Context,
+	req *ssov1.ListOrgMembersRequest,
+) (*ssov1.ListOrgMembersResponce, error) {
+	if req.GetOrgId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.auth.ListOrgMembers(ctx, req.GetOrgId(), claims.UID)
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return &ssov1.ListOrgMembersResponce{
+		Members: toProtoOrgMembers(members),
+	}, nil
+}
+
+func (s *serverAPI) InviteToOrganization(
+	ctx context.Context,
+	req *ssov1.InviteToOrganizationRequest,
+) (*ssov1.InviteToOrganizationResponce, error) {
+	if req.GetOrgId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	if err := s.auth.InviteToOrganization(ctx, req.GetOrgId(), claims.UID, req.GetEmail(), req.GetRole(), ttl); err != nil {
+		return nil, orgError(err)
+	}
+
+	return &ssov1.InviteToOrganizationResponce{}, nil
+}
+
+func (s *serverAPI) AcceptOrgInvite(
+	ctx context.Context,
+	req *ssov1.AcceptOrgInviteRequest,
+) (*ssov1.AcceptOrgInviteResponce, error) {
+	if req.GetInviteToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "invite_token is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	orgID, err := s.auth.AcceptOrgInvite(ctx, claims.UID, req.GetInviteToken())
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return &ssov1.AcceptOrgInviteResponce{
+		OrgId: orgID,
+	}, nil
+}
+
+func (s *serverAPI) RemoveOrgMember(
+	ctx context.Context,
+	req *ssov1.RemoveOrgMemberRequest,
+) (*ssov1.RemoveOrgMemberResponce, error) {
+	if req.GetOrgId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+
+	claims, _, err := s.authorizeUser(ctx, emptyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	// Без user_id пользователь выходит из организации сам
+	userID := req.GetUserId()
+	if userID == emptyValue {
+		userID = claims.UID
+	}
+
+	if err := s.auth.RemoveOrgMember(ctx, req.GetOrgId(), claims.UID, userID); err != nil {
+		return nil, orgError(err)
+	}
+
+	return &ssov1.RemoveOrgMemberResponce{}, nil
+}
+
+func (s *serverAPI) SwitchOrganization(
+	ctx context.Context,
+	req *ssov1.SwitchOrganizationRequest,
+) (*ssov1.SwitchOrganizationResponce, error) {
+	current := authn.TokenFromContext(ctx)
+	if current == "" {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+
+	token, err := s.auth.SwitchOrganization(ctx, current, req.GetOrgId(), clientinfo.FromContext(ctx))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "token expired or invalid")
+		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return nil, status.Error(codes.PermissionDenied, "account is locked")
+		}
+		if errors.Is(err, auth.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not registered in this app")
+		}
+		if errors.Is(err, auth.ErrApprovalPending) {
+			return nil, status.Error(codes.FailedPrecondition, "registration is pending approval")
+		}
+		if errors.Is(err, auth.ErrPolicyDenied) {
+			return nil, status.Error(codes.PermissionDenied, "access denied by app policy")
+		}
+		if errors.Is(err, auth.ErrAppDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		if errors.Is(err, auth.ErrAPIKeyForbidden) {
+			return nil, status.Error(codes.PermissionDenied, "api key can not switch organization")
+		}
+		return nil, orgError(err)
+	}
+
+	return &ssov1.SwitchOrganizationResponce{
+		Token: token,
+	}, nil
+}
+
+func toProtoOrgMembers(members []models.OrgMember) []*ssov1.OrgMember {
+	resp := make([]*ssov1.OrgMember, 0, len(members))
+	for _, member := range members {
+		resp = append(resp, &ssov1.OrgMember{
+			UserId:   member.UserID,
+			Email:    member.Email,
+			Role:     member.Role,
+			JoinedAt: member.JoinedAt.Unix(),
+		})
+	}
+	return resp
+}
+
+func orgError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrNotOrgMember):
+		return status.Error(codes.PermissionDenied, "not a member of organization")
+	case errors.Is(err, auth.ErrOrgAccessDenied):
+		return status.Error(codes.PermissionDenied, "permission denied")
+	case errors.Is(err, auth.ErrLastOrgOwner):
+		return status.Error(codes.FailedPrecondition, "organization must keep at least one owner")
+	case errors.Is(err, auth.ErrInvalidOrgInvite):
+		return status.Error(codes.NotFound, "invite not found or expired")
+	case errors.Is(err, auth.ErrAlreadyOrgMember):
+		return status.Error(codes.AlreadyExists, "already a member of organization")
+	case errors.Is(err, auth.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, auth.ErrInvalidOrganization), errors.Is(err, auth.ErrInvalidOrgRole):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) CheckPermission(
+	ctx context.Context,
+	req *ssov1.CheckPermissionRequest,
+) (*ssov1.CheckPermissionResponce, error) {
+	if req.GetCheck() == nil {
+		return nil, status.Error(codes.InvalidArgument, "check is required")
+	}
+
+	check := toPermissionCheck(req.GetCheck())
+	if err := s.authorizeCheck(ctx, []models.PermissionCheck{check}); err != nil {
+		return nil, err
+	}
+
+	decision, err := s.auth.CheckPermission(ctx, check)
+	if err != nil {
+		return nil, permissionError(err)
+	}
+
+	return &ssov1.CheckPermissionResponce{
+		Allowed:    decision.Allowed,
+		Reason:     decision.Reason,
+		TtlSeconds: int64(s.auth.DecisionTTL().Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) CheckPermissions(
+	ctx context.Context,
+	req *ssov1.CheckPermissionsRequest,
+) (*ssov1.CheckPermissionsResponce, error) {
+	checks := make([]models.PermissionCheck, 0, len(req.GetChecks()))
+	for _, check := range req.GetChecks() {
+		if check == nil {
+			return nil, status.Error(codes.InvalidArgument, "empty check")
+		}
+		checks = append(checks, toPermissionCheck(check))
+	}
+
+	if err := s.authorizeCheck(ctx, checks); err != nil {
+		return nil, err
+	}
+
+	decisions, err := s.auth.CheckPermissions(ctx, checks)
+	if err != nil {
+		return nil, permissionError(err)
+	}
+
+	resp := make([]*ssov1.PermissionDecision, 0, len(decisions))
+	for _, decision := range decisions {
+		resp = append(resp, &ssov1.PermissionDecision{
+			Allowed: decision.Allowed,
+			Reason:  decision.Reason,
+		})
+	}
+
+	return &ssov1.CheckPermissionsResponce{
+		Decisions:  resp,
+		TtlSeconds: int64(s.auth.DecisionTTL().Seconds()),
+	}, nil
+}
+
+func toPermissionCheck(check *ssov1.PermissionCheck) models.PermissionCheck {
+	return models.PermissionCheck{
+		UserID:   check.GetUserId(),
+		AppID:    int(check.GetAppId()),
+		Action:   check.GetAction(),
+		Resource: check.GetResource(),
+	}
+}
+
+func permissionError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidPermissionCheck):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, auth.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, auth.ErrInvalidAppID):
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
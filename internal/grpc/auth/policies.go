@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Политики приложений настраивают только админы
+
+func (s *serverAPI) CreatePolicy(
+	ctx context.Context,
+	req *ssov1.CreatePolicyRequest,
+) (*ssov1.CreatePolicyResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetExpression() == "" {
+		return nil, status.Error(codes.InvalidArgument, "expression is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	policyID, err := s.auth.CreatePolicy(ctx, models.Policy{
+		AppID:      int(req.GetAppId()),
+		Name:       req.GetName(),
+		Target:     req.GetTarget(),
+		Expression: req.GetExpression(),
+		Enabled:    req.GetEnabled(),
+	})
+	if err != nil {
+		return nil, policyError(err)
+	}
+
+	return &ssov1.CreatePolicyResponce{
+		PolicyId: policyID,
+	}, nil
+}
+
+func (s *serverAPI) ListPolicies(
+	ctx context.Context,
+	req *ssov1.ListPoliciesRequest,
+) (*ssov1.ListPoliciesResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	policies, err := s.auth.ListPolicies(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := make([]*ssov1.Policy, 0, len(policies))
+	for _, p := range policies {
+		resp = append(resp, &ssov1.Policy{
+			Id:         p.ID,
+			AppId:      int32(p.AppID),
+			Name:       p.Name,
+			Target:     p.Target,
+			Expression: p.Expression,
+			Enabled:    p.Enabled,
+			CreatedAt:  p.CreatedAt.Unix(),
+		})
+	}
+
+	return &ssov1.ListPoliciesResponce{
+		Policies: resp,
+	}, nil
+}
+
+func (s *serverAPI) SetPolicyEnabled(
+	ctx context.Context,
+	req *ssov1.SetPolicyEnabledRequest,
+) (*ssov1.SetPolicyEnabledResponce, error) {
+	if req.GetPolicyId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "policy_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.SetPolicyEnabled(ctx, req.GetPolicyId(), req.GetEnabled()); err != nil {
+		return nil, policyError(err)
+	}
+
+	return &ssov1.SetPolicyEnabledResponce{}, nil
+}
+
+func (s *serverAPI) DeletePolicy(
+	ctx context.Context,
+	req *ssov1.DeletePolicyRequest,
+) (*ssov1.DeletePolicyResponce, error) {
+	if req.GetPolicyId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "policy_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DeletePolicy(ctx, req.GetPolicyId()); err != nil {
+		return nil, policyError(err)
+	}
+
+	return &ssov1.DeletePolicyResponce{}, nil
+}
+
+// DryRunPolicy отвечает что решили бы политики, ничего не применяя. at это unix время,
+// по умолчанию сейчас, так можно проверить правила по часам не дожидаясь нужного времени
+func (s *serverAPI) DryRunPolicy(
+	ctx context.Context,
+	req *ssov1.DryRunPolicyRequest,
+) (*ssov1.DryRunPolicyResponce, error) {
+	if req.GetUserId() == emptyValue || req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id and app_id are required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var at time.Time
+	if req.GetAt() != emptyValue {
+		at = time.Unix(req.GetAt(), 0)
+	}
+
+	decision, err := s.auth.DryRunPolicy(ctx, models.PolicyDryRun{
+		Expression: req.GetExpression(),
+		UserID:     req.GetUserId(),
+		AppID:      int(req.GetAppId()),
+		Target:     req.GetTarget(),
+		Action:     req.GetAction(),
+		Resource:   req.GetResource(),
+		Client: models.ClientInfo{
+			IP:        req.GetIp(),
+			UserAgent: req.GetUserAgent(),
+		},
+		At: at,
+	})
+	if err != nil {
+		return nil, policyError(err)
+	}
+
+	return &ssov1.DryRunPolicyResponce{
+		Allowed: decision.Allowed,
+		Reason:  decision.Reason,
+	}, nil
+}
+
+func policyError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidPolicy):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, auth.ErrInvalidAppID):
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	case errors.Is(err, auth.ErrPolicyExists):
+		return status.Error(codes.AlreadyExists, "policy already exists")
+	case errors.Is(err, auth.ErrPolicyNotFound):
+		return status.Error(codes.NotFound, "policy not found")
+	case errors.Is(err, auth.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultInviteTTL     = 7 * 24 * time.Hour
+	defaultInviteMaxUses = 1
+)
+
+func (s *serverAPI) CreateInvite(
+	ctx context.Context,
+	req *ssov1.CreateInviteRequest,
+) (*ssov1.CreateInviteResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetMaxUses() < 0 || req.GetTtlSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "max_uses and ttl_seconds must not be negative")
+	}
+
+	claims, err := s.authorizeAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	maxUses := int(req.GetMaxUses())
+	if maxUses == 0 {
+		maxUses = defaultInviteMaxUses
+	}
+
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	if ttl == 0 {
+		ttl = defaultInviteTTL
+	}
+
+	code, err := s.auth.CreateInvite(ctx, int(req.GetAppId()), claims.UID, maxUses, ttl)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		if errors.Is(err, auth.ErrInvitesDisabled) {
+			return nil, status.Error(codes.FailedPrecondition, "app is not invite only")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.CreateInviteResponce{
+		InviteCode: code,
+		ExpiresAt:  time.Now().Add(ttl).Unix(),
+	}, nil
+}
+
+func (s *serverAPI) ListPendingRegistrations(
+	ctx context.Context,
+	req *ssov1.ListPendingRegistrationsRequest,
+) (*ssov1.ListPendingRegistrationsResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	members, err := s.auth.PendingRegistrations(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &ssov1.ListPendingRegistrationsResponce{
+		Registrations: make([]*ssov1.PendingRegistration, 0, len(members)),
+	}
+	for _, member := range members {
+		resp.Registrations = append(resp.Registrations, &ssov1.PendingRegistration{
+			UserId:    member.UserID,
+			Email:     member.Email,
+			CreatedAt: member.CreatedAt.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ApproveRegistration(
+	ctx context.Context,
+	req *ssov1.ApproveRegistrationRequest,
+) (*ssov1.ApproveRegistrationResponce, error) {
+	if req.GetAppId() == emptyValue || req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id and user_id are required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	err := s.auth.ApproveRegistration(ctx, int(req.GetAppId()), req.GetUserId(), req.GetApprove())
+	if err != nil {
+		if errors.Is(err, auth.ErrNotMember) {
+			return nil, status.Error(codes.NotFound, "registration not found")
+		}
+		if errors.Is(err, auth.ErrNotPending) {
+			return nil, status.Error(codes.FailedPrecondition, "registration is not pending")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ApproveRegistrationResponce{}, nil
+}
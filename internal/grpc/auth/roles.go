@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Управлять ролями могут только админы. Список своих ролей пользователь видит сам
+
+func (s *serverAPI) CreateRole(
+	ctx context.Context,
+	req *ssov1.CreateRoleRequest,
+) (*ssov1.CreateRoleResponce, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	roleID, err := s.auth.CreateRole(ctx, models.Role{
+		Name:        req.GetName(),
+		AppID:       int(req.GetAppId()),
+		Inherits:    req.GetInherits(),
+		Permissions: req.GetPermissions(),
+	})
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.CreateRoleResponce{
+		RoleId: roleID,
+	}, nil
+}
+
+func (s *serverAPI) DeleteRole(
+	ctx context.Context,
+	req *ssov1.DeleteRoleRequest,
+) (*ssov1.DeleteRoleResponce, error) {
+	if req.GetRoleId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DeleteRole(ctx, req.GetRoleId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.DeleteRoleResponce{}, nil
+}
+
+func (s *serverAPI) ListRoles(
+	ctx context.Context,
+	req *ssov1.ListRolesRequest,
+) (*ssov1.ListRolesResponce, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.ListRoles(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ListRolesResponce{
+		Roles: toProtoRoles(roles),
+	}, nil
+}
+
+func (s *serverAPI) SetRolePermissions(
+	ctx context.Context,
+	req *ssov1.SetRolePermissionsRequest,
+) (*ssov1.SetRolePermissionsResponce, error) {
+	if req.GetRoleId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.SetRolePermissions(ctx, req.GetRoleId(), req.GetPermissions()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.SetRolePermissionsResponce{}, nil
+}
+
+func (s *serverAPI) AssignRole(
+	ctx context.Context,
+	req *ssov1.AssignRoleRequest,
+) (*ssov1.AssignRoleResponce, error) {
+	if req.GetUserId() == emptyValue || req.GetRoleId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id and role_id are required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.AssignRole(ctx, req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.AssignRoleResponce{}, nil
+}
+
+func (s *serverAPI) RevokeRole(
+	ctx context.Context,
+	req *ssov1.RevokeRoleRequest,
+) (*ssov1.RevokeRoleResponce, error) {
+	if req.GetUserId() == emptyValue || req.GetRoleId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id and role_id are required")
+	}
+
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeRole(ctx, req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.RevokeRoleResponce{}, nil
+}
+
+func (s *serverAPI) ListUserRoles(
+	ctx context.Context,
+	req *ssov1.ListUserRolesRequest,
+) (*ssov1.ListUserRolesResponce, error) {
+	_, userID, err := s.authorizeUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.UserRoles(ctx, userID, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ListUserRolesResponce{
+		Roles: toProtoRoles(roles),
+	}, nil
+}
+
+func toProtoRoles(roles []models.Role) []*ssov1.Role {
+	resp := make([]*ssov1.Role, 0, len(roles))
+	for _, role := range roles {
+		resp = append(resp, &ssov1.Role{
+			Id:          role.ID,
+			Name:        role.Name,
+			AppId:       int32(role.AppID),
+			Inherits:    role.Inherits,
+			Permissions: role.Permissions,
+			CreatedAt:   role.CreatedAt.Unix(),
+		})
+	}
+	return resp
+}
+
+func roleError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	case errors.Is(err, auth.ErrRoleNotAssigned):
+		return status.Error(codes.NotFound, "role is not assigned to user")
+	case errors.Is(err, auth.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, auth.ErrRoleExists):
+		return status.Error(codes.AlreadyExists, "role already exists")
+	case errors.Is(err, auth.ErrInvalidAppID):
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	case errors.Is(err, auth.ErrInvalidRole):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
@@ -1,12 +1,16 @@
 package auth
 
 import (
-	"STTAuth/internal/services/auth"
 	"context"
 	"errors"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
 	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -23,18 +27,76 @@ type Auth interface {
 		email string,
 		password string,
 		appID int,
+		scopes []string,
+		consent bool,
+		client models.ClientInfo,
 	) (token string, err error)
 
 	RegisterNewUser(
 		ctx context.Context,
 		email string,
 		password string,
+		appID int,
+		inviteCode string,
 	) (userID int64, err error)
 
 	IsAdmin(
 		ctx context.Context,
 		userID int64,
 	) (bool, error)
+
+	VerifyToken(
+		ctx context.Context,
+		token string,
+	) (*jwtT.Claims, error)
+	InspectToken(ctx context.Context, token string) (*jwtT.Claims, error)
+
+	ListSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID int64) (int64, error)
+
+	Logout(ctx context.Context, token string, allApps bool) error
+	LockAccount(ctx context.Context, lockToken string) error
+
+	CreateInvite(ctx context.Context, appID int, createdBy int64, maxUses int, ttl time.Duration) (string, error)
+	PendingRegistrations(ctx context.Context, appID int) ([]models.Member, error)
+	ApproveRegistration(ctx context.Context, appID int, userID int64, approve bool) error
+
+	ClientToken(ctx context.Context, appID int, clientSecret string, scopes []string) (string, []string, error)
+	RotateClientSecret(ctx context.Context, appID int) (string, error)
+
+	ListConsents(ctx context.Context, userID int64) ([]models.Consent, error)
+	RevokeConsent(ctx context.Context, userID int64, appID int) error
+
+	CreateRole(ctx context.Context, role models.Role) (int64, error)
+	DeleteRole(ctx context.Context, roleID int64) error
+	ListRoles(ctx context.Context, appID int) ([]models.Role, error)
+	SetRolePermissions(ctx context.Context, roleID int64, permissions []string) error
+	AssignRole(ctx context.Context, userID int64, roleID int64) error
+	RevokeRole(ctx context.Context, userID int64, roleID int64) error
+	UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error)
+
+	CheckPermission(ctx context.Context, check models.PermissionCheck) (models.Decision, error)
+	CheckPermissions(ctx context.Context, checks []models.PermissionCheck) ([]models.Decision, error)
+	DecisionTTL() time.Duration
+
+	CreatePolicy(ctx context.Context, policy models.Policy) (int64, error)
+	ListPolicies(ctx context.Context, appID int) ([]models.Policy, error)
+	SetPolicyEnabled(ctx context.Context, policyID int64, enabled bool) error
+	DeletePolicy(ctx context.Context, policyID int64) error
+	DryRunPolicy(ctx context.Context, req models.PolicyDryRun) (models.Decision, error)
+
+	CreateOrganization(ctx context.Context, ownerID int64, name string) (int64, error)
+	ListOrganizations(ctx context.Context, userID int64) ([]models.OrgMember, error)
+	ListOrgMembers(ctx context.Context, orgID int64, actorID int64) ([]models.OrgMember, error)
+	InviteToOrganization(ctx context.Context, orgID int64, actorID int64, email string, role string, ttl time.Duration) error
+	AcceptOrgInvite(ctx context.Context, userID int64, token string) (int64, error)
+	RemoveOrgMember(ctx context.Context, orgID int64, actorID int64, userID int64) error
+	SwitchOrganization(ctx context.Context, token string, orgID int64, client models.ClientInfo) (string, error)
+
+	CreateAPIKey(ctx context.Context, userID int64, appID int, name string, scopes []string, ttl time.Duration) (string, models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error
 }
 
 type IsAdminRequest struct {
@@ -74,7 +136,7 @@ func (s *serverAPI) Login(
 		return nil, status.Error(codes.InvalidArgument, "app_id is required")
 	}
 
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()), req.GetScopes(), req.GetConsent(), clientinfo.FromContext(ctx))
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
@@ -82,6 +144,31 @@ func (s *serverAPI) Login(
 		if errors.Is(err, auth.ErrTooManyAttempts) {
 			return nil, status.Error(codes.ResourceExhausted, "too many failed login attempts")
 		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return nil, status.Error(codes.PermissionDenied, "account locked")
+		}
+		if errors.Is(err, auth.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not registered in this app")
+		}
+		if errors.Is(err, auth.ErrApprovalPending) {
+			return nil, status.Error(codes.FailedPrecondition, "registration is pending approval")
+		}
+		if errors.Is(err, auth.ErrPolicyDenied) {
+			return nil, status.Error(codes.PermissionDenied, "access denied by app policy")
+		}
+		if errors.Is(err, auth.ErrAppDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		if errors.Is(err, auth.ErrAccountNotLinked) {
+			return nil, status.Error(codes.FailedPrecondition, "account must be linked to directory by admin")
+		}
+		// Клиент показывает пользователю запрошенные scopes и повторяет вход с consent=true
+		if errors.Is(err, auth.ErrConsentRequired) {
+			return nil, status.Error(codes.FailedPrecondition, "consent required for requested scopes")
+		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return nil, status.Error(codes.InvalidArgument, "scope is not allowed for app")
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
@@ -114,11 +201,23 @@ func (s *serverAPI) Register(
 		return nil, err
 	}
 
-	userID, err := s.auth.RegisterNewUser(ctx, loginReq.Email, loginReq.Password)
+	userID, err := s.auth.RegisterNewUser(ctx, loginReq.Email, loginReq.Password, int(req.GetAppId()), req.GetInviteCode())
 	if err != nil {
 		if errors.Is(err, auth.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user alreay exists")
 		}
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.InvalidArgument, "invalid app_id")
+		}
+		if errors.Is(err, auth.ErrInviteRequired) || errors.Is(err, auth.ErrInvalidInvite) {
+			return nil, status.Error(codes.PermissionDenied, "valid invite code is required")
+		}
+		if errors.Is(err, auth.ErrDomainNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, "email domain is not allowed")
+		}
+		if errors.Is(err, auth.ErrAppDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) ListSessions(
+	ctx context.Context,
+	req *ssov1.ListSessionsRequest,
+) (*ssov1.ListSessionsResponce, error) {
+	claims, userID, err := s.authorizeUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.auth.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &ssov1.ListSessionsResponce{
+		Sessions: make([]*ssov1.Session, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &ssov1.Session{
+			Id:         session.ID,
+			AppId:      int32(session.AppID),
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastSeenAt: session.LastSeenAt.Unix(),
+			Current:    session.ID == claims.SessionID,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeSession(
+	ctx context.Context,
+	req *ssov1.RevokeSessionRequest,
+) (*ssov1.RevokeSessionResponce, error) {
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	_, userID, err := s.authorizeUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeSession(ctx, userID, req.GetSessionId()); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			return nil, status.Error(codes.NotFound, "session not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RevokeSessionResponce{}, nil
+}
+
+func (s *serverAPI) RevokeAllSessions(
+	ctx context.Context,
+	req *ssov1.RevokeAllSessionsRequest,
+) (*ssov1.RevokeAllSessionsResponce, error) {
+	_, userID, err := s.authorizeUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.auth.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RevokeAllSessionsResponce{
+		Revoked: revoked,
+	}, nil
+}
+
+func (s *serverAPI) Logout(
+	ctx context.Context,
+	req *ssov1.LogoutRequest,
+) (*ssov1.LogoutResponce, error) {
+	// Выходим из той сессии по токену которой интерцептор пустил вызывающего
+	token := authn.TokenFromContext(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+
+	if err := s.auth.Logout(ctx, token, req.GetAllApps()); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "token expired or invalid")
+		}
+		if errors.Is(err, auth.ErrSessionlessToken) {
+			return nil, status.Error(codes.FailedPrecondition, "token has no session and can not be logged out")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.LogoutResponce{}, nil
+}
+
+// Introspect говорит активен ли токен (RFC 7662). Спрашивать может только приложение своим сервисным
+// токеном и только про свои токены, про токен чужого приложения ответ как про невалидный.
+// Невалидный токен это не ошибка а active=false
+func (s *serverAPI) Introspect(
+	ctx context.Context,
+	req *ssov1.IntrospectRequest,
+) (*ssov1.IntrospectResponce, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	caller, err := authn.Principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsService() {
+		return nil, status.Error(codes.PermissionDenied, "service token is required")
+	}
+
+	claims, err := s.auth.InspectToken(ctx, req.GetToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return &ssov1.IntrospectResponce{Active: false}, nil
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	if claims.AppID != caller.AppID {
+		return &ssov1.IntrospectResponce{Active: false}, nil
+	}
+
+	return &ssov1.IntrospectResponce{
+		Active:    true,
+		UserId:    claims.UID,
+		AppId:     int32(claims.AppID),
+		SessionId: claims.SessionID,
+		Exp:       claims.ExpiresAt.Unix(),
+		Roles:     claims.Roles,
+		OrgId:     claims.OrgID,
+		Scopes:    claims.Scopes,
+		Email:     claims.Email,
+	}, nil
+}
+
+// LockAccount это ручка для ссылки "это был не я" из уведомления о новом входе
+func (s *serverAPI) LockAccount(
+	ctx context.Context,
+	req *ssov1.LockAccountRequest,
+) (*ssov1.LockAccountResponce, error) {
+	if req.GetLockToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "lock_token is required")
+	}
+
+	if err := s.auth.LockAccount(ctx, req.GetLockToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidLockToken) {
+			return nil, status.Error(codes.NotFound, "lock link is invalid or expired")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.LockAccountResponce{}, nil
+}
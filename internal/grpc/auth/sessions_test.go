@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuth реализует только InspectToken, остальные методы тут не нужны
+type fakeAuth struct {
+	Auth
+	claims *jwtT.Claims
+}
+
+func (f *fakeAuth) InspectToken(_ context.Context, _ string) (*jwtT.Claims, error) {
+	return f.claims, nil
+}
+
+func TestIntrospect(t *testing.T) {
+	inspected := &jwtT.Claims{UID: 7, AppID: 1, SessionID: "sid"}
+	inspected.ExpiresAt = time.Now().Add(time.Hour)
+	s := &serverAPI{auth: &fakeAuth{claims: inspected}}
+
+	tests := []struct {
+		name   string
+		caller *jwtT.Claims
+		code   codes.Code
+		active bool
+	}{
+		{name: "owning app", caller: &jwtT.Claims{AppID: 1}, code: codes.OK, active: true},
+		{name: "other app", caller: &jwtT.Claims{AppID: 2}, code: codes.OK, active: false},
+		{name: "user token", caller: &jwtT.Claims{UID: 3, AppID: 1}, code: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := authn.NewContext(context.Background(), tt.caller, "caller-token")
+			resp, err := s.Introspect(ctx, &ssov1.IntrospectRequest{Token: "token"})
+			if tt.code != codes.OK {
+				assert.Equal(t, tt.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.active, resp.GetActive())
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataAuthorization это ключ метаданных в котором клиент присылает "Bearer <token>"
+const MetadataAuthorization = "authorization"
+
+// Requirement это кого пускать в метод. Значения можно объединять через |,
+// тогда достаточно выполнить любое из условий
+type Requirement uint8
+
+const (
+	// RequirePublic пускает всех, токен даже не проверяется
+	RequirePublic Requirement = 0
+	// RequireAuthenticated пускает любой валидный токен, пользователя или сервиса
+	RequireAuthenticated Requirement = 1 << (iota - 1)
+	// RequireAdmin пускает пользователя с глобальной ролью admin
+	RequireAdmin
+	// RequireService пускает сервисный токен приложения
+	RequireService
+)
+
+// Verifier проверяет токен и кто из пользователей админ. VerifyToken заполняет SessionID
+// только если нашел живую сессию этого пользователя в этом приложении
+type Verifier interface {
+	VerifyToken(ctx context.Context, token string) (*jwtT.Claims, error)
+	AdminChecker
+}
+
+// AdminChecker говорит есть ли у пользователя глобальная роль admin
+type AdminChecker interface {
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+type tokenGetter interface {
+	GetToken() string
+}
+
+type (
+	claimsKey struct{}
+	tokenKey  struct{}
+)
+
+// ClaimsFromContext отдает claims вызывающего, если интерцептор их проверил
+func ClaimsFromContext(ctx context.Context) (*jwtT.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*jwtT.Claims)
+	return claims, ok
+}
+
+// NewContext кладет в контекст вызывающего и его токен, так же как это делает интерцептор
+func NewContext(ctx context.Context, claims *jwtT.Claims, token string) context.Context {
+	ctx = context.WithValue(ctx, claimsKey{}, claims)
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext отдает токен по которому интерцептор пустил вызывающего. Нужен методам
+// которым сам токен важнее claims, например Logout
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token
+}
+
+// UnaryServerInterceptor проверяет токен вызывающего до обработчика и кладет claims в контекст.
+// Требования берутся из requirements по полному имени метода, для остальных методов действует fallback
+func UnaryServerInterceptor(
+	log *slog.Logger,
+	verifier Verifier,
+	requirements map[string]Requirement,
+	fallback Requirement,
+) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requirement, ok := requirements[info.FullMethod]
+		if !ok {
+			requirement = fallback
+		}
+		if requirement == RequirePublic {
+			return handler(ctx, req)
+		}
+
+		token := bearerToken(ctx)
+		if token == "" && !InspectedTokenMethods[info.FullMethod] {
+			// Старые клиенты присылают токен в теле запроса, их тоже принимаем
+			if r, ok := req.(tokenGetter); ok {
+				token = r.GetToken()
+			}
+		}
+
+		ctx, err := authenticate(ctx, verifier, token, requirement)
+		if err != nil {
+			log.Warn("request rejected",
+				slog.String("method", info.FullMethod),
+				slog.String("code", status.Code(err).String()),
+				sl.Err(err),
+			)
+
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor то же самое для стримов. Тела запроса на момент вызова еще нет,
+// поэтому токен принимается только из метаданных
+func StreamServerInterceptor(
+	log *slog.Logger,
+	verifier Verifier,
+	requirements map[string]Requirement,
+	fallback Requirement,
+) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		requirement, ok := requirements[info.FullMethod]
+		if !ok {
+			requirement = fallback
+		}
+		if requirement == RequirePublic {
+			return handler(srv, ss)
+		}
+
+		ctx, err := authenticate(ss.Context(), verifier, bearerToken(ss.Context()), requirement)
+		if err != nil {
+			log.Warn("stream rejected",
+				slog.String("method", info.FullMethod),
+				slog.String("code", status.Code(err).String()),
+				sl.Err(err),
+			)
+
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream подменяет контекст стрима на контекст с claims
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate проверяет токен и требование и отдает контекст с claims и самим токеном
+func authenticate(ctx context.Context, verifier Verifier, token string, requirement Requirement) (context.Context, error) {
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+
+	claims, err := verifier.VerifyToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "token expired or invalid")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if err := check(ctx, verifier, claims, requirement); err != nil {
+		return nil, err
+	}
+
+	return NewContext(ctx, claims, token), nil
+}
+
+func check(ctx context.Context, verifier Verifier, claims *jwtT.Claims, requirement Requirement) error {
+	if requirement&RequireAuthenticated != 0 {
+		return nil
+	}
+	// API ключ всегда от имени пользователя, сервисом он не бывает
+	if requirement&RequireService != 0 && claims.IsService() && claims.APIKeyID == 0 {
+		return nil
+	}
+	if requirement&RequireAdmin != 0 {
+		isAdmin, err := IsAdmin(ctx, verifier, claims)
+		if err != nil {
+			return err
+		}
+		if isAdmin {
+			return nil
+		}
+	}
+
+	return status.Error(codes.PermissionDenied, "permission denied")
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataAuthorization)
+	if len(values) == 0 {
+		return ""
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Principal отдает claims вызывающего для обработчика. Если их нет, значит интерцептор не стоит
+// или метод публичный, тогда отвечаем Unauthenticated а не пускаем дальше
+func Principal(ctx context.Context) (*jwtT.Claims, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+	return claims, nil
+}
+
+// IsAdmin решает действует ли вызывающий как админ. Роль admin глобальная, а секрет приложения
+// знает и само приложение, поэтому права админа дает только токен за которым есть сессия.
+// У API ключа сессии нет, ему права админа дает только явный scope models.AdminScope.
+// Все проверки прав админа в обработчиках должны идти через эту функцию
+func IsAdmin(ctx context.Context, checker AdminChecker, claims *jwtT.Claims) (bool, error) {
+	if claims.IsService() {
+		return false, nil
+	}
+	if claims.APIKeyID != 0 {
+		if !slices.Contains(claims.Scopes, models.AdminScope) {
+			return false, nil
+		}
+	} else if claims.SessionID == "" {
+		return false, nil
+	}
+
+	isAdmin, err := checker.IsAdmin(ctx, claims.UID)
+	if err != nil {
+		return false, status.Error(codes.Internal, "internal error")
+	}
+	return isAdmin, nil
+}
@@ -0,0 +1,226 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	userToken    = "user-token"
+	adminToken   = "admin-token"
+	serviceToken = "service-token"
+	brokenToken  = "broken-token"
+	// legacyAdminToken это токен админа без сессии. Подписать такой может любое приложение
+	// знающее свой секрет, поэтому прав админа он не дает
+	legacyAdminToken = "legacy-admin-token"
+	// API ключи админа, с явным scope админа и без него
+	adminAPIKey       = "stt_admin_key"
+	scopedAdminAPIKey = "stt_scoped_admin_key"
+)
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) VerifyToken(_ context.Context, token string) (*jwtT.Claims, error) {
+	switch token {
+	case userToken:
+		return &jwtT.Claims{UID: 1, AppID: 1, SessionID: "user-session"}, nil
+	case adminToken:
+		return &jwtT.Claims{UID: 2, AppID: 1, SessionID: "admin-session"}, nil
+	case legacyAdminToken:
+		return &jwtT.Claims{UID: 2, AppID: 7}, nil
+	case adminAPIKey:
+		return &jwtT.Claims{UID: 2, AppID: 1, Scopes: []string{"openid"}, APIKeyID: 10}, nil
+	case scopedAdminAPIKey:
+		return &jwtT.Claims{UID: 2, AppID: 1, Scopes: []string{models.AdminScope}, APIKeyID: 11}, nil
+	case serviceToken:
+		return &jwtT.Claims{AppID: 1}, nil
+	case brokenToken:
+		return nil, errors.New("db is down")
+	default:
+		return nil, auth.ErrInvalidToken
+	}
+}
+
+func (fakeVerifier) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	return userID == 2, nil
+}
+
+type tokenRequest struct {
+	token string
+}
+
+func (r tokenRequest) GetToken() string { return r.token }
+
+var testRequirements = map[string]Requirement{
+	"/test/Public":         RequirePublic,
+	"/test/Authenticated":  RequireAuthenticated,
+	"/test/Admin":          RequireAdmin,
+	"/test/Service":        RequireService,
+	"/test/AdminOrService": RequireAdmin | RequireService,
+	"/test/Introspect":     RequirePublic,
+
+	ssov1.Auth_Introspect_FullMethodName: RequireService,
+}
+
+func withBearer(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataAuthorization, token))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		fallback Requirement
+		ctx      context.Context
+		req      interface{}
+		wantCode codes.Code
+		wantUID  int64
+		// wantClaims false значит что обработчик вызван без claims, как у публичных методов
+		wantClaims bool
+	}{
+		{name: "public method without token", method: "/test/Public", ctx: context.Background(), req: nil, wantCode: codes.OK},
+		{name: "public method ignores body token", method: "/test/Introspect", ctx: context.Background(), req: tokenRequest{token: "token-to-inspect"}, wantCode: codes.OK},
+		{name: "unlisted method falls back to authenticated", method: "/test/Unknown", fallback: RequireAuthenticated, ctx: context.Background(), wantCode: codes.Unauthenticated},
+		{name: "unlisted method with token", method: "/test/Unknown", fallback: RequireAuthenticated, ctx: withBearer("Bearer " + userToken), wantCode: codes.OK, wantUID: 1, wantClaims: true},
+		{name: "unlisted method with public fallback", method: "/test/Unknown", fallback: RequirePublic, ctx: context.Background(), wantCode: codes.OK},
+
+		{name: "metadata token", method: "/test/Authenticated", ctx: withBearer("Bearer " + userToken), wantCode: codes.OK, wantUID: 1, wantClaims: true},
+		{name: "bearer scheme is case insensitive", method: "/test/Authenticated", ctx: withBearer("bearer " + userToken), wantCode: codes.OK, wantUID: 1, wantClaims: true},
+		{name: "body token", method: "/test/Authenticated", ctx: context.Background(), req: tokenRequest{token: userToken}, wantCode: codes.OK, wantUID: 1, wantClaims: true},
+		{name: "metadata wins over body", method: "/test/Authenticated", ctx: withBearer("Bearer " + adminToken), req: tokenRequest{token: userToken}, wantCode: codes.OK, wantUID: 2, wantClaims: true},
+		{name: "other scheme is not a token", method: "/test/Authenticated", ctx: withBearer("Basic " + userToken), wantCode: codes.Unauthenticated},
+		{name: "no token", method: "/test/Authenticated", ctx: context.Background(), req: tokenRequest{}, wantCode: codes.Unauthenticated},
+		{name: "invalid token", method: "/test/Authenticated", ctx: withBearer("Bearer garbage"), wantCode: codes.Unauthenticated},
+		{name: "verifier failure", method: "/test/Authenticated", ctx: withBearer("Bearer " + brokenToken), wantCode: codes.Internal},
+
+		{name: "admin method rejects user", method: "/test/Admin", ctx: withBearer("Bearer " + userToken), wantCode: codes.PermissionDenied},
+		{name: "admin method accepts admin", method: "/test/Admin", ctx: withBearer("Bearer " + adminToken), wantCode: codes.OK, wantUID: 2, wantClaims: true},
+		{name: "admin method rejects service", method: "/test/Admin", ctx: withBearer("Bearer " + serviceToken), wantCode: codes.PermissionDenied},
+		{name: "service method accepts service", method: "/test/Service", ctx: withBearer("Bearer " + serviceToken), wantCode: codes.OK, wantClaims: true},
+		{name: "service method rejects admin", method: "/test/Service", ctx: withBearer("Bearer " + adminToken), wantCode: codes.PermissionDenied},
+		{name: "admin or service accepts service", method: "/test/AdminOrService", ctx: withBearer("Bearer " + serviceToken), wantCode: codes.OK, wantClaims: true},
+		{name: "admin or service accepts admin", method: "/test/AdminOrService", ctx: withBearer("Bearer " + adminToken), wantCode: codes.OK, wantUID: 2, wantClaims: true},
+		{name: "admin or service rejects user", method: "/test/AdminOrService", ctx: withBearer("Bearer " + userToken), wantCode: codes.PermissionDenied},
+		{name: "admin method rejects sessionless admin token", method: "/test/Admin", ctx: withBearer("Bearer " + legacyAdminToken), wantCode: codes.PermissionDenied},
+		{name: "admin or service rejects sessionless admin token", method: "/test/AdminOrService", ctx: withBearer("Bearer " + legacyAdminToken), wantCode: codes.PermissionDenied},
+		{name: "introspect requires service token", method: ssov1.Auth_Introspect_FullMethodName, ctx: withBearer("Bearer " + userToken), req: tokenRequest{token: userToken}, wantCode: codes.PermissionDenied},
+		{name: "introspect accepts service token", method: ssov1.Auth_Introspect_FullMethodName, ctx: withBearer("Bearer " + serviceToken), req: tokenRequest{token: userToken}, wantCode: codes.OK, wantClaims: true},
+		// Токен в теле это проверяемый токен, выдать себя за его владельца по нему нельзя
+		{name: "introspect ignores body token", method: ssov1.Auth_Introspect_FullMethodName, ctx: context.Background(), req: tokenRequest{token: serviceToken}, wantCode: codes.Unauthenticated},
+		{name: "admin method rejects admin api key", method: "/test/Admin", ctx: withBearer("Bearer " + adminAPIKey), wantCode: codes.PermissionDenied},
+		{name: "admin or service rejects admin api key", method: "/test/AdminOrService", ctx: withBearer("Bearer " + adminAPIKey), wantCode: codes.PermissionDenied},
+		{name: "service method rejects admin api key", method: "/test/Service", ctx: withBearer("Bearer " + scopedAdminAPIKey), wantCode: codes.PermissionDenied},
+		{name: "admin method accepts api key with admin scope", method: "/test/Admin", ctx: withBearer("Bearer " + scopedAdminAPIKey), wantCode: codes.OK, wantUID: 2, wantClaims: true},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := UnaryServerInterceptor(log, fakeVerifier{}, testRequirements, tt.fallback)
+
+			called := false
+			handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+				called = true
+
+				claims, ok := ClaimsFromContext(ctx)
+				require.Equal(t, tt.wantClaims, ok)
+				if ok {
+					assert.Equal(t, tt.wantUID, claims.UID)
+					assert.NotEmpty(t, TokenFromContext(ctx))
+				}
+				return "ok", nil
+			}
+
+			_, err := interceptor(tt.ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCode == codes.OK, called)
+		})
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		ctx        context.Context
+		wantCode   codes.Code
+		wantClaims bool
+	}{
+		{name: "public stream", method: "/test/Public", ctx: context.Background(), wantCode: codes.OK},
+		{name: "unlisted stream without token", method: "/test/Unknown", ctx: context.Background(), wantCode: codes.Unauthenticated},
+		{name: "metadata token", method: "/test/Unknown", ctx: withBearer("Bearer " + userToken), wantCode: codes.OK, wantClaims: true},
+		{name: "admin stream rejects user", method: "/test/Admin", ctx: withBearer("Bearer " + userToken), wantCode: codes.PermissionDenied},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	interceptor := StreamServerInterceptor(log, fakeVerifier{}, testRequirements, RequireAuthenticated)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := func(_ interface{}, ss grpc.ServerStream) error {
+				called = true
+
+				_, ok := ClaimsFromContext(ss.Context())
+				assert.Equal(t, tt.wantClaims, ok)
+				return nil
+			}
+
+			err := interceptor(nil, fakeStream{ctx: tt.ctx}, &grpc.StreamServerInfo{FullMethod: tt.method}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCode == codes.OK, called)
+		})
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	public := []string{
+		ssov1.Auth_Login_FullMethodName,
+		ssov1.Auth_Register_FullMethodName,
+		ssov1.Auth_ClientCredentials_FullMethodName,
+		ssov1.Auth_LockAccount_FullMethodName,
+		ssov1.Challenge_Challenge_FullMethodName,
+		ssov1.Device_DeviceCode_FullMethodName,
+		ssov1.Device_DeviceToken_FullMethodName,
+		ssov1.Federation_AuthURL_FullMethodName,
+		ssov1.Federation_Callback_FullMethodName,
+	}
+	for _, method := range public {
+		requirement, ok := Requirements[method]
+		assert.True(t, ok, "%s must be listed explicitly, unlisted methods require a token", method)
+		assert.Equal(t, RequirePublic, requirement, method)
+	}
+
+	// Кроме перечисленных публичных методов без токена никуда нельзя
+	for method, requirement := range Requirements {
+		if requirement == RequirePublic {
+			assert.Contains(t, public, method)
+		}
+	}
+
+	assert.Equal(t, RequireAdmin, Requirements[ssov1.Admin_DeleteUser_FullMethodName])
+	assert.Equal(t, RequireAdmin|RequireService, Requirements[ssov1.Auth_IsAdmin_FullMethodName])
+	assert.Equal(t, RequireService, Requirements[ssov1.Auth_Introspect_FullMethodName])
+}
@@ -0,0 +1,91 @@
+package authn
+
+import (
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+)
+
+// Requirements это требования к методам нашего API. Метод которого тут нет требует валидный токен,
+// см. RequireAuthenticated как fallback в app.go, так что забытый в списке метод закрыт а не открыт.
+// Публичные методы перечислены явно: вход, регистрация, челленджи, федерация, device flow
+// и LockAccount, который получает в теле не токен вызывающего а токен из письма.
+// Обработчики по прежнему делают свои проверки, например что пользователь смотрит только свои
+// сессии, интерцептор только не пускает дальше тех кому в метод нельзя совсем
+var Requirements = map[string]Requirement{
+	ssov1.Auth_Login_FullMethodName:             RequirePublic,
+	ssov1.Auth_Register_FullMethodName:          RequirePublic,
+	ssov1.Auth_ClientCredentials_FullMethodName: RequirePublic,
+	ssov1.Auth_LockAccount_FullMethodName:       RequirePublic,
+	ssov1.Challenge_Challenge_FullMethodName:    RequirePublic,
+	ssov1.Device_DeviceCode_FullMethodName:      RequirePublic,
+	ssov1.Device_DeviceToken_FullMethodName:     RequirePublic,
+	ssov1.Federation_AuthURL_FullMethodName:     RequirePublic,
+	ssov1.Federation_Callback_FullMethodName:    RequirePublic,
+
+	// IsAdmin раньше отвечал любому, теперь спросить могут только админы и сервисы
+	ssov1.Auth_IsAdmin_FullMethodName: RequireAdmin | RequireService,
+	// Introspect как в RFC 7662 только для приложений, свои ли это токены проверяет обработчик
+	ssov1.Auth_Introspect_FullMethodName: RequireService,
+
+	ssov1.Auth_RotateClientSecret_FullMethodName:       RequireAdmin,
+	ssov1.Auth_CreateInvite_FullMethodName:             RequireAdmin,
+	ssov1.Auth_ListPendingRegistrations_FullMethodName: RequireAdmin,
+	ssov1.Auth_ApproveRegistration_FullMethodName:      RequireAdmin,
+	ssov1.Auth_CreateRole_FullMethodName:               RequireAdmin,
+	ssov1.Auth_DeleteRole_FullMethodName:               RequireAdmin,
+	ssov1.Auth_ListRoles_FullMethodName:                RequireAdmin,
+	ssov1.Auth_SetRolePermissions_FullMethodName:       RequireAdmin,
+	ssov1.Auth_AssignRole_FullMethodName:               RequireAdmin,
+	ssov1.Auth_RevokeRole_FullMethodName:               RequireAdmin,
+	ssov1.Auth_CreatePolicy_FullMethodName:             RequireAdmin,
+	ssov1.Auth_ListPolicies_FullMethodName:             RequireAdmin,
+	ssov1.Auth_SetPolicyEnabled_FullMethodName:         RequireAdmin,
+	ssov1.Auth_DeletePolicy_FullMethodName:             RequireAdmin,
+	ssov1.Auth_DryRunPolicy_FullMethodName:             RequireAdmin,
+
+	ssov1.Admin_ListUsers_FullMethodName:            RequireAdmin,
+	ssov1.Admin_GetUser_FullMethodName:              RequireAdmin,
+	ssov1.Admin_UpdateUser_FullMethodName:           RequireAdmin,
+	ssov1.Admin_SetAdmin_FullMethodName:             RequireAdmin,
+	ssov1.Admin_DeleteUser_FullMethodName:           RequireAdmin,
+	ssov1.Admin_CreateApp_FullMethodName:            RequireAdmin,
+	ssov1.Admin_ListApps_FullMethodName:             RequireAdmin,
+	ssov1.Admin_RotateAppSecret_FullMethodName:      RequireAdmin,
+	ssov1.Admin_SetAppDisabled_FullMethodName:       RequireAdmin,
+	ssov1.Admin_DeleteApp_FullMethodName:            RequireAdmin,
+	ssov1.Admin_LinkDirectoryAccount_FullMethodName: RequireAdmin,
+
+	ssov1.Auth_ListSessions_FullMethodName:         RequireAuthenticated,
+	ssov1.Auth_RevokeSession_FullMethodName:        RequireAuthenticated,
+	ssov1.Auth_RevokeAllSessions_FullMethodName:    RequireAuthenticated,
+	ssov1.Auth_Logout_FullMethodName:               RequireAuthenticated,
+	ssov1.Auth_ListConsents_FullMethodName:         RequireAuthenticated,
+	ssov1.Auth_RevokeConsent_FullMethodName:        RequireAuthenticated,
+	ssov1.Auth_ListUserRoles_FullMethodName:        RequireAuthenticated,
+	ssov1.Auth_CheckPermission_FullMethodName:      RequireAuthenticated,
+	ssov1.Auth_CheckPermissions_FullMethodName:     RequireAuthenticated,
+	ssov1.Auth_CreateAPIKey_FullMethodName:         RequireAuthenticated,
+	ssov1.Auth_ListAPIKeys_FullMethodName:          RequireAuthenticated,
+	ssov1.Auth_RevokeAPIKey_FullMethodName:         RequireAuthenticated,
+	ssov1.Auth_CreateOrganization_FullMethodName:   RequireAuthenticated,
+	ssov1.Auth_ListOrganizations_FullMethodName:    RequireAuthenticated,
+	ssov1.Auth_ListOrgMembers_FullMethodName:       RequireAuthenticated,
+	ssov1.Auth_InviteToOrganization_FullMethodName: RequireAuthenticated,
+	ssov1.Auth_AcceptOrgInvite_FullMethodName:      RequireAuthenticated,
+	ssov1.Auth_RemoveOrgMember_FullMethodName:      RequireAuthenticated,
+	ssov1.Auth_SwitchOrganization_FullMethodName:   RequireAuthenticated,
+	ssov1.Device_ApproveDevice_FullMethodName:      RequireAuthenticated,
+
+	// Check и ListObjects пользователь может спрашивать про себя, это решает обработчик
+	ssov1.Authz_WriteTuples_FullMethodName:  RequireAdmin | RequireService,
+	ssov1.Authz_DeleteTuples_FullMethodName: RequireAdmin | RequireService,
+	ssov1.Authz_Expand_FullMethodName:       RequireAdmin | RequireService,
+	ssov1.Authz_Check_FullMethodName:        RequireAuthenticated,
+	ssov1.Authz_ListObjects_FullMethodName:  RequireAuthenticated,
+}
+
+// InspectedTokenMethods получают в поле token не токен вызывающего а токен который надо проверить.
+// Для них токен вызывающего берется только из метаданных
+var InspectedTokenMethods = map[string]bool{
+	ssov1.Auth_Introspect_FullMethodName:  true,
+	ssov1.Auth_LockAccount_FullMethodName: true,
+}
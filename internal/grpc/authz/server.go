@@ -0,0 +1,238 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/services/authz"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Authz это авторизация на отношениях: кортежи, проверка, раскрытие и обратный поиск объектов
+type Authz interface {
+	WriteTuples(ctx context.Context, tuples []models.RelationTuple) error
+	DeleteTuples(ctx context.Context, tuples []models.RelationTuple) error
+	Check(ctx context.Context, tuple models.RelationTuple) (bool, error)
+	Expand(ctx context.Context, namespace string, objectID string, relation string) (*authz.Tree, error)
+	ListObjects(ctx context.Context, namespace string, relation string, subject models.Subject) ([]string, error)
+	OwnedBy(namespace string, appID int) bool
+}
+
+// Authenticator говорит кто из пользователей админ. Токен вызывающего проверяет интерцептор authn
+type Authenticator interface {
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAuthzServer
+	authz Authz
+	auth  Authenticator
+}
+
+func Register(gRPC *grpc.Server, authz Authz, auth Authenticator) {
+	ssov1.RegisterAuthzServer(gRPC, &serverAPI{authz: authz, auth: auth})
+}
+
+// WriteTuples и DeleteTuples доступны сервисам и админам, отношения это данные сервисов.
+// Сервис меняет только кортежи namespaces своего приложения
+func (s *serverAPI) WriteTuples(
+	ctx context.Context,
+	req *ssov1.WriteTuplesRequest,
+) (*ssov1.WriteTuplesResponce, error) {
+	tuples := fromProtoTuples(req.GetTuples())
+	if _, err := s.authorize(ctx, nil, tupleNamespaces(tuples)...); err != nil {
+		return nil, err
+	}
+
+	if err := s.authz.WriteTuples(ctx, tuples); err != nil {
+		return nil, authzError(err)
+	}
+
+	return &ssov1.WriteTuplesResponce{}, nil
+}
+
+func (s *serverAPI) DeleteTuples(
+	ctx context.Context,
+	req *ssov1.DeleteTuplesRequest,
+) (*ssov1.DeleteTuplesResponce, error) {
+	tuples := fromProtoTuples(req.GetTuples())
+	if _, err := s.authorize(ctx, nil, tupleNamespaces(tuples)...); err != nil {
+		return nil, err
+	}
+
+	if err := s.authz.DeleteTuples(ctx, tuples); err != nil {
+		return nil, authzError(err)
+	}
+
+	return &ssov1.DeleteTuplesResponce{}, nil
+}
+
+// Check пользователь может вызвать и сам, но только спрашивая про себя
+func (s *serverAPI) Check(
+	ctx context.Context,
+	req *ssov1.CheckRequest,
+) (*ssov1.CheckResponce, error) {
+	if req.GetTuple() == nil {
+		return nil, status.Error(codes.InvalidArgument, "tuple is required")
+	}
+
+	tuple := fromProtoTuple(req.GetTuple())
+	if _, err := s.authorize(ctx, &tuple.Subject, tuple.Namespace); err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.authz.Check(ctx, tuple)
+	if err != nil {
+		return nil, authzError(err)
+	}
+
+	return &ssov1.CheckResponce{
+		Allowed: allowed,
+	}, nil
+}
+
+// Expand показывает всех у кого есть отношение, поэтому только сервисам и админам
+func (s *serverAPI) Expand(
+	ctx context.Context,
+	req *ssov1.ExpandRequest,
+) (*ssov1.ExpandResponce, error) {
+	if _, err := s.authorize(ctx, nil, req.GetNamespace()); err != nil {
+		return nil, err
+	}
+
+	tree, err := s.authz.Expand(ctx, req.GetNamespace(), req.GetObjectId(), req.GetRelation())
+	if err != nil {
+		return nil, authzError(err)
+	}
+
+	return &ssov1.ExpandResponce{
+		Tree: toProtoTree(tree),
+	}, nil
+}
+
+func (s *serverAPI) ListObjects(
+	ctx context.Context,
+	req *ssov1.ListObjectsRequest,
+) (*ssov1.ListObjectsResponce, error) {
+	subject := fromProtoSubject(req.GetSubject())
+	if _, err := s.authorize(ctx, &subject, req.GetNamespace()); err != nil {
+		return nil, err
+	}
+
+	objects, err := s.authz.ListObjects(ctx, req.GetNamespace(), req.GetRelation(), subject)
+	if err != nil {
+		return nil, authzError(err)
+	}
+
+	return &ssov1.ListObjectsResponce{
+		ObjectIds: objects,
+	}, nil
+}
+
+// authorize пускает админов и сервисные токены, но сервис только в namespaces своего приложения,
+// иначе одно приложение могло бы переписать отношения другого. Если передан self, то пользователь
+// проходит еще и когда self это он сам
+func (s *serverAPI) authorize(ctx context.Context, self *models.Subject, namespaces ...string) (*jwtT.Claims, error) {
+	claims, err := authn.Principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsService() {
+		for _, namespace := range namespaces {
+			if !s.authz.OwnedBy(namespace, claims.AppID) {
+				return nil, status.Error(codes.PermissionDenied, "namespace belongs to another app")
+			}
+		}
+		return claims, nil
+	}
+
+	if self != nil && *self == (models.Subject{Namespace: models.NamespaceUser, ObjectID: strconv.FormatInt(claims.UID, 10)}) {
+		return claims, nil
+	}
+
+	isAdmin, err := authn.IsAdmin(ctx, s.auth, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return claims, nil
+}
+
+func tupleNamespaces(tuples []models.RelationTuple) []string {
+	namespaces := make([]string, 0, len(tuples))
+	for _, tuple := range tuples {
+		namespaces = append(namespaces, tuple.Namespace)
+	}
+	return namespaces
+}
+
+func fromProtoSubject(s *ssov1.Subject) models.Subject {
+	return models.Subject{
+		Namespace: s.GetNamespace(),
+		ObjectID:  s.GetObjectId(),
+		Relation:  s.GetRelation(),
+	}
+}
+
+func fromProtoTuple(t *ssov1.RelationTuple) models.RelationTuple {
+	return models.RelationTuple{
+		Namespace: t.GetNamespace(),
+		ObjectID:  t.GetObjectId(),
+		Relation:  t.GetRelation(),
+		Subject:   fromProtoSubject(t.GetSubject()),
+	}
+}
+
+func fromProtoTuples(tuples []*ssov1.RelationTuple) []models.RelationTuple {
+	resp := make([]models.RelationTuple, 0, len(tuples))
+	for _, t := range tuples {
+		if t == nil {
+			continue
+		}
+		resp = append(resp, fromProtoTuple(t))
+	}
+	return resp
+}
+
+func toProtoSubject(s models.Subject) *ssov1.Subject {
+	return &ssov1.Subject{
+		Namespace: s.Namespace,
+		ObjectId:  s.ObjectID,
+		Relation:  s.Relation,
+	}
+}
+
+func toProtoTree(tree *authz.Tree) *ssov1.UsersetTree {
+	resp := &ssov1.UsersetTree{
+		Userset: toProtoSubject(tree.Userset),
+	}
+	for _, s := range tree.Subjects {
+		resp.Subjects = append(resp.Subjects, toProtoSubject(s))
+	}
+	for _, child := range tree.Children {
+		resp.Children = append(resp.Children, toProtoTree(child))
+	}
+	return resp
+}
+
+func authzError(err error) error {
+	switch {
+	case errors.Is(err, authz.ErrUnknownRelation), errors.Is(err, authz.ErrInvalidTuple):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, authz.ErrDepthExceeded):
+		return status.Error(codes.FailedPrecondition, "relation graph is too deep")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
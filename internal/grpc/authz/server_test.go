@@ -0,0 +1,152 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/services/authz"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeAuthz struct {
+	schema  authz.Schema
+	written []models.RelationTuple
+}
+
+func (f *fakeAuthz) WriteTuples(_ context.Context, tuples []models.RelationTuple) error {
+	f.written = append(f.written, tuples...)
+	return nil
+}
+
+func (f *fakeAuthz) DeleteTuples(_ context.Context, _ []models.RelationTuple) error { return nil }
+
+func (f *fakeAuthz) Check(_ context.Context, _ models.RelationTuple) (bool, error) { return true, nil }
+
+func (f *fakeAuthz) Expand(_ context.Context, _ string, _ string, _ string) (*authz.Tree, error) {
+	return &authz.Tree{}, nil
+}
+
+func (f *fakeAuthz) ListObjects(_ context.Context, _ string, _ string, _ models.Subject) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeAuthz) OwnedBy(namespace string, appID int) bool {
+	return f.schema.OwnedBy(namespace, appID)
+}
+
+type fakeAdmins map[int64]bool
+
+func (f fakeAdmins) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	return f[userID], nil
+}
+
+func TestServiceTokensAreScopedToOwnApp(t *testing.T) {
+	engine := &fakeAuthz{schema: authz.Schema{Namespaces: map[string]authz.Namespace{
+		"club":   {AppID: 1},
+		"course": {AppID: 2},
+		"shared": {},
+	}}}
+	s := &serverAPI{authz: engine, auth: fakeAdmins{7: true}}
+
+	tuple := func(namespace string) *ssov1.RelationTuple {
+		return &ssov1.RelationTuple{
+			Namespace: namespace,
+			ObjectId:  "1",
+			Relation:  "member",
+			Subject:   &ssov1.Subject{Namespace: "user", ObjectId: "42"},
+		}
+	}
+
+	clubService := authn.NewContext(context.Background(), &jwtT.Claims{AppID: 1}, "club-service")
+	admin := authn.NewContext(context.Background(), &jwtT.Claims{UID: 7, AppID: 1, SessionID: "sid"}, "admin")
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		call     func(ctx context.Context) error
+		wantCode codes.Code
+	}{
+		{
+			name: "service writes own namespace",
+			ctx:  clubService,
+			call: func(ctx context.Context) error {
+				_, err := s.WriteTuples(ctx, &ssov1.WriteTuplesRequest{Tuples: []*ssov1.RelationTuple{tuple("club")}})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "service can not write other app namespace",
+			ctx:  clubService,
+			call: func(ctx context.Context) error {
+				_, err := s.WriteTuples(ctx, &ssov1.WriteTuplesRequest{Tuples: []*ssov1.RelationTuple{tuple("club"), tuple("course")}})
+				return err
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "service can not delete other app tuples",
+			ctx:  clubService,
+			call: func(ctx context.Context) error {
+				_, err := s.DeleteTuples(ctx, &ssov1.DeleteTuplesRequest{Tuples: []*ssov1.RelationTuple{tuple("course")}})
+				return err
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "service can not expand other app namespace",
+			ctx:  clubService,
+			call: func(ctx context.Context) error {
+				_, err := s.Expand(ctx, &ssov1.ExpandRequest{Namespace: "course", ObjectId: "1", Relation: "member"})
+				return err
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "service can not check other app namespace",
+			ctx:  clubService,
+			call: func(ctx context.Context) error {
+				_, err := s.Check(ctx, &ssov1.CheckRequest{Tuple: tuple("course")})
+				return err
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "namespace without owner is admin only",
+			ctx:  clubService,
+			call: func(ctx context.Context) error {
+				_, err := s.WriteTuples(ctx, &ssov1.WriteTuplesRequest{Tuples: []*ssov1.RelationTuple{tuple("shared")}})
+				return err
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "admin writes any namespace",
+			ctx:  admin,
+			call: func(ctx context.Context) error {
+				_, err := s.WriteTuples(ctx, &ssov1.WriteTuplesRequest{Tuples: []*ssov1.RelationTuple{tuple("course"), tuple("shared")}})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine.written = nil
+
+			err := tt.call(tt.ctx)
+			require.Equal(t, tt.wantCode, status.Code(err), err)
+			if tt.wantCode != codes.OK {
+				assert.Empty(t, engine.written)
+			}
+		})
+	}
+}
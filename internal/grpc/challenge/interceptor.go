@@ -0,0 +1,85 @@
+package challenge
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ключи метаданных в которых клиент присылает решенный челлендж
+const (
+	MetadataChallenge = "x-pow-challenge"
+	MetadataSolution  = "x-pow-solution"
+)
+
+// protectedMethods это ручки которые любят боты
+var protectedMethods = map[string]bool{
+	ssov1.Auth_Login_FullMethodName:    true,
+	ssov1.Auth_Register_FullMethodName: true,
+}
+
+type emailGetter interface {
+	GetEmail() string
+}
+
+// UnaryServerInterceptor считает неудачные Login и Register по IP и по email и когда
+// порог превышен требует решенный челлендж до того как запрос дойдет до обработчика
+func UnaryServerInterceptor(log *slog.Logger, guard *pow.Guard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !protectedMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		ip := clientinfo.FromContext(ctx).IP
+
+		var email string
+		if r, ok := req.(emailGetter); ok {
+			email = r.GetEmail()
+		}
+
+		if guard.Required(ip, email) {
+			if err := verify(ctx, guard, ip); err != nil {
+				log.Warn("proof-of-work challenge rejected",
+					slog.String("method", info.FullMethod),
+					slog.String("ip", ip),
+					sl.Err(err),
+				)
+
+				return nil, status.Error(codes.ResourceExhausted, "proof-of-work challenge required")
+			}
+		}
+
+		resp, err := handler(ctx, req)
+
+		switch status.Code(err) {
+		case codes.OK:
+			guard.Succeed(email)
+		case codes.Internal, codes.Unavailable:
+			// Это наши проблемы, клиента за них не наказываем
+		default:
+			guard.Fail(ip, email)
+		}
+
+		return resp, err
+	}
+}
+
+func verify(ctx context.Context, guard *pow.Guard, ip string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	challenge := md.Get(MetadataChallenge)
+	solution := md.Get(MetadataSolution)
+	if len(challenge) == 0 || len(solution) == 0 {
+		return pow.ErrInvalidChallenge
+	}
+
+	return guard.Verify(challenge[0], solution[0], ip)
+}
@@ -0,0 +1,39 @@
+package challenge
+
+import (
+	"context"
+
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type serverAPI struct {
+	ssov1.UnimplementedChallengeServer
+	issuer *pow.Issuer
+}
+
+func Register(gRPC *grpc.Server, issuer *pow.Issuer) {
+	ssov1.RegisterChallengeServer(gRPC, &serverAPI{issuer: issuer})
+}
+
+// Challenge выдает клиенту proof-of-work задачу. Решение клиент присылает в метаданных
+// следующего Login или Register (см. MetadataChallenge и MetadataSolution)
+func (s *serverAPI) Challenge(
+	ctx context.Context,
+	_ *ssov1.ChallengeRequest,
+) (*ssov1.ChallengeResponce, error) {
+	challenge, err := s.issuer.Issue(clientinfo.FromContext(ctx).IP)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ChallengeResponce{
+		Challenge:  challenge.Token,
+		Difficulty: int32(challenge.Difficulty),
+		ExpiresAt:  challenge.ExpiresAt.Unix(),
+	}, nil
+}
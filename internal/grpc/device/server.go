@@ -0,0 +1,130 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/grpc/authn"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"github.com/skinkvi/STTAuth/internal/services/oauth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const emptyValue = 0
+
+// Device это device authorization grant (RFC 8628) для клиентов без браузера
+type Device interface {
+	DeviceAuthorize(ctx context.Context, clientID string, scope string) (oauth.DeviceAuthorization, error)
+	ApproveDevice(ctx context.Context, userID int64, userCode string, approve bool) error
+	Exchange(ctx context.Context, req oauth.TokenRequest, client models.ClientInfo) (oauth.TokenResponse, error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedDeviceServer
+	device Device
+}
+
+func Register(gRPC *grpc.Server, device Device) {
+	ssov1.RegisterDeviceServer(gRPC, &serverAPI{device: device})
+}
+
+func (s *serverAPI) DeviceCode(
+	ctx context.Context,
+	req *ssov1.DeviceCodeRequest,
+) (*ssov1.DeviceCodeResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	resp, err := s.device.DeviceAuthorize(ctx, strconv.Itoa(int(req.GetAppId())), req.GetScope())
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidClient) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.DeviceCodeResponce{
+		DeviceCode:              resp.DeviceCode,
+		UserCode:                resp.UserCode,
+		VerificationUri:         resp.VerificationURI,
+		VerificationUriComplete: resp.VerificationURIComplete,
+		ExpiresIn:               resp.ExpiresIn,
+		Interval:                resp.Interval,
+	}, nil
+}
+
+func (s *serverAPI) ApproveDevice(
+	ctx context.Context,
+	req *ssov1.ApproveDeviceRequest,
+) (*ssov1.ApproveDeviceResponce, error) {
+	if req.GetUserCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_code is required")
+	}
+
+	// Какой пользователь одобряет устройство берем из контекста, токен уже проверил интерцептор authn
+	claims, err := authn.Principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IsService() {
+		return nil, status.Error(codes.PermissionDenied, "user token required")
+	}
+
+	if err := s.device.ApproveDevice(ctx, claims.UID, req.GetUserCode(), req.GetApprove()); err != nil {
+		if errors.Is(err, oauth.ErrInvalidUserCode) {
+			return nil, status.Error(codes.NotFound, "invalid or expired user code")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ApproveDeviceResponce{}, nil
+}
+
+// DeviceToken это опрос устройства. Ошибки из RFC 8628 передаются в сообщении статуса как есть
+// (authorization_pending, slow_down, access_denied, expired_token), что бы клиент мог их различить
+func (s *serverAPI) DeviceToken(
+	ctx context.Context,
+	req *ssov1.DeviceTokenRequest,
+) (*ssov1.DeviceTokenResponce, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetDeviceCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "device_code is required")
+	}
+
+	resp, err := s.device.Exchange(ctx, oauth.TokenRequest{
+		GrantType:  oauth.GrantTypeDeviceCode,
+		ClientID:   strconv.Itoa(int(req.GetAppId())),
+		DeviceCode: req.GetDeviceCode(),
+	}, clientinfo.FromContext(ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, oauth.ErrAuthorizationPending):
+			return nil, status.Error(codes.FailedPrecondition, "authorization_pending")
+		case errors.Is(err, oauth.ErrSlowDown):
+			return nil, status.Error(codes.ResourceExhausted, "slow_down")
+		case errors.Is(err, oauth.ErrAccessDenied):
+			return nil, status.Error(codes.PermissionDenied, "access_denied")
+		case errors.Is(err, oauth.ErrExpiredToken):
+			return nil, status.Error(codes.DeadlineExceeded, "expired_token")
+		case errors.Is(err, oauth.ErrInvalidGrant), errors.Is(err, oauth.ErrInvalidClient):
+			return nil, status.Error(codes.InvalidArgument, "invalid device code")
+		case errors.Is(err, auth.ErrAccountLocked), errors.Is(err, auth.ErrNotMember), errors.Is(err, auth.ErrApprovalPending),
+			errors.Is(err, auth.ErrPolicyDenied), errors.Is(err, auth.ErrAppDisabled):
+			return nil, status.Error(codes.PermissionDenied, "access_denied")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.DeviceTokenResponce{
+		Token: resp.AccessToken,
+	}, nil
+}
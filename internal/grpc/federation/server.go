@@ -0,0 +1,96 @@
+package federation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"github.com/skinkvi/STTAuth/internal/services/federation"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const emptyValue = 0
+
+type Federation interface {
+	AuthURL(ctx context.Context, provider string, appID int) (string, error)
+	Callback(ctx context.Context, provider string, state string, code string, client models.ClientInfo) (string, error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedFederationServer
+	federation Federation
+}
+
+func Register(gRPC *grpc.Server, federation Federation) {
+	ssov1.RegisterFederationServer(gRPC, &serverAPI{federation: federation})
+}
+
+func (s *serverAPI) AuthURL(
+	ctx context.Context,
+	req *ssov1.FederationAuthURLRequest,
+) (*ssov1.FederationAuthURLResponce, error) {
+	if req.GetProvider() == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	url, err := s.federation.AuthURL(ctx, req.GetProvider(), int(req.GetAppId()))
+	if err != nil {
+		if errors.Is(err, federation.ErrUnknownProvider) {
+			return nil, status.Error(codes.NotFound, "unknown provider")
+		}
+		if errors.Is(err, federation.ErrUpstream) {
+			return nil, status.Error(codes.Unavailable, "identity provider is unavailable")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.FederationAuthURLResponce{
+		Url: url,
+	}, nil
+}
+
+func (s *serverAPI) Callback(
+	ctx context.Context,
+	req *ssov1.FederationCallbackRequest,
+) (*ssov1.FederationCallbackResponce, error) {
+	if req.GetProvider() == "" || req.GetState() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider, state and code are required")
+	}
+
+	token, err := s.federation.Callback(ctx, req.GetProvider(), req.GetState(), req.GetCode(), clientinfo.FromContext(ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, federation.ErrUnknownProvider):
+			return nil, status.Error(codes.NotFound, "unknown provider")
+		case errors.Is(err, federation.ErrInvalidState):
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired state")
+		case errors.Is(err, federation.ErrEmailNotVerified):
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified by identity provider")
+		case errors.Is(err, federation.ErrUpstream):
+			return nil, status.Error(codes.Unauthenticated, "identity provider rejected the login")
+		case errors.Is(err, auth.ErrAccountLocked):
+			return nil, status.Error(codes.PermissionDenied, "account locked")
+		case errors.Is(err, auth.ErrNotMember):
+			return nil, status.Error(codes.PermissionDenied, "user is not registered in this app")
+		case errors.Is(err, auth.ErrApprovalPending):
+			return nil, status.Error(codes.FailedPrecondition, "registration is pending approval")
+		case errors.Is(err, auth.ErrPolicyDenied):
+			return nil, status.Error(codes.PermissionDenied, "access denied by app policy")
+		case errors.Is(err, auth.ErrAppDisabled):
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.FederationCallbackResponce{
+		Token: token,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/skinkvi/STTAuth/internal/services/oauth"
+)
+
+// CSRF защита формы входа по схеме double submit: один и тот же случайный токен лежит в cookie
+// и в скрытом поле формы. Чужая страница может отправить форму, но прочитать cookie не может,
+// поэтому совпадающий токен подставить не получится
+const (
+	csrfCookie     = "stt_csrf"
+	csrfField      = "csrf_token"
+	csrfTokenBytes = 32
+)
+
+// setCSRFCookie отдает токен для формы. Если в браузере уже есть cookie то используем ее,
+// иначе форма открытая в соседней вкладке перестала бы отправляться
+func setCSRFCookie(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && validCSRFToken(cookie.Value) {
+		return cookie.Value, nil
+	}
+
+	b := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     oauth.AuthorizePath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+// validCSRF сверяет токен из формы с cookie. Форму нужно разобрать заранее
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || !validCSRFToken(cookie.Value) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get(csrfField))) == 1
+}
+
+func validCSRFToken(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && len(b) == csrfTokenBytes
+}
@@ -0,0 +1,486 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/clientinfo"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"github.com/skinkvi/STTAuth/internal/services/oauth"
+)
+
+type OAuth interface {
+	ValidateAuthorize(ctx context.Context, req oauth.AuthorizeRequest) (string, error)
+	Authorize(ctx context.Context, req oauth.AuthorizeRequest, email string, password string, consent bool) (string, error)
+	Exchange(ctx context.Context, req oauth.TokenRequest, client models.ClientInfo) (oauth.TokenResponse, error)
+	DeviceAuthorize(ctx context.Context, clientID string, scope string) (oauth.DeviceAuthorization, error)
+	Discovery() oidc.Metadata
+	JWKS() oidc.JWKS
+	UserInfo(ctx context.Context, accessToken string) (oauth.UserInfo, error)
+
+	RegisterClient(ctx context.Context, initialAccessToken string, metadata oauth.ClientMetadata) (oauth.RegisteredClient, error)
+	ClientConfiguration(ctx context.Context, clientID string, registrationToken string) (oauth.RegisteredClient, error)
+	UpdateClient(ctx context.Context, clientID string, registrationToken string, metadata oauth.ClientMetadata) (oauth.RegisteredClient, error)
+	DeleteClient(ctx context.Context, clientID string, registrationToken string) error
+}
+
+type handlers struct {
+	oauth OAuth
+	// guard тот же что у gRPC Login, форма входа считается такой же попыткой входа
+	guard *pow.Guard
+}
+
+func Register(mux *http.ServeMux, oauthService OAuth, guard *pow.Guard) {
+	h := &handlers{oauth: oauthService, guard: guard}
+
+	mux.HandleFunc("GET "+oauth.AuthorizePath, h.authorizeForm)
+	mux.HandleFunc("POST "+oauth.AuthorizePath, h.authorize)
+	mux.HandleFunc("POST "+oauth.TokenPath, h.token)
+	mux.HandleFunc("POST "+oauth.DeviceAuthorizationPath, h.deviceAuthorization)
+
+	mux.HandleFunc("GET "+oidc.DiscoveryPath, h.discovery)
+	mux.HandleFunc("GET "+oauth.JWKSPath, h.jwks)
+	mux.HandleFunc("GET "+oauth.UserInfoPath, h.userInfo)
+	mux.HandleFunc("POST "+oauth.UserInfoPath, h.userInfo)
+
+	mux.HandleFunc("POST "+oauth.RegistrationPath, h.registerClient)
+	mux.HandleFunc("GET "+oauth.RegistrationPath+"/{client_id}", h.clientConfiguration)
+	mux.HandleFunc("PUT "+oauth.RegistrationPath+"/{client_id}", h.updateClient)
+	mux.HandleFunc("DELETE "+oauth.RegistrationPath+"/{client_id}", h.deleteClient)
+}
+
+// Коды ошибок из RFC 6749
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errInvalidScope            = "invalid_scope"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errAccessDenied            = "access_denied"
+	errServerError             = "server_error"
+
+	// Из RFC 8628
+	errAuthorizationPending = "authorization_pending"
+	errSlowDown             = "slow_down"
+	errExpiredToken         = "expired_token"
+
+	// Из RFC 6750
+	errInvalidToken = "invalid_token"
+
+	// Из RFC 7591
+	errInvalidRedirectURI    = "invalid_redirect_uri"
+	errInvalidClientMetadata = "invalid_client_metadata"
+)
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<form method="post" action="/authorize">
+{{range $key, $value := .Params}}<input type="hidden" name="{{$key}}" value="{{$value}}">
+{{end}}<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}<input type="email" name="email" value="{{.Email}}" placeholder="Email" required autofocus>
+<input type="password" name="password" placeholder="Password" required>
+{{if .Scopes}}<p>The application requests access to:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<label><input type="checkbox" name="consent" value="1"> Allow</label>
+{{end}}<button type="submit">Sign in</button>
+{{with .Challenge}}<input type="hidden" name="pow_challenge" value="{{.Token}}" data-difficulty="{{.Difficulty}}">
+<input type="hidden" name="pow_solution" value="">
+<script>
+(async function () {
+	var challenge = document.querySelector('input[name="pow_challenge"]');
+	var solution = document.querySelector('input[name="pow_solution"]');
+	var button = document.querySelector('button[type="submit"]');
+	var difficulty = Number(challenge.dataset.difficulty);
+	var encoder = new TextEncoder();
+
+	function zeroBits(sum) {
+		var zeros = 0;
+		for (var i = 0; i < sum.length; i++) {
+			if (sum[i] !== 0) {
+				return zeros + Math.clz32(sum[i]) - 24;
+			}
+			zeros += 8;
+		}
+		return zeros;
+	}
+
+	button.disabled = true;
+	for (var n = 0; ; n++) {
+		var sum = new Uint8Array(await crypto.subtle.digest("SHA-256", encoder.encode(challenge.value + ":" + n)));
+		if (zeroBits(sum) >= difficulty) {
+			solution.value = String(n);
+			break;
+		}
+	}
+	button.disabled = false;
+})();
+</script>
+{{end}}</form>
+</body>
+</html>
+`))
+
+func authorizeRequest(values url.Values) oauth.AuthorizeRequest {
+	return oauth.AuthorizeRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		Nonce:               values.Get("nonce"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// authorizeForm проверяет параметры и показывает форму входа. Параметры запроса
+// передаются дальше через скрытые поля формы
+func (h *handlers) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest(r.URL.Query())
+
+	redirectURI, err := h.oauth.ValidateAuthorize(r.Context(), req)
+	if err != nil {
+		h.authorizeError(w, r, req, redirectURI, err)
+		return
+	}
+
+	h.renderLogin(w, r, http.StatusOK, req, "", "")
+}
+
+// authorize принимает форму входа. До проверки пароля идут те же защиты что у gRPC Login:
+// CSRF токен формы и челлендж после серии неудач с этого IP или для этого email
+func (h *handlers) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	req := authorizeRequest(r.PostForm)
+	email := r.PostForm.Get("email")
+	ip := clientinfo.FromRequest(r).IP
+
+	if !validCSRF(r) {
+		h.renderLogin(w, r, http.StatusForbidden, req, email, "The form has expired, please try again")
+		return
+	}
+
+	if h.guard.Required(ip, email) {
+		if err := h.guard.Verify(r.PostForm.Get("pow_challenge"), r.PostForm.Get("pow_solution"), ip); err != nil {
+			h.renderLogin(w, r, http.StatusTooManyRequests, req, email, "Too many failed attempts, complete the check and try again")
+			return
+		}
+	}
+
+	consent := r.PostForm.Get("consent") != ""
+
+	location, err := h.oauth.Authorize(r.Context(), req, email, r.PostForm.Get("password"), consent)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			h.guard.Fail(ip, email)
+			h.renderLogin(w, r, http.StatusUnauthorized, req, email, "Invalid email or password")
+			return
+		}
+		if errors.Is(err, auth.ErrAccountNotLinked) {
+			h.renderLogin(w, r, http.StatusForbidden, req, email, "Ask an administrator to link your account to the directory")
+			return
+		}
+		// Согласие спрашиваем на той же форме, пароль при этом придется ввести еще раз
+		if errors.Is(err, auth.ErrConsentRequired) {
+			h.renderLogin(w, r, http.StatusOK, req, email, "Allow access to continue")
+			return
+		}
+
+		redirectURI, _ := h.oauth.ValidateAuthorize(r.Context(), req)
+		h.authorizeError(w, r, req, redirectURI, err)
+		return
+	}
+
+	h.guard.Succeed(email)
+
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// authorizeError отправляет ошибку клиенту через redirect_uri. Если не понятно кто клиент
+// или redirect_uri не зарегистрирован, то редиректить нельзя, показываем ошибку прямо тут
+func (h *handlers) authorizeError(w http.ResponseWriter, r *http.Request, req oauth.AuthorizeRequest, redirectURI string, err error) {
+	if redirectURI == "" || errors.Is(err, oauth.ErrInvalidClient) || errors.Is(err, oauth.ErrInvalidRedirectURI) {
+		http.Error(w, "invalid client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := errServerError
+	switch {
+	case errors.Is(err, oauth.ErrUnsupportedResponseType):
+		code = errUnsupportedResponseType
+	case errors.Is(err, oauth.ErrInvalidRequest):
+		code = errInvalidRequest
+	case errors.Is(err, oauth.ErrInvalidScope), errors.Is(err, auth.ErrInvalidScope):
+		code = errInvalidScope
+	case errors.Is(err, auth.ErrAccountLocked), errors.Is(err, auth.ErrNotMember), errors.Is(err, auth.ErrApprovalPending),
+		errors.Is(err, auth.ErrPolicyDenied), errors.Is(err, auth.ErrAppDisabled):
+		code = errAccessDenied
+	}
+
+	http.Redirect(w, r, oauth.RedirectURL(redirectURI, url.Values{
+		"error": {code},
+		"state": {req.State},
+	}), http.StatusFound)
+}
+
+func (h *handlers) renderLogin(w http.ResponseWriter, r *http.Request, status int, req oauth.AuthorizeRequest, email string, errMsg string) {
+	csrfToken, err := setCSRFCookie(w, r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var challenge *pow.Challenge
+	if ip := clientinfo.FromRequest(r).IP; h.guard.Required(ip, email) {
+		c, err := h.guard.Issue(ip)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		challenge = &c
+	}
+
+	// Форму с паролем нельзя встраивать в чужие страницы
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = loginPage.Execute(w, struct {
+		Params    map[string]string
+		Scopes    []string
+		Email     string
+		Error     string
+		CSRFToken string
+		Challenge *pow.Challenge
+	}{
+		Params: map[string]string{
+			"client_id":             req.ClientID,
+			"redirect_uri":          req.RedirectURI,
+			"response_type":         req.ResponseType,
+			"scope":                 req.Scope,
+			"state":                 req.State,
+			"nonce":                 req.Nonce,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+		},
+		Scopes:    strings.Fields(req.Scope),
+		Email:     email,
+		Error:     errMsg,
+		CSRFToken: csrfToken,
+		Challenge: challenge,
+	})
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (h *handlers) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidRequest})
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(r)
+
+	resp, err := h.oauth.Exchange(r.Context(), oauth.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+		Scope:        r.PostForm.Get("scope"),
+	}, clientinfo.FromRequest(r))
+	if err != nil {
+		status, body := tokenError(err)
+		if status == http.StatusUnauthorized && basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		writeJSON(w, status, body)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: resp.AccessToken,
+		TokenType:   resp.TokenType,
+		ExpiresIn:   resp.ExpiresIn,
+		Scope:       resp.Scope,
+		IDToken:     resp.IDToken,
+	})
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+func (h *handlers) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidRequest})
+		return
+	}
+
+	clientID, _, _ := clientCredentials(r)
+
+	resp, err := h.oauth.DeviceAuthorize(r.Context(), clientID, r.PostForm.Get("scope"))
+	if err != nil {
+		status, body := tokenError(err)
+		writeJSON(w, status, body)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              resp.DeviceCode,
+		UserCode:                resp.UserCode,
+		VerificationURI:         resp.VerificationURI,
+		VerificationURIComplete: resp.VerificationURIComplete,
+		ExpiresIn:               resp.ExpiresIn,
+		Interval:                resp.Interval,
+	})
+}
+
+func (h *handlers) discovery(w http.ResponseWriter, r *http.Request) {
+	writePublicJSON(w, h.oauth.Discovery())
+}
+
+func (h *handlers) jwks(w http.ResponseWriter, r *http.Request) {
+	writePublicJSON(w, h.oauth.JWKS())
+}
+
+type userInfoResponse struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// userInfo принимает access токен в заголовке Authorization или в форме (RFC 6750)
+func (h *handlers) userInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok && r.Method == http.MethodPost {
+		token = r.PostFormValue("access_token")
+	}
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: errInvalidRequest})
+		return
+	}
+
+	info, err := h.oauth.UserInfo(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo", error="invalid_token"`)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: errInvalidToken})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: errServerError})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userInfoResponse{
+		Subject:           info.Subject,
+		Email:             info.Email,
+		PreferredUsername: info.PreferredUsername,
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// clientCredentials достает client_id и client_secret из Basic авторизации или из формы.
+// В Basic они дополнительно закодированы как в форме, см. RFC 6749 2.3.1
+func clientCredentials(r *http.Request) (string, string, bool) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+	}
+
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+
+	return id, secret, true
+}
+
+func tokenError(err error) (int, errorResponse) {
+	switch {
+	case errors.Is(err, oauth.ErrUnsupportedGrantType):
+		return http.StatusBadRequest, errorResponse{Error: errUnsupportedGrantType}
+	case errors.Is(err, oauth.ErrInvalidRequest):
+		return http.StatusBadRequest, errorResponse{Error: errInvalidRequest, ErrorDescription: "code and code_verifier are required"}
+	case errors.Is(err, oauth.ErrInvalidClient), errors.Is(err, auth.ErrInvalidClient):
+		return http.StatusUnauthorized, errorResponse{Error: errInvalidClient}
+	case errors.Is(err, auth.ErrInvalidScope), errors.Is(err, oauth.ErrInvalidScope):
+		return http.StatusBadRequest, errorResponse{Error: errInvalidScope}
+	case errors.Is(err, oauth.ErrAuthorizationPending):
+		return http.StatusBadRequest, errorResponse{Error: errAuthorizationPending}
+	case errors.Is(err, oauth.ErrSlowDown):
+		return http.StatusBadRequest, errorResponse{Error: errSlowDown}
+	case errors.Is(err, oauth.ErrAccessDenied):
+		return http.StatusBadRequest, errorResponse{Error: errAccessDenied}
+	case errors.Is(err, oauth.ErrExpiredToken):
+		return http.StatusBadRequest, errorResponse{Error: errExpiredToken}
+	case errors.Is(err, oauth.ErrInvalidGrant):
+		return http.StatusBadRequest, errorResponse{Error: errInvalidGrant}
+	case errors.Is(err, auth.ErrAccountLocked), errors.Is(err, auth.ErrNotMember), errors.Is(err, auth.ErrApprovalPending),
+		errors.Is(err, auth.ErrPolicyDenied), errors.Is(err, auth.ErrAppDisabled):
+		return http.StatusBadRequest, errorResponse{Error: errInvalidGrant, ErrorDescription: "user is not allowed in this app"}
+	default:
+		return http.StatusInternalServerError, errorResponse{Error: errServerError}
+	}
+}
+
+// writePublicJSON для документов которые одинаковы для всех и их можно кешировать
+func writePublicJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	// RFC 6749 требует что бы ответы с токенами не кешировались
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
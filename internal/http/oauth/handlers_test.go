@@ -0,0 +1,438 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/lib/pow"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"github.com/skinkvi/STTAuth/internal/services/oauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOAuth struct {
+	validateErr error
+}
+
+func (f *fakeOAuth) ValidateAuthorize(_ context.Context, req oauth.AuthorizeRequest) (string, error) {
+	if req.ClientID != "1" {
+		return "", oauth.ErrInvalidClient
+	}
+	return "https://game.example.com/callback", f.validateErr
+}
+
+func (f *fakeOAuth) Authorize(ctx context.Context, req oauth.AuthorizeRequest, email string, password string, consent bool) (string, error) {
+	if _, err := f.ValidateAuthorize(ctx, req); err != nil {
+		return "", err
+	}
+	if password != "secret" {
+		return "", auth.ErrInvalidCredentials
+	}
+	if req.Scope != "" && !consent {
+		return "", auth.ErrConsentRequired
+	}
+	return "https://game.example.com/callback?code=abc&state=" + req.State, nil
+}
+
+func (f *fakeOAuth) Exchange(_ context.Context, req oauth.TokenRequest, _ models.ClientInfo) (oauth.TokenResponse, error) {
+	if req.GrantType == oauth.GrantTypeClient {
+		if req.ClientID != "1" || req.ClientSecret != "s3cr:t" {
+			return oauth.TokenResponse{}, auth.ErrInvalidClient
+		}
+		return oauth.TokenResponse{AccessToken: "service", TokenType: oauth.TokenTypeBearer}, nil
+	}
+	if req.Code != "abc" {
+		return oauth.TokenResponse{}, oauth.ErrInvalidGrant
+	}
+	return oauth.TokenResponse{AccessToken: "token", TokenType: oauth.TokenTypeBearer, ExpiresIn: 3600}, nil
+}
+
+func (f *fakeOAuth) DeviceAuthorize(_ context.Context, clientID string, _ string) (oauth.DeviceAuthorization, error) {
+	if clientID != "1" {
+		return oauth.DeviceAuthorization{}, oauth.ErrInvalidClient
+	}
+	return oauth.DeviceAuthorization{DeviceCode: "device", UserCode: "BCDF-GHJK", Interval: 5}, nil
+}
+
+func (f *fakeOAuth) Discovery() oidc.Metadata {
+	return oidc.Metadata{Issuer: "https://sso.example.com"}
+}
+
+func (f *fakeOAuth) JWKS() oidc.JWKS { return oidc.JWKS{} }
+
+func (f *fakeOAuth) UserInfo(_ context.Context, accessToken string) (oauth.UserInfo, error) {
+	if accessToken != "token" {
+		return oauth.UserInfo{}, oauth.ErrInvalidToken
+	}
+	return oauth.UserInfo{Subject: "7", Email: "alice@example.com"}, nil
+}
+
+func (f *fakeOAuth) RegisterClient(_ context.Context, initialAccessToken string, metadata oauth.ClientMetadata) (oauth.RegisteredClient, error) {
+	if initialAccessToken != "initial" {
+		return oauth.RegisteredClient{}, oauth.ErrInvalidToken
+	}
+	if len(metadata.RedirectURIs) == 0 {
+		return oauth.RegisteredClient{}, fmt.Errorf("oauth.RegisterClient: %w: redirect_uris are required", oauth.ErrInvalidClientRedirectURI)
+	}
+	return oauth.RegisteredClient{
+		ClientMetadata:          metadata,
+		ClientID:                "42",
+		ClientSecret:            "secret",
+		RegistrationAccessToken: "registration",
+	}, nil
+}
+
+func (f *fakeOAuth) ClientConfiguration(_ context.Context, clientID string, registrationToken string) (oauth.RegisteredClient, error) {
+	if clientID != "42" || registrationToken != "registration" {
+		return oauth.RegisteredClient{}, oauth.ErrInvalidToken
+	}
+	return oauth.RegisteredClient{ClientID: clientID}, nil
+}
+
+func (f *fakeOAuth) UpdateClient(ctx context.Context, clientID string, registrationToken string, _ oauth.ClientMetadata) (oauth.RegisteredClient, error) {
+	return f.ClientConfiguration(ctx, clientID, registrationToken)
+}
+
+func (f *fakeOAuth) DeleteClient(ctx context.Context, clientID string, registrationToken string) error {
+	_, err := f.ClientConfiguration(ctx, clientID, registrationToken)
+	return err
+}
+
+func newServer(t *testing.T, f *fakeOAuth) *http.ServeMux {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	Register(mux, f, pow.NewGuard(pow.NewIssuer("test-secret", 4, time.Minute), pow.NewFailureCounter(time.Minute), pow.Thresholds{
+		IP:      100,
+		Account: 2,
+	}))
+	return mux
+}
+
+// testCSRFToken подходит по формату, сам handler только сверяет cookie с полем формы
+var testCSRFToken = base64.RawURLEncoding.EncodeToString(make([]byte, csrfTokenBytes))
+
+func postAuthorize(mux *http.ServeMux, form url.Values) *httptest.ResponseRecorder {
+	form.Set(csrfField, testCSRFToken)
+	req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthorizeForm(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?client_id=1&state=%22%3E%3Cscript%3E", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	assert.Contains(t, rec.Body.String(), `name="client_id" value="1"`)
+	assert.NotContains(t, rec.Body.String(), "<script>")
+}
+
+func TestAuthorizeForm_Errors(t *testing.T) {
+	t.Run("unknown client is not redirected", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newServer(t, &fakeOAuth{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?client_id=2", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("invalid request is redirected to client", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newServer(t, &fakeOAuth{validateErr: oauth.ErrInvalidRequest}).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?client_id=1&state=xyz", nil))
+
+		require.Equal(t, http.StatusFound, rec.Code)
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "invalid_request", location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	post := func(password string) *httptest.ResponseRecorder {
+		return postAuthorize(mux, url.Values{"client_id": {"1"}, "state": {"xyz"}, "email": {"alice@example.com"}, "password": {password}})
+	}
+
+	rec := post("wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Invalid email or password")
+
+	rec = post("secret")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://game.example.com/callback?code=abc&state=xyz", rec.Header().Get("Location"))
+}
+
+func TestAuthorize_Consent(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	post := func(consent string) *httptest.ResponseRecorder {
+		form := url.Values{"client_id": {"1"}, "scope": {"openid email"}, "email": {"alice@example.com"}, "password": {"secret"}}
+		if consent != "" {
+			form.Set("consent", consent)
+		}
+		return postAuthorize(mux, form)
+	}
+
+	rec := post("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<li>email</li>")
+	assert.Contains(t, rec.Body.String(), `name="consent"`)
+
+	rec = post("1")
+	assert.Equal(t, http.StatusFound, rec.Code)
+}
+
+func TestAuthorize_CSRF(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?client_id=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, csrfCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+	assert.Contains(t, rec.Body.String(), `name="csrf_token" value="`+cookies[0].Value+`"`)
+
+	post := func(cookie string, field string) *httptest.ResponseRecorder {
+		form := url.Values{"client_id": {"1"}, "email": {"alice@example.com"}, "password": {"secret"}, csrfField: {field}}
+		req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: csrfCookie, Value: cookie})
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("missing cookie", func(t *testing.T) {
+		rec := post("", cookies[0].Value)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		// Форма показывается заново с новым токеном, пароль при этом не проверялся
+		assert.Len(t, rec.Result().Cookies(), 1)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("token mismatch", func(t *testing.T) {
+		rec := post(cookies[0].Value, testCSRFToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("matching token", func(t *testing.T) {
+		rec := post(cookies[0].Value, cookies[0].Value)
+		assert.Equal(t, http.StatusFound, rec.Code)
+	})
+}
+
+func TestAuthorize_Challenge(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+	challengeField := regexp.MustCompile(`name="pow_challenge" value="([^"]+)" data-difficulty="(\d+)"`)
+
+	post := func(password string, challenge string, solution string) *httptest.ResponseRecorder {
+		return postAuthorize(mux, url.Values{
+			"client_id":     {"1"},
+			"email":         {"alice@example.com"},
+			"password":      {password},
+			"pow_challenge": {challenge},
+			"pow_solution":  {solution},
+		})
+	}
+
+	rec := post("wrong", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "pow_challenge")
+
+	// После второй неудачи для этого email форма приходит уже с челленджем
+	rec = post("wrong", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Regexp(t, challengeField, rec.Body.String())
+
+	rec = post("secret", "", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	match := challengeField.FindStringSubmatch(rec.Body.String())
+	require.Len(t, match, 3)
+	difficulty, err := strconv.Atoi(match[2])
+	require.NoError(t, err)
+
+	rec = post("secret", match[1], "not-a-solution")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	rec = post("secret", match[1], pow.Solve(match[1], difficulty))
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	// Успешный вход сбрасывает счетчик аккаунта
+	rec = post("wrong", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "pow_challenge")
+}
+
+func TestToken(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	exchange := func(code string) (*httptest.ResponseRecorder, map[string]any) {
+		form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"1"}, "code": {code}}
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec, body
+	}
+
+	rec, body := exchange("abc")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "token", body["access_token"])
+	assert.Equal(t, "Bearer", body["token_type"])
+
+	rec, body = exchange("other")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestToken_ClientCredentials(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	exchange := func(secret string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("1", url.QueryEscape(secret))
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := exchange("s3cr:t")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"access_token":"service"`)
+
+	rec = exchange("wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, rec.Body.String(), `"error":"invalid_client"`)
+}
+
+func TestUserInfo(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	get := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("Bearer token")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"sub":"7","email":"alice@example.com"}`, rec.Body.String())
+
+	rec = get("Bearer expired")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	rec = get("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestDiscovery(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newServer(t, &fakeOAuth{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"issuer":"https://sso.example.com"`)
+}
+
+func TestRegisterClient(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	register := func(token string, body string) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec, resp
+	}
+
+	rec, body := register("initial", `{"client_name":"arcade","redirect_uris":["https://arcade.example.com/cb"]}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "42", body["client_id"])
+	assert.Equal(t, "secret", body["client_secret"])
+	assert.Equal(t, float64(0), body["client_secret_expires_at"])
+	assert.Equal(t, "registration", body["registration_access_token"])
+
+	rec, body = register("initial", `{"client_name":"arcade"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_redirect_uri", body["error"])
+	assert.Equal(t, "redirect_uris are required", body["error_description"])
+
+	rec, body = register("initial", `not json`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_client_metadata", body["error"])
+
+	rec, _ = register("", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestClientConfiguration(t *testing.T) {
+	mux := newServer(t, &fakeOAuth{})
+
+	do := func(method string, clientID string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/register/"+clientID, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "42", "registration").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "42", "registration").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "42", "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "1", "registration").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "42", "registration").Code)
+}
@@ -0,0 +1,157 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/services/oauth"
+)
+
+// Максимальный размер метаданных клиента, больше нормальному клиенту не нужно
+const maxMetadataBytes = 64 << 10
+
+type clientMetadataRequest struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope"`
+}
+
+type clientRegistrationResponse struct {
+	ClientID         string `json:"client_id"`
+	ClientSecret     string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt int64  `json:"client_id_issued_at"`
+	// 0 значит что секрет не истекает, поле обязательно если секрет выдан
+	ClientSecretExpiresAt   *int64   `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string   `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string   `json:"registration_client_uri"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope,omitempty"`
+}
+
+func (h *handlers) registerClient(w http.ResponseWriter, r *http.Request) {
+	metadata, ok := readClientMetadata(w, r)
+	if !ok {
+		return
+	}
+
+	token, _ := bearerToken(r)
+
+	client, err := h.oauth.RegisterClient(r.Context(), token, metadata)
+	if err != nil {
+		registrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, registrationResponse(client))
+}
+
+func (h *handlers) clientConfiguration(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	client, err := h.oauth.ClientConfiguration(r.Context(), r.PathValue("client_id"), token)
+	if err != nil {
+		registrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, registrationResponse(client))
+}
+
+func (h *handlers) updateClient(w http.ResponseWriter, r *http.Request) {
+	metadata, ok := readClientMetadata(w, r)
+	if !ok {
+		return
+	}
+
+	token, _ := bearerToken(r)
+
+	client, err := h.oauth.UpdateClient(r.Context(), r.PathValue("client_id"), token, metadata)
+	if err != nil {
+		registrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, registrationResponse(client))
+}
+
+func (h *handlers) deleteClient(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	if err := h.oauth.DeleteClient(r.Context(), r.PathValue("client_id"), token); err != nil {
+		registrationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readClientMetadata(w http.ResponseWriter, r *http.Request) (oauth.ClientMetadata, bool) {
+	var req clientMetadataRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMetadataBytes)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidClientMetadata, ErrorDescription: "request body must be a JSON object"})
+		return oauth.ClientMetadata{}, false
+	}
+
+	return oauth.ClientMetadata{
+		ClientName:              req.ClientName,
+		RedirectURIs:            req.RedirectURIs,
+		GrantTypes:              req.GrantTypes,
+		ResponseTypes:           req.ResponseTypes,
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+		Scope:                   req.Scope,
+	}, true
+}
+
+func registrationResponse(client oauth.RegisteredClient) clientRegistrationResponse {
+	resp := clientRegistrationResponse{
+		ClientID:                client.ClientID,
+		ClientSecret:            client.ClientSecret,
+		ClientIDIssuedAt:        client.ClientIDIssuedAt,
+		RegistrationAccessToken: client.RegistrationAccessToken,
+		RegistrationClientURI:   client.RegistrationClientURI,
+		ClientName:              client.ClientName,
+		RedirectURIs:            client.RedirectURIs,
+		GrantTypes:              client.GrantTypes,
+		ResponseTypes:           client.ResponseTypes,
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		Scope:                   client.Scope,
+	}
+	if client.ClientSecret != "" {
+		var never int64
+		resp.ClientSecretExpiresAt = &never
+	}
+
+	return resp
+}
+
+func registrationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, oauth.ErrInvalidClientRedirectURI):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidRedirectURI, ErrorDescription: errorDescription(err, oauth.ErrInvalidClientRedirectURI)})
+	case errors.Is(err, oauth.ErrInvalidClientMetadata):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidClientMetadata, ErrorDescription: errorDescription(err, oauth.ErrInvalidClientMetadata)})
+	case errors.Is(err, oauth.ErrInvalidToken):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="register", error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: errInvalidToken})
+	case errors.Is(err, oauth.ErrRegistrationDisabled):
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: errAccessDenied, ErrorDescription: "client registration is disabled"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: errServerError})
+	}
+}
+
+// errorDescription достает из ошибки пояснение которое сервис дописал после sentinel ошибки
+func errorDescription(err error, sentinel error) string {
+	_, description, _ := strings.Cut(err.Error(), sentinel.Error()+": ")
+	return description
+}
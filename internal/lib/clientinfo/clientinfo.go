@@ -0,0 +1,178 @@
+package clientinfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type infoKey struct{}
+
+// Proxies это reverse proxy перед сервисом, например nginx. Заголовки которые проставляет прокси
+// принимаются только если запрос пришел с его адреса, иначе их мог бы подставить сам клиент.
+// Прокси должен дописывать адрес клиента в X-Forwarded-For или перезаписывать X-Real-IP
+type Proxies struct {
+	trusted       []netip.Prefix
+	countryHeader string
+}
+
+// NewProxies разбирает CIDR доверенных прокси. countryHeader это заголовок в котором прокси
+// передает страну клиента, пустой значит что страну не передают
+func NewProxies(cidrs []string, countryHeader string) (*Proxies, error) {
+	p := &Proxies{countryHeader: strings.ToLower(countryHeader)}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		p.trusted = append(p.trusted, prefix.Masked())
+	}
+	return p, nil
+}
+
+// UnaryServerInterceptor один раз собирает ClientInfo и кладет в контекст, дальше его отдает FromContext.
+// Должен стоять первым, до интерцепторов которым нужен адрес клиента
+func (p *Proxies) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		info := peerInfo(ctx)
+		if p.trustedAddr(info.IP) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if p.countryHeader != "" {
+				if values := md.Get(p.countryHeader); len(values) > 0 {
+					info.Country = normalizeCountry(values[0])
+				}
+			}
+			if ip := p.forwardedIP(md.Get("x-forwarded-for"), md.Get("x-real-ip")); ip != "" {
+				info.IP = ip
+			}
+		}
+
+		return handler(context.WithValue(ctx, infoKey{}, info), req)
+	}
+}
+
+// Middleware то же самое для HTTP
+func (p *Proxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := requestInfo(r)
+		if p.trustedAddr(info.IP) {
+			if p.countryHeader != "" {
+				info.Country = normalizeCountry(r.Header.Get(p.countryHeader))
+			}
+			if ip := p.forwardedIP(r.Header.Values("X-Forwarded-For"), r.Header.Values("X-Real-IP")); ip != "" {
+				info.IP = ip
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), infoKey{}, info)))
+	})
+}
+
+// forwardedIP достает адрес клиента из заголовков прокси. X-Forwarded-For идем справа налево и берем
+// первый адрес не из доверенных сетей: левее него значения мог написать сам клиент. Если X-Forwarded-For
+// нет, берем X-Real-IP. Пустая строка значит что адреса в заголовках нет или он не разбирается
+func (p *Proxies) forwardedIP(forwardedFor []string, realIP []string) string {
+	var hops []string
+	for _, value := range forwardedFor {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return ""
+		}
+		addr = addr.Unmap()
+		if i == 0 || !p.trustedAddr(addr.String()) {
+			return addr.String()
+		}
+	}
+
+	if len(realIP) > 0 {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(realIP[0])); err == nil {
+			return addr.Unmap().String()
+		}
+	}
+	return ""
+}
+
+func (p *Proxies) trustedAddr(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range p.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromContext достает из контекста gRPC запроса то что нам известно о клиенте
+func FromContext(ctx context.Context) models.ClientInfo {
+	if info, ok := ctx.Value(infoKey{}).(models.ClientInfo); ok {
+		return info
+	}
+	return peerInfo(ctx)
+}
+
+// FromRequest то же самое для HTTP запроса. X-Forwarded-For и X-Real-IP учитываются только через
+// Proxies.Middleware и только от доверенного прокси, сами по себе их может подставить кто угодно
+func FromRequest(r *http.Request) models.ClientInfo {
+	if info, ok := r.Context().Value(infoKey{}).(models.ClientInfo); ok {
+		return info
+	}
+	return requestInfo(r)
+}
+
+func peerInfo(ctx context.Context) models.ClientInfo {
+	var info models.ClientInfo
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ua := md.Get("user-agent"); len(ua) > 0 {
+		info.UserAgent = ua[0]
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		info.IP = host
+	}
+
+	return info
+}
+
+func requestInfo(r *http.Request) models.ClientInfo {
+	info := models.ClientInfo{UserAgent: r.UserAgent()}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	info.IP = host
+
+	return info
+}
+
+// normalizeCountry приводит код к виду "RU". Все что не похоже на код страны отбрасываем,
+// GeoIP модули отдают "-" или пустую строку когда страну не нашли
+func normalizeCountry(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if len(value) != 2 || value[0] < 'A' || value[0] > 'Z' || value[1] < 'A' || value[1] > 'Z' {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,97 @@
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func grpcInfo(t *testing.T, p *Proxies, peerAddr string, md metadata.MD) models.ClientInfo {
+	t.Helper()
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerAddr), Port: 5000}})
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	var info models.ClientInfo
+	_, err := p.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		info = FromContext(ctx)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	return info
+}
+
+func TestProxies_Country(t *testing.T) {
+	p, err := NewProxies([]string{"10.0.0.0/8"}, "X-Country-Code")
+	require.NoError(t, err)
+
+	info := grpcInfo(t, p, "10.1.2.3", metadata.Pairs("x-country-code", "ru", "user-agent", "game/1.0"))
+	assert.Equal(t, "RU", info.Country)
+	assert.Equal(t, "10.1.2.3", info.IP)
+	assert.Equal(t, "game/1.0", info.UserAgent)
+
+	info = grpcInfo(t, p, "203.0.113.7", metadata.Pairs("x-country-code", "RU"))
+	assert.Empty(t, info.Country, "header from untrusted peer is ignored")
+
+	info = grpcInfo(t, p, "10.1.2.3", metadata.Pairs("x-country-code", "--"))
+	assert.Empty(t, info.Country)
+
+	var got models.ClientInfo
+	handler := p.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/authorize", nil)
+	r.RemoteAddr = "10.9.9.9:4000"
+	r.Header.Set("X-Country-Code", "DE")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "DE", got.Country)
+}
+
+func TestProxies_ForwardedIP(t *testing.T) {
+	p, err := NewProxies([]string{"10.0.0.0/8"}, "")
+	require.NoError(t, err)
+
+	info := grpcInfo(t, p, "10.1.2.3", metadata.Pairs("x-forwarded-for", "1.1.1.1, 203.0.113.7, 10.0.0.5"))
+	assert.Equal(t, "203.0.113.7", info.IP, "rightmost untrusted hop, the left part is written by the client")
+
+	info = grpcInfo(t, p, "10.1.2.3", metadata.Pairs("x-real-ip", "203.0.113.8"))
+	assert.Equal(t, "203.0.113.8", info.IP)
+
+	info = grpcInfo(t, p, "10.1.2.3", metadata.Pairs("x-forwarded-for", "not-an-ip"))
+	assert.Equal(t, "10.1.2.3", info.IP)
+
+	info = grpcInfo(t, p, "198.51.100.1", metadata.Pairs("x-forwarded-for", "203.0.113.7", "x-real-ip", "203.0.113.8"))
+	assert.Equal(t, "198.51.100.1", info.IP, "headers from untrusted peer are ignored")
+
+	var got models.ClientInfo
+	handler := p.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/authorize", nil)
+	r.RemoteAddr = "10.9.9.9:4000"
+	r.Header.Add("X-Forwarded-For", "1.1.1.1")
+	r.Header.Add("X-Forwarded-For", "203.0.113.9")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "203.0.113.9", got.IP)
+
+	r = httptest.NewRequest(http.MethodGet, "/authorize", nil)
+	r.RemoteAddr = "198.51.100.1:4000"
+	r.Header.Set("X-Real-IP", "203.0.113.9")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "198.51.100.1", got.IP)
+}
+
+func TestNewProxies_InvalidCIDR(t *testing.T) {
+	_, err := NewProxies([]string{"10.0.0.0/33"}, "")
+	assert.Error(t, err)
+}
@@ -1,30 +1,113 @@
 package jwtT
 
 import (
-	"STTAuth/internal/domain/models"
+	"crypto/rsa"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/pkg/sttauth/sttjwt"
 )
 
 const (
-	UIDKey   = "uid"
-	EmailKey = "email"
-	ExpKey   = "exp"
-	AppIDKey = "app_id"
+	UIDKey       = sttjwt.UIDKey
+	EmailKey     = sttjwt.EmailKey
+	ExpKey       = sttjwt.ExpKey
+	IssuedAtKey  = sttjwt.IssuedAtKey
+	AppIDKey     = sttjwt.AppIDKey
+	SessionIDKey = sttjwt.SessionIDKey
+	ScopeKey     = sttjwt.ScopeKey
+	RolesKey     = sttjwt.RolesKey
+	OrgIDKey     = sttjwt.OrgIDKey
 )
 
+var ErrInvalidToken = sttjwt.ErrInvalidToken
+
+// Claims это то что мы достаем из токена после проверки подписи
+type Claims struct {
+	// UID пустой у сервисных токенов, их получает само приложение а не пользователь
+	UID       int64
+	Email     string
+	AppID     int
+	SessionID string
+	Scopes    []string
+	// Roles это имена ролей пользователя в приложении на момент выдачи токена
+	Roles []string
+	// OrgID это организация от имени которой пользователь работает, 0 если ее нет
+	OrgID     int64
+	ExpiresAt time.Time
+	// IssuedAt пустой у токенов выпущенных до того как в них появился iat
+	IssuedAt time.Time
+	// APIKeyID не 0 если запрос пришел с личным API ключом а не с JWT. Такие claims собирает
+	// сервис после поиска ключа в базе, в самом JWT этого поля нет
+	APIKeyID int64
+}
+
+// IsService говорит что токен выдан приложению через client credentials, без пользователя
+func (c *Claims) IsService() bool {
+	return c.UID == 0
+}
+
+// Option добавляет в токен дополнительные claims
+type Option func(claims jwt.MapClaims)
+
+func WithSessionID(sessionID string) Option {
+	return func(claims jwt.MapClaims) {
+		claims[SessionIDKey] = sessionID
+	}
+}
+
+func WithScopes(scopes []string) Option {
+	return func(claims jwt.MapClaims) {
+		claims[ScopeKey] = strings.Join(scopes, " ")
+	}
+}
+
+func WithRoles(roles []string) Option {
+	return func(claims jwt.MapClaims) {
+		claims[RolesKey] = roles
+	}
+}
+
+func WithOrgID(orgID int64) Option {
+	return func(claims jwt.MapClaims) {
+		claims[OrgIDKey] = orgID
+	}
+}
+
+// WithExpiresAt задает конец срока жизни явно. Нужен когда токен перевыпускается без входа
+// и не должен жить дольше того из которого получен
+func WithExpiresAt(expiresAt time.Time) Option {
+	return func(claims jwt.MapClaims) {
+		claims[ExpKey] = expiresAt.Unix()
+	}
+}
+
+// WithoutEmail убирает email из токена, если пользователь не давал приложению scope email
+func WithoutEmail() Option {
+	return func(claims jwt.MapClaims) {
+		delete(claims, EmailKey)
+	}
+}
+
 // Эта модель имеет риск быть логированной а в ней мы передаем секрет так что
 // TODO: Нужно что то сделать с тем как прятать секрет что бы не спалить его в логах
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
+func NewToken(user models.User, app models.App, duration time.Duration, opts ...Option) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
 	claims[UIDKey] = user.ID
 	claims[EmailKey] = user.Email
-	claims[ExpKey] = time.Now().Add(duration).Unix()
+	now := time.Now()
+	claims[ExpKey] = now.Add(duration).Unix()
+	claims[IssuedAtKey] = now.Unix()
 	claims[AppIDKey] = app.ID
 
+	for _, opt := range opts {
+		opt(claims)
+	}
+
 	tokenString, err := token.SignedString([]byte(app.Secret))
 	if err != nil {
 		return "", err
@@ -32,3 +115,87 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 
 	return tokenString, nil
 }
+
+// NewServiceToken выдает токен самому приложению. uid и email в нем нет, только app_id и scope
+func NewServiceToken(app models.App, duration time.Duration, scopes []string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		AppIDKey: app.ID,
+		ExpKey:   time.Now().Add(duration).Unix(),
+		ScopeKey: strings.Join(scopes, " "),
+	})
+
+	return token.SignedString([]byte(app.Secret))
+}
+
+// ParseToken проверяет подпись и срок жизни токена. Токен подписан секретом приложения
+// поэтому сначала достаем app_id без проверки а потом через secretFunc получаем секрет
+func ParseToken(tokenString string, secretFunc func(appID int) (string, error)) (*Claims, error) {
+	return ParseTokenWithSecrets(tokenString, func(appID int) ([]string, error) {
+		secret, err := secretFunc(appID)
+		if err != nil {
+			return nil, err
+		}
+		return []string{secret}, nil
+	})
+}
+
+// ParseTokenWithSecrets то же самое что ParseToken, но у приложения может быть несколько
+// действующих секретов, например во время ротации. Сам разбор живет в pkg/sttauth/sttjwt,
+// им же проверяют токены сервисы
+func ParseTokenWithSecrets(tokenString string, secretsFunc func(appID int) ([]string, error)) (*Claims, error) {
+	claims, err := sttjwt.Parse(tokenString, secretsFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		UID:       claims.UID,
+		Email:     claims.Email,
+		AppID:     claims.AppID,
+		SessionID: claims.SessionID,
+		Scopes:    claims.Scopes,
+		Roles:     claims.Roles,
+		OrgID:     claims.OrgID,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+	}, nil
+}
+
+// IDTokenClaims это содержимое OpenID Connect ID токена
+type IDTokenClaims struct {
+	Issuer            string
+	Subject           string
+	Audience          string
+	Nonce             string
+	AuthTime          time.Time
+	ExpiresAt         time.Time
+	Email             string
+	PreferredUsername string
+}
+
+// NewIDToken подписывает ID токен RSA ключом. В отличие от access токенов его проверяют
+// сторонние клиенты, у которых нет секрета приложения, поэтому тут асимметричная подпись
+func NewIDToken(key *rsa.PrivateKey, keyID string, c IDTokenClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       c.Issuer,
+		"sub":       c.Subject,
+		"aud":       c.Audience,
+		"iat":       time.Now().Unix(),
+		ExpKey:      c.ExpiresAt.Unix(),
+		"auth_time": c.AuthTime.Unix(),
+	}
+	if c.Nonce != "" {
+		claims["nonce"] = c.Nonce
+	}
+	if c.Email != "" {
+		claims[EmailKey] = c.Email
+	}
+	if c.PreferredUsername != "" {
+		claims["preferred_username"] = c.PreferredUsername
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+
+	return token.SignedString(key)
+}
@@ -1,12 +1,12 @@
 package jwtT
 
 import (
-	"STTAuth/internal/domain/models"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +43,74 @@ func TestNewToken(t *testing.T) {
 	assert.NotZero(t, claims[ExpKey])
 	assert.Equal(t, float64(app.ID), claims[AppIDKey])
 }
+
+func TestParseToken(t *testing.T) {
+	user := models.User{
+		ID:    1,
+		Email: "test_user_email@example.com",
+	}
+
+	app := models.App{
+		ID:     1,
+		Secret: "test_app_secret",
+	}
+
+	tokenString, err := NewToken(user, app, time.Hour, WithSessionID("session-id"))
+	assert.NoError(t, err)
+
+	secretFunc := func(appID int) (string, error) {
+		assert.Equal(t, app.ID, appID)
+		return app.Secret, nil
+	}
+
+	claims, err := ParseToken(tokenString, secretFunc)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UID)
+	assert.Equal(t, user.Email, claims.Email)
+	assert.Equal(t, app.ID, claims.AppID)
+	assert.Equal(t, "session-id", claims.SessionID)
+
+	_, err = ParseToken(tokenString, func(int) (string, error) { return "wrong_secret", nil })
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := NewToken(user, app, -time.Minute)
+	assert.NoError(t, err)
+
+	_, err = ParseToken(expired, secretFunc)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseTokenWithSecrets(t *testing.T) {
+	user := models.User{ID: 1, Email: "test_user_email@example.com"}
+	oldApp := models.App{ID: 1, Secret: "old_secret"}
+
+	tokenString, err := NewToken(user, oldApp, time.Hour)
+	assert.NoError(t, err)
+
+	claims, err := ParseTokenWithSecrets(tokenString, func(int) ([]string, error) {
+		return []string{"new_secret", "old_secret"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UID)
+
+	_, err = ParseTokenWithSecrets(tokenString, func(int) ([]string, error) {
+		return []string{"new_secret"}, nil
+	})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestServiceToken(t *testing.T) {
+	app := models.App{
+		ID:     2,
+		Secret: "test_app_secret",
+	}
+
+	tokenString, err := NewServiceToken(app, time.Hour, []string{"leaderboard:write", "matches:read"})
+	assert.NoError(t, err)
+
+	claims, err := ParseToken(tokenString, func(int) (string, error) { return app.Secret, nil })
+	assert.NoError(t, err)
+	assert.True(t, claims.IsService())
+	assert.Equal(t, app.ID, claims.AppID)
+	assert.Equal(t, []string{"leaderboard:write", "matches:read"}, claims.Scopes)
+}
@@ -0,0 +1,172 @@
+// Package ldapauth проверяет логин и пароль в LDAP / Active Directory. Схема классическая:
+// сервисной учеткой ищем пользователя по email, потом биндимся его DN и паролем
+package ldapauth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+const (
+	defaultUserFilter     = "(mail=%s)"
+	defaultEmailAttribute = "mail"
+	defaultGroupAttribute = "memberOf"
+	dialTimeout           = 5 * time.Second
+)
+
+type Config struct {
+	// Name это имя каталога из конфига, по нему пользователи каталога привязываются к нашим аккаунтам
+	Name         string
+	URL          string
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter это фильтр поиска пользователя, %s заменяется на экранированный email
+	UserFilter     string
+	EmailAttribute string
+	GroupAttribute string
+	// GroupRoles сопоставляет DN группы с именем роли у нас. Сравнение без учета регистра
+	GroupRoles map[string]string
+}
+
+// User это то что мы узнали о пользователе из каталога
+type User struct {
+	DN    string
+	Email string
+	Roles []string
+}
+
+type Authenticator struct {
+	cfg Config
+}
+
+func New(cfg Config) *Authenticator {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = defaultUserFilter
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = defaultEmailAttribute
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = defaultGroupAttribute
+	}
+
+	return &Authenticator{cfg: cfg}
+}
+
+func (a *Authenticator) Name() string {
+	return a.cfg.Name
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, email string, password string) (User, error) {
+	const op = "ldapauth.Authenticate"
+
+	// Пустой пароль в LDAP это unauthenticated bind, который многие серверы считают успешным
+	if password == "" {
+		return User{}, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+		return User{}, fmt.Errorf("%s: service bind: %w", op, err)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, 0, false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(email)),
+		[]string{a.cfg.EmailAttribute, a.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return User{}, ErrInvalidCredentials
+		}
+		return User{}, fmt.Errorf("%s: search: %w", op, err)
+	}
+
+	// Ноль или несколько совпадений одинаково плохо, угадывать кого имели в виду не будем
+	if len(result.Entries) != 1 {
+		return User{}, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return User{}, ErrInvalidCredentials
+		}
+		return User{}, fmt.Errorf("%s: user bind: %w", op, err)
+	}
+
+	user := User{
+		DN:    entry.DN,
+		Email: entry.GetAttributeValue(a.cfg.EmailAttribute),
+		Roles: a.roles(entry.GetAttributeValues(a.cfg.GroupAttribute)),
+	}
+	if user.Email == "" {
+		user.Email = email
+	}
+
+	return user, nil
+}
+
+func (a *Authenticator) roles(groups []string) []string {
+	var roles []string
+	seen := make(map[string]bool)
+
+	for _, group := range groups {
+		for groupDN, role := range a.cfg.GroupRoles {
+			if strings.EqualFold(group, groupDN) && !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return roles
+}
+
+func (a *Authenticator) dial(ctx context.Context) (*ldap.Conn, error) {
+	timeout := dialTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			timeout = left
+		}
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(a.cfg.URL, "ldap://"), "ldaps://")
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,105 @@
+package ldapauth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/lib/ldapauth"
+	"github.com/skinkvi/STTAuth/internal/lib/ldapauth/ldaptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	serviceDN = "cn=sso,ou=services,dc=example,dc=com"
+	adminsDN  = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+func newDirectory(t *testing.T) *ldaptest.Server {
+	t.Helper()
+
+	return ldaptest.NewServer(t,
+		ldaptest.Entry{DN: serviceDN, Password: "service-secret"},
+		ldaptest.Entry{
+			DN:       "uid=alice,ou=people,dc=example,dc=com",
+			Password: "alice-pass",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"mail":        {"alice@example.com"},
+				"memberOf":    {"CN=Admins,OU=Groups,DC=example,DC=com", "cn=devs,ou=groups,dc=example,dc=com"},
+			},
+		},
+		ldaptest.Entry{
+			DN:       "uid=bob,ou=people,dc=example,dc=com",
+			Password: "bob-pass",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"mail":        {"bob@example.com"},
+			},
+		},
+	)
+}
+
+func newAuthenticator(url string) *ldapauth.Authenticator {
+	return ldapauth.New(ldapauth.Config{
+		URL:          url,
+		BindDN:       serviceDN,
+		BindPassword: "service-secret",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		UserFilter:   "(&(objectClass=person)(mail=%s))",
+		GroupRoles:   map[string]string{adminsDN: "admin"},
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	srv := newDirectory(t)
+	a := newAuthenticator(srv.URL())
+
+	user, err := a.Authenticate(context.Background(), "alice@example.com", "alice-pass")
+	require.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=example,dc=com", user.DN)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Equal(t, []string{"admin"}, user.Roles)
+
+	user, err = a.Authenticate(context.Background(), "bob@example.com", "bob-pass")
+	require.NoError(t, err)
+	assert.Empty(t, user.Roles)
+}
+
+func TestAuthenticate_InvalidCredentials(t *testing.T) {
+	srv := newDirectory(t)
+	a := newAuthenticator(srv.URL())
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "wrong password", email: "alice@example.com", password: "bob-pass"},
+		{name: "unknown user", email: "carol@example.com", password: "alice-pass"},
+		{name: "empty password", email: "alice@example.com", password: ""},
+		{name: "filter injection", email: "*", password: "alice-pass"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Authenticate(context.Background(), tt.email, tt.password)
+			assert.ErrorIs(t, err, ldapauth.ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestAuthenticate_ServiceBindFails(t *testing.T) {
+	srv := newDirectory(t)
+	a := ldapauth.New(ldapauth.Config{
+		URL:          srv.URL(),
+		BindDN:       serviceDN,
+		BindPassword: "wrong",
+		BaseDN:       "ou=people,dc=example,dc=com",
+	})
+
+	_, err := a.Authenticate(context.Background(), "alice@example.com", "alice-pass")
+	require.Error(t, err)
+	// Сломанная сервисная учетка это ошибка конфигурации, а не неверный пароль пользователя
+	assert.NotErrorIs(t, err, ldapauth.ErrInvalidCredentials)
+}
@@ -0,0 +1,297 @@
+// Package ldaptest поднимает в процессе минимальный LDAP сервер для тестов. Он умеет только
+// simple bind, поиск по дереву с фильтрами and/or/not/равенство/присутствие и unbind,
+// этого хватает что бы прогнать ldapauth без настоящего каталога
+package ldaptest
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry это запись каталога. Password нужен для bind, в атрибутах он не отдается
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+type Server struct {
+	listener net.Listener
+
+	mu      sync.RWMutex
+	entries []Entry
+	wg      sync.WaitGroup
+}
+
+// NewServer запускает сервер на случайном порту и останавливает его в конце теста
+func NewServer(t *testing.T, entries ...Entry) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ldaptest: listen: %v", err)
+	}
+
+	s := &Server{listener: listener, entries: entries}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+
+	return s
+}
+
+// URL это адрес для ldap.DialURL
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *Server) AddEntry(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	bound := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op)
+			bound = code == ldap.LDAPResultSuccess && bindName(op) != ""
+			write(conn, messageID, result(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			for _, entry := range s.search(op) {
+				write(conn, messageID, entry)
+			}
+			write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		default:
+			// StartTLS и прочие расширения не поддерживаем
+			write(conn, messageID, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+		}
+	}
+}
+
+func bindName(op *ber.Packet) string {
+	if len(op.Children) < 3 {
+		return ""
+	}
+	name, _ := op.Children[1].Value.(string)
+	return name
+}
+
+func (s *Server) bind(op *ber.Packet) uint16 {
+	if len(op.Children) < 3 {
+		return ldap.LDAPResultProtocolError
+	}
+
+	name := bindName(op)
+	password := op.Children[2].Data.String()
+
+	// Анонимный bind разрешаем, но искать после него нельзя
+	if name == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, name) {
+			if entry.Password != "" && entry.Password == password {
+				return ldap.LDAPResultSuccess
+			}
+			break
+		}
+	}
+
+	return ldap.LDAPResultInvalidCredentials
+}
+
+func (s *Server) search(op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return nil
+	}
+
+	baseDN, _ := op.Children[0].Value.(string)
+	filter := op.Children[6]
+
+	var requested []string
+	for _, attr := range op.Children[7].Children {
+		if name, ok := attr.Value.(string); ok {
+			requested = append(requested, name)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found []*ber.Packet
+	for _, entry := range s.entries {
+		if !inBase(entry.DN, baseDN) || !match(filter, entry) {
+			continue
+		}
+		found = append(found, encodeEntry(entry, requested))
+	}
+
+	return found
+}
+
+func inBase(dn string, baseDN string) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+	return baseDN == "" || dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+}
+
+func match(filter *ber.Packet, entry Entry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !match(child, entry) {
+				return false
+			}
+		}
+		return true
+
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if match(child, entry) {
+				return true
+			}
+		}
+		return false
+
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !match(filter.Children[0], entry)
+
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for _, v := range attribute(entry, name) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+
+	case ldap.FilterPresent:
+		return len(attribute(entry, filter.Data.String())) > 0
+
+	default:
+		return false
+	}
+}
+
+func attribute(entry Entry, name string) []string {
+	for attr, values := range entry.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func encodeEntry(entry Entry, requested []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		if !wanted(name, requested) {
+			continue
+		}
+
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+
+	return op
+}
+
+func wanted(name string, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, r := range requested {
+		if r == "*" || strings.EqualFold(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return op
+}
+
+func write(conn net.Conn, messageID interface{}, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+
+	_, _ = conn.Write(packet.Bytes())
+}
@@ -49,13 +49,14 @@ func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
 	fields := make(map[string]interface{}, r.NumAttrs())
 
 	r.Attrs(func(a slog.Attr) bool {
-		fields[a.Key] = a.Value.Any()
+		// Resolve вызывает LogValue, без него значения с LogValuer (например конфиг) уйдут в лог как есть
+		fields[a.Key] = a.Value.Resolve().Any()
 
 		return true
 	})
 
 	for _, a := range h.attrs {
-		fields[a.Key] = a.Value.Any()
+		fields[a.Key] = a.Value.Resolve().Any()
 	}
 
 	var b []byte
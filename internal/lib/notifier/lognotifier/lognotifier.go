@@ -0,0 +1,53 @@
+package lognotifier
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/notifier"
+)
+
+// Notifier ничего никуда не отправляет а просто пишет уведомление в лог. Подходит для локальной разработки
+type Notifier struct {
+	log       *slog.Logger
+	lockURL   string
+	inviteURL string
+}
+
+func New(log *slog.Logger, lockURL string, inviteURL string) *Notifier {
+	return &Notifier{
+		log:       log,
+		lockURL:   lockURL,
+		inviteURL: inviteURL,
+	}
+}
+
+func (n *Notifier) NewDeviceLogin(_ context.Context, alert models.LoginAlert) error {
+	n.log.Info("new device login notification",
+		slog.Int64("user_id", alert.UserID),
+		slog.String("app", alert.AppName),
+		slog.String("ip", alert.IP),
+		slog.String("user_agent", alert.UserAgent),
+		slog.String("lock_link", notifier.LockLink(n.lockURL, alert.LockToken)),
+	)
+
+	return nil
+}
+
+func (n *Notifier) RegistrationAttempt(_ context.Context, email string) error {
+	n.log.Info("registration attempt notification", slog.String("email", email))
+
+	return nil
+}
+
+func (n *Notifier) OrgInvitation(_ context.Context, invite models.OrgInvite) error {
+	n.log.Info("organization invitation notification",
+		slog.String("email", invite.Email),
+		slog.String("org", invite.OrgName),
+		slog.String("role", invite.Role),
+		slog.String("invite_link", notifier.InviteLink(n.inviteURL, invite.Token)),
+	)
+
+	return nil
+}
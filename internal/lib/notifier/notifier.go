@@ -0,0 +1,28 @@
+package notifier
+
+import (
+	"net/url"
+)
+
+// LockLink собирает ссылку "это был не я" из базового адреса и токена блокировки
+func LockLink(lockURL string, lockToken string) string {
+	return tokenLink(lockURL, lockToken)
+}
+
+// InviteLink собирает ссылку для принятия приглашения в организацию
+func InviteLink(inviteURL string, inviteToken string) string {
+	return tokenLink(inviteURL, inviteToken)
+}
+
+func tokenLink(base string, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
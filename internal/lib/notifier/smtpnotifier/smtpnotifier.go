@@ -0,0 +1,163 @@
+package smtpnotifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/notifier"
+)
+
+type Config struct {
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	From      string
+	LockURL   string
+	InviteURL string
+}
+
+type Notifier struct {
+	cfg Config
+}
+
+func New(cfg Config) *Notifier {
+	return &Notifier{cfg: cfg}
+}
+
+var newDeviceTmpl = template.Must(template.New("new_device").Parse(`From: {{.From}}
+To: {{.To}}
+Subject: New sign-in to your SpeedTyping account
+Content-Type: text/plain; charset=UTF-8
+
+We noticed a new sign-in to your account{{if .App}} in {{.App}}{{end}}.
+
+Time:    {{.At}}
+IP:      {{.IP}}
+Device:  {{.UserAgent}}
+
+If this was you, you can ignore this email.
+If this wasn't you, lock your account right away:
+
+{{.LockLink}}
+`))
+
+var registrationAttemptTmpl = template.Must(template.New("registration_attempt").Parse(`From: {{.From}}
+To: {{.To}}
+Subject: Someone tried to create a SpeedTyping account with your email
+Content-Type: text/plain; charset=UTF-8
+
+Someone just tried to sign up using this email address, but you already have an account.
+
+If this was you, just sign in with your existing password.
+If this wasn't you, you can ignore this email. Nothing has changed in your account.
+`))
+
+var orgInvitationTmpl = template.Must(template.New("org_invitation").Parse(`From: {{.From}}
+To: {{.To}}
+Subject: You are invited to join {{.Org}} on SpeedTyping
+Content-Type: text/plain; charset=UTF-8
+
+You have been invited to join {{.Org}} as {{.Role}}.
+
+To accept the invitation, sign in with this email and open the link below:
+
+{{.InviteLink}}
+
+The invitation expires on {{.ExpiresAt}}. If you don't know what this is about, you can ignore this email.
+`))
+
+func (n *Notifier) NewDeviceLogin(ctx context.Context, alert models.LoginAlert) error {
+	const op = "notifier.smtp.NewDeviceLogin"
+
+	var body bytes.Buffer
+	err := newDeviceTmpl.Execute(&body, map[string]string{
+		"From":      n.cfg.From,
+		"To":        alert.Email,
+		"App":       alert.AppName,
+		"At":        alert.At.UTC().Format(time.RFC1123),
+		"IP":        alert.IP,
+		"UserAgent": alert.UserAgent,
+		"LockLink":  notifier.LockLink(n.cfg.LockURL, alert.LockToken),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := n.send(ctx, alert.Email, body.Bytes()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (n *Notifier) RegistrationAttempt(ctx context.Context, email string) error {
+	const op = "notifier.smtp.RegistrationAttempt"
+
+	var body bytes.Buffer
+	err := registrationAttemptTmpl.Execute(&body, map[string]string{
+		"From": n.cfg.From,
+		"To":   email,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := n.send(ctx, email, body.Bytes()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (n *Notifier) OrgInvitation(ctx context.Context, invite models.OrgInvite) error {
+	const op = "notifier.smtp.OrgInvitation"
+
+	var body bytes.Buffer
+	err := orgInvitationTmpl.Execute(&body, map[string]string{
+		"From":       n.cfg.From,
+		"To":         invite.Email,
+		"Org":        invite.OrgName,
+		"Role":       invite.Role,
+		"InviteLink": notifier.InviteLink(n.cfg.InviteURL, invite.Token),
+		"ExpiresAt":  invite.ExpiresAt.UTC().Format(time.RFC1123),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := n.send(ctx, invite.Email, body.Bytes()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// send это smtp.SendMail но с учетом контекста: если письмо не ушло за отведенное время то бросаем
+func (n *Notifier) send(ctx context.Context, to string, msg []byte) error {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, n.cfg.From, []string{to}, msg)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// IDToken это claims из ID токена которые нам нужны для связывания аккаунтов
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Client ходит в одного внешнего провайдера. Metadata получаем лениво при первом обращении
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *RemoteKeySet
+}
+
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		cfg:  cfg,
+		http: httpClient,
+	}
+}
+
+// init делает discovery один раз. Если провайдер лежал то попробуем снова при следующем запросе
+func (c *Client) init(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata != nil {
+		return nil
+	}
+
+	metadata, err := Discover(ctx, c.http, c.cfg.Issuer)
+	if err != nil {
+		return err
+	}
+
+	c.metadata = metadata
+	c.keys = NewRemoteKeySet(c.http, metadata.JWKSURI)
+
+	return nil
+}
+
+// AuthCodeURL это адрес куда нужно отправить браузер пользователя. codeVerifier это PKCE
+// verifier, в запрос уходит только его S256 хеш
+func (c *Client) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	if err := c.init(ctx); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(c.metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.cfg.ClientID)
+	q.Set("redirect_uri", c.cfg.RedirectURL)
+	q.Set("scope", strings.Join(c.scopes(), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", S256Challenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func (c *Client) Exchange(ctx context.Context, code string, codeVerifier string) (*TokenResponse, error) {
+	const op = "oidc.Client.Exchange"
+
+	if err := c.init(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	var token TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%s: %w: no id_token in response", op, ErrInvalidIDToken)
+	}
+
+	return &token, nil
+}
+
+// VerifyIDToken проверяет подпись по JWKS провайдера, iss, aud, exp и nonce
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IDToken, error) {
+	const op = "oidc.Client.VerifyIDToken"
+
+	if err := c.init(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(c.metadata.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%s: %w: nonce mismatch", op, ErrInvalidIDToken)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%s: %w: empty subject", op, ErrInvalidIDToken)
+	}
+
+	idToken := &IDToken{
+		Issuer:  c.metadata.Issuer,
+		Subject: subject,
+	}
+	idToken.Email, _ = claims["email"].(string)
+	idToken.EmailVerified, _ = claims["email_verified"].(bool)
+	idToken.Name, _ = claims["name"].(string)
+
+	return idToken, nil
+}
+
+func (c *Client) scopes() []string {
+	if len(c.cfg.Scopes) > 0 {
+		return c.cfg.Scopes
+	}
+	return []string{"openid", "email", "profile"}
+}
+
+// S256Challenge считает PKCE code_challenge по методу S256
+func S256Challenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+const (
+	// costLimit ограничивает сколько работы может сделать одно выражение, что бы политика
+	// с огромным циклом по списку не съела процессор на каждом входе
+	costLimit = 10000
+	// maxPrograms это сколько скомпилированных программ держим в памяти. Ключ кеша это текст
+	// выражения, а DryRunPolicy компилирует любой присланный текст, так что без предела кеш рос бы бесконечно
+	maxPrograms = 1000
+)
+
+var ErrInvalidExpression = errors.New("invalid policy expression")
+
+// Input это атрибуты которые видит выражение: user, app, request и now.
+// В выражении они доступны как user.email, user.email_verified, app.id, request.ip, request.country,
+// now.getHours("Europe/Moscow")
+type Input struct {
+	User    map[string]any
+	App     map[string]any
+	Request map[string]any
+	Now     time.Time
+}
+
+// Engine компилирует CEL выражения и держит скомпилированные программы,
+// одна и та же политика проверяется на каждом входе и компилировать ее каждый раз дорого.
+// Программ храним не больше limit, давно не нужные вытесняются первыми
+type Engine struct {
+	env   *cel.Env
+	limit int
+
+	mu       sync.Mutex
+	programs map[string]*list.Element
+	// recent это выражения от последнего использованного к самому давнему
+	recent *list.List
+}
+
+type cachedProgram struct {
+	expression string
+	program    cel.Program
+}
+
+func NewEngine() (*Engine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("app", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		env:      env,
+		limit:    maxPrograms,
+		programs: make(map[string]*list.Element),
+		recent:   list.New(),
+	}, nil
+}
+
+// Compile проверяет выражение и запоминает программу. Выражение должно давать bool
+func (e *Engine) Compile(expression string) error {
+	_, err := e.program(expression)
+	return err
+}
+
+// Eval выполняет выражение. Ошибка выполнения (нет такого атрибута, превышен лимит)
+// возвращается как есть, что с ней делать решает вызывающий
+func (e *Engine) Eval(expression string, input Input) (bool, error) {
+	prg, err := e.program(expression)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := prg.Eval(map[string]any{
+		"user":    input.User,
+		"app":     input.App,
+		"request": input.Request,
+		"now":     input.Now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s instead of bool", out.Type().TypeName())
+	}
+
+	return result, nil
+}
+
+func (e *Engine) program(expression string) (cel.Program, error) {
+	if prg, ok := e.cached(expression); ok {
+		return prg, nil
+	}
+
+	ast, iss := e.env.Compile(expression)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpression, iss.Err())
+	}
+	// Атрибуты в map объявлены как dyn, поэтому dyn тоже пропускаем, тип проверится при выполнении
+	if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("%w: expression must return bool, got %s", ErrInvalidExpression, t)
+	}
+
+	prg, err := e.env.Program(ast, cel.CostLimit(costLimit))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpression, err)
+	}
+
+	e.store(expression, prg)
+
+	return prg, nil
+}
+
+func (e *Engine) cached(expression string) (cel.Program, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	elem, ok := e.programs[expression]
+	if !ok {
+		return nil, false
+	}
+	e.recent.MoveToFront(elem)
+	return elem.Value.(*cachedProgram).program, true
+}
+
+func (e *Engine) store(expression string, prg cel.Program) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Пока компилировали, то же выражение мог положить другой запрос
+	if elem, ok := e.programs[expression]; ok {
+		e.recent.MoveToFront(elem)
+		return
+	}
+
+	e.programs[expression] = e.recent.PushFront(&cachedProgram{expression: expression, program: prg})
+
+	for e.recent.Len() > e.limit {
+		oldest := e.recent.Back()
+		e.recent.Remove(oldest)
+		delete(e.programs, oldest.Value.(*cachedProgram).expression)
+	}
+}
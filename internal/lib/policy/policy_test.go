@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_CacheIsBounded(t *testing.T) {
+	e, err := NewEngine()
+	require.NoError(t, err)
+	e.limit = 2
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, e.Compile(fmt.Sprintf("user.id == %d", i)))
+	}
+	assert.Len(t, e.programs, 2)
+	assert.Equal(t, 2, e.recent.Len())
+
+	// Недавно использованное выражение вытесняется последним
+	_, ok := e.cached("user.id == 3")
+	require.True(t, ok)
+	require.NoError(t, e.Compile("user.id == 5"))
+
+	_, ok = e.cached("user.id == 3")
+	assert.True(t, ok)
+	_, ok = e.cached("user.id == 4")
+	assert.False(t, ok)
+}
+
+func TestEngine_EvalNewAttributes(t *testing.T) {
+	e, err := NewEngine()
+	require.NoError(t, err)
+
+	ok, err := e.Eval(`user.email_verified && request.country == "RU"`, Input{
+		User:    map[string]any{"email_verified": true},
+		Request: map[string]any{"country": "RU"},
+	})
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
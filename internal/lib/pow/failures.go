@@ -0,0 +1,69 @@
+package pow
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureCounter считает неудачные попытки по ключу (IP или email) в скользящем окне.
+// Живет в памяти процесса, при нескольких репликах у каждой свой счетчик
+type FailureCounter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*failureEntry
+}
+
+type failureEntry struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewFailureCounter(window time.Duration) *FailureCounter {
+	return &FailureCounter{
+		window:  window,
+		entries: make(map[string]*failureEntry),
+	}
+}
+
+func (c *FailureCounter) Fail(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.resetAt) {
+		c.cleanup(now)
+
+		entry = &failureEntry{resetAt: now.Add(c.window)}
+		c.entries[key] = entry
+	}
+	entry.count++
+}
+
+func (c *FailureCounter) Count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.resetAt) {
+		return 0
+	}
+	return entry.count
+}
+
+func (c *FailureCounter) Reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// cleanup выкидывает протухшие записи что бы карта не росла бесконечно
+func (c *FailureCounter) cleanup(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.resetAt) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package pow
+
+import "strings"
+
+type Thresholds struct {
+	// IP это сколько неудач с одного адреса можно допустить до того как потребовать челлендж
+	IP int
+	// Account то же самое но для одного email
+	Account int
+}
+
+// Guard решает когда клиенту пора решать челлендж. Один Guard на gRPC и HTTP, иначе бот
+// просто переключался бы между ними и счетчики не доходили бы до порога
+type Guard struct {
+	issuer     *Issuer
+	failures   *FailureCounter
+	thresholds Thresholds
+}
+
+func NewGuard(issuer *Issuer, failures *FailureCounter, thresholds Thresholds) *Guard {
+	return &Guard{
+		issuer:     issuer,
+		failures:   failures,
+		thresholds: thresholds,
+	}
+}
+
+// Required говорит нужен ли челлендж для запроса с этого IP и email. email может быть пустым,
+// например когда форма входа еще только показывается
+func (g *Guard) Required(ip string, email string) bool {
+	if g.failures.Count(ipKey(ip)) >= g.thresholds.IP {
+		return true
+	}
+	return email != "" && g.failures.Count(accountKey(email)) >= g.thresholds.Account
+}
+
+func (g *Guard) Issue(ip string) (Challenge, error) {
+	return g.issuer.Issue(ip)
+}
+
+func (g *Guard) Verify(token string, solution string, ip string) error {
+	if token == "" || solution == "" {
+		return ErrInvalidChallenge
+	}
+	return g.issuer.Verify(token, solution, ip)
+}
+
+// Fail засчитывает неудачную попытку и адресу и аккаунту
+func (g *Guard) Fail(ip string, email string) {
+	g.failures.Fail(ipKey(ip))
+	if email != "" {
+		g.failures.Fail(accountKey(email))
+	}
+}
+
+// Succeed сбрасывает счетчик аккаунта. Счетчик IP не трогаем, иначе бот мог бы обнулять его
+// входя время от времени в свой аккаунт
+func (g *Guard) Succeed(email string) {
+	if email != "" {
+		g.failures.Reset(accountKey(email))
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
@@ -0,0 +1,175 @@
+// Package pow это proof-of-work челленджи которые мы выдаем клиентам после серии неудачных попыток.
+// Все что нужно для проверки лежит в самом челлендже и подписано HMAC, на сервере помним только
+// уже использованные челленджи до истечения их срока
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid challenge")
+	ErrExpiredChallenge = errors.New("challenge expired")
+	ErrInvalidSolution  = errors.New("invalid solution")
+	ErrSpentChallenge   = errors.New("challenge already used")
+)
+
+const nonceBytes = 16
+
+type Challenge struct {
+	Token      string
+	Difficulty int
+	ExpiresAt  time.Time
+}
+
+// Issuer выдает и проверяет челленджи. Difficulty это сколько ведущих нулевых бит должно быть
+// в sha256(token + ":" + solution), каждый бит в среднем удваивает работу клиента
+type Issuer struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	spent map[string]time.Time
+}
+
+func NewIssuer(secret string, difficulty int, ttl time.Duration) *Issuer {
+	return &Issuer{
+		secret:     []byte(secret),
+		difficulty: difficulty,
+		ttl:        ttl,
+		spent:      make(map[string]time.Time),
+	}
+}
+
+// Issue выдает челлендж привязанный к subject (например IP клиента). Сам subject в токен
+// не попадает, он только участвует в подписи, поэтому решенный челлендж нельзя отдать другому клиенту
+func (i *Issuer) Issue(subject string) (Challenge, error) {
+	nonce := make([]byte, nonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, err
+	}
+
+	expiresAt := time.Now().Add(i.ttl)
+
+	payload := strings.Join([]string{
+		hex.EncodeToString(nonce),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		strconv.Itoa(i.difficulty),
+	}, ".")
+
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(i.sign(payload, subject))
+
+	return Challenge{
+		Token:      token,
+		Difficulty: i.difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify проверяет подпись, срок жизни и само решение. Каждый челлендж проходит один раз, повторно
+// присланный отклоняется с ErrSpentChallenge. Использованные челленджи живут в памяти процесса,
+// при нескольких репликах у каждой свой список
+func (i *Issuer) Verify(token string, solution string, subject string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return ErrInvalidChallenge
+	}
+
+	payload := strings.Join(parts[:3], ".")
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil || !hmac.Equal(mac, i.sign(payload, subject)) {
+		return ErrInvalidChallenge
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	if time.Now().Unix() > expiresAt {
+		return ErrExpiredChallenge
+	}
+
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+
+	if leadingZeroBits(token, solution) < difficulty {
+		return ErrInvalidSolution
+	}
+
+	// Срок проверяется с точностью до секунды, поэтому держим запись на секунду дольше
+	return i.spend(parts[0], time.Unix(expiresAt+1, 0))
+}
+
+// spend запоминает nonce до истечения челленджа. После истечения его отклонит проверка срока,
+// так что запись можно выкинуть
+func (i *Issuer) spend(nonce string, expiresAt time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := i.spent[nonce]; ok && !now.After(until) {
+		return ErrSpentChallenge
+	}
+
+	i.cleanup(now)
+	i.spent[nonce] = expiresAt
+
+	return nil
+}
+
+// cleanup выкидывает протухшие записи что бы карта не росла бесконечно
+func (i *Issuer) cleanup(now time.Time) {
+	for nonce, until := range i.spent {
+		if now.After(until) {
+			delete(i.spent, nonce)
+		}
+	}
+}
+
+func (i *Issuer) sign(payload string, subject string) []byte {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(subject))
+	return mac.Sum(nil)
+}
+
+// Solve перебирает решения пока не найдет подходящее. Это то что должен делать клиент,
+// на сервере используется только в тестах
+func Solve(token string, difficulty int) string {
+	for n := uint64(0); ; n++ {
+		solution := strconv.FormatUint(n, 10)
+		if leadingZeroBits(token, solution) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func leadingZeroBits(token string, solution string) int {
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+
+	zeros := 0
+	for i := 0; i < len(sum); i += 8 {
+		word := binary.BigEndian.Uint64(sum[i : i+8])
+		if word != 0 {
+			return zeros + bits.LeadingZeros64(word)
+		}
+		zeros += 64
+	}
+	return zeros
+}
@@ -0,0 +1,116 @@
+package pow
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuer_IssueVerify(t *testing.T) {
+	issuer := NewIssuer("test-secret", 8, time.Minute)
+
+	challenge, err := issuer.Issue("127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 8, challenge.Difficulty)
+
+	solution := Solve(challenge.Token, challenge.Difficulty)
+
+	assert.NoError(t, issuer.Verify(challenge.Token, solution, "127.0.0.1"))
+
+	// Челлендж привязан к клиенту которому его выдали
+	assert.ErrorIs(t, issuer.Verify(challenge.Token, solution, "10.0.0.1"), ErrInvalidChallenge)
+
+	// Другой секрет значит подпись не сойдется
+	other := NewIssuer("other-secret", 8, time.Minute)
+	assert.ErrorIs(t, other.Verify(challenge.Token, solution, "127.0.0.1"), ErrInvalidChallenge)
+
+	assert.ErrorIs(t, issuer.Verify("garbage", solution, "127.0.0.1"), ErrInvalidChallenge)
+}
+
+func TestIssuer_Replay(t *testing.T) {
+	issuer := NewIssuer("test-secret", 4, time.Minute)
+
+	challenge, err := issuer.Issue("127.0.0.1")
+	require.NoError(t, err)
+
+	solution := Solve(challenge.Token, challenge.Difficulty)
+	require.NoError(t, issuer.Verify(challenge.Token, solution, "127.0.0.1"))
+	assert.ErrorIs(t, issuer.Verify(challenge.Token, solution, "127.0.0.1"), ErrSpentChallenge)
+
+	// Другое решение того же челленджа тоже не проходит
+	var other string
+	for n := 0; other == ""; n++ {
+		candidate := strconv.Itoa(n)
+		if candidate != solution && leadingZeroBits(challenge.Token, candidate) >= challenge.Difficulty {
+			other = candidate
+		}
+	}
+	assert.ErrorIs(t, issuer.Verify(challenge.Token, other, "127.0.0.1"), ErrSpentChallenge)
+
+	next, err := issuer.Issue("127.0.0.1")
+	require.NoError(t, err)
+	assert.NoError(t, issuer.Verify(next.Token, Solve(next.Token, next.Difficulty), "127.0.0.1"))
+}
+
+func TestIssuer_InvalidSolution(t *testing.T) {
+	issuer := NewIssuer("test-secret", 16, time.Minute)
+
+	challenge, err := issuer.Issue("127.0.0.1")
+	require.NoError(t, err)
+
+	for n := 0; ; n++ {
+		candidate := strconv.Itoa(n)
+		if leadingZeroBits(challenge.Token, candidate) < challenge.Difficulty {
+			assert.ErrorIs(t, issuer.Verify(challenge.Token, candidate, "127.0.0.1"), ErrInvalidSolution)
+			break
+		}
+	}
+}
+
+func TestIssuer_Expired(t *testing.T) {
+	issuer := NewIssuer("test-secret", 1, -time.Second)
+
+	challenge, err := issuer.Issue("127.0.0.1")
+	require.NoError(t, err)
+
+	solution := Solve(challenge.Token, challenge.Difficulty)
+	assert.ErrorIs(t, issuer.Verify(challenge.Token, solution, "127.0.0.1"), ErrExpiredChallenge)
+}
+
+func TestFailureCounter(t *testing.T) {
+	counter := NewFailureCounter(time.Minute)
+
+	counter.Fail("ip:127.0.0.1")
+	counter.Fail("ip:127.0.0.1")
+	assert.Equal(t, 2, counter.Count("ip:127.0.0.1"))
+	assert.Equal(t, 0, counter.Count("ip:10.0.0.1"))
+
+	counter.Reset("ip:127.0.0.1")
+	assert.Equal(t, 0, counter.Count("ip:127.0.0.1"))
+}
+
+func TestGuard(t *testing.T) {
+	guard := NewGuard(NewIssuer("test-secret", 4, time.Minute), NewFailureCounter(time.Minute), Thresholds{IP: 3, Account: 2})
+
+	assert.False(t, guard.Required("10.0.0.1", "alice@example.com"))
+
+	guard.Fail("10.0.0.1", "Alice@example.com")
+	guard.Fail("10.0.0.2", "alice@example.com")
+	assert.True(t, guard.Required("10.0.0.3", "alice@example.com"), "account counter is shared between addresses")
+	assert.False(t, guard.Required("10.0.0.3", "bob@example.com"))
+
+	guard.Succeed("alice@example.com")
+	assert.False(t, guard.Required("10.0.0.1", "alice@example.com"))
+
+	guard.Fail("10.0.0.1", "")
+	guard.Fail("10.0.0.1", "")
+	assert.True(t, guard.Required("10.0.0.1", ""), "ip counter survives successful logins")
+
+	challenge, err := guard.Issue("10.0.0.1")
+	require.NoError(t, err)
+	assert.ErrorIs(t, guard.Verify(challenge.Token, "", "10.0.0.1"), ErrInvalidChallenge)
+	assert.NoError(t, guard.Verify(challenge.Token, Solve(challenge.Token, challenge.Difficulty), "10.0.0.1"))
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const (
+	// apiKeyPrefix отличает API ключ от JWT, по нему VerifyToken понимает что токен надо искать в базе
+	apiKeyPrefix      = "stt_"
+	apiKeyIDBytes     = 4
+	apiKeySecretBytes = 32
+	maxAPIKeyName     = 64
+	maxAPIKeysPerUser = 20
+	defaultAPIKeyTTL  = 90 * 24 * time.Hour
+	maxAPIKeyTTL      = 365 * 24 * time.Hour
+)
+
+// APIKeyStorage хранит личные API ключи пользователей
+type APIKeyStorage interface {
+	SaveAPIKey(ctx context.Context, key models.APIKey, tokenHash string) (int64, error)
+	APIKeyByHash(ctx context.Context, tokenHash string) (models.APIKey, error)
+	APIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error
+	TouchAPIKey(ctx context.Context, keyID int64) error
+}
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid api key")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrTooManyAPIKeys  = errors.New("too many api keys")
+	ErrAPIKeyForbidden = errors.New("api key can not be used for this action")
+)
+
+// CreateAPIKey выпускает ключ для скриптов. Ключ работает от имени пользователя в одном приложении,
+// scopes ограничивают его так же как токен входа. Сам ключ возвращается только здесь
+func (a *Auth) CreateAPIKey(
+	ctx context.Context,
+	userID int64,
+	appID int,
+	name string,
+	scopes []string,
+	ttl time.Duration,
+) (string, models.APIKey, error) {
+	const op = "auth.CreateAPIKey"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", appID),
+	)
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyName {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w: name is required and must be at most %d characters", op, ErrInvalidAPIKey, maxAPIKeyName)
+	}
+	if ttl <= 0 {
+		ttl = defaultAPIKeyTTL
+	}
+	if ttl > maxAPIKeyTTL {
+		ttl = maxAPIKeyTTL
+	}
+
+	app, err := a.appProvader.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", models.APIKey{}, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if app.DisabledAt != nil {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, ErrAppDisabled)
+	}
+
+	for _, scope := range scopes {
+		if scope == models.AdminScope {
+			isAdmin, err := a.usrProvader.IsAdmin(ctx, userID)
+			if err != nil {
+				return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+			}
+			if !isAdmin {
+				log.Warn("admin scope requested by non admin")
+
+				return "", models.APIKey{}, fmt.Errorf("%s: %w: %q", op, ErrInvalidScope, scope)
+			}
+			continue
+		}
+		if !app.AllowsUserScope(scope) {
+			return "", models.APIKey{}, fmt.Errorf("%s: %w: %q", op, ErrInvalidScope, scope)
+		}
+	}
+
+	if err := a.checkMembership(ctx, app, userID); err != nil {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	existing, err := a.apiKeys.APIKeys(ctx, userID)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, ErrTooManyAPIKeys)
+	}
+
+	keyID, err := randomToken(apiKeyIDBytes)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+	secret, err := randomToken(apiKeySecretBytes)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	prefix := apiKeyPrefix + keyID
+	token := prefix + "_" + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		AppID:     app.ID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+
+	key.ID, err = a.apiKeys.SaveAPIKey(ctx, key, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", models.APIKey{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("falied to save api key", sl.Err(err))
+
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("api key created", slog.Int64("key_id", key.ID), slog.String("prefix", prefix))
+
+	return token, key, nil
+}
+
+func (a *Auth) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const op = "auth.ListAPIKeys"
+
+	keys, err := a.apiKeys.APIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (a *Auth) RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error {
+	const op = "auth.RevokeAPIKey"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int64("key_id", keyID),
+	)
+
+	if err := a.apiKeys.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAPIKeyNotFound)
+		}
+		log.Error("falied to revoke api key", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("api key revoked")
+
+	return nil
+}
+
+// verifyAPIKey собирает claims по ключу. Блокировку пользователя, доступ к приложению и роли
+// проверяем на каждый запрос, ключ живет долго и не должен переживать эти изменения
+func (a *Auth) verifyAPIKey(ctx context.Context, log *slog.Logger, token string, touch bool) (*jwtT.Claims, error) {
+	key, err := a.apiKeys.APIKeyByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			log.Info("api key rejected: unknown key")
+
+			return nil, ErrInvalidToken
+		}
+		log.Error("falied to get api key", sl.Err(err))
+
+		return nil, err
+	}
+
+	log = log.With(slog.Int64("key_id", key.ID), slog.Int64("user_id", key.UserID))
+
+	if key.RevokedAt != nil || time.Now().After(key.ExpiresAt) {
+		log.Info("api key rejected: revoked or expired")
+
+		return nil, ErrInvalidToken
+	}
+
+	user, err := a.usrProvader.UserByID(ctx, key.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if user.LockedAt != nil {
+		log.Warn("api key rejected: user is locked")
+
+		return nil, ErrInvalidToken
+	}
+
+	app, err := a.appProvader.App(ctx, key.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if app.DisabledAt != nil {
+		log.Info("api key rejected: app is disabled")
+
+		return nil, ErrInvalidToken
+	}
+
+	if err := a.checkMembership(ctx, app, user.ID); err != nil {
+		log.Warn("api key rejected: user is not allowed in app", sl.Err(err))
+
+		return nil, ErrInvalidToken
+	}
+
+	roles, err := a.roles.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if touch {
+		if err := a.apiKeys.TouchAPIKey(ctx, key.ID); err != nil {
+			// Как и с сессиями, ключ от этого не становится невалидным
+			log.Warn("falied to touch api key", sl.Err(err))
+		}
+	}
+
+	claims := &jwtT.Claims{
+		UID:       user.ID,
+		Email:     user.Email,
+		AppID:     app.ID,
+		Scopes:    key.Scopes,
+		Roles:     roleNames(roles),
+		ExpiresAt: key.ExpiresAt,
+		APIKeyID:  key.ID,
+	}
+	if len(key.Scopes) > 0 && !slices.Contains(key.Scopes, "email") {
+		claims.Email = ""
+	}
+
+	return claims, nil
+}
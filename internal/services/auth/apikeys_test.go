@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey_Lifecycle(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+	st.apps[5] = models.App{ID: 5, Name: "stats", Secret: "secret", RegisterMode: models.RegisterModeOpen, Scopes: []string{"stats:read"}}
+
+	userID, err := st.SaveUser(ctx, "analyst@example.com", nil)
+	require.NoError(t, err)
+
+	_, _, err = a.CreateAPIKey(ctx, userID, 5, " ", nil, 0)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, _, err = a.CreateAPIKey(ctx, userID, 5, "script", []string{"stats:write"}, 0)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	token, key, err := a.CreateAPIKey(ctx, userID, 5, "nightly export", []string{"stats:read"}, 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, key.Prefix+"_"))
+	assert.WithinDuration(t, time.Now().Add(defaultAPIKeyTTL), key.ExpiresAt, time.Minute)
+
+	keys, err := a.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "nightly export", keys[0].Name)
+	assert.Nil(t, keys[0].LastUsedAt)
+
+	claims, err := a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UID)
+	assert.Equal(t, 5, claims.AppID)
+	assert.Equal(t, key.ID, claims.APIKeyID)
+	assert.Equal(t, []string{"stats:read"}, claims.Scopes)
+	assert.Empty(t, claims.Email, "email scope was not granted")
+
+	keys, err = a.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	_, err = a.VerifyToken(ctx, key.Prefix+"_"+strings.Repeat("0", 64))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Ключ нельзя обменять на обычный токен
+	_, err = a.SwitchOrganization(ctx, token, 0, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrAPIKeyForbidden)
+
+	assert.ErrorIs(t, a.RevokeAPIKey(ctx, userID+1, key.ID), ErrAPIKeyNotFound)
+	require.NoError(t, a.RevokeAPIKey(ctx, userID, key.ID))
+
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAPIKey_AdminScopeOnlyForAdmins(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "analyst@example.com", nil)
+	require.NoError(t, err)
+
+	_, _, err = a.CreateAPIKey(ctx, userID, 1, "script", []string{models.AdminScope}, 0)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	require.NoError(t, st.SetAdmin(ctx, userID, true))
+
+	_, key, err := a.CreateAPIKey(ctx, userID, 1, "script", []string{models.AdminScope}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.AdminScope}, key.Scopes)
+}
+
+func TestAPIKey_RejectedWhenExpiredOrLocked(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "analyst@example.com", nil)
+	require.NoError(t, err)
+
+	token, _, err := a.CreateAPIKey(ctx, userID, 1, "script", nil, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "analyst@example.com", claims.Email)
+
+	st.mu.Lock()
+	expired := st.apiKeys[hashToken(token)]
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	st.apiKeys[hashToken(token)] = expired
+	st.mu.Unlock()
+
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	token, _, err = a.CreateAPIKey(ctx, userID, 1, "script 2", nil, 0)
+	require.NoError(t, err)
+
+	st.mu.Lock()
+	user := st.users["analyst@example.com"]
+	lockedAt := time.Now()
+	user.LockedAt = &lockedAt
+	st.users["analyst@example.com"] = user
+	st.mu.Unlock()
+
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const (
+	appSecretBytes = 32
+	// maxAppSecretOverlap ограничивает сколько старый ключ подписи живет после ротации
+	maxAppSecretOverlap = 7 * 24 * time.Hour
+)
+
+// AppStorage это управление приложениями из админки
+type AppStorage interface {
+	SaveApp(ctx context.Context, app models.App) (int, error)
+	Apps(ctx context.Context) ([]models.App, error)
+	RotateAppSecret(ctx context.Context, appID int, secret string, previousExpiresAt time.Time) error
+	SetAppDisabled(ctx context.Context, appID int, disabled bool) error
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+var (
+	ErrInvalidApp  = errors.New("invalid app")
+	ErrAppExists   = errors.New("app already exists")
+	ErrAppDisabled = errors.New("app is disabled")
+)
+
+// CreateApp заводит приложение и генерирует ему ключ подписи токенов. Ключ возвращается
+// только здесь и при ротации, в списке приложений его нет
+func (a *Auth) CreateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "auth.CreateApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("name", app.Name),
+	)
+
+	app.Name = strings.TrimSpace(app.Name)
+	if app.Name == "" {
+		return models.App{}, fmt.Errorf("%s: %w: name is required", op, ErrInvalidApp)
+	}
+	switch app.RegisterMode {
+	case "":
+		app.RegisterMode = models.RegisterModeOpen
+	case models.RegisterModeOpen, models.RegisterModeInvite, models.RegisterModeApproval:
+	case models.RegisterModeDomain:
+		if len(app.AllowedDomains) == 0 {
+			return models.App{}, fmt.Errorf("%s: %w: allowed_domains are required in domain mode", op, ErrInvalidApp)
+		}
+	default:
+		return models.App{}, fmt.Errorf("%s: %w: unknown register mode %q", op, ErrInvalidApp, app.RegisterMode)
+	}
+
+	secret, err := randomToken(appSecretBytes)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.Secret = secret
+
+	app.ID, err = a.apps.SaveApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+		log.Error("falied to save app", sl.Err(err))
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.CreatedAt = time.Now()
+
+	log.Info("app created", slog.Int("app_id", app.ID))
+
+	return app, nil
+}
+
+// ListApps отдает приложения без ключей и хешей секретов
+func (a *Auth) ListApps(ctx context.Context) ([]models.App, error) {
+	const op = "auth.ListApps"
+
+	apps, err := a.apps.Apps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range apps {
+		apps[i].Secret = ""
+		apps[i].PreviousSecret = ""
+		apps[i].ClientSecretHash = nil
+		apps[i].RegistrationTokenHash = ""
+	}
+
+	return apps, nil
+}
+
+// RotateAppSecret меняет ключ подписи. Токены подписанные старым ключом принимаются еще overlap,
+// по умолчанию это время жизни токена, так что ротация никого не разлогинит
+func (a *Auth) RotateAppSecret(ctx context.Context, appID int, overlap time.Duration) (string, time.Time, error) {
+	const op = "auth.RotateAppSecret"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	if overlap <= 0 {
+		overlap = a.tokenTTL
+	}
+	if overlap > maxAppSecretOverlap {
+		overlap = maxAppSecretOverlap
+	}
+
+	secret, err := randomToken(appSecretBytes)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	previousExpiresAt := time.Now().Add(overlap)
+	if err := a.apps.RotateAppSecret(ctx, appID, secret, previousExpiresAt); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("falied to rotate app secret", sl.Err(err))
+
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("app secret rotated", slog.Time("previous_expires_at", previousExpiresAt))
+
+	return secret, previousExpiresAt, nil
+}
+
+// SetAppDisabled выключает приложение не удаляя его данные. Уже выданные токены перестают приниматься сразу
+func (a *Auth) SetAppDisabled(ctx context.Context, appID int, disabled bool) error {
+	const op = "auth.SetAppDisabled"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	if err := a.apps.SetAppDisabled(ctx, appID, disabled); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("falied to set app disabled", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("app disabled flag changed", slog.Bool("disabled", disabled))
+
+	return nil
+}
+
+// DeleteApp удаляет приложение вместе с сессиями, ролями, политиками и ключами в нем
+func (a *Auth) DeleteApp(ctx context.Context, appID int) error {
+	const op = "auth.DeleteApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	if err := a.apps.DeleteApp(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("falied to delete app", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("app deleted")
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndListApps(t *testing.T) {
+	a, _, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	_, err := a.CreateApp(ctx, models.App{Name: " "})
+	assert.ErrorIs(t, err, ErrInvalidApp)
+	_, err = a.CreateApp(ctx, models.App{Name: "school", RegisterMode: "whatever"})
+	assert.ErrorIs(t, err, ErrInvalidApp)
+	_, err = a.CreateApp(ctx, models.App{Name: "school", RegisterMode: models.RegisterModeDomain})
+	assert.ErrorIs(t, err, ErrInvalidApp)
+
+	app, err := a.CreateApp(ctx, models.App{Name: " school "})
+	require.NoError(t, err)
+	assert.NotZero(t, app.ID)
+	assert.Equal(t, "school", app.Name)
+	assert.Equal(t, models.RegisterModeOpen, app.RegisterMode)
+	assert.Len(t, app.Secret, 2*appSecretBytes)
+
+	_, err = a.CreateApp(ctx, models.App{Name: "school"})
+	assert.ErrorIs(t, err, ErrAppExists)
+
+	apps, err := a.ListApps(ctx)
+	require.NoError(t, err)
+	require.Len(t, apps, 1)
+	assert.Equal(t, app.ID, apps[0].ID)
+	assert.Empty(t, apps[0].Secret)
+}
+
+func TestRotateAppSecret(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	app, err := a.CreateApp(ctx, models.App{Name: "school"})
+	require.NoError(t, err)
+	userID, err := st.SaveUser(ctx, "student@school.ru", nil)
+	require.NoError(t, err)
+
+	token, err := a.LoginUser(ctx, models.User{ID: userID, Email: "student@school.ru"}, app.ID, nil, models.ClientInfo{})
+	require.NoError(t, err)
+
+	secret, previousExpiresAt, err := a.RotateAppSecret(ctx, app.ID, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, app.Secret, secret)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), previousExpiresAt, time.Minute)
+
+	// Старый токен живет пока не кончилось перекрытие
+	_, err = a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+
+	fresh, err := a.LoginUser(ctx, models.User{ID: userID, Email: "student@school.ru"}, app.ID, nil, models.ClientInfo{})
+	require.NoError(t, err)
+	_, err = a.VerifyToken(ctx, fresh)
+	require.NoError(t, err)
+
+	st.mu.Lock()
+	rotated := st.apps[app.ID]
+	expired := time.Now().Add(-time.Second)
+	rotated.PreviousSecretExpiresAt = &expired
+	st.apps[app.ID] = rotated
+	st.mu.Unlock()
+
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = a.VerifyToken(ctx, fresh)
+	assert.NoError(t, err)
+
+	_, _, err = a.RotateAppSecret(ctx, 999, 0)
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+}
+
+func TestDisableAndDeleteApp(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	app, err := a.CreateApp(ctx, models.App{Name: "school"})
+	require.NoError(t, err)
+	userID, err := st.SaveUser(ctx, "student@school.ru", nil)
+	require.NoError(t, err)
+	user := models.User{ID: userID, Email: "student@school.ru"}
+
+	token, err := a.LoginUser(ctx, user, app.ID, nil, models.ClientInfo{})
+	require.NoError(t, err)
+
+	require.NoError(t, a.SetAppDisabled(ctx, app.ID, true))
+
+	_, err = a.LoginUser(ctx, user, app.ID, nil, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrAppDisabled)
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	require.NoError(t, a.SetAppDisabled(ctx, app.ID, false))
+	_, err = a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+
+	require.NoError(t, a.DeleteApp(ctx, app.ID))
+	assert.ErrorIs(t, a.DeleteApp(ctx, app.ID), ErrInvalidAppID)
+	assert.ErrorIs(t, a.SetAppDisabled(ctx, app.ID, true), ErrInvalidAppID)
+}
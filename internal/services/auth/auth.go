@@ -1,16 +1,17 @@
 package auth
 
 import (
-	"STTAuth/internal/domain/models"
-	jwtT "STTAuth/internal/lib/jwt"
-	"STTAuth/internal/lib/logger/sl"
-	"STTAuth/internal/storage"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,7 +20,35 @@ type Auth struct {
 	usrSaver    UserSaver
 	usrProvader UserProvider
 	appProvader AppProvider
+	sesSaver    SessionSaver
+	sesProvider SessionProvider
+	devices     DeviceStorage
+	notifier    Notifier
+	members     MemberStorage
+	clients     ClientStorage
+	consents    ConsentStorage
+	roles       RoleStorage
+	policies    PolicyStorage
+	orgs        OrgStorage
+	apiKeys     APIKeyStorage
+	apps        AppStorage
+	// identities это привязки пользователей каталогов LDAP к нашим аккаунтам
+	identities IdentityStorage
+	// policyEngine выполняет CEL выражения политик приложений
+	policyEngine PolicyEngine
+	// directories это каталоги LDAP по id приложения, для этих приложений пароль проверяется в каталоге
+	directories map[int]Directory
 	tokenTTL    time.Duration
+	// decisionTTL это сколько вызывающий может кешировать ответ CheckPermission
+	decisionTTL time.Duration
+	// uniformRegister включает режим регистрации при котором ответ не зависит от того
+	// занят email или нет, а владельцу занятого email уходит письмо
+	uniformRegister bool
+	// sessionlessCutoff см. Config.SessionlessCutoff
+	sessionlessCutoff time.Time
+	// comparePassword сверяет пароль с bcrypt хешем. Вынесено в поле что бы тесты могли проверить
+	// что для несуществующего email тоже идет сравнение с хешем, не замеряя время
+	comparePassword func(hash []byte, password []byte) error
 }
 
 // Тут мог быть просто один большой интерфейс Storage и так возможно в данном примере могло быть лучше но, я хочу делать все +- на перед и вдруг у меня будет такое что мне нужно будет работать и прикручивать отдельный сервис который будет заниматься юзерпровайдером там та же kafka или может быть что то с кешем связанное. А UserSaver в этом не хочет участвовать и он там будет лишним грузом
@@ -30,47 +59,137 @@ type UserSaver interface {
 		email string,
 		passHash []byte,
 	) (uid int64, err error)
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	UpdateUserEmail(ctx context.Context, userID int64, email string) error
+	SetUserLocked(ctx context.Context, userID int64, locked bool) error
+	DeleteUser(ctx context.Context, userID int64) error
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	UserInfo(ctx context.Context, userID int64) (models.UserInfo, error)
+	ListUsers(ctx context.Context, filter models.UserFilter) ([]models.UserInfo, error)
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appID int) (models.App, error)
 }
 
+type SessionSaver interface {
+	SaveSession(ctx context.Context, session models.Session) error
+	TouchSession(ctx context.Context, sessionID string) error
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID int64) (int64, error)
+}
+
+type SessionProvider interface {
+	Session(ctx context.Context, sessionID string) (models.Session, error)
+	Sessions(ctx context.Context, userID int64) ([]models.Session, error)
+}
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidAppID       = errors.New("invalid app id")
 	ErrUserExists         = errors.New("user already exists")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrTooManyAttempts    = errors.New("too many login attempts")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrAccountLocked      = errors.New("account locked")
+	ErrInvalidLockToken   = errors.New("invalid lock token")
+	ErrInviteRequired     = errors.New("invite code required")
+	ErrInvalidInvite      = errors.New("invalid invite code")
+	ErrInvitesDisabled    = errors.New("app is not invite only")
+	ErrDomainNotAllowed   = errors.New("email domain not allowed")
+	ErrNotMember          = errors.New("user is not a member of app")
+	ErrApprovalPending    = errors.New("registration pending approval")
+	ErrNotPending         = errors.New("registration is not pending")
+	// ErrSessionlessToken это токен без сессии: старый, сервисный или API ключ. Отозвать его
+	// Logout не может, он живет до exp, поэтому честно отвечаем ошибкой а не успехом
+	ErrSessionlessToken = errors.New("token has no session and can not be logged out")
 )
 
+// Deps это хранилища и внешние зависимости Auth. Обычно почти все поля это один и тот же Storage,
+// но интерфейсы разделены, см. комментарий к UserSaver
+type Deps struct {
+	UserSaver       UserSaver
+	UserProvider    UserProvider
+	AppProvider     AppProvider
+	SessionSaver    SessionSaver
+	SessionProvider SessionProvider
+	Devices         DeviceStorage
+	Notifier        Notifier
+	Members         MemberStorage
+	Clients         ClientStorage
+	Consents        ConsentStorage
+	Roles           RoleStorage
+	Policies        PolicyStorage
+	Orgs            OrgStorage
+	APIKeys         APIKeyStorage
+	Apps            AppStorage
+	Identities      IdentityStorage
+	PolicyEngine    PolicyEngine
+	// Directories это каталоги LDAP по id приложения, может быть nil
+	Directories map[int]Directory
+}
+
+// Config это настройки Auth из конфига приложения
+type Config struct {
+	TokenTTL time.Duration
+	// DecisionTTL это сколько вызывающий может кешировать ответ CheckPermission
+	DecisionTTL time.Duration
+	// UniformRegister включает регистрацию с одинаковым ответом для занятого и свободного email
+	UniformRegister bool
+	// SessionlessCutoff это конец переезда на сессии. Токены без sid выпущенные до этого момента
+	// принимаются пока не истекут, но не дольше SessionlessCutoff + TokenTTL. Пустое значение
+	// значит что токены без сессии не принимаются совсем
+	SessionlessCutoff time.Time
+}
+
 // New это конструктор для Auth сервиса
-func New(
-	log *slog.Logger,
-	userSaver UserSaver,
-	userProvider UserProvider,
-	appProvider AppProvider,
-	tokenTTL time.Duration,
-) *Auth {
+func New(log *slog.Logger, deps Deps, cfg Config) *Auth {
 	return &Auth{
-		usrSaver:    userSaver,
-		usrProvader: userProvider,
+		usrSaver:    deps.UserSaver,
+		usrProvader: deps.UserProvider,
 		log:         log,
-		appProvader: appProvider,
-		tokenTTL:    tokenTTL,
+		appProvader: deps.AppProvider,
+		sesSaver:    deps.SessionSaver,
+		sesProvider: deps.SessionProvider,
+		devices:     deps.Devices,
+		notifier:    deps.Notifier,
+		members:     deps.Members,
+		clients:     deps.Clients,
+		consents:    deps.Consents,
+		roles:       deps.Roles,
+		policies:    deps.Policies,
+		orgs:        deps.Orgs,
+		apiKeys:     deps.APIKeys,
+		apps:        deps.Apps,
+		identities:  deps.Identities,
+		directories: deps.Directories,
+		tokenTTL:    cfg.TokenTTL,
+		decisionTTL: cfg.DecisionTTL,
+
+		policyEngine: deps.PolicyEngine,
+
+		uniformRegister:   cfg.UniformRegister,
+		sessionlessCutoff: cfg.SessionlessCutoff,
+		comparePassword:   bcrypt.CompareHashAndPassword,
 	}
 }
 
+// Login проверяет пароль и выдает токен. Если приложение запросило scopes на которые пользователь
+// еще не соглашался, то вернется ErrConsentRequired, тогда надо спросить пользователя и повторить вход с consent=true
 func (a *Auth) Login(
 	ctx context.Context,
 	email string,
 	password string,
 	appID int,
+	scopes []string,
+	consent bool,
+	client models.ClientInfo,
 ) (string, error) {
 	const op = "auth.Login"
 
@@ -81,51 +200,261 @@ func (a *Auth) Login(
 
 	log.Info("attempting to login user")
 
+	user, err := a.authenticate(ctx, log, email, password, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.CheckConsent(ctx, user.ID, appID, scopes, consent); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := a.issueToken(ctx, log, user, appID, scopes, client)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// Authenticate только проверяет логин и пароль для приложения, без сессии и токена.
+// Нужен там где токен выдается позже, например в OAuth authorization code flow
+func (a *Auth) Authenticate(ctx context.Context, email string, password string, appID int) (models.User, error) {
+	const op = "auth.Authenticate"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("username", email),
+	)
+
+	user, err := a.authenticate(ctx, log, email, password, appID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// authenticate проверяет пароль и блокировку аккаунта. Блокировку смотрим только после пароля,
+// иначе по ответу можно было бы узнать что аккаунт с таким email есть и заблокирован
+func (a *Auth) authenticate(ctx context.Context, log *slog.Logger, email string, password string, appID int) (models.User, error) {
+	user, err := a.checkPassword(ctx, log, email, password, appID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if user.LockedAt != nil {
+		log.Warn("user is locked")
+
+		return models.User{}, ErrAccountLocked
+	}
+
+	return user, nil
+}
+
+func (a *Auth) checkPassword(ctx context.Context, log *slog.Logger, email string, password string, appID int) (models.User, error) {
+	if dir, ok := a.directories[appID]; ok {
+		return a.loginDirectory(ctx, log, dir, email, password, appID)
+	}
+
 	user, err := a.usrProvader.User(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
-			a.log.Warn("user not found", sl.Err(err))
+			log.Warn("user not found", sl.Err(err))
+
+			// Сравниваем с фиктивным хешем что бы по времени ответа нельзя было понять есть такой email или нет
+			a.compareDummyHash(password)
 
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return models.User{}, ErrInvalidCredentials
 		}
-		a.log.Error("falied to get user", sl.Err(err))
+		log.Error("falied to get user", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.User{}, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		a.log.Info("invalid credentials", sl.Err(err))
+	if err := a.comparePassword(user.PassHash, []byte(password)); err != nil {
+		log.Info("invalid credentials", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		return models.User{}, ErrInvalidCredentials
 	}
 
-	app, err := a.appProvader.App(ctx, appID)
+	return user, nil
+}
+
+// LoginUser выдает токен пользователю который уже подтвердил личность другим способом,
+// например через внешнего OpenID Connect провайдера. Пароль и согласие на scopes тут не проверяются,
+// это дело вызывающего
+func (a *Auth) LoginUser(ctx context.Context, user models.User, appID int, scopes []string, client models.ClientInfo) (string, error) {
+	const op = "auth.LoginUser"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+	)
+
+	token, err := a.issueToken(ctx, log, user, appID, scopes, client)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("user logged in successfully")
+	return token, nil
+}
 
-	token, err := jwtT.NewToken(user, app, a.tokenTTL)
+// issueToken это общая часть входа после того как личность пользователя подтверждена:
+// проверки блокировки, доступа к приложению и политик входа, сессия и сам токен
+func (a *Auth) issueToken(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	appID int,
+	scopes []string,
+	client models.ClientInfo,
+) (string, error) {
+	app, roles, err := a.checkAccess(ctx, log, user, appID, client)
 	if err != nil {
-		a.log.Error("falied to generate token")
+		return "", err
+	}
 
-		return "", fmt.Errorf("%s: %w", op, err)
+	a.checkDevice(ctx, log, user, app, client)
+
+	session, err := a.newSession(ctx, user, app, client)
+	if err != nil {
+		log.Error("falied to save session", sl.Err(err))
+
+		return "", err
+	}
+
+	log.Info("user logged in successfully", slog.String("session_id", session.ID))
+
+	orgID, err := a.defaultOrganization(ctx, user.ID)
+	if err != nil {
+		log.Error("falied to get user organizations", sl.Err(err))
+
+		return "", err
+	}
+
+	token, err := a.newToken(user, app, session.ID, roles, scopes, orgID)
+	if err != nil {
+		log.Error("falied to generate token")
+
+		return "", err
 	}
+
 	return token, nil
 }
 
-func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string) (int64, error) {
+// newToken собирает claims токена пользователя. orgID = 0 значит без организации
+// checkAccess это проверки перед выдачей любого токена пользователю: блокировка, выключенное приложение,
+// участие в приложении и политики входа. Отдает приложение и роли пользователя в нем
+func (a *Auth) checkAccess(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	appID int,
+	client models.ClientInfo,
+) (models.App, []models.Role, error) {
+	if user.LockedAt != nil {
+		log.Warn("user is locked")
+
+		return models.App{}, nil, ErrAccountLocked
+	}
+
+	app, err := a.appProvader.App(ctx, appID)
+	if err != nil {
+		return models.App{}, nil, err
+	}
+	if app.DisabledAt != nil {
+		log.Warn("app is disabled")
+
+		return models.App{}, nil, ErrAppDisabled
+	}
+
+	if err := a.checkMembership(ctx, app, user.ID); err != nil {
+		log.Warn("user is not allowed in app", sl.Err(err))
+
+		return models.App{}, nil, err
+	}
+
+	roles, err := a.roles.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("falied to get user roles", sl.Err(err))
+
+		return models.App{}, nil, err
+	}
+
+	if err := a.enforceLoginPolicies(ctx, log, user, app, roles, client); err != nil {
+		return models.App{}, nil, err
+	}
+
+	return app, roles, nil
+}
+
+func (a *Auth) newToken(
+	user models.User,
+	app models.App,
+	sessionID string,
+	roles []models.Role,
+	scopes []string,
+	orgID int64,
+	extra ...jwtT.Option,
+) (string, error) {
+	opts := []jwtT.Option{jwtT.WithSessionID(sessionID)}
+	if len(roles) > 0 {
+		opts = append(opts, jwtT.WithRoles(roleNames(roles)))
+	}
+	if orgID != 0 {
+		opts = append(opts, jwtT.WithOrgID(orgID))
+	}
+	// Если scopes не запросили то токен получает только openid, то есть sub без email.
+	// Claims которые раскрывают данные пользователя попадают в токен только по scope на который есть согласие
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	opts = append(opts, jwtT.WithScopes(scopes))
+	if !slices.Contains(scopes, "email") {
+		opts = append(opts, jwtT.WithoutEmail())
+	}
+	opts = append(opts, extra...)
+
+	return jwtT.NewToken(user, app, a.tokenTTL, opts...)
+}
+
+// RegisterNewUser регистрирует пользователя. Если appID передан то применяется политика регистрации
+// этого приложения и пользователь становится его участником, без appID регистрация как раньше открытая
+func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string, appID int, inviteCode string) (int64, error) {
 	const op = "auth.RegisterNewUser"
 
 	log := a.log.With(
 		slog.String("op", op),
 		// Если делать такую систему для авторизации то логировать email нельзя ни в коем случае потому что если вся информацию разбредеться по логам а нужно будет удалить кого полностью, искать все это будет очень муторно и не делай так в продакшине))
 		slog.String("username", email),
+		slog.Int("app_id", appID),
 	)
 
 	log.Info("registering user")
 
+	memberStatus := ""
+	inviteHash := ""
+	if appID != 0 {
+		app, err := a.appProvader.App(ctx, appID)
+		if err != nil {
+			if errors.Is(err, storage.ErrAppNotFound) {
+				return 0, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+			}
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if app.DisabledAt != nil {
+			return 0, fmt.Errorf("%s: %w", op, ErrAppDisabled)
+		}
+
+		memberStatus, inviteHash, err = a.registerPolicy(app, email, inviteCode)
+		if err != nil {
+			log.Warn("registration rejected by app policy", sl.Err(err))
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
 	passHash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
 	if err != nil {
 		log.Error("falied to generate password hash", sl.Err(err))
@@ -133,11 +462,27 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string) (
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	id, err := a.usrSaver.SaveUser(ctx, email, passHash)
+	var id int64
+	if memberStatus != "" {
+		id, err = a.members.RegisterMember(ctx, email, passHash, appID, memberStatus, inviteHash)
+	} else {
+		id, err = a.usrSaver.SaveUser(ctx, email, passHash)
+	}
 	if err != nil {
+		if errors.Is(err, storage.ErrInviteNotFound) {
+			log.Warn("invite not found or used up")
+
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvite)
+		}
 		if errors.Is(err, storage.ErrUserExists) {
 			log.Warn("user already exists")
 
+			if a.uniformRegister {
+				a.notifyRegistrationAttempt(ctx, log, email)
+
+				return 0, nil
+			}
+
 			return 0, fmt.Errorf("%s: %w", op, ErrUserExists)
 		}
 		log.Error("falied to save user", sl.Err(err))
@@ -145,7 +490,12 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string) (
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("user registered")
+	log.Info("user registered", slog.String("member_status", memberStatus))
+
+	if a.uniformRegister {
+		// id не отдаем, иначе ответ для нового и существующего пользователя будет отличаться
+		return 0, nil
+	}
 
 	return id, nil
 }
@@ -0,0 +1,1063 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/policy"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeStorage держит все в памяти и реализует все интерфейсы хранилища которые нужны Auth
+type fakeStorage struct {
+	mu        sync.Mutex
+	users     map[string]models.User
+	sessions  map[string]models.Session
+	apps      map[int]models.App
+	members   map[int]map[int64]string
+	invites   map[string]int
+	admins    map[int64]bool
+	consents  map[int64]map[int][]string
+	roles     map[int64]models.Role
+	userRoles map[int64]map[int64]bool
+	policies  map[int64]models.Policy
+	orgs      map[int64]models.Organization
+	orgRoles  map[int64]map[int64]string
+	orgInvite map[string]models.OrgInvite
+	apiKeys   map[string]models.APIKey
+	devices   map[int64]map[string]bool
+	alerts    map[string]int64
+	idents    map[string]models.Identity
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		users:     make(map[string]models.User),
+		sessions:  make(map[string]models.Session),
+		apps:      make(map[int]models.App),
+		members:   make(map[int]map[int64]string),
+		invites:   make(map[string]int),
+		admins:    make(map[int64]bool),
+		consents:  make(map[int64]map[int][]string),
+		roles:     make(map[int64]models.Role),
+		userRoles: make(map[int64]map[int64]bool),
+		policies:  make(map[int64]models.Policy),
+		orgs:      make(map[int64]models.Organization),
+		orgRoles:  make(map[int64]map[int64]string),
+		orgInvite: make(map[string]models.OrgInvite),
+		apiKeys:   make(map[string]models.APIKey),
+		devices:   make(map[int64]map[string]bool),
+		alerts:    make(map[string]int64),
+		idents:    make(map[string]models.Identity),
+	}
+}
+
+func (s *fakeStorage) SaveUser(_ context.Context, email string, passHash []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[email]; ok {
+		return 0, storage.ErrUserExists
+	}
+	id := int64(len(s.users) + 1)
+	s.users[email] = models.User{ID: id, Email: email, PassHash: passHash}
+	return id, nil
+}
+
+func (s *fakeStorage) User(_ context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *fakeStorage) UserByID(_ context.Context, userID int64) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return models.User{}, storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) SetAdmin(_ context.Context, userID int64, isAdmin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.admins[userID] = isAdmin
+	return nil
+}
+
+func (s *fakeStorage) UpdateUserEmail(_ context.Context, userID int64, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[email]; ok {
+		return storage.ErrUserExists
+	}
+	for old, user := range s.users {
+		if user.ID == userID {
+			delete(s.users, old)
+			user.Email = email
+			s.users[email] = user
+			return nil
+		}
+	}
+	return storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) SetUserLocked(_ context.Context, userID int64, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for email, user := range s.users {
+		if user.ID == userID {
+			user.LockedAt = nil
+			if locked {
+				now := time.Now()
+				user.LockedAt = &now
+			}
+			s.users[email] = user
+			return nil
+		}
+	}
+	return storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) DeleteUser(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for email, user := range s.users {
+		if user.ID == userID {
+			delete(s.users, email)
+			return nil
+		}
+	}
+	return storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) UserInfo(_ context.Context, userID int64) (models.UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == userID {
+			return models.UserInfo{ID: user.ID, Email: user.Email, IsAdmin: s.admins[user.ID], LockedAt: user.LockedAt}, nil
+		}
+	}
+	return models.UserInfo{}, storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) ListUsers(_ context.Context, filter models.UserFilter) ([]models.UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []models.UserInfo
+	for _, user := range s.users {
+		if user.ID <= filter.AfterID || !strings.HasPrefix(strings.ToLower(user.Email), strings.ToLower(filter.EmailPrefix)) {
+			continue
+		}
+		if filter.Locked != nil && *filter.Locked != (user.LockedAt != nil) {
+			continue
+		}
+		if filter.AdminsOnly && !s.admins[user.ID] {
+			continue
+		}
+		users = append(users, models.UserInfo{ID: user.ID, Email: user.Email, IsAdmin: s.admins[user.ID], LockedAt: user.LockedAt})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (s *fakeStorage) SetClientSecret(_ context.Context, appID int, secretHash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return storage.ErrAppNotFound
+	}
+	app.ClientSecretHash = secretHash
+	s.apps[appID] = app
+	return nil
+}
+
+func (s *fakeStorage) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.admins[userID], nil
+}
+
+func (s *fakeStorage) App(_ context.Context, appID int) (models.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if app, ok := s.apps[appID]; ok {
+		return app, nil
+	}
+	return models.App{ID: appID, Name: "test", Secret: "test-secret", RegisterMode: models.RegisterModeOpen}, nil
+}
+
+func (s *fakeStorage) SaveSession(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *fakeStorage) TouchSession(_ context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return storage.ErrSessionNotFound
+	}
+	session.LastSeenAt = time.Now()
+	s.sessions[sessionID] = session
+	return nil
+}
+
+func (s *fakeStorage) RevokeSession(_ context.Context, userID int64, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return storage.ErrSessionNotFound
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	s.sessions[sessionID] = session
+	return nil
+}
+
+func (s *fakeStorage) RevokeAllSessions(_ context.Context, userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revoked int64
+	for id, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			now := time.Now()
+			session.RevokedAt = &now
+			s.sessions[id] = session
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (s *fakeStorage) Session(_ context.Context, sessionID string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return models.Session{}, storage.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *fakeStorage) Sessions(_ context.Context, _ int64) ([]models.Session, error) { return nil, nil }
+
+func (s *fakeStorage) KnownDevice(_ context.Context, userID int64, device string, ipPrefix string) (bool, bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := s.devices[userID]
+	return seen["device:"+device], seen["prefix:"+ipPrefix], len(seen) > 0, nil
+}
+
+func (s *fakeStorage) SaveDevice(_ context.Context, userID int64, device string, ipPrefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.devices[userID] == nil {
+		s.devices[userID] = make(map[string]bool)
+	}
+	s.devices[userID]["device:"+device] = true
+	s.devices[userID]["prefix:"+ipPrefix] = true
+	return nil
+}
+
+func (s *fakeStorage) SaveLoginAlert(_ context.Context, userID int64, tokenHash string, _ string, _ string, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts[tokenHash] = userID
+	return nil
+}
+
+func (s *fakeStorage) UseLoginAlert(_ context.Context, tokenHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.alerts[tokenHash]
+	if !ok {
+		return 0, storage.ErrAlertNotFound
+	}
+	delete(s.alerts, tokenHash)
+	return userID, nil
+}
+
+func (s *fakeStorage) LockUser(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for email, user := range s.users {
+		if user.ID == userID {
+			now := time.Now()
+			user.LockedAt = &now
+			s.users[email] = user
+			return nil
+		}
+	}
+	return storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) SaveMember(_ context.Context, appID int, userID int64, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.members[appID] == nil {
+		s.members[appID] = make(map[int64]string)
+	}
+	s.members[appID][userID] = status
+	return nil
+}
+
+func (s *fakeStorage) MemberStatus(_ context.Context, appID int, userID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.members[appID][userID]
+	if !ok {
+		return "", storage.ErrMemberNotFound
+	}
+	return status, nil
+}
+
+func (s *fakeStorage) MembersByStatus(_ context.Context, _ int, _ string) ([]models.Member, error) {
+	return nil, nil
+}
+
+func (s *fakeStorage) DeleteMember(_ context.Context, appID int, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.members[appID], userID)
+	return nil
+}
+
+func (s *fakeStorage) SaveInvite(_ context.Context, codeHash string, invite models.Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invites[codeHash] = invite.MaxUses
+	return nil
+}
+
+func (s *fakeStorage) Identity(_ context.Context, provider string, subject string) (models.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, ok := s.idents[provider+"|"+subject]
+	if !ok {
+		return models.Identity{}, storage.ErrIdentityNotFound
+	}
+	return identity, nil
+}
+
+func (s *fakeStorage) SaveIdentity(_ context.Context, identity models.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identity.Provider + "|" + identity.Subject
+	if _, ok := s.idents[key]; ok {
+		return storage.ErrIdentityExists
+	}
+	s.idents[key] = identity
+	return nil
+}
+
+// RegisterMember ведет себя как транзакция: при любой ошибке инвайт не расходуется
+func (s *fakeStorage) RegisterMember(_ context.Context, email string, passHash []byte, appID int, status string, inviteHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inviteHash != "" && s.invites[inviteHash] == 0 {
+		return 0, storage.ErrInviteNotFound
+	}
+	if _, ok := s.users[email]; ok {
+		return 0, storage.ErrUserExists
+	}
+	if inviteHash != "" {
+		s.invites[inviteHash]--
+	}
+
+	id := int64(len(s.users) + 1)
+	s.users[email] = models.User{ID: id, Email: email, PassHash: passHash}
+	if s.members[appID] == nil {
+		s.members[appID] = make(map[int64]string)
+	}
+	s.members[appID][id] = status
+	return id, nil
+}
+
+func (s *fakeStorage) Consent(_ context.Context, userID int64, appID int) (models.Consent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scopes, ok := s.consents[userID][appID]
+	if !ok {
+		return models.Consent{}, storage.ErrConsentNotFound
+	}
+	return models.Consent{UserID: userID, AppID: appID, Scopes: scopes}, nil
+}
+
+func (s *fakeStorage) SaveConsent(_ context.Context, userID int64, appID int, scopes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.consents[userID] == nil {
+		s.consents[userID] = make(map[int][]string)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(s.consents[userID][appID], scope) {
+			s.consents[userID][appID] = append(s.consents[userID][appID], scope)
+		}
+	}
+	return nil
+}
+
+func (s *fakeStorage) Consents(_ context.Context, userID int64) ([]models.Consent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var consents []models.Consent
+	for appID, scopes := range s.consents[userID] {
+		consents = append(consents, models.Consent{UserID: userID, AppID: appID, Scopes: scopes})
+	}
+	return consents, nil
+}
+
+func (s *fakeStorage) DeleteConsent(_ context.Context, userID int64, appID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.consents[userID][appID]; !ok {
+		return storage.ErrConsentNotFound
+	}
+	delete(s.consents[userID], appID)
+	return nil
+}
+
+func (s *fakeStorage) SaveRole(_ context.Context, role models.Role) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.roles {
+		if r.Name == role.Name && r.AppID == role.AppID {
+			return 0, storage.ErrRoleExists
+		}
+	}
+	role.ID = int64(len(s.roles) + 1)
+	s.roles[role.ID] = role
+	return role.ID, nil
+}
+
+func (s *fakeStorage) Role(_ context.Context, roleID int64) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.roles[roleID]
+	if !ok {
+		return models.Role{}, storage.ErrRoleNotFound
+	}
+	return role, nil
+}
+
+func (s *fakeStorage) Roles(_ context.Context, appID int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var roles []models.Role
+	for _, r := range s.roles {
+		if r.AppID == appID {
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *fakeStorage) DeleteRole(_ context.Context, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[roleID]; !ok {
+		return storage.ErrRoleNotFound
+	}
+	delete(s.roles, roleID)
+	for _, assigned := range s.userRoles {
+		delete(assigned, roleID)
+	}
+	return nil
+}
+
+func (s *fakeStorage) SetRolePermissions(_ context.Context, roleID int64, permissions []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.roles[roleID]
+	if !ok {
+		return storage.ErrRoleNotFound
+	}
+	role.Permissions = permissions
+	s.roles[roleID] = role
+	return nil
+}
+
+func (s *fakeStorage) AssignRole(_ context.Context, userID int64, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[roleID]; !ok {
+		return storage.ErrRoleNotFound
+	}
+	if s.userRoles[userID] == nil {
+		s.userRoles[userID] = make(map[int64]bool)
+	}
+	s.userRoles[userID][roleID] = true
+	return nil
+}
+
+func (s *fakeStorage) UnassignRole(_ context.Context, userID int64, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userRoles[userID][roleID] {
+		return storage.ErrRoleNotAssigned
+	}
+	delete(s.userRoles[userID], roleID)
+	return nil
+}
+
+func (s *fakeStorage) UserRoles(_ context.Context, userID int64, appID int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[int64]bool)
+	var roles []models.Role
+	for roleID := range s.userRoles[userID] {
+		role := s.roles[roleID]
+		if role.AppID != 0 && role.AppID != appID {
+			continue
+		}
+		for id := roleID; id != 0 && !seen[id]; id = s.roles[id].Inherits {
+			seen[id] = true
+			roles = append(roles, s.roles[id])
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (s *fakeStorage) SavePolicy(_ context.Context, policy models.Policy) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.policies {
+		if p.AppID == policy.AppID && p.Name == policy.Name {
+			return 0, storage.ErrPolicyExists
+		}
+	}
+	policy.ID = int64(len(s.policies) + 1)
+	s.policies[policy.ID] = policy
+	return policy.ID, nil
+}
+
+func (s *fakeStorage) Policies(_ context.Context, appID int) ([]models.Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var policies []models.Policy
+	for _, p := range s.policies {
+		if p.AppID == appID {
+			policies = append(policies, p)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+func (s *fakeStorage) SetPolicyEnabled(_ context.Context, policyID int64, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.policies[policyID]
+	if !ok {
+		return storage.ErrPolicyNotFound
+	}
+	p.Enabled = enabled
+	s.policies[policyID] = p
+	return nil
+}
+
+func (s *fakeStorage) DeletePolicy(_ context.Context, policyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[policyID]; !ok {
+		return storage.ErrPolicyNotFound
+	}
+	delete(s.policies, policyID)
+	return nil
+}
+
+func (s *fakeStorage) SaveOrganization(_ context.Context, name string, ownerID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := int64(len(s.orgs) + 1)
+	s.orgs[id] = models.Organization{ID: id, Name: name, CreatedBy: ownerID, CreatedAt: time.Now()}
+	s.orgRoles[id] = map[int64]string{ownerID: models.OrgRoleOwner}
+	return id, nil
+}
+
+func (s *fakeStorage) Organization(_ context.Context, orgID int64) (models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org, ok := s.orgs[orgID]
+	if !ok {
+		return models.Organization{}, storage.ErrOrgNotFound
+	}
+	return org, nil
+}
+
+func (s *fakeStorage) UserOrganizations(_ context.Context, userID int64) ([]models.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var orgs []models.OrgMember
+	for orgID, members := range s.orgRoles {
+		if role, ok := members[userID]; ok {
+			orgs = append(orgs, models.OrgMember{OrgID: orgID, OrgName: s.orgs[orgID].Name, UserID: userID, Role: role})
+		}
+	}
+	return orgs, nil
+}
+
+func (s *fakeStorage) OrgMembers(_ context.Context, orgID int64) ([]models.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var members []models.OrgMember
+	for userID, role := range s.orgRoles[orgID] {
+		members = append(members, models.OrgMember{OrgID: orgID, OrgName: s.orgs[orgID].Name, UserID: userID, Role: role})
+	}
+	return members, nil
+}
+
+func (s *fakeStorage) OrgMember(_ context.Context, orgID int64, userID int64) (models.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.orgRoles[orgID][userID]
+	if !ok {
+		return models.OrgMember{}, storage.ErrOrgMemberNotFound
+	}
+	return models.OrgMember{OrgID: orgID, OrgName: s.orgs[orgID].Name, UserID: userID, Role: role}, nil
+}
+
+func (s *fakeStorage) DeleteOrgMember(_ context.Context, orgID int64, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orgRoles[orgID][userID]; !ok {
+		return storage.ErrOrgMemberNotFound
+	}
+	delete(s.orgRoles[orgID], userID)
+	return nil
+}
+
+func (s *fakeStorage) SaveOrgInvite(_ context.Context, tokenHash string, invite models.OrgInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite.Token = ""
+	s.orgInvite[tokenHash] = invite
+	return nil
+}
+
+func (s *fakeStorage) AcceptOrgInvite(_ context.Context, tokenHash string, userID int64, email string) (models.OrgInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.orgInvite[tokenHash]
+	if !ok || !strings.EqualFold(invite.Email, email) || time.Now().After(invite.ExpiresAt) {
+		return models.OrgInvite{}, storage.ErrOrgInviteNotFound
+	}
+	if _, ok := s.orgRoles[invite.OrgID][userID]; ok {
+		return models.OrgInvite{}, storage.ErrOrgMemberExists
+	}
+	delete(s.orgInvite, tokenHash)
+	s.orgRoles[invite.OrgID][userID] = invite.Role
+	return invite, nil
+}
+
+func (s *fakeStorage) SaveAPIKey(_ context.Context, key models.APIKey, tokenHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = int64(len(s.apiKeys) + 1)
+	s.apiKeys[tokenHash] = key
+	return key.ID, nil
+}
+
+func (s *fakeStorage) APIKeyByHash(_ context.Context, tokenHash string) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[tokenHash]
+	if !ok {
+		return models.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *fakeStorage) APIKeys(_ context.Context, userID int64) ([]models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []models.APIKey
+	for _, key := range s.apiKeys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *fakeStorage) RevokeAPIKey(_ context.Context, userID int64, keyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.apiKeys {
+		if key.ID == keyID && key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			s.apiKeys[hash] = key
+			return nil
+		}
+	}
+	return storage.ErrAPIKeyNotFound
+}
+
+func (s *fakeStorage) TouchAPIKey(_ context.Context, keyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.apiKeys {
+		if key.ID == keyID {
+			now := time.Now()
+			key.LastUsedAt = &now
+			s.apiKeys[hash] = key
+		}
+	}
+	return nil
+}
+
+func (s *fakeStorage) SaveApp(_ context.Context, app models.App) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := 100
+	for existing := range s.apps {
+		if s.apps[existing].Name == app.Name {
+			return 0, storage.ErrAppExists
+		}
+		if existing >= id {
+			id = existing + 1
+		}
+	}
+	app.ID = id
+	s.apps[id] = app
+	return id, nil
+}
+
+func (s *fakeStorage) Apps(_ context.Context) ([]models.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps := make([]models.App, 0, len(s.apps))
+	for _, app := range s.apps {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
+	return apps, nil
+}
+
+func (s *fakeStorage) RotateAppSecret(_ context.Context, appID int, secret string, previousExpiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return storage.ErrAppNotFound
+	}
+	app.PreviousSecret = app.Secret
+	app.PreviousSecretExpiresAt = &previousExpiresAt
+	app.Secret = secret
+	s.apps[appID] = app
+	return nil
+}
+
+func (s *fakeStorage) SetAppDisabled(_ context.Context, appID int, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return storage.ErrAppNotFound
+	}
+	app.DisabledAt = nil
+	if disabled {
+		now := time.Now()
+		app.DisabledAt = &now
+	}
+	s.apps[appID] = app
+	return nil
+}
+
+func (s *fakeStorage) DeleteApp(_ context.Context, appID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appID]; !ok {
+		return storage.ErrAppNotFound
+	}
+	delete(s.apps, appID)
+	return nil
+}
+
+type fakeNotifier struct {
+	registrationAttempts chan string
+	deviceLogins         chan models.LoginAlert
+	orgInvites           []models.OrgInvite
+}
+
+func (n *fakeNotifier) NewDeviceLogin(_ context.Context, alert models.LoginAlert) error {
+	n.deviceLogins <- alert
+	return nil
+}
+
+func (n *fakeNotifier) RegistrationAttempt(_ context.Context, email string) error {
+	n.registrationAttempts <- email
+	return nil
+}
+
+func (n *fakeNotifier) OrgInvitation(_ context.Context, invite models.OrgInvite) error {
+	n.orgInvites = append(n.orgInvites, invite)
+	return nil
+}
+
+func newTestAuth(t *testing.T, uniformRegister bool) (*Auth, *fakeStorage, *fakeNotifier) {
+	t.Helper()
+
+	st := newFakeStorage()
+	notifier := &fakeNotifier{
+		registrationAttempts: make(chan string, 1),
+		deviceLogins:         make(chan models.LoginAlert, 10),
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	engine, err := policy.NewEngine()
+	require.NoError(t, err)
+
+	return New(log, Deps{
+		UserSaver:       st,
+		UserProvider:    st,
+		AppProvider:     st,
+		SessionSaver:    st,
+		SessionProvider: st,
+		Devices:         st,
+		Notifier:        notifier,
+		Members:         st,
+		Clients:         st,
+		Consents:        st,
+		Roles:           st,
+		Policies:        st,
+		Orgs:            st,
+		APIKeys:         st,
+		Apps:            st,
+		Identities:      st,
+		PolicyEngine:    engine,
+	}, Config{
+		TokenTTL:        time.Hour,
+		DecisionTTL:     time.Minute,
+		UniformRegister: uniformRegister,
+	}), st, notifier
+}
+
+func TestLogin_UnknownEmailComparesDummyHash(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = st.SaveUser(ctx, "known@example.com", passHash)
+	require.NoError(t, err)
+
+	var compared [][]byte
+	a.comparePassword = func(hash []byte, password []byte) error {
+		compared = append(compared, hash)
+		return bcrypt.CompareHashAndPassword(hash, password)
+	}
+
+	_, err = a.Login(ctx, "unknown@example.com", "wrong-password", 1, nil, false, models.ClientInfo{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Login(ctx, "known@example.com", "wrong-password", 1, nil, false, models.ClientInfo{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// На оба неверных входа ровно одно сравнение с хешем. Для неизвестного email это фиктивный
+	// хеш той же стоимости что и при регистрации, поэтому по времени ответа их не отличить
+	require.Len(t, compared, 2)
+	assert.Equal(t, dummyPassHash(), compared[0])
+	assert.Equal(t, passHash, compared[1])
+
+	cost, err := bcrypt.Cost(compared[0])
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+}
+
+func TestRegisterNewUser_UniformResponse(t *testing.T) {
+	a, _, notifier := newTestAuth(t, true)
+
+	ctx := context.Background()
+
+	firstID, err := a.RegisterNewUser(ctx, "player@example.com", "password", 0, "")
+	require.NoError(t, err)
+
+	secondID, err := a.RegisterNewUser(ctx, "player@example.com", "another-password", 0, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, firstID, secondID)
+
+	select {
+	case email := <-notifier.registrationAttempts:
+		assert.Equal(t, "player@example.com", email)
+	case <-time.After(time.Second):
+		t.Fatal("owner was not notified about registration attempt")
+	}
+}
+
+func TestRegisterNewUser_UserExists(t *testing.T) {
+	a, _, _ := newTestAuth(t, false)
+
+	ctx := context.Background()
+
+	_, err := a.RegisterNewUser(ctx, "player@example.com", "password", 0, "")
+	require.NoError(t, err)
+
+	_, err = a.RegisterNewUser(ctx, "player@example.com", "password", 0, "")
+	assert.ErrorIs(t, err, ErrUserExists)
+}
+
+func TestRegisterNewUser_DomainAllowlist(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[2] = models.App{ID: 2, RegisterMode: models.RegisterModeDomain, AllowedDomains: []string{"corp.example"}}
+
+	ctx := context.Background()
+
+	_, err := a.RegisterNewUser(ctx, "player@gmail.example", "password", 2, "")
+	assert.ErrorIs(t, err, ErrDomainNotAllowed)
+
+	_, err = a.RegisterNewUser(ctx, "employee@Corp.Example", "password", 2, "")
+	assert.NoError(t, err)
+}
+
+func TestRegisterNewUser_InviteOnly(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[2] = models.App{ID: 2, RegisterMode: models.RegisterModeInvite}
+
+	ctx := context.Background()
+
+	_, err := a.RegisterNewUser(ctx, "first@example.com", "password", 2, "")
+	assert.ErrorIs(t, err, ErrInviteRequired)
+
+	code, err := a.CreateInvite(ctx, 2, 1, 1, time.Hour)
+	require.NoError(t, err)
+
+	_, err = a.RegisterNewUser(ctx, "first@example.com", "password", 2, code)
+	require.NoError(t, err)
+
+	_, err = a.RegisterNewUser(ctx, "second@example.com", "password", 2, code)
+	assert.ErrorIs(t, err, ErrInvalidInvite)
+}
+
+func TestRegisterNewUser_InviteKeptWhenEmailTaken(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[2] = models.App{ID: 2, RegisterMode: models.RegisterModeInvite}
+	ctx := context.Background()
+
+	_, err := st.SaveUser(ctx, "taken@example.com", nil)
+	require.NoError(t, err)
+
+	code, err := a.CreateInvite(ctx, 2, 1, 1, time.Hour)
+	require.NoError(t, err)
+
+	_, err = a.RegisterNewUser(ctx, "taken@example.com", "password", 2, code)
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	// Неудачная регистрация не сожгла единственное использование инвайта
+	userID, err := a.RegisterNewUser(ctx, "new@example.com", "password", 2, code)
+	require.NoError(t, err)
+
+	status, err := st.MemberStatus(ctx, 2, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.MemberActive, status)
+}
+
+func TestLogin_ApprovalPending(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[2] = models.App{ID: 2, Secret: "secret", RegisterMode: models.RegisterModeApproval}
+
+	ctx := context.Background()
+
+	userID, err := a.RegisterNewUser(ctx, "player@example.com", "password", 2, "")
+	require.NoError(t, err)
+
+	_, err = a.Login(ctx, "player@example.com", "password", 2, nil, false, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrApprovalPending)
+
+	require.NoError(t, a.ApproveRegistration(ctx, 2, userID, true))
+
+	_, err = a.Login(ctx, "player@example.com", "password", 2, nil, false, models.ClientInfo{})
+	assert.NoError(t, err)
+}
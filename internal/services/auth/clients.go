@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const clientSecretBytes = 32
+
+// ClientStorage хранит секреты приложений для client credentials
+type ClientStorage interface {
+	SetClientSecret(ctx context.Context, appID int, secretHash []byte) error
+}
+
+var (
+	ErrInvalidClient = errors.New("invalid client credentials")
+	ErrInvalidScope  = errors.New("scope is not allowed for app")
+)
+
+// ClientToken выдает сервисный токен приложению по его id и секрету (OAuth client credentials).
+// Если scopes не переданы то в токен попадают все scope приложения
+func (a *Auth) ClientToken(ctx context.Context, appID int, clientSecret string, scopes []string) (string, []string, error) {
+	const op = "auth.ClientToken"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	app, err := a.appProvader.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+
+			return "", nil, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+		}
+		log.Error("falied to get app", sl.Err(err))
+
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if app.DisabledAt != nil {
+		log.Warn("app is disabled")
+
+		return "", nil, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+	}
+
+	// Приложение без секрета вообще не может получать сервисные токены
+	if len(app.ClientSecretHash) == 0 || bcrypt.CompareHashAndPassword(app.ClientSecretHash, []byte(clientSecret)) != nil {
+		log.Warn("invalid client secret")
+
+		return "", nil, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+	}
+
+	granted, err := grantScopes(app, scopes)
+	if err != nil {
+		log.Warn("requested scope is not allowed", slog.Any("scopes", scopes))
+
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwtT.NewServiceToken(app, a.tokenTTL, granted)
+	if err != nil {
+		log.Error("falied to generate token", sl.Err(err))
+
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service token issued", slog.Any("scopes", granted))
+
+	return token, granted, nil
+}
+
+// RotateClientSecret создает приложению новый секрет, старый сразу перестает работать.
+// Секрет возвращается один раз, у нас хранится только хеш
+func (a *Auth) RotateClientSecret(ctx context.Context, appID int) (string, error) {
+	const op = "auth.RotateClientSecret"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	secret, err := randomToken(clientSecretBytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.clients.SetClientSecret(ctx, appID, secretHash); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("falied to save client secret", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client secret rotated")
+
+	return secret, nil
+}
+
+func grantScopes(app models.App, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return app.Scopes, nil
+	}
+
+	for _, scope := range requested {
+		if !slices.Contains(app.Scopes, scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	return requested, nil
+}
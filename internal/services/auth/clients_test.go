@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientToken(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[3] = models.App{ID: 3, Name: "aggregator", Secret: "signing-secret", Scopes: []string{"leaderboard:write", "matches:read"}}
+
+	_, _, err := a.ClientToken(context.Background(), 3, "", nil)
+	assert.ErrorIs(t, err, ErrInvalidClient, "app without secret must not get tokens")
+
+	secret, err := a.RotateClientSecret(context.Background(), 3)
+	require.NoError(t, err)
+
+	token, scopes, err := a.ClientToken(context.Background(), 3, secret, []string{"matches:read"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"matches:read"}, scopes)
+
+	claims, err := jwtT.ParseToken(token, func(int) (string, error) { return "signing-secret", nil })
+	require.NoError(t, err)
+	assert.True(t, claims.IsService())
+	assert.Equal(t, 3, claims.AppID)
+	assert.Equal(t, []string{"matches:read"}, claims.Scopes)
+
+	_, scopes, err = a.ClientToken(context.Background(), 3, secret, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"leaderboard:write", "matches:read"}, scopes)
+
+	_, _, err = a.ClientToken(context.Background(), 3, secret, []string{"users:delete"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, _, err = a.ClientToken(context.Background(), 3, "wrong", nil)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, _, err = a.ClientToken(context.Background(), 4, secret, nil)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, err = a.RotateClientSecret(context.Background(), 4)
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// ConsentStorage хранит согласия пользователей на scope приложений
+type ConsentStorage interface {
+	Consent(ctx context.Context, userID int64, appID int) (models.Consent, error)
+	SaveConsent(ctx context.Context, userID int64, appID int, scopes []string) error
+	Consents(ctx context.Context, userID int64) ([]models.Consent, error)
+	DeleteConsent(ctx context.Context, userID int64, appID int) error
+}
+
+var (
+	ErrConsentRequired = errors.New("user consent required for requested scopes")
+	ErrConsentNotFound = errors.New("consent not found")
+)
+
+// CheckConsent проверяет что пользователь уже согласился отдать приложению все scopes.
+// С grant=true пользователь соглашается прямо сейчас и согласие записывается.
+// Если scopes пустые то согласие не нужно, такой токен получает только openid без данных пользователя
+func (a *Auth) CheckConsent(ctx context.Context, userID int64, appID int, scopes []string, grant bool) error {
+	const op = "auth.CheckConsent"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", appID),
+	)
+
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	app, err := a.appProvader.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, scope := range scopes {
+		if !app.AllowsUserScope(scope) {
+			log.Warn("requested scope is not declared by app", slog.String("scope", scope))
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidScope)
+		}
+	}
+
+	if grant {
+		if err := a.consents.SaveConsent(ctx, userID, appID, scopes); err != nil {
+			log.Error("falied to save consent", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("consent granted", slog.Any("scopes", scopes))
+
+		return nil
+	}
+
+	consent, err := a.consents.Consent(ctx, userID, appID)
+	if err != nil && !errors.Is(err, storage.ErrConsentNotFound) {
+		log.Error("falied to get consent", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			log.Info("consent required", slog.String("scope", scope))
+
+			return fmt.Errorf("%s: %w", op, ErrConsentRequired)
+		}
+	}
+
+	return nil
+}
+
+// ListConsents это приложения которым пользователь дал доступ
+func (a *Auth) ListConsents(ctx context.Context, userID int64) ([]models.Consent, error) {
+	const op = "auth.ListConsents"
+
+	consents, err := a.consents.Consents(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consents, nil
+}
+
+// RevokeConsent отзывает согласие целиком. Уже выданные токены живут до конца срока,
+// а при следующем входе приложению снова придется спросить пользователя
+func (a *Auth) RevokeConsent(ctx context.Context, userID int64, appID int) error {
+	const op = "auth.RevokeConsent"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", appID),
+	)
+
+	if err := a.consents.DeleteConsent(ctx, userID, appID); err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrConsentNotFound)
+		}
+		log.Error("falied to delete consent", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("consent revoked")
+
+	return nil
+}
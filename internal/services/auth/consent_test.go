@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLogin_Consent(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[2] = models.App{ID: 2, Secret: "secret", RegisterMode: models.RegisterModeOpen, Scopes: []string{"matches:read"}}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	userID, err := st.SaveUser(context.Background(), "player@example.com", passHash)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	login := func(scopes []string, consent bool) (string, error) {
+		return a.Login(ctx, "player@example.com", "password", 2, scopes, consent, models.ClientInfo{})
+	}
+
+	_, err = login([]string{"openid", "matches:read"}, false)
+	assert.ErrorIs(t, err, ErrConsentRequired)
+
+	_, err = login([]string{"matches:write"}, true)
+	assert.ErrorIs(t, err, ErrInvalidScope, "scope is not declared by app")
+
+	token, err := login([]string{"openid", "matches:read"}, true)
+	require.NoError(t, err)
+
+	claims, err := jwtT.ParseToken(token, func(int) (string, error) { return "secret", nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "matches:read"}, claims.Scopes)
+	assert.Empty(t, claims.Email, "email scope was not granted")
+
+	// Согласие запомнено, второй раз спрашивать не надо. Новый scope снова требует согласия
+	_, err = login([]string{"matches:read"}, false)
+	assert.NoError(t, err)
+	_, err = login([]string{"matches:read", "email"}, false)
+	assert.ErrorIs(t, err, ErrConsentRequired)
+
+	consents, err := a.ListConsents(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, consents, 1)
+	assert.ElementsMatch(t, []string{"openid", "matches:read"}, consents[0].Scopes)
+
+	require.NoError(t, a.RevokeConsent(ctx, userID, 2))
+	assert.ErrorIs(t, a.RevokeConsent(ctx, userID, 2), ErrConsentNotFound)
+
+	_, err = login([]string{"matches:read"}, false)
+	assert.ErrorIs(t, err, ErrConsentRequired)
+
+	// Без scopes согласие не нужно, но и данных пользователя в токене нет
+	token, err = login(nil, false)
+	require.NoError(t, err)
+	claims, err = jwtT.ParseToken(token, func(int) (string, error) { return "secret", nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid"}, claims.Scopes)
+	assert.Empty(t, claims.Email)
+}
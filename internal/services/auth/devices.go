@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const (
+	lockTokenBytes = 32
+	loginAlertTTL  = 7 * 24 * time.Hour
+	notifyTimeout  = 30 * time.Second
+)
+
+type DeviceStorage interface {
+	KnownDevice(ctx context.Context, userID int64, device string, ipPrefix string) (deviceSeen bool, prefixSeen bool, hasAny bool, err error)
+	SaveDevice(ctx context.Context, userID int64, device string, ipPrefix string) error
+	SaveLoginAlert(ctx context.Context, userID int64, tokenHash string, ip string, userAgent string, expiresAt time.Time) error
+	UseLoginAlert(ctx context.Context, tokenHash string) (int64, error)
+	LockUser(ctx context.Context, userID int64) error
+}
+
+// Notifier отправляет пользователю уведомления. Реализации лежат в lib/notifier
+type Notifier interface {
+	NewDeviceLogin(ctx context.Context, alert models.LoginAlert) error
+	RegistrationAttempt(ctx context.Context, email string) error
+	OrgInvitation(ctx context.Context, invite models.OrgInvite) error
+}
+
+// checkDevice запоминает устройство и сеть с которых вошел пользователь и если хотя бы одно
+// из них мы раньше не видели то отправляет уведомление. Ошибки тут не должны ломать логин поэтому только логируем
+func (a *Auth) checkDevice(ctx context.Context, log *slog.Logger, user models.User, app models.App, client models.ClientInfo) {
+	device := deviceFingerprint(client.UserAgent)
+	prefix := ipPrefix(client.IP)
+
+	deviceSeen, prefixSeen, hasAny, err := a.devices.KnownDevice(ctx, user.ID, device, prefix)
+	if err != nil {
+		log.Error("falied to check known device", sl.Err(err))
+		return
+	}
+
+	if err := a.devices.SaveDevice(ctx, user.ID, device, prefix); err != nil {
+		log.Error("falied to save device", sl.Err(err))
+		return
+	}
+
+	// Самый первый вход после регистрации новым не считаем, иначе уведомление придет каждому
+	if !hasAny || (deviceSeen && prefixSeen) {
+		return
+	}
+
+	lockToken, err := randomToken(lockTokenBytes)
+	if err != nil {
+		log.Error("falied to generate lock token", sl.Err(err))
+		return
+	}
+
+	now := time.Now()
+	if err := a.devices.SaveLoginAlert(ctx, user.ID, hashToken(lockToken), client.IP, client.UserAgent, now.Add(loginAlertTTL)); err != nil {
+		log.Error("falied to save login alert", sl.Err(err))
+		return
+	}
+
+	alert := models.LoginAlert{
+		UserID:    user.ID,
+		Email:     user.Email,
+		AppID:     app.ID,
+		AppName:   app.Name,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		At:        now,
+		LockToken: lockToken,
+	}
+
+	log.Info("login from new device", slog.Bool("new_device", !deviceSeen), slog.Bool("new_network", !prefixSeen))
+
+	// Отправка письма может быть долгой, пользователя ждать не заставляем
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		defer cancel()
+
+		if err := a.notifier.NewDeviceLogin(ctx, alert); err != nil {
+			log.Error("falied to send new device notification", sl.Err(err))
+		}
+	}()
+}
+
+// LockAccount вызывается по ссылке "это был не я" из уведомления. Блокирует аккаунт и
+// завершает все его сессии, разблокировать потом может только админ
+func (a *Auth) LockAccount(ctx context.Context, lockToken string) error {
+	const op = "auth.LockAccount"
+
+	log := a.log.With(slog.String("op", op))
+
+	userID, err := a.devices.UseLoginAlert(ctx, hashToken(lockToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrAlertNotFound) {
+			log.Warn("lock token not found or expired")
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidLockToken)
+		}
+		log.Error("falied to use login alert", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", userID))
+
+	if err := a.devices.LockUser(ctx, userID); err != nil {
+		log.Error("falied to lock user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.sesSaver.RevokeAllSessions(ctx, userID); err != nil {
+		log.Error("falied to revoke sessions", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("account locked by owner")
+
+	return nil
+}
+
+// deviceFingerprint это хеш user agent. Сам user agent хранить незачем, а сравнивать так удобнее
+func deviceFingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ipPrefix обрезает адрес до сети: /24 для IPv4 и /48 для IPv6, что бы смена адреса у
+// провайдера не считалась новым входом
+func ipPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
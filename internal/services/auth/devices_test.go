@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIPPrefix(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "192.168.1.15", want: "192.168.1.0/24"},
+		{ip: "192.168.1.200", want: "192.168.1.0/24"},
+		{ip: "2001:db8:abcd:12::1", want: "2001:db8:abcd::/48"},
+		{ip: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ipPrefix(tt.ip), tt.ip)
+	}
+}
+
+func TestCheckDevice_NotifiesAboutNewDevice(t *testing.T) {
+	a, st, notifier := newTestAuth(t, false)
+	ctx := context.Background()
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	userID, err := st.SaveUser(ctx, "student@school.ru", passHash)
+	require.NoError(t, err)
+
+	laptop := models.ClientInfo{IP: "10.0.0.5", UserAgent: "Firefox"}
+
+	// Первый вход после регистрации и вход из той же сети с того же браузера уведомлений не шлют
+	_, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, laptop)
+	require.NoError(t, err)
+	_, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{IP: "10.0.0.77", UserAgent: "Firefox"})
+	require.NoError(t, err)
+	assertNoDeviceLogin(t, notifier)
+
+	phone := models.ClientInfo{IP: "10.0.0.5", UserAgent: "Chrome Mobile"}
+	_, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, phone)
+	require.NoError(t, err)
+
+	alert := waitDeviceLogin(t, notifier)
+	assert.Equal(t, userID, alert.UserID)
+	assert.Equal(t, "student@school.ru", alert.Email)
+	assert.Equal(t, 1, alert.AppID)
+	assert.Equal(t, phone.IP, alert.IP)
+	assert.Equal(t, phone.UserAgent, alert.UserAgent)
+	assert.NotEmpty(t, alert.LockToken)
+
+	// Тот же браузер из другой сети это тоже новый вход
+	_, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{IP: "172.16.4.2", UserAgent: "Firefox"})
+	require.NoError(t, err)
+	waitDeviceLogin(t, notifier)
+}
+
+func TestLockAccount(t *testing.T) {
+	a, st, notifier := newTestAuth(t, false)
+	ctx := context.Background()
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = st.SaveUser(ctx, "student@school.ru", passHash)
+	require.NoError(t, err)
+
+	token, err := a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{IP: "10.0.0.5", UserAgent: "Firefox"})
+	require.NoError(t, err)
+	_, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{IP: "203.0.113.9", UserAgent: "curl"})
+	require.NoError(t, err)
+	alert := waitDeviceLogin(t, notifier)
+
+	assert.ErrorIs(t, a.LockAccount(ctx, "not-a-lock-token"), ErrInvalidLockToken)
+	require.NoError(t, a.LockAccount(ctx, alert.LockToken))
+
+	// Ссылка одноразовая
+	assert.ErrorIs(t, a.LockAccount(ctx, alert.LockToken), ErrInvalidLockToken)
+
+	// Выданные токены отозваны, войти заново нельзя даже с верным паролем
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{IP: "10.0.0.5", UserAgent: "Firefox"})
+	assert.ErrorIs(t, err, ErrAccountLocked)
+
+	// Форма входа OAuth идет через Authenticate, блокировка действует и там
+	_, err = a.Authenticate(ctx, "student@school.ru", "password", 1)
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	// С неверным паролем про блокировку не рассказываем
+	_, err = a.Authenticate(ctx, "student@school.ru", "wrong", 1)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func waitDeviceLogin(t *testing.T, notifier *fakeNotifier) models.LoginAlert {
+	t.Helper()
+
+	select {
+	case alert := <-notifier.deviceLogins:
+		return alert
+	case <-time.After(time.Second):
+		t.Fatal("new device notification was not sent")
+		return models.LoginAlert{}
+	}
+}
+
+func assertNoDeviceLogin(t *testing.T, notifier *fakeNotifier) {
+	t.Helper()
+
+	select {
+	case alert := <-notifier.deviceLogins:
+		t.Fatalf("unexpected new device notification for %s", alert.UserAgent)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/ldapauth"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Directory это внешний каталог пользователей (LDAP / Active Directory) который проверяет пароль
+// вместо нашей базы. Реализация лежит в lib/ldapauth
+type Directory interface {
+	Name() string
+	Authenticate(ctx context.Context, email string, password string) (ldapauth.User, error)
+}
+
+// IdentityStorage хранит привязки внешних аккаунтов к нашим, та же таблица что у федерации
+type IdentityStorage interface {
+	Identity(ctx context.Context, provider string, subject string) (models.Identity, error)
+	SaveIdentity(ctx context.Context, identity models.Identity) error
+}
+
+var (
+	// ErrAccountNotLinked значит что пароль в каталоге верный, но у нас уже есть локальный аккаунт
+	// с этим email. Сами их не склеиваем, иначе каталог получил бы доступ к чужому аккаунту
+	ErrAccountNotLinked = errors.New("local account is not linked to directory")
+	ErrNoDirectory      = errors.New("app does not use a directory")
+	ErrAlreadyLinked    = errors.New("directory account is already linked")
+)
+
+// loginDirectory проверяет пароль в каталоге и при первом входе заводит пользователя у нас.
+// Пароль из каталога мы не храним, у такого пользователя случайный хеш и войти мимо каталога он не сможет
+func (a *Auth) loginDirectory(ctx context.Context, log *slog.Logger, dir Directory, email string, password string, appID int) (models.User, error) {
+	entry, err := dir.Authenticate(ctx, email, password)
+	if err != nil {
+		if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+			log.Info("invalid directory credentials")
+
+			return models.User{}, ErrInvalidCredentials
+		}
+		log.Error("falied to authenticate in directory", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	user, err := a.directoryUser(ctx, log, dir, entry)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Каталог главный источник ролей в этом приложении, поэтому синхронизируем их на каждом входе.
+	// Глобальные роли, в том числе admin, каталог не трогает
+	if err := a.syncDirectoryRoles(ctx, log, user.ID, appID, entry.Roles); err != nil {
+		log.Error("falied to sync user roles", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// directoryUser находит нашего пользователя по привязке к записи каталога. Новых заводит сам,
+// а существующий локальный аккаунт с тем же email пускает только после явной привязки админом
+func (a *Auth) directoryUser(ctx context.Context, log *slog.Logger, dir Directory, entry ldapauth.User) (models.User, error) {
+	provider := directoryProvider(dir)
+	subject := strings.ToLower(entry.DN)
+
+	identity, err := a.identities.Identity(ctx, provider, subject)
+	if err == nil {
+		return a.usrProvader.UserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, storage.ErrIdentityNotFound) {
+		log.Error("falied to get directory identity", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	_, err = a.usrProvader.User(ctx, entry.Email)
+	if err == nil {
+		log.Warn("local account is not linked to directory", slog.String("dn", entry.DN))
+
+		return models.User{}, ErrAccountNotLinked
+	}
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		log.Error("falied to get directory user", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	user, err := a.provisionUser(ctx, entry.Email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			// Локальный аккаунт с этим email появился параллельно, он тоже не наш
+			return models.User{}, ErrAccountNotLinked
+		}
+		log.Error("falied to provision directory user", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	err = a.identities.SaveIdentity(ctx, models.Identity{
+		Provider: provider,
+		Subject:  subject,
+		UserID:   user.ID,
+		Email:    entry.Email,
+	})
+	if err != nil {
+		log.Error("falied to link directory user", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	log.Info("user provisioned from directory", slog.Int64("user_id", user.ID))
+
+	return user, nil
+}
+
+func (a *Auth) provisionUser(ctx context.Context, email string) (models.User, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	id, err := a.usrSaver.SaveUser(ctx, email, passHash)
+	if err != nil {
+		return models.User{}, fmt.Errorf("save user: %w", err)
+	}
+
+	return models.User{ID: id, Email: email, PassHash: passHash}, nil
+}
+
+// syncDirectoryRoles приводит роли пользователя в приложении к тем что пришли из групп каталога.
+// Роли ищутся по имени среди ролей приложения, их надо завести заранее через CreateRole
+func (a *Auth) syncDirectoryRoles(ctx context.Context, log *slog.Logger, userID int64, appID int, names []string) error {
+	appRoles, err := a.roles.Roles(ctx, appID)
+	if err != nil {
+		return err
+	}
+	assigned, err := a.roles.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return err
+	}
+
+	has := make(map[int64]bool, len(assigned))
+	for _, role := range assigned {
+		has[role.ID] = true
+	}
+
+	known := make(map[string]bool, len(appRoles))
+	for _, role := range appRoles {
+		known[role.Name] = true
+		want := slices.Contains(names, role.Name)
+
+		switch {
+		case want && !has[role.ID]:
+			if err := a.roles.AssignRole(ctx, userID, role.ID); err != nil {
+				return err
+			}
+		case !want && has[role.ID]:
+			// Унаследованная роль в UserRoles есть, а напрямую не назначена, это не ошибка
+			if err := a.roles.UnassignRole(ctx, userID, role.ID); err != nil && !errors.Is(err, storage.ErrRoleNotAssigned) {
+				return err
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !known[name] {
+			log.Warn("directory role does not exist in app", slog.String("role", name))
+		}
+	}
+
+	return nil
+}
+
+// LinkDirectoryAccount привязывает существующий локальный аккаунт к записи каталога приложения.
+// После этого пользователь входит в приложение паролем из каталога
+func (a *Auth) LinkDirectoryAccount(ctx context.Context, actorID int64, userID int64, appID int, dn string) error {
+	const op = "auth.LinkDirectoryAccount"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorID),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", appID),
+	)
+
+	dir, ok := a.directories[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, ErrNoDirectory)
+	}
+
+	user, err := a.usrProvader.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("falied to get user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.identities.SaveIdentity(ctx, models.Identity{
+		Provider: directoryProvider(dir),
+		Subject:  strings.ToLower(dn),
+		UserID:   user.ID,
+		Email:    user.Email,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrIdentityExists) {
+			return fmt.Errorf("%s: %w", op, ErrAlreadyLinked)
+		}
+		log.Error("falied to link directory account", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("directory account linked", slog.String("dn", dn))
+
+	return nil
+}
+
+// directoryProvider это имя провайдера в таблице привязок. Префикс не дает пересечься с провайдерами федерации
+func directoryProvider(dir Directory) string {
+	return "ldap:" + dir.Name()
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/ldapauth"
+	"github.com/skinkvi/STTAuth/internal/lib/ldapauth/ldaptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func userRoleNames(t *testing.T, st *fakeStorage, userID int64, appID int) []string {
+	t.Helper()
+
+	roles, err := st.UserRoles(context.Background(), userID, appID)
+	require.NoError(t, err)
+	return roleNames(roles)
+}
+
+func TestLogin_Directory(t *testing.T) {
+	const (
+		serviceDN  = "cn=sso,dc=example,dc=com"
+		teachersDN = "cn=teachers,dc=example,dc=com"
+		adminsDN   = "cn=admins,dc=example,dc=com"
+		aliceDN    = "uid=alice,ou=people,dc=example,dc=com"
+		bobDN      = "uid=bob,ou=people,dc=example,dc=com"
+	)
+
+	srv := ldaptest.NewServer(t,
+		ldaptest.Entry{DN: serviceDN, Password: "service-secret"},
+		ldaptest.Entry{
+			DN:       aliceDN,
+			Password: "alice-pass",
+			Attributes: map[string][]string{
+				"mail":     {"alice@example.com"},
+				"memberOf": {teachersDN, adminsDN},
+			},
+		},
+		ldaptest.Entry{
+			DN:         bobDN,
+			Password:   "bob-pass",
+			Attributes: map[string][]string{"mail": {"bob@example.com"}},
+		},
+	)
+
+	ctx := context.Background()
+	a, st, _ := newTestAuth(t, false)
+	st.apps[1] = models.App{ID: 1, Name: "corp", Secret: "secret"}
+	a.directories = map[int]Directory{1: ldapauth.New(ldapauth.Config{
+		Name:         "corp",
+		URL:          srv.URL(),
+		BindDN:       serviceDN,
+		BindPassword: "service-secret",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		GroupRoles:   map[string]string{teachersDN: "teacher", adminsDN: models.RoleAdmin},
+	})}
+
+	teacherID, err := a.CreateRole(ctx, models.Role{Name: "teacher", AppID: 1})
+	require.NoError(t, err)
+	_, err = a.CreateRole(ctx, models.Role{Name: models.RoleAdmin, Permissions: []string{models.PermissionAll}})
+	require.NoError(t, err)
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, err := a.Login(ctx, "alice@example.com", "wrong", 1, nil, false, models.ClientInfo{})
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+		_, err = st.User(ctx, "alice@example.com")
+		assert.Error(t, err, "user must not be provisioned on failed login")
+	})
+
+	t.Run("provisions user on first login", func(t *testing.T) {
+		token, err := a.Login(ctx, "alice@example.com", "alice-pass", 1, nil, false, models.ClientInfo{})
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		user, err := st.User(ctx, "alice@example.com")
+		require.NoError(t, err)
+
+		// Пароль из каталога у нас не оседает
+		assert.Error(t, bcrypt.CompareHashAndPassword(user.PassHash, []byte("alice-pass")))
+
+		// Группа админов в каталоге это роль приложения, а не глобальный admin
+		assert.Equal(t, []string{"teacher"}, userRoleNames(t, st, user.ID, 1))
+		isAdmin, err := st.IsAdmin(ctx, user.ID)
+		require.NoError(t, err)
+		assert.False(t, isAdmin)
+
+		_, err = a.Login(ctx, "alice@example.com", "alice-pass", 1, nil, false, models.ClientInfo{})
+		require.NoError(t, err, "linked user logs in again")
+	})
+
+	t.Run("existing local account is not linked automatically", func(t *testing.T) {
+		userID, err := st.SaveUser(ctx, "bob@example.com", []byte("x"))
+		require.NoError(t, err)
+		require.NoError(t, st.SetAdmin(ctx, userID, true))
+		require.NoError(t, st.AssignRole(ctx, userID, teacherID))
+
+		_, err = a.Login(ctx, "bob@example.com", "bob-pass", 1, nil, false, models.ClientInfo{})
+		assert.ErrorIs(t, err, ErrAccountNotLinked)
+		assert.Equal(t, []string{"teacher"}, userRoleNames(t, st, userID, 1), "roles must not change before linking")
+
+		require.NoError(t, a.LinkDirectoryAccount(ctx, 99, userID, 1, "UID=bob,ou=people,dc=example,dc=com"))
+		assert.ErrorIs(t, a.LinkDirectoryAccount(ctx, 99, userID, 1, bobDN), ErrAlreadyLinked)
+
+		_, err = a.Login(ctx, "bob@example.com", "bob-pass", 1, nil, false, models.ClientInfo{})
+		require.NoError(t, err)
+
+		// bob не в группе учителей, роль приложения снята, а глобальный admin остался как был
+		assert.Empty(t, userRoleNames(t, st, userID, 1))
+		isAdmin, err := st.IsAdmin(ctx, userID)
+		require.NoError(t, err)
+		assert.True(t, isAdmin)
+	})
+
+	t.Run("link requires directory", func(t *testing.T) {
+		user, err := st.User(ctx, "bob@example.com")
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, a.LinkDirectoryAccount(ctx, 99, user.ID, 2, bobDN), ErrNoDirectory)
+		assert.ErrorIs(t, a.LinkDirectoryAccount(ctx, 99, 12345, 1, bobDN), ErrUserNotFound)
+	})
+
+	t.Run("other apps use local passwords", func(t *testing.T) {
+		st.apps[2] = models.App{ID: 2, Name: "public", Secret: "secret"}
+
+		_, err := a.Login(ctx, "alice@example.com", "alice-pass", 2, nil, false, models.ClientInfo{})
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyHash делает ту же работу что и проверка настоящего пароля
+func (a *Auth) compareDummyHash(password string) {
+	_ = a.comparePassword(dummyPassHash(), []byte(password))
+}
+
+// dummyPassHash считается с той же стоимостью что и при регистрации, иначе время ответа все равно будет разным
+func dummyPassHash() []byte {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+		if err != nil {
+			panic("cannot generate dummy hash: " + err.Error())
+		}
+		dummyHash = hash
+	})
+
+	return dummyHash
+}
+
+// notifyRegistrationAttempt пишет владельцу email что кто то пытался зарегистрироваться на его адрес.
+// Отправляем в фоне по той же причине что и в checkDevice
+func (a *Auth) notifyRegistrationAttempt(ctx context.Context, log *slog.Logger, email string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		defer cancel()
+
+		if err := a.notifier.RegistrationAttempt(ctx, email); err != nil {
+			log.Error("falied to send registration attempt notification", sl.Err(err))
+		}
+	}()
+}
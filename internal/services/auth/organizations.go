@@ -0,0 +1,364 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const (
+	orgInviteTokenBytes = 24
+	defaultOrgInviteTTL = 7 * 24 * time.Hour
+	maxOrgInviteTTL     = 30 * 24 * time.Hour
+)
+
+// OrgStorage хранит организации, их участников и приглашения
+type OrgStorage interface {
+	SaveOrganization(ctx context.Context, name string, ownerID int64) (int64, error)
+	Organization(ctx context.Context, orgID int64) (models.Organization, error)
+	UserOrganizations(ctx context.Context, userID int64) ([]models.OrgMember, error)
+	OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error)
+	OrgMember(ctx context.Context, orgID int64, userID int64) (models.OrgMember, error)
+	DeleteOrgMember(ctx context.Context, orgID int64, userID int64) error
+	SaveOrgInvite(ctx context.Context, tokenHash string, invite models.OrgInvite) error
+	AcceptOrgInvite(ctx context.Context, tokenHash string, userID int64, email string) (models.OrgInvite, error)
+}
+
+var (
+	ErrInvalidOrganization = errors.New("invalid organization")
+	ErrNotOrgMember        = errors.New("user is not a member of organization")
+	ErrOrgAccessDenied     = errors.New("not enough rights in organization")
+	ErrInvalidOrgRole      = errors.New("invalid organization role")
+	ErrInvalidOrgInvite    = errors.New("invalid or expired organization invite")
+	ErrAlreadyOrgMember    = errors.New("user is already a member of organization")
+	ErrLastOrgOwner        = errors.New("organization must keep at least one owner")
+)
+
+// CreateOrganization создает организацию, создатель становится ее владельцем
+func (a *Auth) CreateOrganization(ctx context.Context, ownerID int64, name string) (int64, error) {
+	const op = "auth.CreateOrganization"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("owner_id", ownerID),
+	)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, fmt.Errorf("%s: %w: name is required", op, ErrInvalidOrganization)
+	}
+
+	orgID, err := a.orgs.SaveOrganization(ctx, name, ownerID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("falied to save organization", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("organization created", slog.Int64("org_id", orgID))
+
+	return orgID, nil
+}
+
+// ListOrganizations отдает организации пользователя вместе с его ролью в каждой
+func (a *Auth) ListOrganizations(ctx context.Context, userID int64) ([]models.OrgMember, error) {
+	const op = "auth.ListOrganizations"
+
+	orgs, err := a.orgs.UserOrganizations(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return orgs, nil
+}
+
+// ListOrgMembers видят только участники самой организации
+func (a *Auth) ListOrgMembers(ctx context.Context, orgID int64, actorID int64) ([]models.OrgMember, error) {
+	const op = "auth.ListOrgMembers"
+
+	if _, err := a.orgMember(ctx, orgID, actorID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	members, err := a.orgs.OrgMembers(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// InviteToOrganization отправляет приглашение на email. Приглашать могут владельцы и админы,
+// но админа может пригласить только владелец. Сам токен уходит только в письмо
+func (a *Auth) InviteToOrganization(
+	ctx context.Context,
+	orgID int64,
+	actorID int64,
+	email string,
+	role string,
+	ttl time.Duration,
+) error {
+	const op = "auth.InviteToOrganization"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("org_id", orgID),
+		slog.Int64("invited_by", actorID),
+	)
+
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return fmt.Errorf("%s: %w: invalid email", op, ErrInvalidOrganization)
+	}
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+	if role != models.OrgRoleMember && role != models.OrgRoleAdmin {
+		return fmt.Errorf("%s: %w: %q", op, ErrInvalidOrgRole, role)
+	}
+	if ttl <= 0 {
+		ttl = defaultOrgInviteTTL
+	}
+	if ttl > maxOrgInviteTTL {
+		ttl = maxOrgInviteTTL
+	}
+
+	actor, err := a.orgMember(ctx, orgID, actorID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if actor.Role == models.OrgRoleMember || (role == models.OrgRoleAdmin && actor.Role != models.OrgRoleOwner) {
+		log.Warn("not enough rights to invite", slog.String("actor_role", actor.Role), slog.String("role", role))
+
+		return fmt.Errorf("%s: %w", op, ErrOrgAccessDenied)
+	}
+
+	token, err := randomToken(orgInviteTokenBytes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	invite := models.OrgInvite{
+		Token:     token,
+		OrgID:     orgID,
+		OrgName:   actor.OrgName,
+		Email:     email,
+		Role:      role,
+		InvitedBy: actorID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := a.orgs.SaveOrgInvite(ctx, hashToken(token), invite); err != nil {
+		log.Error("falied to save organization invite", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.notifier.OrgInvitation(ctx, invite); err != nil {
+		log.Error("falied to send organization invite", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("organization invite sent", slog.String("role", role))
+
+	return nil
+}
+
+// AcceptOrgInvite добавляет пользователя в организацию по приглашению. Приглашение
+// одноразовое и принять его может только владелец того email на который оно отправлено
+func (a *Auth) AcceptOrgInvite(ctx context.Context, userID int64, token string) (int64, error) {
+	const op = "auth.AcceptOrgInvite"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	user, err := a.usrProvader.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invite, err := a.orgs.AcceptOrgInvite(ctx, hashToken(token), user.ID, user.Email)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgInviteNotFound) {
+			log.Warn("invalid organization invite")
+
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidOrgInvite)
+		}
+		if errors.Is(err, storage.ErrOrgMemberExists) {
+			return 0, fmt.Errorf("%s: %w", op, ErrAlreadyOrgMember)
+		}
+		log.Error("falied to accept organization invite", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("organization invite accepted", slog.Int64("org_id", invite.OrgID), slog.String("role", invite.Role))
+
+	return invite.OrgID, nil
+}
+
+// RemoveOrgMember удаляет участника. Уйти сам может любой, владелец удаляет кого угодно,
+// админ только обычных участников. Последнего владельца удалить нельзя
+func (a *Auth) RemoveOrgMember(ctx context.Context, orgID int64, actorID int64, userID int64) error {
+	const op = "auth.RemoveOrgMember"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("org_id", orgID),
+		slog.Int64("actor_id", actorID),
+		slog.Int64("user_id", userID),
+	)
+
+	actor, err := a.orgMember(ctx, orgID, actorID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	target := actor
+	if userID != actorID {
+		target, err = a.orgMember(ctx, orgID, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		allowed := actor.Role == models.OrgRoleOwner ||
+			(actor.Role == models.OrgRoleAdmin && target.Role == models.OrgRoleMember)
+		if !allowed {
+			log.Warn("not enough rights to remove member", slog.String("actor_role", actor.Role))
+
+			return fmt.Errorf("%s: %w", op, ErrOrgAccessDenied)
+		}
+	}
+
+	if target.Role == models.OrgRoleOwner {
+		last, err := a.lastOrgOwner(ctx, orgID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if last {
+			return fmt.Errorf("%s: %w", op, ErrLastOrgOwner)
+		}
+	}
+
+	if err := a.orgs.DeleteOrgMember(ctx, orgID, userID); err != nil {
+		if errors.Is(err, storage.ErrOrgMemberNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNotOrgMember)
+		}
+		log.Error("falied to remove organization member", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("organization member removed")
+
+	return nil
+}
+
+// SwitchOrganization выдает новый токен той же сессии но от имени другой организации.
+// orgID = 0 убирает организацию из токена
+func (a *Auth) SwitchOrganization(ctx context.Context, token string, orgID int64, client models.ClientInfo) (string, error) {
+	const op = "auth.SwitchOrganization"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("org_id", orgID),
+	)
+
+	claims, err := a.VerifyToken(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if claims.IsService() {
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+	// Иначе ключ можно было бы обменять на JWT, который уже не отозвать вместе с ключом
+	if claims.APIKeyID != 0 {
+		return "", fmt.Errorf("%s: %w", op, ErrAPIKeyForbidden)
+	}
+
+	if orgID != 0 {
+		if _, err := a.orgMember(ctx, orgID, claims.UID); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	user, err := a.usrProvader.UserByID(ctx, claims.UID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Новый токен это тот же вход, поэтому и проверки те же что при входе
+	app, roles, err := a.checkAccess(ctx, log, user, claims.AppID, client)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Срок жизни остается от исходного токена, иначе переключаясь можно было бы продлевать его бесконечно
+	newToken, err := a.newToken(user, app, claims.SessionID, roles, claims.Scopes, orgID, jwtT.WithExpiresAt(claims.ExpiresAt))
+	if err != nil {
+		log.Error("falied to generate token", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return newToken, nil
+}
+
+// defaultOrganization это организация для токена при входе. Если пользователь состоит в нескольких
+// то какую выбрать мы не знаем, тогда клиент сам вызывает SwitchOrganization
+func (a *Auth) defaultOrganization(ctx context.Context, userID int64) (int64, error) {
+	orgs, err := a.orgs.UserOrganizations(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if len(orgs) != 1 {
+		return 0, nil
+	}
+	return orgs[0].OrgID, nil
+}
+
+// lastOrgOwner говорит что у организации остался один владелец
+func (a *Auth) lastOrgOwner(ctx context.Context, orgID int64) (bool, error) {
+	members, err := a.orgs.OrgMembers(ctx, orgID)
+	if err != nil {
+		return false, err
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.OrgRoleOwner {
+			owners++
+		}
+	}
+	return owners <= 1, nil
+}
+
+func (a *Auth) orgMember(ctx context.Context, orgID int64, userID int64) (models.OrgMember, error) {
+	member, err := a.orgs.OrgMember(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgMemberNotFound) {
+			return models.OrgMember{}, ErrNotOrgMember
+		}
+		return models.OrgMember{}, err
+	}
+	return member, nil
+}
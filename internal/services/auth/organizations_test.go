@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOrganizations_InviteAndToken(t *testing.T) {
+	a, st, notifier := newTestAuth(t, false)
+	ctx := context.Background()
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	ownerID, err := st.SaveUser(ctx, "owner@school.ru", passHash)
+	require.NoError(t, err)
+	studentID, err := st.SaveUser(ctx, "student@school.ru", passHash)
+	require.NoError(t, err)
+	strangerID, err := st.SaveUser(ctx, "stranger@example.com", passHash)
+	require.NoError(t, err)
+
+	_, err = a.CreateOrganization(ctx, ownerID, "  ")
+	assert.ErrorIs(t, err, ErrInvalidOrganization)
+
+	orgID, err := a.CreateOrganization(ctx, ownerID, "School 57")
+	require.NoError(t, err)
+
+	err = a.InviteToOrganization(ctx, orgID, strangerID, "student@school.ru", models.OrgRoleMember, 0)
+	assert.ErrorIs(t, err, ErrNotOrgMember)
+	err = a.InviteToOrganization(ctx, orgID, ownerID, "student@school.ru", models.OrgRoleOwner, 0)
+	assert.ErrorIs(t, err, ErrInvalidOrgRole)
+
+	require.NoError(t, a.InviteToOrganization(ctx, orgID, ownerID, "Student@School.ru", "", 0))
+	require.Len(t, notifier.orgInvites, 1)
+	invite := notifier.orgInvites[0]
+	assert.NotEmpty(t, invite.Token)
+	assert.Equal(t, "School 57", invite.OrgName)
+	assert.Equal(t, models.OrgRoleMember, invite.Role)
+
+	// Приглашение привязано к email, чужой аккаунт его не примет
+	_, err = a.AcceptOrgInvite(ctx, strangerID, invite.Token)
+	assert.ErrorIs(t, err, ErrInvalidOrgInvite)
+
+	acceptedOrg, err := a.AcceptOrgInvite(ctx, studentID, invite.Token)
+	require.NoError(t, err)
+	assert.Equal(t, orgID, acceptedOrg)
+
+	_, err = a.AcceptOrgInvite(ctx, studentID, invite.Token)
+	assert.ErrorIs(t, err, ErrInvalidOrgInvite, "invite is single use")
+
+	// Участник не может приглашать
+	err = a.InviteToOrganization(ctx, orgID, studentID, "friend@school.ru", models.OrgRoleMember, 0)
+	assert.ErrorIs(t, err, ErrOrgAccessDenied)
+
+	members, err := a.ListOrgMembers(ctx, orgID, studentID)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+	_, err = a.ListOrgMembers(ctx, orgID, strangerID)
+	assert.ErrorIs(t, err, ErrNotOrgMember)
+
+	// Единственная организация сразу попадает в токен
+	token, err := a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{})
+	require.NoError(t, err)
+	claims, err := a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, orgID, claims.OrgID)
+
+	otherID, err := a.CreateOrganization(ctx, studentID, "Chess club")
+	require.NoError(t, err)
+
+	token, err = a.Login(ctx, "student@school.ru", "password", 1, nil, false, models.ClientInfo{})
+	require.NoError(t, err)
+	claims, err = a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	assert.Zero(t, claims.OrgID, "organization is ambiguous")
+
+	switched, err := a.SwitchOrganization(ctx, token, otherID, models.ClientInfo{})
+	require.NoError(t, err)
+	switchedClaims, err := a.VerifyToken(ctx, switched)
+	require.NoError(t, err)
+	assert.Equal(t, otherID, switchedClaims.OrgID)
+	assert.Equal(t, claims.SessionID, switchedClaims.SessionID)
+
+	strangerToken, err := a.Login(ctx, "stranger@example.com", "password", 1, nil, false, models.ClientInfo{})
+	require.NoError(t, err)
+	_, err = a.SwitchOrganization(ctx, strangerToken, orgID, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrNotOrgMember)
+}
+
+func TestSwitchOrganization_AppliesLoginChecks(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+	st.apps[3] = models.App{ID: 3, Name: "league", Secret: "secret", RegisterMode: models.RegisterModeOpen}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	userID, err := st.SaveUser(ctx, "student@school.ru", passHash)
+	require.NoError(t, err)
+	orgID, err := a.CreateOrganization(ctx, userID, "School 57")
+	require.NoError(t, err)
+
+	a.tokenTTL = time.Hour
+	token, err := a.Login(ctx, "student@school.ru", "password", 3, nil, false, models.ClientInfo{})
+	require.NoError(t, err)
+	claims, err := a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+
+	// Переключение не продлевает токен
+	a.tokenTTL = 24 * time.Hour
+	switched, err := a.SwitchOrganization(ctx, token, orgID, models.ClientInfo{})
+	require.NoError(t, err)
+	switchedClaims, err := a.VerifyToken(ctx, switched)
+	require.NoError(t, err)
+	assert.Equal(t, claims.ExpiresAt.Unix(), switchedClaims.ExpiresAt.Unix())
+
+	policyID, err := a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "office network", Target: models.PolicyTargetLogin, Expression: `request.ip.startsWith("10.")`, Enabled: true})
+	require.NoError(t, err)
+	_, err = a.SwitchOrganization(ctx, token, orgID, models.ClientInfo{IP: "192.168.1.5"})
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	require.NoError(t, a.SetPolicyEnabled(ctx, policyID, false))
+
+	st.apps[3] = models.App{ID: 3, Name: "league", Secret: "secret", RegisterMode: models.RegisterModeInvite}
+	_, err = a.SwitchOrganization(ctx, token, orgID, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrNotMember)
+}
+
+func TestRemoveOrgMember(t *testing.T) {
+	a, st, notifier := newTestAuth(t, false)
+	ctx := context.Background()
+
+	ownerID, err := st.SaveUser(ctx, "owner@school.ru", nil)
+	require.NoError(t, err)
+	adminID, err := st.SaveUser(ctx, "admin@school.ru", nil)
+	require.NoError(t, err)
+	memberID, err := st.SaveUser(ctx, "member@school.ru", nil)
+	require.NoError(t, err)
+
+	orgID, err := a.CreateOrganization(ctx, ownerID, "School 57")
+	require.NoError(t, err)
+
+	join := func(userID int64, email string, role string) {
+		require.NoError(t, a.InviteToOrganization(ctx, orgID, ownerID, email, role, 0))
+		invite := notifier.orgInvites[len(notifier.orgInvites)-1]
+		_, err := a.AcceptOrgInvite(ctx, userID, invite.Token)
+		require.NoError(t, err)
+	}
+	join(adminID, "admin@school.ru", models.OrgRoleAdmin)
+	join(memberID, "member@school.ru", models.OrgRoleMember)
+
+	assert.ErrorIs(t, a.RemoveOrgMember(ctx, orgID, memberID, adminID), ErrOrgAccessDenied)
+	assert.ErrorIs(t, a.RemoveOrgMember(ctx, orgID, adminID, ownerID), ErrOrgAccessDenied)
+	assert.ErrorIs(t, a.RemoveOrgMember(ctx, orgID, ownerID, ownerID), ErrLastOrgOwner)
+
+	require.NoError(t, a.RemoveOrgMember(ctx, orgID, adminID, memberID))
+	require.NoError(t, a.RemoveOrgMember(ctx, orgID, adminID, adminID), "anyone can leave")
+
+	members, err := a.ListOrgMembers(ctx, orgID, ownerID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, ownerID, members[0].UserID)
+}
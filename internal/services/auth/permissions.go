@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// maxPermissionChecks ограничивает пачку в CheckPermissions что бы один запрос не положил базу
+const maxPermissionChecks = 100
+
+var ErrInvalidPermissionCheck = errors.New("invalid permission check")
+
+// CheckPermission отвечает может ли пользователь сделать action над resource в приложении.
+// Решение принимается по разрешениям его ролей, включая унаследованные и глобальные,
+// а то что роли разрешили еще могут запретить политики приложения для проверок
+func (a *Auth) CheckPermission(ctx context.Context, check models.PermissionCheck) (models.Decision, error) {
+	const op = "auth.CheckPermission"
+
+	decisions, err := a.CheckPermissions(ctx, []models.PermissionCheck{check})
+	if err != nil {
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return decisions[0], nil
+}
+
+// CheckPermissions это пачка проверок за один вызов. Роли каждого пользователя в приложении
+// достаются один раз на всю пачку. Ответы идут в том же порядке что и проверки
+func (a *Auth) CheckPermissions(ctx context.Context, checks []models.PermissionCheck) ([]models.Decision, error) {
+	const op = "auth.CheckPermissions"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("checks", len(checks)),
+	)
+
+	if len(checks) == 0 || len(checks) > maxPermissionChecks {
+		return nil, fmt.Errorf("%s: %w: from 1 to %d checks allowed", op, ErrInvalidPermissionCheck, maxPermissionChecks)
+	}
+	for _, check := range checks {
+		if err := validatePermissionCheck(check); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	type rolesKey struct {
+		userID int64
+		appID  int
+	}
+	rolesCache := make(map[rolesKey][]models.Role)
+	users := make(map[int64]models.User)
+	apps := make(map[int]models.App)
+	appPolicies := make(map[int][]models.Policy)
+	now := time.Now()
+
+	decisions := make([]models.Decision, 0, len(checks))
+	for _, check := range checks {
+		user, ok := users[check.UserID]
+		if !ok {
+			var err error
+			user, err = a.usrProvader.UserByID(ctx, check.UserID)
+			if err != nil {
+				if errors.Is(err, storage.ErrUserNotFound) {
+					return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+				}
+				log.Error("falied to get user", sl.Err(err))
+
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			users[check.UserID] = user
+		}
+
+		if user.LockedAt != nil {
+			decisions = append(decisions, models.Decision{Reason: "user is locked"})
+			continue
+		}
+
+		key := rolesKey{userID: check.UserID, appID: check.AppID}
+		roles, ok := rolesCache[key]
+		if !ok {
+			var err error
+			roles, err = a.roles.UserRoles(ctx, check.UserID, check.AppID)
+			if err != nil {
+				log.Error("falied to get user roles", sl.Err(err))
+
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			rolesCache[key] = roles
+		}
+
+		decision := decide(roles, check)
+		if !decision.Allowed || check.AppID == 0 {
+			decisions = append(decisions, decision)
+			continue
+		}
+
+		app, ok := apps[check.AppID]
+		if !ok {
+			var err error
+			app, err = a.appProvader.App(ctx, check.AppID)
+			if err != nil {
+				if errors.Is(err, storage.ErrAppNotFound) {
+					return nil, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+				}
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			apps[check.AppID] = app
+
+			appPolicies[check.AppID], err = a.policies.Policies(ctx, check.AppID)
+			if err != nil {
+				log.Error("falied to get policies", sl.Err(err))
+
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		input := policyInput(user, app, roles, models.PolicyTargetCheck, models.ClientInfo{}, check.Action, check.Resource, now)
+		if policyDecision := evaluatePolicies(a.policyEngine, appPolicies[check.AppID], models.PolicyTargetCheck, input); !policyDecision.Allowed {
+			decision = policyDecision
+		}
+
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, nil
+}
+
+// DecisionTTL это сколько вызывающий может кешировать ответы CheckPermission
+func (a *Auth) DecisionTTL() time.Duration {
+	return a.decisionTTL
+}
+
+func decide(roles []models.Role, check models.PermissionCheck) models.Decision {
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if models.PermissionGrants(permission, check.Resource, check.Action) {
+				return models.Decision{
+					Allowed: true,
+					Reason:  fmt.Sprintf("granted by role %q (%s)", role.Name, permission),
+				}
+			}
+		}
+	}
+
+	return models.Decision{
+		Reason: fmt.Sprintf("no role grants %s on %s", check.Action, check.Resource),
+	}
+}
+
+func validatePermissionCheck(check models.PermissionCheck) error {
+	switch {
+	case check.UserID == 0:
+		return fmt.Errorf("%w: user_id is required", ErrInvalidPermissionCheck)
+	case check.Action == "" || strings.Contains(check.Action, ":"):
+		return fmt.Errorf("%w: invalid action %q", ErrInvalidPermissionCheck, check.Action)
+	case check.Resource == "":
+		return fmt.Errorf("%w: resource is required", ErrInvalidPermissionCheck)
+	}
+	return nil
+}
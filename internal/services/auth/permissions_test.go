@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionGrants(t *testing.T) {
+	tests := []struct {
+		permission string
+		resource   string
+		action     string
+		want       bool
+	}{
+		{models.PermissionAll, "matches/42", "delete", true},
+		{"matches:read", "matches", "read", true},
+		{"matches:read", "matches/42", "read", true},
+		{"matches:read", "matches/42", "write", false},
+		{"matches:read", "matchesarchive", "read", false},
+		{"matches:*", "matches/42", "write", true},
+		{"*:read", "teams/7", "read", true},
+		{"matches/*/score:write", "matches/42/score", "write", true},
+		{"matches/42:write", "matches/43", "write", false},
+		{"matches", "matches", "read", false},
+	}
+
+	for _, tt := range tests {
+		got := models.PermissionGrants(tt.permission, tt.resource, tt.action)
+		assert.Equal(t, tt.want, got, "%s on %s:%s", tt.permission, tt.resource, tt.action)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "judge@example.com", []byte("hash"))
+	require.NoError(t, err)
+	lockedID, err := st.SaveUser(ctx, "locked@example.com", []byte("hash"))
+	require.NoError(t, err)
+	locked := st.users["locked@example.com"]
+	now := time.Now()
+	locked.LockedAt = &now
+	st.users["locked@example.com"] = locked
+
+	viewerID, err := a.CreateRole(ctx, models.Role{Name: "viewer", Permissions: []string{"matches:read"}})
+	require.NoError(t, err)
+	judgeID, err := a.CreateRole(ctx, models.Role{Name: "judge", AppID: 2, Inherits: viewerID, Permissions: []string{"matches:score"}})
+	require.NoError(t, err)
+	require.NoError(t, a.AssignRole(ctx, userID, judgeID))
+	require.NoError(t, a.AssignRole(ctx, lockedID, judgeID))
+
+	decisions, err := a.CheckPermissions(ctx, []models.PermissionCheck{
+		{UserID: userID, AppID: 2, Action: "score", Resource: "matches/42"},
+		{UserID: userID, AppID: 2, Action: "read", Resource: "matches/42"},
+		{UserID: userID, AppID: 3, Action: "score", Resource: "matches/42"},
+		{UserID: userID, AppID: 2, Action: "delete", Resource: "matches/42"},
+		{UserID: lockedID, AppID: 2, Action: "read", Resource: "matches/42"},
+	})
+	require.NoError(t, err)
+	require.Len(t, decisions, 5)
+
+	assert.True(t, decisions[0].Allowed)
+	assert.Equal(t, `granted by role "judge" (matches:score)`, decisions[0].Reason)
+	assert.True(t, decisions[1].Allowed, "inherited global role")
+	assert.Equal(t, `granted by role "viewer" (matches:read)`, decisions[1].Reason)
+	assert.False(t, decisions[2].Allowed, "app role does not apply in another app")
+	assert.False(t, decisions[3].Allowed)
+	assert.Equal(t, "no role grants delete on matches/42", decisions[3].Reason)
+	assert.False(t, decisions[4].Allowed)
+	assert.Equal(t, "user is locked", decisions[4].Reason)
+
+	_, err = a.CheckPermission(ctx, models.PermissionCheck{UserID: 404, AppID: 2, Action: "read", Resource: "matches"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = a.CheckPermission(ctx, models.PermissionCheck{UserID: userID, AppID: 2, Action: "matches:read", Resource: "matches"})
+	assert.ErrorIs(t, err, ErrInvalidPermissionCheck)
+	_, err = a.CheckPermissions(ctx, nil)
+	assert.ErrorIs(t, err, ErrInvalidPermissionCheck)
+}
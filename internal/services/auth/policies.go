@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/lib/policy"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// PolicyStorage хранит политики приложений
+type PolicyStorage interface {
+	SavePolicy(ctx context.Context, policy models.Policy) (int64, error)
+	Policies(ctx context.Context, appID int) ([]models.Policy, error)
+	SetPolicyEnabled(ctx context.Context, policyID int64, enabled bool) error
+	DeletePolicy(ctx context.Context, policyID int64) error
+}
+
+// PolicyEngine выполняет выражения политик
+type PolicyEngine interface {
+	Compile(expression string) error
+	Eval(expression string, input policy.Input) (bool, error)
+}
+
+var (
+	ErrPolicyExists   = errors.New("policy already exists")
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrInvalidPolicy  = errors.New("invalid policy")
+	ErrPolicyDenied   = errors.New("access denied by policy")
+)
+
+// CreatePolicy сохраняет политику. Выражение компилируется сразу, что бы опечатка
+// не обнаружилась только на входе пользователя
+func (a *Auth) CreatePolicy(ctx context.Context, p models.Policy) (int64, error) {
+	const op = "auth.CreatePolicy"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", p.AppID),
+		slog.String("policy", p.Name),
+	)
+
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return 0, fmt.Errorf("%s: %w: name is required", op, ErrInvalidPolicy)
+	}
+	if err := validatePolicy(a.policyEngine, p.Target, p.Expression); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := a.policies.SavePolicy(ctx, p)
+	if err != nil {
+		if errors.Is(err, storage.ErrPolicyExists) {
+			return 0, fmt.Errorf("%s: %w", op, ErrPolicyExists)
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("falied to save policy", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("policy created", slog.Int64("policy_id", id), slog.Bool("enabled", p.Enabled))
+
+	return id, nil
+}
+
+func (a *Auth) ListPolicies(ctx context.Context, appID int) ([]models.Policy, error) {
+	const op = "auth.ListPolicies"
+
+	policies, err := a.policies.Policies(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return policies, nil
+}
+
+func (a *Auth) SetPolicyEnabled(ctx context.Context, policyID int64, enabled bool) error {
+	const op = "auth.SetPolicyEnabled"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("policy_id", policyID),
+	)
+
+	if err := a.policies.SetPolicyEnabled(ctx, policyID, enabled); err != nil {
+		if errors.Is(err, storage.ErrPolicyNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPolicyNotFound)
+		}
+		log.Error("falied to update policy", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("policy updated", slog.Bool("enabled", enabled))
+
+	return nil
+}
+
+func (a *Auth) DeletePolicy(ctx context.Context, policyID int64) error {
+	const op = "auth.DeletePolicy"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("policy_id", policyID),
+	)
+
+	if err := a.policies.DeletePolicy(ctx, policyID); err != nil {
+		if errors.Is(err, storage.ErrPolicyNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPolicyNotFound)
+		}
+		log.Error("falied to delete policy", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("policy deleted")
+
+	return nil
+}
+
+// DryRunPolicy показывает что решили бы политики для пользователя, ничего не применяя.
+// Так новую политику можно проверить до того как включить ее
+func (a *Auth) DryRunPolicy(ctx context.Context, req models.PolicyDryRun) (models.Decision, error) {
+	const op = "auth.DryRunPolicy"
+
+	if req.Expression != "" {
+		if err := validatePolicy(a.policyEngine, req.Target, req.Expression); err != nil {
+			return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+		}
+	} else if req.Target != models.PolicyTargetLogin && req.Target != models.PolicyTargetCheck {
+		return models.Decision{}, fmt.Errorf("%s: %w: unknown target %q", op, ErrInvalidPolicy, req.Target)
+	}
+
+	user, err := a.usrProvader.UserByID(ctx, req.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.Decision{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.appProvader.App(ctx, req.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.Decision{}, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := a.roles.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var policies []models.Policy
+	if req.Expression != "" {
+		policies = []models.Policy{{Name: "dry-run", Target: req.Target, Expression: req.Expression, Enabled: true}}
+	} else {
+		policies, err = a.policies.Policies(ctx, app.ID)
+		if err != nil {
+			return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+		}
+		// Выключенные тоже проверяем, ради них dry-run обычно и зовут
+		for i := range policies {
+			policies[i].Enabled = true
+		}
+	}
+
+	at := req.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	input := policyInput(user, app, roles, req.Target, req.Client, req.Action, req.Resource, at)
+
+	return evaluatePolicies(a.policyEngine, policies, req.Target, input), nil
+}
+
+// enforceLoginPolicies применяет политики входа приложения
+func (a *Auth) enforceLoginPolicies(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	app models.App,
+	roles []models.Role,
+	client models.ClientInfo,
+) error {
+	policies, err := a.policies.Policies(ctx, app.ID)
+	if err != nil {
+		log.Error("falied to get policies", sl.Err(err))
+
+		return err
+	}
+
+	input := policyInput(user, app, roles, models.PolicyTargetLogin, client, "", "", time.Now())
+
+	decision := evaluatePolicies(a.policyEngine, policies, models.PolicyTargetLogin, input)
+	if !decision.Allowed {
+		log.Warn("login denied by policy", slog.String("reason", decision.Reason))
+
+		return fmt.Errorf("%w: %s", ErrPolicyDenied, decision.Reason)
+	}
+
+	return nil
+}
+
+// evaluatePolicies проходит по включенным политикам для target. Первая вернувшая false
+// запрещает доступ. Ошибка выполнения тоже запрещает, молча пропустить сломанную политику хуже
+func evaluatePolicies(engine PolicyEngine, policies []models.Policy, target string, input policy.Input) models.Decision {
+	checked := 0
+	for _, p := range policies {
+		if !p.Enabled || p.Target != target {
+			continue
+		}
+		checked++
+
+		ok, err := engine.Eval(p.Expression, input)
+		if err != nil {
+			return models.Decision{Reason: fmt.Sprintf("policy %q failed: %s", p.Name, err)}
+		}
+		if !ok {
+			return models.Decision{Reason: fmt.Sprintf("denied by policy %q", p.Name)}
+		}
+	}
+
+	if checked == 0 {
+		return models.Decision{Allowed: true, Reason: "no policies"}
+	}
+	return models.Decision{Allowed: true, Reason: fmt.Sprintf("%d policies passed", checked)}
+}
+
+func policyInput(
+	user models.User,
+	app models.App,
+	roles []models.Role,
+	target string,
+	client models.ClientInfo,
+	action string,
+	resource string,
+	now time.Time,
+) policy.Input {
+	var emailDomain string
+	if i := strings.LastIndex(user.Email, "@"); i >= 0 {
+		emailDomain = strings.ToLower(user.Email[i+1:])
+	}
+
+	return policy.Input{
+		User: map[string]any{
+			"id":             user.ID,
+			"email":          user.Email,
+			"email_domain":   emailDomain,
+			"email_verified": user.EmailVerifiedAt != nil,
+			"roles":          roleNames(roles),
+		},
+		App: map[string]any{
+			"id":   app.ID,
+			"name": app.Name,
+		},
+		Request: map[string]any{
+			"target":     target,
+			"ip":         client.IP,
+			"country":    client.Country,
+			"user_agent": client.UserAgent,
+			"action":     action,
+			"resource":   resource,
+		},
+		Now: now,
+	}
+}
+
+func validatePolicy(engine PolicyEngine, target string, expression string) error {
+	if target != models.PolicyTargetLogin && target != models.PolicyTargetCheck {
+		return fmt.Errorf("%w: unknown target %q", ErrInvalidPolicy, target)
+	}
+	if err := engine.Compile(expression); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPolicy, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLogin_Policy(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[3] = models.App{ID: 3, Name: "league", Secret: "secret", RegisterMode: models.RegisterModeOpen}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = st.SaveUser(context.Background(), "player@club.ru", passHash)
+	require.NoError(t, err)
+	_, err = st.SaveUser(context.Background(), "player@example.com", passHash)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	login := func(email string, ip string) error {
+		_, err := a.Login(ctx, email, "password", 3, nil, false, models.ClientInfo{IP: ip})
+		return err
+	}
+
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "club only", Target: models.PolicyTargetLogin, Expression: `user.email_domain == "club.ru"`, Enabled: true})
+	require.NoError(t, err)
+	netID, err := a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "office network", Target: models.PolicyTargetLogin, Expression: `request.ip.startsWith("10.")`})
+	require.NoError(t, err)
+
+	assert.NoError(t, login("player@club.ru", "192.168.1.5"), "disabled policy is not enforced")
+	assert.ErrorIs(t, login("player@example.com", "10.0.0.1"), ErrPolicyDenied)
+
+	require.NoError(t, a.SetPolicyEnabled(ctx, netID, true))
+	assert.ErrorIs(t, login("player@club.ru", "192.168.1.5"), ErrPolicyDenied)
+	assert.NoError(t, login("player@club.ru", "10.0.0.1"))
+
+	// Политики одного приложения не влияют на другие
+	_, err = a.Login(ctx, "player@example.com", "password", 1, nil, false, models.ClientInfo{})
+	assert.NoError(t, err)
+}
+
+func TestLogin_PolicyVerifiedEmailAndCountry(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[3] = models.App{ID: 3, Name: "league", Secret: "secret", RegisterMode: models.RegisterModeOpen}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = st.SaveUser(context.Background(), "verified@example.com", passHash)
+	require.NoError(t, err)
+	_, err = st.SaveUser(context.Background(), "unverified@example.com", passHash)
+	require.NoError(t, err)
+
+	verifiedAt := time.Now()
+	user := st.users["verified@example.com"]
+	user.EmailVerifiedAt = &verifiedAt
+	st.users["verified@example.com"] = user
+
+	ctx := context.Background()
+	login := func(email string, country string) error {
+		_, err := a.Login(ctx, email, "password", 3, nil, false, models.ClientInfo{Country: country})
+		return err
+	}
+
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "verified from RU", Target: models.PolicyTargetLogin, Expression: `user.email_verified && request.country == "RU"`, Enabled: true})
+	require.NoError(t, err)
+
+	assert.NoError(t, login("verified@example.com", "RU"))
+	assert.ErrorIs(t, login("verified@example.com", "DE"), ErrPolicyDenied)
+	assert.ErrorIs(t, login("verified@example.com", ""), ErrPolicyDenied, "country is unknown without proxy")
+	assert.ErrorIs(t, login("unverified@example.com", "RU"), ErrPolicyDenied)
+}
+
+func TestCreatePolicy_Validation(t *testing.T) {
+	a, _, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	_, err := a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "broken", Target: models.PolicyTargetLogin, Expression: `user.email ==`})
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "not bool", Target: models.PolicyTargetLogin, Expression: `"yes"`})
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "target", Target: "logout", Expression: `true`})
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "dup", Target: models.PolicyTargetLogin, Expression: `true`})
+	require.NoError(t, err)
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "dup", Target: models.PolicyTargetLogin, Expression: `true`})
+	assert.ErrorIs(t, err, ErrPolicyExists)
+}
+
+func TestDryRunPolicy(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "judge@club.ru", []byte("hash"))
+	require.NoError(t, err)
+
+	// В рабочие часы по Москве, 12:00 MSK это 09:00 UTC
+	const businessHours = `now.getHours("Europe/Moscow") >= 9 && now.getHours("Europe/Moscow") < 18`
+	noon := time.Date(2024, 9, 30, 9, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 9, 30, 21, 0, 0, 0, time.UTC)
+
+	decision, err := a.DryRunPolicy(ctx, models.PolicyDryRun{Expression: businessHours, UserID: userID, AppID: 3, Target: models.PolicyTargetLogin, At: noon})
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, err = a.DryRunPolicy(ctx, models.PolicyDryRun{Expression: businessHours, UserID: userID, AppID: 3, Target: models.PolicyTargetLogin, At: night})
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, `denied by policy "dry-run"`, decision.Reason)
+
+	// Без выражения проверяются сохраненные политики, и выключенные тоже
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "business hours", Target: models.PolicyTargetLogin, Expression: businessHours})
+	require.NoError(t, err)
+	decision, err = a.DryRunPolicy(ctx, models.PolicyDryRun{UserID: userID, AppID: 3, Target: models.PolicyTargetLogin, At: night})
+	require.NoError(t, err)
+	assert.Equal(t, `denied by policy "business hours"`, decision.Reason)
+
+	// Ошибка выполнения запрещает доступ
+	decision, err = a.DryRunPolicy(ctx, models.PolicyDryRun{Expression: `user.country == "RU"`, UserID: userID, AppID: 3, Target: models.PolicyTargetLogin})
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Contains(t, decision.Reason, `policy "dry-run" failed`)
+
+	_, err = a.DryRunPolicy(ctx, models.PolicyDryRun{Expression: `true`, UserID: 404, AppID: 3, Target: models.PolicyTargetLogin})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestCheckPermission_Policy(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "judge@example.com", []byte("hash"))
+	require.NoError(t, err)
+	roleID, err := a.CreateRole(ctx, models.Role{Name: "judge", Permissions: []string{"matches:*"}})
+	require.NoError(t, err)
+	require.NoError(t, a.AssignRole(ctx, userID, roleID))
+
+	_, err = a.CreatePolicy(ctx, models.Policy{AppID: 3, Name: "read only", Target: models.PolicyTargetCheck, Expression: `request.action == "read"`, Enabled: true})
+	require.NoError(t, err)
+
+	decisions, err := a.CheckPermissions(ctx, []models.PermissionCheck{
+		{UserID: userID, AppID: 3, Action: "read", Resource: "matches/1"},
+		{UserID: userID, AppID: 3, Action: "score", Resource: "matches/1"},
+		{UserID: userID, AppID: 4, Action: "score", Resource: "matches/1"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, decisions[0].Allowed)
+	assert.False(t, decisions[1].Allowed)
+	assert.Equal(t, `denied by policy "read only"`, decisions[1].Reason)
+	assert.True(t, decisions[2].Allowed)
+}
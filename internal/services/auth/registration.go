@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const inviteCodeBytes = 12
+
+type MemberStorage interface {
+	SaveMember(ctx context.Context, appID int, userID int64, status string) error
+	MemberStatus(ctx context.Context, appID int, userID int64) (string, error)
+	MembersByStatus(ctx context.Context, appID int, status string) ([]models.Member, error)
+	DeleteMember(ctx context.Context, appID int, userID int64) error
+	SaveInvite(ctx context.Context, codeHash string, invite models.Invite) error
+	// RegisterMember создает пользователя участником приложения и расходует инвайт в одной транзакции
+	RegisterMember(ctx context.Context, email string, passHash []byte, appID int, status string, inviteHash string) (int64, error)
+}
+
+// registerPolicy проверяет можно ли зарегистрироваться в приложении и возвращает статус
+// с которым пользователь станет его участником и хеш инвайта. Сам инвайт тут не расходуется,
+// это делает RegisterMember вместе с созданием пользователя, иначе он сгорит на занятом email
+func (a *Auth) registerPolicy(app models.App, email string, inviteCode string) (string, string, error) {
+	switch app.RegisterMode {
+	case models.RegisterModeOpen, "":
+		return models.MemberActive, "", nil
+
+	case models.RegisterModeInvite:
+		if inviteCode == "" {
+			return "", "", ErrInviteRequired
+		}
+		return models.MemberActive, hashToken(inviteCode), nil
+
+	case models.RegisterModeDomain:
+		if !domainAllowed(email, app.AllowedDomains) {
+			return "", "", ErrDomainNotAllowed
+		}
+		return models.MemberActive, "", nil
+
+	case models.RegisterModeApproval:
+		return models.MemberPending, "", nil
+
+	default:
+		return "", "", fmt.Errorf("unknown register mode %q", app.RegisterMode)
+	}
+}
+
+// checkMembership не пускает в закрытые приложения тех кто в них не регистрировался или еще не одобрен
+func (a *Auth) checkMembership(ctx context.Context, app models.App, userID int64) error {
+	if app.RegisterMode == models.RegisterModeOpen || app.RegisterMode == "" {
+		return nil
+	}
+
+	status, err := a.members.MemberStatus(ctx, app.ID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return ErrNotMember
+		}
+		return err
+	}
+
+	if status == models.MemberPending {
+		return ErrApprovalPending
+	}
+
+	return nil
+}
+
+func (a *Auth) CreateInvite(ctx context.Context, appID int, createdBy int64, maxUses int, ttl time.Duration) (string, error) {
+	const op = "auth.CreateInvite"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int64("created_by", createdBy),
+	)
+
+	app, err := a.appProvader.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if app.RegisterMode != models.RegisterModeInvite {
+		log.Warn("app is not invite only", slog.String("register_mode", app.RegisterMode))
+
+		return "", fmt.Errorf("%s: %w", op, ErrInvitesDisabled)
+	}
+
+	code, err := randomToken(inviteCodeBytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	invite := models.Invite{
+		AppID:     appID,
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := a.members.SaveInvite(ctx, hashToken(code), invite); err != nil {
+		log.Error("falied to save invite", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invite created", slog.Int("max_uses", maxUses))
+
+	return code, nil
+}
+
+func (a *Auth) PendingRegistrations(ctx context.Context, appID int) ([]models.Member, error) {
+	const op = "auth.PendingRegistrations"
+
+	members, err := a.members.MembersByStatus(ctx, appID, models.MemberPending)
+	if err != nil {
+		a.log.Error("falied to list pending registrations", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// ApproveRegistration одобряет или отклоняет заявку. Отклоненная заявка просто удаляется,
+// сам аккаунт остается и может войти в другие приложения
+func (a *Auth) ApproveRegistration(ctx context.Context, appID int, userID int64, approve bool) error {
+	const op = "auth.ApproveRegistration"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int64("user_id", userID),
+		slog.Bool("approve", approve),
+	)
+
+	status, err := a.members.MemberStatus(ctx, appID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNotMember)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if status != models.MemberPending {
+		return fmt.Errorf("%s: %w", op, ErrNotPending)
+	}
+
+	if approve {
+		err = a.members.SaveMember(ctx, appID, userID, models.MemberActive)
+	} else {
+		err = a.members.DeleteMember(ctx, appID, userID)
+	}
+	if err != nil {
+		log.Error("falied to update registration", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("registration reviewed")
+
+	return nil
+}
+
+func domainAllowed(email string, allowed []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(email[at+1:])
+
+	return slices.ContainsFunc(allowed, func(d string) bool {
+		return strings.ToLower(d) == domain
+	})
+}
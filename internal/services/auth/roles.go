@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// RoleStorage хранит роли, их разрешения и кому какие роли выданы
+type RoleStorage interface {
+	SaveRole(ctx context.Context, role models.Role) (int64, error)
+	Role(ctx context.Context, roleID int64) (models.Role, error)
+	Roles(ctx context.Context, appID int) ([]models.Role, error)
+	DeleteRole(ctx context.Context, roleID int64) error
+	SetRolePermissions(ctx context.Context, roleID int64, permissions []string) error
+	AssignRole(ctx context.Context, userID int64, roleID int64) error
+	UnassignRole(ctx context.Context, userID int64, roleID int64) error
+	UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error)
+}
+
+var (
+	ErrRoleExists      = errors.New("role already exists")
+	ErrRoleNotFound    = errors.New("role not found")
+	ErrRoleNotAssigned = errors.New("role is not assigned to user")
+	ErrInvalidRole     = errors.New("invalid role")
+)
+
+// CreateRole заводит роль. Наследовать можно глобальную роль или роль того же приложения,
+// иначе роль одного приложения давала бы права в другом
+func (a *Auth) CreateRole(ctx context.Context, role models.Role) (int64, error) {
+	const op = "auth.CreateRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("role", role.Name),
+		slog.Int("app_id", role.AppID),
+	)
+
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return 0, fmt.Errorf("%s: %w: name is required", op, ErrInvalidRole)
+	}
+
+	if role.AppID != 0 {
+		if _, err := a.appProvader.App(ctx, role.AppID); err != nil {
+			if errors.Is(err, storage.ErrAppNotFound) {
+				return 0, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+			}
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if role.Inherits != 0 {
+		parent, err := a.roles.Role(ctx, role.Inherits)
+		if err != nil {
+			if errors.Is(err, storage.ErrRoleNotFound) {
+				return 0, fmt.Errorf("%s: %w: inherited role not found", op, ErrInvalidRole)
+			}
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if parent.AppID != 0 && parent.AppID != role.AppID {
+			return 0, fmt.Errorf("%s: %w: inherited role belongs to another app", op, ErrInvalidRole)
+		}
+	}
+
+	id, err := a.roles.SaveRole(ctx, role)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleExists) {
+			return 0, fmt.Errorf("%s: %w", op, ErrRoleExists)
+		}
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return 0, fmt.Errorf("%s: %w: inherited role not found", op, ErrInvalidRole)
+		}
+		log.Error("falied to save role", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role created", slog.Int64("role_id", id))
+
+	return id, nil
+}
+
+// DeleteRole удаляет роль у всех кому она выдана. Роли которые ее наследовали остаются без наследования
+func (a *Auth) DeleteRole(ctx context.Context, roleID int64) error {
+	const op = "auth.DeleteRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("role_id", roleID),
+	)
+
+	role, err := a.roles.Role(ctx, roleID)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// На глобальной роли admin держится IsAdmin, без нее админов не останется
+	if role.Name == models.RoleAdmin && role.AppID == 0 {
+		return fmt.Errorf("%s: %w: built-in admin role cannot be deleted", op, ErrInvalidRole)
+	}
+
+	if err := a.roles.DeleteRole(ctx, roleID); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		log.Error("falied to delete role", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role deleted")
+
+	return nil
+}
+
+// ListRoles отдает роли приложения, при appID = 0 глобальные роли
+func (a *Auth) ListRoles(ctx context.Context, appID int) ([]models.Role, error) {
+	const op = "auth.ListRoles"
+
+	roles, err := a.roles.Roles(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (a *Auth) SetRolePermissions(ctx context.Context, roleID int64, permissions []string) error {
+	const op = "auth.SetRolePermissions"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("role_id", roleID),
+	)
+
+	for _, permission := range permissions {
+		if strings.TrimSpace(permission) == "" {
+			return fmt.Errorf("%s: %w: empty permission", op, ErrInvalidRole)
+		}
+	}
+
+	if err := a.roles.SetRolePermissions(ctx, roleID, permissions); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		log.Error("falied to set role permissions", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role permissions updated", slog.Any("permissions", permissions))
+
+	return nil
+}
+
+func (a *Auth) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "auth.AssignRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int64("role_id", roleID),
+	)
+
+	if err := a.roles.AssignRole(ctx, userID, roleID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		log.Error("falied to assign role", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role assigned")
+
+	return nil
+}
+
+func (a *Auth) RevokeRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "auth.RevokeRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int64("role_id", roleID),
+	)
+
+	if err := a.roles.UnassignRole(ctx, userID, roleID); err != nil {
+		if errors.Is(err, storage.ErrRoleNotAssigned) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotAssigned)
+		}
+		log.Error("falied to revoke role", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role revoked")
+
+	return nil
+}
+
+// UserRoles это роли которые действуют для пользователя в приложении, включая унаследованные
+func (a *Auth) UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	const op = "auth.UserRoles"
+
+	roles, err := a.roles.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func roleNames(roles []models.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRoles_TokenClaim(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	st.apps[2] = models.App{ID: 2, Secret: "secret", RegisterMode: models.RegisterModeOpen}
+	st.apps[3] = models.App{ID: 3, Secret: "secret", RegisterMode: models.RegisterModeOpen}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	userID, err := st.SaveUser(context.Background(), "judge@example.com", passHash)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	viewerID, err := a.CreateRole(ctx, models.Role{Name: "viewer", Permissions: []string{"matches:read"}})
+	require.NoError(t, err)
+	judgeID, err := a.CreateRole(ctx, models.Role{Name: "judge", AppID: 2, Inherits: viewerID, Permissions: []string{"matches:score"}})
+	require.NoError(t, err)
+
+	_, err = a.CreateRole(ctx, models.Role{Name: "judge", AppID: 2})
+	assert.ErrorIs(t, err, ErrRoleExists)
+	_, err = a.CreateRole(ctx, models.Role{Name: "coach", AppID: 3, Inherits: judgeID})
+	assert.ErrorIs(t, err, ErrInvalidRole, "role of another app cannot be inherited")
+
+	require.NoError(t, a.AssignRole(ctx, userID, judgeID))
+
+	rolesInToken := func(appID int) []string {
+		token, err := a.Login(ctx, "judge@example.com", "password", appID, nil, false, models.ClientInfo{})
+		require.NoError(t, err)
+		claims, err := jwtT.ParseToken(token, func(int) (string, error) { return "secret", nil })
+		require.NoError(t, err)
+		return claims.Roles
+	}
+
+	// Роль приложения вместе с унаследованной глобальной, в другом приложении роли нет
+	assert.Equal(t, []string{"judge", "viewer"}, rolesInToken(2))
+	assert.Empty(t, rolesInToken(3))
+
+	require.NoError(t, a.RevokeRole(ctx, userID, judgeID))
+	assert.ErrorIs(t, a.RevokeRole(ctx, userID, judgeID), ErrRoleNotAssigned)
+	assert.Empty(t, rolesInToken(2))
+}
+
+func TestDeleteRole_AdminIsBuiltIn(t *testing.T) {
+	a, _, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	adminID, err := a.CreateRole(ctx, models.Role{Name: models.RoleAdmin, Permissions: []string{models.PermissionAll}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.DeleteRole(ctx, adminID), ErrInvalidRole)
+
+	// Роль admin конкретного приложения это обычная роль
+	appAdminID, err := a.CreateRole(ctx, models.Role{Name: models.RoleAdmin, AppID: 1})
+	require.NoError(t, err)
+	assert.NoError(t, a.DeleteRole(ctx, appAdminID))
+	assert.ErrorIs(t, a.DeleteRole(ctx, appAdminID), ErrRoleNotFound)
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const sessionIDBytes = 16
+
+func (a *Auth) newSession(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	client models.ClientInfo,
+) (models.Session, error) {
+	id, err := randomToken(sessionIDBytes)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         id,
+		UserID:     user.ID,
+		AppID:      app.ID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	if err := a.sesSaver.SaveSession(ctx, session); err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// VerifyToken проверяет подпись токена и то что его сессия еще жива.
+// Заодно обновляет last_seen у сессии что бы в списке сессий было видно когда ей пользовались.
+// Личные API ключи принимаются здесь же, поэтому работают везде где принимается токен
+func (a *Auth) VerifyToken(ctx context.Context, token string) (*jwtT.Claims, error) {
+	const op = "auth.VerifyToken"
+
+	claims, err := a.verifyToken(ctx, a.log.With(slog.String("op", op)), token, true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
+
+// InspectToken проверяет токен так же как VerifyToken, но last_seen не трогает. Это для Introspect:
+// токен проверяет сервис, а не пользователь, и сессией от этого никто не пользовался
+func (a *Auth) InspectToken(ctx context.Context, token string) (*jwtT.Claims, error) {
+	const op = "auth.InspectToken"
+
+	claims, err := a.verifyToken(ctx, a.log.With(slog.String("op", op)), token, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
+
+func (a *Auth) verifyToken(ctx context.Context, log *slog.Logger, token string, touch bool) (*jwtT.Claims, error) {
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return a.verifyAPIKey(ctx, log, token, touch)
+	}
+
+	claims, err := jwtT.ParseTokenWithSecrets(token, func(appID int) ([]string, error) {
+		app, err := a.appProvader.App(ctx, appID)
+		if err != nil {
+			return nil, err
+		}
+		if app.DisabledAt != nil {
+			return nil, ErrAppDisabled
+		}
+		return app.VerificationSecrets(time.Now()), nil
+	})
+	if err != nil {
+		log.Info("token rejected", sl.Err(err))
+
+		return nil, ErrInvalidToken
+	}
+
+	if claims.SessionID == "" {
+		// Сервисный токен приложения сессии не имеет по своей природе
+		if claims.IsService() {
+			return claims, nil
+		}
+		if !a.legacyToken(claims) {
+			log.Warn("token without session rejected", slog.Int64("user_id", claims.UID), slog.Int("app_id", claims.AppID))
+
+			return nil, ErrInvalidToken
+		}
+		return claims, nil
+	}
+
+	session, err := a.sesProvider.Session(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return nil, ErrInvalidToken
+		}
+		log.Error("falied to get session", sl.Err(err))
+
+		return nil, err
+	}
+
+	// Сессия другого приложения не подходит, иначе приложение знающее свой секрет подписало бы
+	// токен с чужим sid
+	if session.RevokedAt != nil || session.UserID != claims.UID || session.AppID != claims.AppID {
+		return nil, ErrInvalidToken
+	}
+
+	if touch {
+		if err := a.sesSaver.TouchSession(ctx, session.ID); err != nil {
+			// Не критично, токен все равно валидный
+			log.Warn("falied to touch session", sl.Err(err))
+		}
+	}
+
+	return claims, nil
+}
+
+// legacyToken решает пускать ли пользовательский токен без sid. Такие токены выпускались до появления
+// сессий и проверить их по базе нельзя, а подписать такой может любой кто знает секрет приложения.
+// Поэтому пускаем только выпущенные до sessionlessCutoff и живущие не дольше cutoff + tokenTTL.
+// У самых старых токенов нет iat, для них время выпуска считаем от exp
+func (a *Auth) legacyToken(claims *jwtT.Claims) bool {
+	if a.sessionlessCutoff.IsZero() {
+		return false
+	}
+
+	issuedAt := claims.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = claims.ExpiresAt.Add(-a.tokenTTL)
+	}
+
+	return issuedAt.Before(a.sessionlessCutoff) && !claims.ExpiresAt.After(a.sessionlessCutoff.Add(a.tokenTTL))
+}
+
+func (a *Auth) ListSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "auth.ListSessions"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	sessions, err := a.sesProvider.Sessions(ctx, userID)
+	if err != nil {
+		log.Error("falied to list sessions", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (a *Auth) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "auth.RevokeSession"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("session_id", sessionID),
+	)
+
+	if err := a.sesSaver.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			log.Warn("session not found", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+		log.Error("falied to revoke session", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("session revoked")
+
+	return nil
+}
+
+func (a *Auth) RevokeAllSessions(ctx context.Context, userID int64) (int64, error) {
+	const op = "auth.RevokeAllSessions"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	revoked, err := a.sesSaver.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		log.Error("falied to revoke sessions", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("sessions revoked", slog.Int64("count", revoked))
+
+	return revoked, nil
+}
+
+// Logout завершает сессию к которой привязан токен. С allApps отзываются вообще все сессии
+// пользователя, то есть он выходит из всех приложений сразу. Токен без сессии отклоняется с
+// ErrSessionlessToken даже с allApps, иначе клиент решит что вышел, а сам токен продолжит работать
+func (a *Auth) Logout(ctx context.Context, token string, allApps bool) error {
+	const op = "auth.Logout"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Bool("all_apps", allApps),
+	)
+
+	claims, err := a.VerifyToken(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", claims.UID))
+
+	if claims.SessionID == "" {
+		log.Warn("logout rejected: token has no session", slog.Int64("api_key_id", claims.APIKeyID))
+
+		return fmt.Errorf("%s: %w", op, ErrSessionlessToken)
+	}
+
+	if allApps {
+		if _, err := a.sesSaver.RevokeAllSessions(ctx, claims.UID); err != nil {
+			log.Error("falied to revoke sessions", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("user logged out of all apps")
+
+		return nil
+	}
+
+	if err := a.sesSaver.RevokeSession(ctx, claims.UID, claims.SessionID); err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+		log.Error("falied to revoke session", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged out", slog.String("session_id", claims.SessionID))
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogout(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "student@school.ru", nil)
+	require.NoError(t, err)
+	user := models.User{ID: userID, Email: "student@school.ru"}
+
+	token, err := a.LoginUser(ctx, user, 1, nil, models.ClientInfo{})
+	require.NoError(t, err)
+
+	require.NoError(t, a.Logout(ctx, token, false))
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	assert.ErrorIs(t, a.Logout(ctx, token, false), ErrInvalidToken)
+}
+
+func TestLogout_SessionlessTokenIsRejected(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "student@school.ru", nil)
+	require.NoError(t, err)
+
+	// Такие токены выдавались до появления сессий и принимаются только до конца переезда
+	a.sessionlessCutoff = time.Now().Add(time.Minute)
+	legacy, err := jwtT.NewToken(models.User{ID: userID, Email: "student@school.ru"}, models.App{ID: 1, Secret: "test-secret"}, time.Hour)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, a.Logout(ctx, legacy, false), ErrSessionlessToken)
+	assert.ErrorIs(t, a.Logout(ctx, legacy, true), ErrSessionlessToken)
+
+	apiKey, _, err := a.CreateAPIKey(ctx, userID, 1, "script", nil, 0)
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.Logout(ctx, apiKey, false), ErrSessionlessToken)
+}
+
+func TestVerifyToken_Sessionless(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	adminID, err := st.SaveUser(ctx, "admin@school.ru", nil)
+	require.NoError(t, err)
+	require.NoError(t, st.SetAdmin(ctx, adminID, true))
+	admin := models.User{ID: adminID, Email: "admin@school.ru"}
+
+	// Секрет приложения 2 знает само приложение, например для sttauth.NewSecretVerifier
+	downstream := models.App{ID: 2, Name: "downstream", Secret: "downstream-secret"}
+	st.apps[downstream.ID] = downstream
+
+	forged, err := jwtT.NewToken(admin, downstream, time.Hour)
+	require.NoError(t, err)
+
+	// Самые старые токены были без iat
+	noIAT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		jwtT.UIDKey:   adminID,
+		jwtT.AppIDKey: downstream.ID,
+		jwtT.ExpKey:   time.Now().Add(30 * time.Minute).Unix(),
+	}).SignedString([]byte(downstream.Secret))
+	require.NoError(t, err)
+
+	longLived, err := jwtT.NewToken(admin, downstream, 24*time.Hour)
+	require.NoError(t, err)
+
+	service, err := jwtT.NewServiceToken(downstream, time.Hour, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		cutoff  time.Time
+		token   string
+		wantErr bool
+	}{
+		{name: "forged token without cutoff", token: forged, wantErr: true},
+		{name: "token issued after cutoff", cutoff: time.Now().Add(-time.Minute), token: forged, wantErr: true},
+		{name: "token issued before cutoff", cutoff: time.Now().Add(time.Minute), token: forged},
+		{name: "token without iat before cutoff", cutoff: time.Now().Add(time.Minute), token: noIAT},
+		{name: "token outliving cutoff", cutoff: time.Now().Add(time.Minute), token: longLived, wantErr: true},
+		{name: "service token", token: service},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.sessionlessCutoff = tt.cutoff
+
+			claims, err := a.VerifyToken(ctx, tt.token)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, claims.SessionID)
+		})
+	}
+}
+
+func TestVerifyToken_SessionOfOtherApp(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "admin@school.ru", nil)
+	require.NoError(t, err)
+	user := models.User{ID: userID, Email: "admin@school.ru"}
+
+	token, err := a.LoginUser(ctx, user, 1, nil, models.ClientInfo{})
+	require.NoError(t, err)
+	claims, err := a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+
+	downstream := models.App{ID: 2, Name: "downstream", Secret: "downstream-secret"}
+	st.apps[downstream.ID] = downstream
+
+	forged, err := jwtT.NewToken(user, downstream, time.Hour, jwtT.WithSessionID(claims.SessionID))
+	require.NoError(t, err)
+
+	_, err = a.VerifyToken(ctx, forged)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestInspectToken_DoesNotTouchSession(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := st.SaveUser(ctx, "student@school.ru", nil)
+	require.NoError(t, err)
+	token, err := a.LoginUser(ctx, models.User{ID: userID, Email: "student@school.ru"}, 1, nil, models.ClientInfo{})
+	require.NoError(t, err)
+
+	claims, err := a.InspectToken(ctx, token)
+	require.NoError(t, err)
+
+	// Делаем вид что сессией давно не пользовались
+	lastSeen := time.Now().Add(-time.Hour)
+	session := st.sessions[claims.SessionID]
+	session.LastSeenAt = lastSeen
+	st.sessions[claims.SessionID] = session
+
+	_, err = a.InspectToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, lastSeen, st.sessions[claims.SessionID].LastSeenAt)
+
+	_, err = a.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, st.sessions[claims.SessionID].LastSeenAt.After(lastSeen))
+}
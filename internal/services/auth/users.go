@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidEmail  = errors.New("invalid email")
+	// ErrSelfModification не дает админу заблокировать, удалить или разжаловать самого себя
+	ErrSelfModification = errors.New("admin can not do this with own account")
+)
+
+// ListUsers отдает страницу пользователей по id. Курсор непрозрачный, клиент просто передает
+// то что вернулось в прошлый раз. Пустой курсор в ответе значит что это последняя страница
+func (a *Auth) ListUsers(ctx context.Context, filter models.UserFilter, cursor string) ([]models.UserInfo, string, error) {
+	const op = "auth.ListUsers"
+
+	afterID, err := decodeUserCursor(cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	filter.AfterID = afterID
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUsersPageSize
+	}
+	if filter.Limit > maxUsersPageSize {
+		filter.Limit = maxUsersPageSize
+	}
+	pageSize := filter.Limit
+	// Берем на одного больше, так без отдельного COUNT понятно есть ли следующая страница
+	filter.Limit++
+
+	users, err := a.usrProvader.ListUsers(ctx, filter)
+	if err != nil {
+		a.log.Error("falied to list users", slog.String("op", op), sl.Err(err))
+
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	next := ""
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		next = encodeUserCursor(users[len(users)-1].ID)
+	}
+
+	return users, next, nil
+}
+
+func (a *Auth) GetUser(ctx context.Context, userID int64) (models.UserInfo, error) {
+	const op = "auth.GetUser"
+
+	user, err := a.usrProvader.UserInfo(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// UpdateUser меняет email и блокировку. При блокировке сессии отзываются так же как при
+// блокировке самим пользователем по ссылке из письма
+func (a *Auth) UpdateUser(ctx context.Context, actorID int64, userID int64, update models.UserUpdate) (models.UserInfo, error) {
+	const op = "auth.UpdateUser"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorID),
+		slog.Int64("user_id", userID),
+	)
+
+	if update.Locked != nil && *update.Locked && actorID == userID {
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrSelfModification)
+	}
+
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		if !strings.Contains(email, "@") || len(email) > 100 {
+			return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidEmail)
+		}
+
+		if err := a.usrSaver.UpdateUserEmail(ctx, userID, email); err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+			}
+			if errors.Is(err, storage.ErrUserExists) {
+				return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrUserExists)
+			}
+			log.Error("falied to update email", sl.Err(err))
+
+			return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("user email changed by admin")
+	}
+
+	if update.Locked != nil {
+		if err := a.usrSaver.SetUserLocked(ctx, userID, *update.Locked); err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+			}
+			log.Error("falied to set user lock", sl.Err(err))
+
+			return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if *update.Locked {
+			if _, err := a.sesSaver.RevokeAllSessions(ctx, userID); err != nil {
+				log.Error("falied to revoke sessions", sl.Err(err))
+
+				return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		log.Warn("user lock changed by admin", slog.Bool("locked", *update.Locked))
+	}
+
+	return a.GetUser(ctx, userID)
+}
+
+// SetAdmin выдает или забирает глобальную роль admin. Забрать ее у себя нельзя,
+// иначе последний админ может случайно остаться без доступа
+func (a *Auth) SetAdmin(ctx context.Context, actorID int64, userID int64, isAdmin bool) error {
+	const op = "auth.SetAdmin"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorID),
+		slog.Int64("user_id", userID),
+	)
+
+	if !isAdmin && actorID == userID {
+		return fmt.Errorf("%s: %w", op, ErrSelfModification)
+	}
+
+	if err := a.usrSaver.SetAdmin(ctx, userID, isAdmin); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("falied to set admin", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("admin flag changed", slog.Bool("is_admin", isAdmin))
+
+	return nil
+}
+
+// DeleteUser удаляет пользователя насовсем. Если он единственный владелец какой-то организации
+// то сначала надо передать ее другому, иначе организация останется без управления
+func (a *Auth) DeleteUser(ctx context.Context, actorID int64, userID int64) error {
+	const op = "auth.DeleteUser"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorID),
+		slog.Int64("user_id", userID),
+	)
+
+	if actorID == userID {
+		return fmt.Errorf("%s: %w", op, ErrSelfModification)
+	}
+
+	orgs, err := a.orgs.UserOrganizations(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, org := range orgs {
+		if org.Role != models.OrgRoleOwner {
+			continue
+		}
+		last, err := a.lastOrgOwner(ctx, org.OrgID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if last {
+			return fmt.Errorf("%s: %w: organization %d", op, ErrLastOrgOwner, org.OrgID)
+		}
+	}
+
+	if err := a.usrSaver.DeleteUser(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("falied to delete user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("user deleted by admin")
+
+	return nil
+}
+
+func encodeUserCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeUserCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
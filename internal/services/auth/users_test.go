@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsers_Pagination(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := st.SaveUser(ctx, fmt.Sprintf("student%d@school.ru", i), nil)
+		require.NoError(t, err)
+	}
+	adminID, err := st.SaveUser(ctx, "admin@example.com", nil)
+	require.NoError(t, err)
+	require.NoError(t, st.SetAdmin(ctx, adminID, true))
+
+	var emails []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "pagination does not terminate")
+
+		users, next, err := a.ListUsers(ctx, models.UserFilter{EmailPrefix: "Student", Limit: 2}, cursor)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(users), 2)
+		for _, user := range users {
+			emails = append(emails, user.Email)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Len(t, emails, 5)
+	assert.Equal(t, "student0@school.ru", emails[0])
+
+	admins, next, err := a.ListUsers(ctx, models.UserFilter{AdminsOnly: true}, "")
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, admins, 1)
+	assert.True(t, admins[0].IsAdmin)
+
+	_, _, err = a.ListUsers(ctx, models.UserFilter{}, "not-a-cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestUpdateUser(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	adminID, err := st.SaveUser(ctx, "admin@example.com", nil)
+	require.NoError(t, err)
+	userID, err := st.SaveUser(ctx, "user@example.com", nil)
+	require.NoError(t, err)
+
+	token, err := a.LoginUser(ctx, models.User{ID: userID, Email: "user@example.com"}, 1, nil, models.ClientInfo{})
+	require.NoError(t, err)
+
+	email := "renamed@example.com"
+	locked := true
+	user, err := a.UpdateUser(ctx, adminID, userID, models.UserUpdate{Email: &email, Locked: &locked})
+	require.NoError(t, err)
+	assert.Equal(t, email, user.Email)
+	assert.NotNil(t, user.LockedAt)
+
+	// Блокировка отзывает уже выданные токены
+	_, err = a.VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	taken := "admin@example.com"
+	_, err = a.UpdateUser(ctx, adminID, userID, models.UserUpdate{Email: &taken})
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	_, err = a.UpdateUser(ctx, adminID, adminID, models.UserUpdate{Locked: &locked})
+	assert.ErrorIs(t, err, ErrSelfModification)
+
+	unlocked := false
+	user, err = a.UpdateUser(ctx, adminID, userID, models.UserUpdate{Locked: &unlocked})
+	require.NoError(t, err)
+	assert.Nil(t, user.LockedAt)
+}
+
+func TestSetAdminAndDeleteUser(t *testing.T) {
+	a, st, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	adminID, err := st.SaveUser(ctx, "admin@example.com", nil)
+	require.NoError(t, err)
+	require.NoError(t, st.SetAdmin(ctx, adminID, true))
+	ownerID, err := st.SaveUser(ctx, "owner@school.ru", nil)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, a.SetAdmin(ctx, adminID, adminID, false), ErrSelfModification)
+	require.NoError(t, a.SetAdmin(ctx, adminID, ownerID, true))
+	user, err := a.GetUser(ctx, ownerID)
+	require.NoError(t, err)
+	assert.True(t, user.IsAdmin)
+
+	_, err = a.CreateOrganization(ctx, ownerID, "School 57")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, a.DeleteUser(ctx, adminID, adminID), ErrSelfModification)
+	assert.ErrorIs(t, a.DeleteUser(ctx, adminID, ownerID), ErrLastOrgOwner)
+	assert.ErrorIs(t, a.DeleteUser(ctx, adminID, 100), ErrUserNotFound)
+
+	require.NoError(t, a.DeleteUser(ctx, ownerID, adminID))
+	_, err = a.GetUser(ctx, adminID)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -0,0 +1,344 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+)
+
+// maxDepth ограничивает глубину обхода, длинные цепочки userset почти всегда ошибка в данных
+const maxDepth = 25
+
+// Authz это движок авторизации на отношениях в духе Zanzibar: права выводятся из кортежей
+// вида club:1#moderator@user:7 по правилам из Schema
+type Authz struct {
+	log    *slog.Logger
+	schema Schema
+	tuples TupleStorage
+}
+
+type TupleStorage interface {
+	WriteTuples(ctx context.Context, tuples []models.RelationTuple) error
+	DeleteTuples(ctx context.Context, tuples []models.RelationTuple) error
+	Subjects(ctx context.Context, namespace string, objectID string, relation string) ([]models.Subject, error)
+	Objects(ctx context.Context, namespace string) ([]string, error)
+}
+
+var (
+	ErrUnknownRelation = errors.New("unknown namespace or relation")
+	ErrInvalidTuple    = errors.New("invalid relation tuple")
+	ErrDepthExceeded   = errors.New("relation graph is too deep")
+)
+
+func New(log *slog.Logger, schema Schema, tupleStorage TupleStorage) *Authz {
+	return &Authz{
+		log:    log,
+		schema: schema,
+		tuples: tupleStorage,
+	}
+}
+
+// OwnedBy говорит принадлежит ли namespace приложению appID, см. Namespace.AppID
+func (a *Authz) OwnedBy(namespace string, appID int) bool {
+	return a.schema.OwnedBy(namespace, appID)
+}
+
+// WriteTuples записывает отношения. Отношение должно быть объявлено в схеме,
+// иначе кортеж никогда не участвовал бы в проверках
+func (a *Authz) WriteTuples(ctx context.Context, tuples []models.RelationTuple) error {
+	const op = "authz.WriteTuples"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("tuples", len(tuples)),
+	)
+
+	if err := a.validateTuples(tuples); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.tuples.WriteTuples(ctx, tuples); err != nil {
+		log.Error("falied to write tuples", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("tuples written")
+
+	return nil
+}
+
+func (a *Authz) DeleteTuples(ctx context.Context, tuples []models.RelationTuple) error {
+	const op = "authz.DeleteTuples"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("tuples", len(tuples)),
+	)
+
+	if err := a.validateTuples(tuples); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.tuples.DeleteTuples(ctx, tuples); err != nil {
+		log.Error("falied to delete tuples", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("tuples deleted")
+
+	return nil
+}
+
+// Check отвечает есть ли у tuple.Subject отношение tuple.Relation к объекту
+func (a *Authz) Check(ctx context.Context, tuple models.RelationTuple) (bool, error) {
+	const op = "authz.Check"
+
+	if err := a.validateTuple(tuple); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ok, err := a.check(ctx, tuple.Namespace, tuple.ObjectID, tuple.Relation, tuple.Subject, 0, make(map[string]bool))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ok, nil
+}
+
+func (a *Authz) check(
+	ctx context.Context,
+	namespace string,
+	objectID string,
+	relation string,
+	subject models.Subject,
+	depth int,
+	visited map[string]bool,
+) (bool, error) {
+	if depth > maxDepth {
+		return false, ErrDepthExceeded
+	}
+
+	// В графе могут быть циклы (club:1#member@club:2#member и обратно), второй заход ничего не добавит
+	node := models.Subject{Namespace: namespace, ObjectID: objectID, Relation: relation}
+	if visited[node.String()] {
+		return false, nil
+	}
+	visited[node.String()] = true
+
+	if node == subject {
+		return true, nil
+	}
+
+	rel, ok := a.schema.relation(namespace, relation)
+	if !ok {
+		return false, nil
+	}
+
+	direct, err := a.tuples.Subjects(ctx, namespace, objectID, relation)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range direct {
+		if s == subject {
+			return true, nil
+		}
+		if s.Relation == "" {
+			continue
+		}
+		ok, err := a.check(ctx, s.Namespace, s.ObjectID, s.Relation, subject, depth+1, visited)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	for _, computed := range rel.ComputedUsersets {
+		ok, err := a.check(ctx, namespace, objectID, computed, subject, depth+1, visited)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	for _, ttu := range rel.TupleToUsersets {
+		parents, err := a.tuples.Subjects(ctx, namespace, objectID, ttu.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, parent := range parents {
+			ok, err := a.check(ctx, parent.Namespace, parent.ObjectID, ttu.Relation, subject, depth+1, visited)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Tree это раскрытое отношение: Userset это само отношение, Subjects записаны в нем напрямую,
+// а Children это вложенные множества из которых оно собирается
+type Tree struct {
+	Userset  models.Subject
+	Subjects []models.Subject
+	Children []*Tree
+}
+
+// Expand раскрывает отношение объекта в дерево, из которого видно откуда у кого доступ
+func (a *Authz) Expand(ctx context.Context, namespace string, objectID string, relation string) (*Tree, error) {
+	const op = "authz.Expand"
+
+	if _, ok := a.schema.relation(namespace, relation); !ok {
+		return nil, fmt.Errorf("%s: %w: %s#%s", op, ErrUnknownRelation, namespace, relation)
+	}
+	if objectID == "" {
+		return nil, fmt.Errorf("%s: %w: object id is required", op, ErrInvalidTuple)
+	}
+
+	tree, err := a.expand(ctx, models.Subject{Namespace: namespace, ObjectID: objectID, Relation: relation}, 0, make(map[string]bool))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tree, nil
+}
+
+func (a *Authz) expand(ctx context.Context, userset models.Subject, depth int, visited map[string]bool) (*Tree, error) {
+	if depth > maxDepth {
+		return nil, ErrDepthExceeded
+	}
+
+	tree := &Tree{Userset: userset}
+
+	// Уже раскрытое множество отдаем листом, иначе цикл в данных дал бы бесконечное дерево
+	if visited[userset.String()] {
+		return tree, nil
+	}
+	visited[userset.String()] = true
+
+	rel, ok := a.schema.relation(userset.Namespace, userset.Relation)
+	if !ok {
+		return tree, nil
+	}
+
+	direct, err := a.tuples.Subjects(ctx, userset.Namespace, userset.ObjectID, userset.Relation)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range direct {
+		if s.Relation == "" {
+			tree.Subjects = append(tree.Subjects, s)
+			continue
+		}
+		child, err := a.expand(ctx, s, depth+1, visited)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, child)
+	}
+
+	for _, computed := range rel.ComputedUsersets {
+		child, err := a.expand(ctx, models.Subject{Namespace: userset.Namespace, ObjectID: userset.ObjectID, Relation: computed}, depth+1, visited)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, child)
+	}
+
+	for _, ttu := range rel.TupleToUsersets {
+		parents, err := a.tuples.Subjects(ctx, userset.Namespace, userset.ObjectID, ttu.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			child, err := a.expand(ctx, models.Subject{Namespace: parent.Namespace, ObjectID: parent.ObjectID, Relation: ttu.Relation}, depth+1, visited)
+			if err != nil {
+				return nil, err
+			}
+			tree.Children = append(tree.Children, child)
+		}
+	}
+
+	return tree, nil
+}
+
+// ListObjects отдает id объектов namespace к которым у субъекта есть отношение.
+// Идем по всем объектам namespace и проверяем каждый, для наших объемов этого хватает
+func (a *Authz) ListObjects(ctx context.Context, namespace string, relation string, subject models.Subject) ([]string, error) {
+	const op = "authz.ListObjects"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("namespace", namespace),
+		slog.String("relation", relation),
+	)
+
+	if _, ok := a.schema.relation(namespace, relation); !ok {
+		return nil, fmt.Errorf("%s: %w: %s#%s", op, ErrUnknownRelation, namespace, relation)
+	}
+	if err := validateSubject(subject); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	candidates, err := a.tuples.Objects(ctx, namespace)
+	if err != nil {
+		log.Error("falied to list objects", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	objects := make([]string, 0)
+	for _, objectID := range candidates {
+		ok, err := a.check(ctx, namespace, objectID, relation, subject, 0, make(map[string]bool))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if ok {
+			objects = append(objects, objectID)
+		}
+	}
+
+	return objects, nil
+}
+
+func (a *Authz) validateTuples(tuples []models.RelationTuple) error {
+	if len(tuples) == 0 {
+		return fmt.Errorf("%w: no tuples", ErrInvalidTuple)
+	}
+	for _, t := range tuples {
+		if err := a.validateTuple(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Authz) validateTuple(t models.RelationTuple) error {
+	if _, ok := a.schema.relation(t.Namespace, t.Relation); !ok {
+		return fmt.Errorf("%w: %s#%s", ErrUnknownRelation, t.Namespace, t.Relation)
+	}
+	if t.ObjectID == "" || strings.ContainsAny(t.ObjectID, ":#@") {
+		return fmt.Errorf("%w: invalid object id %q", ErrInvalidTuple, t.ObjectID)
+	}
+	if err := validateSubject(t.Subject); err != nil {
+		return err
+	}
+	if t.Subject.Relation != "" {
+		if _, ok := a.schema.relation(t.Subject.Namespace, t.Subject.Relation); !ok {
+			return fmt.Errorf("%w: subject %s", ErrUnknownRelation, t.Subject)
+		}
+	}
+	return nil
+}
+
+func validateSubject(s models.Subject) error {
+	if s.Namespace == "" || s.ObjectID == "" || strings.ContainsAny(s.Namespace+s.ObjectID, ":#@") {
+		return fmt.Errorf("%w: invalid subject %q", ErrInvalidTuple, s.String())
+	}
+	return nil
+}
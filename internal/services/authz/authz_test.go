@@ -0,0 +1,204 @@
+package authz
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTuples struct {
+	mu     sync.Mutex
+	tuples map[models.RelationTuple]bool
+}
+
+func (f *fakeTuples) WriteTuples(_ context.Context, tuples []models.RelationTuple) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, t := range tuples {
+		f.tuples[t] = true
+	}
+	return nil
+}
+
+func (f *fakeTuples) DeleteTuples(_ context.Context, tuples []models.RelationTuple) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, t := range tuples {
+		delete(f.tuples, t)
+	}
+	return nil
+}
+
+func (f *fakeTuples) Subjects(_ context.Context, namespace string, objectID string, relation string) ([]models.Subject, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var subjects []models.Subject
+	for t := range f.tuples {
+		if t.Namespace == namespace && t.ObjectID == objectID && t.Relation == relation {
+			subjects = append(subjects, t.Subject)
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].String() < subjects[j].String() })
+	return subjects, nil
+}
+
+func (f *fakeTuples) Objects(_ context.Context, namespace string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var objects []string
+	for t := range f.tuples {
+		if t.Namespace == namespace && !seen[t.ObjectID] {
+			seen[t.ObjectID] = true
+			objects = append(objects, t.ObjectID)
+		}
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// testSchema это клубы с владельцами, модераторами и участниками и комнаты внутри клубов
+func testSchema() Schema {
+	return Schema{Namespaces: map[string]Namespace{
+		"club": {Relations: map[string]Relation{
+			"owner":     {},
+			"moderator": {ComputedUsersets: []string{"owner"}},
+			"member":    {ComputedUsersets: []string{"moderator"}},
+		}},
+		"room": {Relations: map[string]Relation{
+			"parent": {},
+			"viewer": {TupleToUsersets: []TupleToUserset{{Tupleset: "parent", Relation: "member"}}},
+		}},
+	}}
+}
+
+func user(id string) models.Subject {
+	return models.Subject{Namespace: models.NamespaceUser, ObjectID: id}
+}
+
+func tuple(namespace, objectID, relation string, subject models.Subject) models.RelationTuple {
+	return models.RelationTuple{Namespace: namespace, ObjectID: objectID, Relation: relation, Subject: subject}
+}
+
+func newTestAuthz(t *testing.T) *Authz {
+	t.Helper()
+
+	require.NoError(t, testSchema().Validate())
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := New(log, testSchema(), &fakeTuples{tuples: make(map[models.RelationTuple]bool)})
+
+	require.NoError(t, a.WriteTuples(context.Background(), []models.RelationTuple{
+		tuple("club", "1", "owner", user("alice")),
+		tuple("club", "1", "moderator", user("bob")),
+		tuple("club", "1", "member", user("carol")),
+		// Участники клуба 2 считаются участниками клуба 1
+		tuple("club", "1", "member", models.Subject{Namespace: "club", ObjectID: "2", Relation: "member"}),
+		tuple("club", "2", "member", user("dave")),
+		tuple("room", "lobby", "parent", models.Subject{Namespace: "club", ObjectID: "1"}),
+	}))
+
+	return a
+}
+
+func TestCheck(t *testing.T) {
+	a := newTestAuthz(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		tuple models.RelationTuple
+		want  bool
+	}{
+		{tuple("club", "1", "owner", user("alice")), true},
+		{tuple("club", "1", "member", user("alice")), true},
+		{tuple("club", "1", "moderator", user("carol")), false},
+		{tuple("club", "1", "member", user("dave")), true},
+		{tuple("club", "2", "member", user("carol")), false},
+		{tuple("room", "lobby", "viewer", user("bob")), true},
+		{tuple("room", "lobby", "viewer", user("dave")), true},
+		{tuple("room", "lobby", "viewer", user("eve")), false},
+	}
+
+	for _, tt := range tests {
+		got, err := a.Check(ctx, tt.tuple)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.tuple.String())
+	}
+
+	_, err := a.Check(ctx, tuple("club", "1", "janitor", user("alice")))
+	assert.ErrorIs(t, err, ErrUnknownRelation)
+}
+
+func TestCheck_Cycle(t *testing.T) {
+	a := newTestAuthz(t)
+	ctx := context.Background()
+
+	require.NoError(t, a.WriteTuples(ctx, []models.RelationTuple{
+		tuple("club", "2", "member", models.Subject{Namespace: "club", ObjectID: "1", Relation: "member"}),
+	}))
+
+	ok, err := a.Check(ctx, tuple("club", "2", "member", user("carol")))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = a.Check(ctx, tuple("club", "2", "member", user("eve")))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestExpand(t *testing.T) {
+	a := newTestAuthz(t)
+
+	tree, err := a.Expand(context.Background(), "club", "1", "member")
+	require.NoError(t, err)
+
+	assert.Equal(t, "club:1#member", tree.Userset.String())
+	assert.Equal(t, []models.Subject{user("carol")}, tree.Subjects)
+	require.Len(t, tree.Children, 2)
+	assert.Equal(t, "club:2#member", tree.Children[0].Userset.String())
+	assert.Equal(t, []models.Subject{user("dave")}, tree.Children[0].Subjects)
+	assert.Equal(t, "club:1#moderator", tree.Children[1].Userset.String())
+	assert.Equal(t, []models.Subject{user("bob")}, tree.Children[1].Subjects)
+	require.Len(t, tree.Children[1].Children, 1)
+	assert.Equal(t, []models.Subject{user("alice")}, tree.Children[1].Children[0].Subjects)
+}
+
+func TestListObjects(t *testing.T) {
+	a := newTestAuthz(t)
+	ctx := context.Background()
+
+	clubs, err := a.ListObjects(ctx, "club", "member", user("dave"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, clubs)
+
+	rooms, err := a.ListObjects(ctx, "room", "viewer", user("eve"))
+	require.NoError(t, err)
+	assert.Empty(t, rooms)
+}
+
+func TestWriteTuples_Validation(t *testing.T) {
+	a := newTestAuthz(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, a.WriteTuples(ctx, []models.RelationTuple{tuple("team", "1", "member", user("alice"))}), ErrUnknownRelation)
+	assert.ErrorIs(t, a.WriteTuples(ctx, []models.RelationTuple{tuple("club", "1#x", "member", user("alice"))}), ErrInvalidTuple)
+	assert.ErrorIs(t, a.WriteTuples(ctx, []models.RelationTuple{tuple("club", "1", "member", models.Subject{Namespace: "club", ObjectID: "2", Relation: "janitor"})}), ErrUnknownRelation)
+	assert.ErrorIs(t, a.WriteTuples(ctx, nil), ErrInvalidTuple)
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema := testSchema()
+	schema.Namespaces["club"].Relations["member"] = Relation{ComputedUsersets: []string{"moderatr"}}
+	assert.ErrorIs(t, schema.Validate(), ErrInvalidSchema)
+}
@@ -0,0 +1,86 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Schema описывает namespaces и их отношения. Отношение без правил держится только на
+// записанных кортежах, правила добавляют к ним вычисляемых субъектов
+type Schema struct {
+	Namespaces map[string]Namespace
+}
+
+type Namespace struct {
+	// AppID это приложение которому принадлежит namespace. Сервисные токены других приложений
+	// его кортежи не видят и не меняют, 0 значит что работать с ним могут только админы
+	AppID     int
+	Relations map[string]Relation
+}
+
+// Relation это отношение с правилами перезаписи как в Zanzibar. Прямые кортежи (this)
+// учитываются всегда, ComputedUsersets и TupleToUsersets объединяются с ними
+type Relation struct {
+	// ComputedUsersets это отношения того же объекта которые дают это отношение:
+	// у club member в ComputedUsersets стоит moderator, значит модератор тоже участник
+	ComputedUsersets []string
+	// TupleToUsersets берут отношение у связанного объекта: room#viewer из parent -> member
+	// значит что участники клуба-родителя видят комнату
+	TupleToUsersets []TupleToUserset
+}
+
+// TupleToUserset это "найди объекты по отношению Tupleset и возьми у них отношение Relation"
+type TupleToUserset struct {
+	Tupleset string
+	Relation string
+}
+
+var ErrInvalidSchema = errors.New("invalid authorization schema")
+
+// Validate проверяет что правила ссылаются на объявленные отношения. Вызывается на старте,
+// что бы опечатка в конфиге не превратилась в молчаливый отказ при проверке
+func (s Schema) Validate() error {
+	for name, ns := range s.Namespaces {
+		for relName, rel := range ns.Relations {
+			for _, computed := range rel.ComputedUsersets {
+				if _, ok := ns.Relations[computed]; !ok {
+					return fmt.Errorf("%w: %s#%s references unknown relation %q", ErrInvalidSchema, name, relName, computed)
+				}
+			}
+			for _, ttu := range rel.TupleToUsersets {
+				if _, ok := ns.Relations[ttu.Tupleset]; !ok {
+					return fmt.Errorf("%w: %s#%s references unknown tupleset %q", ErrInvalidSchema, name, relName, ttu.Tupleset)
+				}
+				if !s.hasRelation(ttu.Relation) {
+					return fmt.Errorf("%w: %s#%s references relation %q that no namespace has", ErrInvalidSchema, name, relName, ttu.Relation)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s Schema) relation(namespace string, relation string) (Relation, bool) {
+	ns, ok := s.Namespaces[namespace]
+	if !ok {
+		return Relation{}, false
+	}
+	rel, ok := ns.Relations[relation]
+	return rel, ok
+}
+
+func (s Schema) hasRelation(relation string) bool {
+	for _, ns := range s.Namespaces {
+		if _, ok := ns.Relations[relation]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnedBy говорит принадлежит ли namespace приложению appID
+func (s Schema) OwnedBy(namespace string, appID int) bool {
+	ns, ok := s.Namespaces[namespace]
+	return ok && appID != 0 && ns.AppID == appID
+}
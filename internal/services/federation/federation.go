@@ -0,0 +1,293 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	stateTTL        = 10 * time.Minute
+	randomTokenSize = 32
+)
+
+// Federation отвечает за вход через внешних OpenID Connect провайдеров (Google и т.п.).
+// Сам токен STTAuth выдает auth сервис через TokenIssuer, тут только подтверждение личности
+type Federation struct {
+	log         *slog.Logger
+	providers   map[string]Provider
+	states      StateStorage
+	identities  IdentityStorage
+	usrSaver    UserSaver
+	usrProvider UserProvider
+	tokens      TokenIssuer
+}
+
+// Provider это то что нам нужно от OIDC клиента, реализуется oidc.Client
+type Provider interface {
+	AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error)
+	Exchange(ctx context.Context, code string, codeVerifier string) (*oidc.TokenResponse, error)
+	VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*oidc.IDToken, error)
+}
+
+type StateStorage interface {
+	SaveFederationState(ctx context.Context, stateHash string, state models.FederationState) error
+	UseFederationState(ctx context.Context, stateHash string) (models.FederationState, error)
+}
+
+type IdentityStorage interface {
+	Identity(ctx context.Context, provider string, subject string) (models.Identity, error)
+	SaveIdentity(ctx context.Context, identity models.Identity) error
+}
+
+type UserSaver interface {
+	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
+	MarkEmailVerified(ctx context.Context, userID int64) error
+}
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+}
+
+type TokenIssuer interface {
+	LoginUser(ctx context.Context, user models.User, appID int, scopes []string, client models.ClientInfo) (string, error)
+}
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidState     = errors.New("invalid or expired state")
+	ErrEmailNotVerified = errors.New("email is not verified by identity provider")
+	ErrUpstream         = errors.New("identity provider error")
+)
+
+// New это конструктор для Federation сервиса
+func New(
+	log *slog.Logger,
+	providers map[string]Provider,
+	stateStorage StateStorage,
+	identityStorage IdentityStorage,
+	userSaver UserSaver,
+	userProvider UserProvider,
+	tokenIssuer TokenIssuer,
+) *Federation {
+	return &Federation{
+		log:         log,
+		providers:   providers,
+		states:      stateStorage,
+		identities:  identityStorage,
+		usrSaver:    userSaver,
+		usrProvider: userProvider,
+		tokens:      tokenIssuer,
+	}
+}
+
+// AuthURL начинает вход через провайдера: запоминает state, nonce и PKCE verifier
+// и возвращает адрес на который клиент должен отправить браузер
+func (f *Federation) AuthURL(ctx context.Context, providerName string, appID int) (string, error) {
+	const op = "federation.AuthURL"
+
+	log := f.log.With(
+		slog.String("op", op),
+		slog.String("provider", providerName),
+		slog.Int("app_id", appID),
+	)
+
+	provider, ok := f.providers[providerName]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	var state, nonce, verifier string
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		token, err := randomToken()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		*v = token
+	}
+
+	err := f.states.SaveFederationState(ctx, hashToken(state), models.FederationState{
+		Provider:     providerName,
+		AppID:        appID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(stateTTL),
+	})
+	if err != nil {
+		log.Error("falied to save state", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Error("falied to build auth url", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w: %w", op, ErrUpstream, err)
+	}
+
+	return authURL, nil
+}
+
+// Callback завершает вход: меняет code на токены провайдера, проверяет ID токен,
+// находит или заводит пользователя и выдает обычный токен STTAuth
+func (f *Federation) Callback(
+	ctx context.Context,
+	providerName string,
+	state string,
+	code string,
+	client models.ClientInfo,
+) (string, error) {
+	const op = "federation.Callback"
+
+	log := f.log.With(
+		slog.String("op", op),
+		slog.String("provider", providerName),
+	)
+
+	provider, ok := f.providers[providerName]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	saved, err := f.states.UseFederationState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, storage.ErrStateNotFound) {
+			log.Warn("state not found")
+
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidState)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// state выдан для другого провайдера, значит кто то склеил чужие параметры
+	if saved.Provider != providerName {
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidState)
+	}
+
+	tokens, err := provider.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		log.Warn("falied to exchange code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w: %w", op, ErrUpstream, err)
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, tokens.IDToken, saved.Nonce)
+	if err != nil {
+		log.Warn("id token rejected", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w: %w", op, ErrUpstream, err)
+	}
+
+	user, err := f.linkUser(ctx, log, providerName, idToken)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := f.tokens.LoginUser(ctx, user, saved.AppID, nil, client)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// linkUser находит пользователя по внешнему аккаунту. Если связи еще нет то привязываем по email,
+// но только подтвержденному провайдером, иначе можно было бы войти в чужой аккаунт указав его email
+func (f *Federation) linkUser(ctx context.Context, log *slog.Logger, providerName string, idToken *oidc.IDToken) (models.User, error) {
+	identity, err := f.identities.Identity(ctx, providerName, idToken.Subject)
+	if err == nil {
+		return f.usrProvider.UserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, storage.ErrIdentityNotFound) {
+		return models.User{}, err
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		log.Warn("cannot link identity without verified email")
+
+		return models.User{}, ErrEmailNotVerified
+	}
+
+	user, err := f.usrProvider.User(ctx, idToken.Email)
+	switch {
+	case err == nil:
+		log.Info("linking identity to existing user", slog.Int64("user_id", user.ID))
+	case errors.Is(err, storage.ErrUserNotFound):
+		user, err = f.createUser(ctx, idToken.Email)
+		if err != nil {
+			return models.User{}, err
+		}
+		log.Info("created user from identity", slog.Int64("user_id", user.ID))
+	default:
+		return models.User{}, err
+	}
+
+	err = f.identities.SaveIdentity(ctx, models.Identity{
+		Provider: providerName,
+		Subject:  idToken.Subject,
+		UserID:   user.ID,
+		Email:    idToken.Email,
+	})
+	if err != nil && !errors.Is(err, storage.ErrIdentityExists) {
+		return models.User{}, err
+	}
+
+	// Провайдер подтвердил что email принадлежит этому человеку, политики входа могут на это опираться
+	if user.EmailVerifiedAt == nil {
+		if err := f.usrSaver.MarkEmailVerified(ctx, user.ID); err != nil {
+			return models.User{}, err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	return user, nil
+}
+
+// createUser заводит пользователя без пароля. В pass_hash кладем хеш случайной строки,
+// которую никто не знает, так что войти по паролю нельзя пока пользователь сам его не задаст
+func (f *Federation) createUser(ctx context.Context, email string) (models.User, error) {
+	password, err := randomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	id, err := f.usrSaver.SaveUser(ctx, email, passHash)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return models.User{ID: id, Email: email, PassHash: passHash}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, randomTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,245 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc/oidctest"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	mu         sync.Mutex
+	states     map[string]models.FederationState
+	identities map[string]models.Identity
+	users      map[int64]models.User
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		states:     make(map[string]models.FederationState),
+		identities: make(map[string]models.Identity),
+		users:      make(map[int64]models.User),
+	}
+}
+
+func (s *fakeStorage) SaveFederationState(_ context.Context, stateHash string, state models.FederationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[stateHash] = state
+	return nil
+}
+
+func (s *fakeStorage) UseFederationState(_ context.Context, stateHash string) (models.FederationState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[stateHash]
+	if !ok {
+		return models.FederationState{}, storage.ErrStateNotFound
+	}
+	delete(s.states, stateHash)
+	return state, nil
+}
+
+func (s *fakeStorage) Identity(_ context.Context, provider string, subject string) (models.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, ok := s.identities[provider+"|"+subject]
+	if !ok {
+		return models.Identity{}, storage.ErrIdentityNotFound
+	}
+	return identity, nil
+}
+
+func (s *fakeStorage) SaveIdentity(_ context.Context, identity models.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identities[identity.Provider+"|"+identity.Subject] = identity
+	return nil
+}
+
+func (s *fakeStorage) SaveUser(_ context.Context, email string, passHash []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := int64(len(s.users) + 1)
+	s.users[id] = models.User{ID: id, Email: email, PassHash: passHash}
+	return id, nil
+}
+
+func (s *fakeStorage) MarkEmailVerified(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	s.users[userID] = user
+	return nil
+}
+
+func (s *fakeStorage) User(_ context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) UserByID(_ context.Context, userID int64) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+type fakeIssuer struct{}
+
+func (fakeIssuer) LoginUser(_ context.Context, user models.User, appID int, _ []string, _ models.ClientInfo) (string, error) {
+	return fmt.Sprintf("token-%d-%d", user.ID, appID), nil
+}
+
+func newTestFederation(t *testing.T) (*Federation, *oidctest.Provider, *fakeStorage) {
+	t.Helper()
+
+	provider := oidctest.NewProvider(t, "stt-client", "stt-secret")
+
+	client := oidc.NewClient(oidc.Config{
+		Issuer:       provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  "http://localhost:3000/federation/callback",
+	}, provider.Server.Client())
+
+	st := newFakeStorage()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	f := New(log, map[string]Provider{"mock": client}, st, st, st, st, fakeIssuer{})
+
+	return f, provider, st
+}
+
+func TestFederation_NewUser(t *testing.T) {
+	f, provider, st := newTestFederation(t)
+	ctx := context.Background()
+
+	authURL, err := f.AuthURL(ctx, "mock", 1)
+	require.NoError(t, err)
+
+	code, state := provider.Authorize(t, authURL, oidctest.User{
+		Subject:       "upstream-1",
+		Email:         "player@example.com",
+		EmailVerified: true,
+	})
+
+	token, err := f.Callback(ctx, "mock", state, code, models.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-1-1", token)
+
+	user, err := st.User(ctx, "player@example.com")
+	require.NoError(t, err)
+
+	identity, err := st.Identity(ctx, "mock", "upstream-1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, identity.UserID)
+
+	// Второй вход с тем же внешним аккаунтом попадает в того же пользователя
+	authURL, err = f.AuthURL(ctx, "mock", 1)
+	require.NoError(t, err)
+	code, state = provider.Authorize(t, authURL, oidctest.User{Subject: "upstream-1"})
+
+	token, err = f.Callback(ctx, "mock", state, code, models.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-1-1", token)
+}
+
+func TestFederation_LinkExistingUser(t *testing.T) {
+	f, provider, st := newTestFederation(t)
+	ctx := context.Background()
+
+	existingID, err := st.SaveUser(ctx, "player@example.com", []byte("hash"))
+	require.NoError(t, err)
+
+	authURL, err := f.AuthURL(ctx, "mock", 2)
+	require.NoError(t, err)
+
+	code, state := provider.Authorize(t, authURL, oidctest.User{
+		Subject:       "upstream-1",
+		Email:         "player@example.com",
+		EmailVerified: true,
+	})
+
+	token, err := f.Callback(ctx, "mock", state, code, models.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("token-%d-2", existingID), token)
+
+	user, err := st.UserByID(ctx, existingID)
+	require.NoError(t, err)
+	assert.NotNil(t, user.EmailVerifiedAt, "provider verified the email")
+}
+
+func TestFederation_UnverifiedEmail(t *testing.T) {
+	f, provider, st := newTestFederation(t)
+	ctx := context.Background()
+
+	_, err := st.SaveUser(ctx, "victim@example.com", []byte("hash"))
+	require.NoError(t, err)
+
+	authURL, err := f.AuthURL(ctx, "mock", 1)
+	require.NoError(t, err)
+
+	code, state := provider.Authorize(t, authURL, oidctest.User{
+		Subject: "attacker",
+		Email:   "victim@example.com",
+	})
+
+	_, err = f.Callback(ctx, "mock", state, code, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+}
+
+func TestFederation_StateIsSingleUse(t *testing.T) {
+	f, provider, _ := newTestFederation(t)
+	ctx := context.Background()
+
+	authURL, err := f.AuthURL(ctx, "mock", 1)
+	require.NoError(t, err)
+
+	code, state := provider.Authorize(t, authURL, oidctest.User{
+		Subject:       "upstream-1",
+		Email:         "player@example.com",
+		EmailVerified: true,
+	})
+
+	_, err = f.Callback(ctx, "mock", state, code, models.ClientInfo{})
+	require.NoError(t, err)
+
+	_, err = f.Callback(ctx, "mock", state, code, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	_, err = f.Callback(ctx, "unknown", state, code, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
@@ -0,0 +1,299 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const (
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// Согласные без гласных и похожих друг на друга букв, так из кода не сложится слово (RFC 8628 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// user_code короткий, так что при совпадении просто пробуем еще раз
+	userCodeAttempts = 5
+)
+
+type DeviceStorage interface {
+	SaveDeviceCode(ctx context.Context, deviceCodeHash string, code models.DeviceCode) error
+	PendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	ResolveDeviceCode(ctx context.Context, userCode string, userID int64, status string) (models.DeviceCode, error)
+	PollDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, bool, error)
+	DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error
+}
+
+// DeviceConfig это настройки device authorization grant
+type DeviceConfig struct {
+	// VerificationURI это страница где пользователь вводит user_code
+	VerificationURI string
+	TTL             time.Duration
+	Interval        time.Duration
+}
+
+// DeviceAuthorization это ответ устройству на запрос входа
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               int64
+	Interval                int64
+}
+
+// Ошибки опроса из RFC 8628 3.5
+var (
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("slow down")
+	ErrAccessDenied         = errors.New("access denied")
+	ErrExpiredToken         = errors.New("device code expired")
+	ErrInvalidUserCode      = errors.New("invalid or expired user code")
+)
+
+// DeviceAuthorize начинает вход для устройства без браузера
+func (o *OAuth) DeviceAuthorize(ctx context.Context, clientID string, scope string) (DeviceAuthorization, error) {
+	const op = "oauth.DeviceAuthorize"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("client_id", clientID),
+	)
+
+	app, err := o.client(ctx, clientID)
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkScopes(app, scope); err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deviceCode, err := randomToken()
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var userCode string
+	for attempt := 0; ; attempt++ {
+		userCode, err = newUserCode()
+		if err != nil {
+			return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = o.devices.SaveDeviceCode(ctx, hashToken(deviceCode), models.DeviceCode{
+			UserCode:  userCode,
+			AppID:     app.ID,
+			Scope:     scope,
+			Status:    models.DeviceCodePending,
+			Interval:  o.device.Interval,
+			ExpiresAt: time.Now().Add(o.device.TTL),
+		})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, storage.ErrDeviceCodeExists) || attempt+1 == userCodeAttempts {
+			log.Error("falied to save device code", sl.Err(err))
+
+			return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("device code issued")
+
+	display := formatUserCode(userCode)
+
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                display,
+		VerificationURI:         o.device.VerificationURI,
+		VerificationURIComplete: RedirectURL(o.device.VerificationURI, url.Values{"user_code": {display}}),
+		ExpiresIn:               int64(o.device.TTL.Seconds()),
+		Interval:                int64(o.device.Interval.Seconds()),
+	}, nil
+}
+
+// ApproveDevice вызывается когда вошедший пользователь ввел user_code. approve=false отклоняет запрос.
+// Одобрение это и есть согласие на scope которые запросило устройство
+func (o *OAuth) ApproveDevice(ctx context.Context, userID int64, userCode string, approve bool) error {
+	const op = "oauth.ApproveDevice"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	userCode = normalizeUserCode(userCode)
+
+	status := models.DeviceCodeDenied
+	if approve {
+		status = models.DeviceCodeApproved
+
+		// Согласие записываем до одобрения. Иначе при ошибке код уже одобрен и устройство
+		// получит токен на scope на которые согласия нет
+		pending, err := o.devices.PendingDeviceCode(ctx, userCode)
+		if err != nil {
+			if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+				log.Warn("user code not found")
+
+				return fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+			}
+			log.Error("falied to get device code", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := o.auth.CheckConsent(ctx, userID, pending.AppID, strings.Fields(pending.Scope), true); err != nil {
+			log.Error("falied to save consent", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	code, err := o.devices.ResolveDeviceCode(ctx, userCode, userID, status)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("user code not found")
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+		}
+		log.Error("falied to resolve device code", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("device code resolved", slog.Int("app_id", code.AppID), slog.String("status", status))
+
+	return nil
+}
+
+// exchangeDeviceCode это опрос устройства. Пока пользователь не ответил возвращает ErrAuthorizationPending,
+// после одобрения выдает обычный токен и удаляет код
+func (o *OAuth) exchangeDeviceCode(ctx context.Context, req TokenRequest, client models.ClientInfo) (TokenResponse, error) {
+	const op = "oauth.exchangeDeviceCode"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("client_id", req.ClientID),
+	)
+
+	if req.DeviceCode == "" {
+		return TokenResponse{}, fmt.Errorf("%s: %w: device_code is required", op, ErrInvalidRequest)
+	}
+
+	app, err := o.client(ctx, req.ClientID)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkClientSecret(app, req.ClientSecret); err != nil {
+		log.Warn("invalid client secret")
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deviceCodeHash := hashToken(req.DeviceCode)
+
+	code, slowDown, err := o.devices.PollDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if code.AppID != app.ID {
+		log.Warn("device code issued for another client")
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	if time.Now().After(code.ExpiresAt) {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrExpiredToken)
+	}
+
+	if slowDown {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrSlowDown)
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrAuthorizationPending)
+
+	case models.DeviceCodeDenied:
+		_ = o.devices.DeleteDeviceCode(ctx, deviceCodeHash)
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrAccessDenied)
+	}
+
+	// Удаление это и есть погашение кода: если два опроса пришли одновременно, токен получит только один
+	if err := o.devices.DeleteDeviceCode(ctx, deviceCodeHash); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := o.usrProvider.UserByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := o.tokens.LoginUser(ctx, user, app.ID, strings.Fields(code.Scope), client)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("device code exchanged", slog.Int64("user_id", user.ID))
+
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(o.tokenTTL.Seconds()),
+		Scope:       code.Scope,
+	}, nil
+}
+
+func newUserCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// formatUserCode показывает код пользователю как XXXX-XXXX, так его проще переписать
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode прощает регистр, дефис и пробелы при вводе
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,136 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func pollDevice(o *OAuth, deviceCode string) (TokenResponse, error) {
+	return o.Exchange(context.Background(), TokenRequest{
+		GrantType:  GrantTypeDeviceCode,
+		ClientID:   "1",
+		DeviceCode: deviceCode,
+	}, models.ClientInfo{})
+}
+
+func TestDeviceFlow(t *testing.T) {
+	o, st := newTestOAuthWithStorage(t)
+
+	auth, err := o.DeviceAuthorize(context.Background(), "1", "profile")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[B-Z]{4}-[B-Z]{4}$`, auth.UserCode)
+	assert.Equal(t, "https://example.com/device?user_code="+auth.UserCode, auth.VerificationURIComplete)
+	assert.Equal(t, int64(1), auth.Interval)
+
+	_, err = pollDevice(o, auth.DeviceCode)
+	assert.ErrorIs(t, err, ErrAuthorizationPending)
+
+	// Опрос раньше interval
+	_, err = pollDevice(o, auth.DeviceCode)
+	assert.ErrorIs(t, err, ErrSlowDown)
+
+	// Пользователь вводит код как попало
+	require.NoError(t, o.ApproveDevice(context.Background(), 7, " "+auth.UserCode[:4]+auth.UserCode[5:], true))
+	assert.ErrorIs(t, o.ApproveDevice(context.Background(), 7, auth.UserCode, true), ErrInvalidUserCode, "code is resolved only once")
+
+	// Сбрасываем время опроса что бы не ждать интервал в тесте
+	for _, c := range st.deviceCodes {
+		c.lastPolled = time.Time{}
+	}
+
+	resp, err := pollDevice(o, auth.DeviceCode)
+	require.NoError(t, err)
+	assert.Equal(t, "token-for-user", resp.AccessToken)
+	assert.Equal(t, "profile", resp.Scope)
+
+	_, err = pollDevice(o, auth.DeviceCode)
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+}
+
+func TestDeviceFlow_Denied(t *testing.T) {
+	o := newTestOAuth(t)
+
+	auth, err := o.DeviceAuthorize(context.Background(), "1", "")
+	require.NoError(t, err)
+
+	require.NoError(t, o.ApproveDevice(context.Background(), 7, auth.UserCode, false))
+
+	_, err = pollDevice(o, auth.DeviceCode)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
+
+func TestDeviceFlow_ConsentBeforeApproval(t *testing.T) {
+	o, st := newTestOAuthWithStorage(t)
+
+	auth, err := o.DeviceAuthorize(context.Background(), "1", "profile")
+	require.NoError(t, err)
+
+	// Согласие не сохранилось, значит код не одобрен и его еще можно одобрить
+	assert.Error(t, o.ApproveDevice(context.Background(), consentFailingUserID, auth.UserCode, true))
+	_, err = pollDevice(o, auth.DeviceCode)
+	assert.ErrorIs(t, err, ErrAuthorizationPending)
+
+	require.NoError(t, o.ApproveDevice(context.Background(), 7, auth.UserCode, true))
+	for _, c := range st.deviceCodes {
+		assert.Equal(t, int64(7), c.code.UserID)
+	}
+}
+
+func TestDeviceFlow_ConfidentialClient(t *testing.T) {
+	o, st := newTestOAuthWithStorage(t)
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte("client-secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	st.apps[3] = models.App{ID: 3, Name: "console", TokenEndpointAuthMethod: AuthMethodClientSecretBasic, ClientSecretHash: secretHash}
+
+	auth, err := o.DeviceAuthorize(context.Background(), "3", "")
+	require.NoError(t, err)
+	require.NoError(t, o.ApproveDevice(context.Background(), 7, auth.UserCode, true))
+
+	poll := func(secret string) (TokenResponse, error) {
+		return o.Exchange(context.Background(), TokenRequest{
+			GrantType:    GrantTypeDeviceCode,
+			ClientID:     "3",
+			ClientSecret: secret,
+			DeviceCode:   auth.DeviceCode,
+		}, models.ClientInfo{})
+	}
+
+	_, err = poll("")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, err = poll("wrong-secret")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	// Неудачные попытки код не тратят
+	resp, err := poll("client-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "token-for-user", resp.AccessToken)
+}
+
+func TestDeviceFlow_Expired(t *testing.T) {
+	o, st := newTestOAuthWithStorage(t)
+
+	auth, err := o.DeviceAuthorize(context.Background(), "1", "")
+	require.NoError(t, err)
+
+	for _, c := range st.deviceCodes {
+		c.code.ExpiresAt = time.Now().Add(-time.Second)
+	}
+
+	_, err = pollDevice(o, auth.DeviceCode)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	assert.ErrorIs(t, o.ApproveDevice(context.Background(), 7, auth.UserCode, true), ErrInvalidUserCode)
+}
+
+func TestDeviceAuthorize_UnknownClient(t *testing.T) {
+	o := newTestOAuth(t)
+
+	_, err := o.DeviceAuthorize(context.Background(), "2", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
@@ -0,0 +1,463 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// RFC 6749 советует жизнь кода не больше 10 минут
+	codeTTL   = 10 * time.Minute
+	codeBytes = 32
+
+	ResponseTypeCode       = "code"
+	GrantTypeAuthorization = "authorization_code"
+	GrantTypeClient        = "client_credentials"
+	ChallengeMethodS256    = "S256"
+	TokenTypeBearer        = "Bearer"
+)
+
+// OAuth это OAuth 2.0 authorization server поверх auth сервиса. Пароль проверяет Authenticator,
+// access token это обычный токен STTAuth который выдает TokenIssuer
+type OAuth struct {
+	log         *slog.Logger
+	appProvider AppProvider
+	codes       CodeStorage
+	usrProvider UserProvider
+	auth        Authenticator
+	tokens      TokenIssuer
+	verifier    TokenVerifier
+	devices     DeviceStorage
+	registry    ClientRegistry
+	device      DeviceConfig
+	provider    ProviderConfig
+	keyID       string
+	tokenTTL    time.Duration
+	// registration это настройки динамической регистрации клиентов
+	registration RegistrationConfig
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appID int) (models.App, error)
+}
+
+type CodeStorage interface {
+	SaveAuthCode(ctx context.Context, codeHash string, code models.AuthCode) error
+	UseAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error)
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, email string, password string, appID int) (models.User, error)
+	CheckConsent(ctx context.Context, userID int64, appID int, scopes []string, grant bool) error
+}
+
+type TokenIssuer interface {
+	LoginUser(ctx context.Context, user models.User, appID int, scopes []string, client models.ClientInfo) (string, error)
+	ClientToken(ctx context.Context, appID int, clientSecret string, scopes []string) (string, []string, error)
+}
+
+// AuthorizeRequest это параметры запроса на /authorize
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest это параметры запроса на /token
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	DeviceCode   string
+	Scope        string
+}
+
+type TokenResponse struct {
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int64
+	Scope       string
+	// IDToken есть только если был запрошен scope openid
+	IDToken string
+}
+
+// Ошибки совпадают с кодами ошибок из RFC 6749, транспорт превращает их в error из ответа.
+// После ErrInvalidClient и ErrInvalidRedirectURI пользователя нельзя отправлять на redirect_uri
+var (
+	ErrInvalidClient           = errors.New("invalid client")
+	ErrInvalidRedirectURI      = errors.New("redirect uri is not registered")
+	ErrInvalidRequest          = errors.New("invalid request")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	ErrInvalidGrant            = errors.New("invalid grant")
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")
+	ErrInvalidScope            = errors.New("scope is not allowed for client")
+)
+
+// New это конструктор для OAuth сервиса
+func New(
+	log *slog.Logger,
+	appProvider AppProvider,
+	codeStorage CodeStorage,
+	userProvider UserProvider,
+	authenticator Authenticator,
+	tokenIssuer TokenIssuer,
+	tokenVerifier TokenVerifier,
+	deviceStorage DeviceStorage,
+	clientRegistry ClientRegistry,
+	deviceConfig DeviceConfig,
+	providerConfig ProviderConfig,
+	registrationConfig RegistrationConfig,
+	tokenTTL time.Duration,
+) *OAuth {
+	return &OAuth{
+		log:         log,
+		appProvider: appProvider,
+		codes:       codeStorage,
+		usrProvider: userProvider,
+		auth:        authenticator,
+		tokens:      tokenIssuer,
+		verifier:    tokenVerifier,
+		devices:     deviceStorage,
+		registry:    clientRegistry,
+		device:      deviceConfig,
+		provider:    providerConfig,
+		keyID:       oidc.KeyID(&providerConfig.SigningKey.PublicKey),
+		tokenTTL:    tokenTTL,
+
+		registration: registrationConfig,
+	}
+}
+
+// ValidateAuthorize проверяет запрос на /authorize до того как показать пользователю форму входа.
+// Возвращает redirect_uri на который потом уйдет ответ, он может быть не указан в запросе
+// если у приложения зарегистрирован ровно один
+func (o *OAuth) ValidateAuthorize(ctx context.Context, req AuthorizeRequest) (string, error) {
+	const op = "oauth.ValidateAuthorize"
+
+	app, err := o.client(ctx, req.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	redirectURI, err := matchRedirectURI(app, req.RedirectURI)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return redirectURI, fmt.Errorf("%s: %w", op, ErrUnsupportedResponseType)
+	}
+
+	// PKCE обязателен для всех клиентов, plain не принимаем потому что он ничего не защищает
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != ChallengeMethodS256 {
+		return redirectURI, fmt.Errorf("%s: %w: code_challenge with S256 method is required", op, ErrInvalidRequest)
+	}
+
+	if err := checkScopes(app, req.Scope); err != nil {
+		return redirectURI, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return redirectURI, nil
+}
+
+// Authorize проверяет логин и пароль пользователя и выдает код. Возвращает адрес
+// на который надо отправить браузер, в нем уже есть code и state. consent означает
+// что пользователь на этой форме согласился отдать клиенту запрошенные scope
+func (o *OAuth) Authorize(ctx context.Context, req AuthorizeRequest, email string, password string, consent bool) (string, error) {
+	const op = "oauth.Authorize"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("client_id", req.ClientID),
+	)
+
+	redirectURI, err := o.ValidateAuthorize(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	// ValidateAuthorize уже проверил что client_id это число
+	appID, _ := strconv.Atoi(req.ClientID)
+
+	user, err := o.auth.Authenticate(ctx, email, password, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.auth.CheckConsent(ctx, user.ID, appID, strings.Fields(req.Scope), consent); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = o.codes.SaveAuthCode(ctx, hashToken(code), models.AuthCode{
+		AppID:  appID,
+		UserID: user.ID,
+		// Сохраняем то что прислал клиент: если redirect_uri не было в запросе, то и в /token его быть не должно
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		AuthTime:      time.Now(),
+		ExpiresAt:     time.Now().Add(codeTTL),
+	})
+	if err != nil {
+		log.Error("falied to save authorization code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code issued", slog.Int64("user_id", user.ID))
+
+	return RedirectURL(redirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	}), nil
+}
+
+// Exchange это обработчик /token, выбирает grant по grant_type
+func (o *OAuth) Exchange(ctx context.Context, req TokenRequest, client models.ClientInfo) (TokenResponse, error) {
+	const op = "oauth.Exchange"
+
+	switch req.GrantType {
+	case GrantTypeAuthorization:
+		return o.exchangeCode(ctx, req, client)
+	case GrantTypeClient:
+		return o.clientCredentials(ctx, req)
+	case GrantTypeDeviceCode:
+		return o.exchangeDeviceCode(ctx, req, client)
+	default:
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+}
+
+// exchangeCode меняет код на access token
+func (o *OAuth) exchangeCode(ctx context.Context, req TokenRequest, client models.ClientInfo) (TokenResponse, error) {
+	const op = "oauth.exchangeCode"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("client_id", req.ClientID),
+	)
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		return TokenResponse{}, fmt.Errorf("%s: %w: code and code_verifier are required", op, ErrInvalidRequest)
+	}
+
+	app, err := o.client(ctx, req.ClientID)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkClientSecret(app, req.ClientSecret); err != nil {
+		log.Warn("invalid client secret")
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Код удаляется при первой же попытке, даже неудачной, так что перебрать verifier не выйдет
+	code, err := o.codes.UseAuthCode(ctx, hashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, storage.ErrAuthCodeNotFound) {
+			log.Warn("authorization code not found")
+
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if code.AppID != app.ID || code.RedirectURI != req.RedirectURI {
+		log.Warn("authorization code issued for another client or redirect uri")
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	challenge := oidc.S256Challenge(req.CodeVerifier)
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		log.Warn("pkce verification failed")
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	user, err := o.usrProvider.UserByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := o.tokens.LoginUser(ctx, user, app.ID, strings.Fields(code.Scope), client)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	idToken, err := o.idToken(user, code)
+	if err != nil {
+		log.Error("falied to sign id token", sl.Err(err))
+
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code exchanged", slog.Int64("user_id", user.ID))
+
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(o.tokenTTL.Seconds()),
+		Scope:       code.Scope,
+		IDToken:     idToken,
+	}, nil
+}
+
+// clientCredentials выдает сервисный токен без пользователя, проверку секрета делает auth сервис
+func (o *OAuth) clientCredentials(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	const op = "oauth.clientCredentials"
+
+	if req.ClientSecret == "" {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+	}
+
+	appID, err := strconv.Atoi(req.ClientID)
+	if err != nil || appID <= 0 {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+	}
+
+	token, scopes, err := o.tokens.ClientToken(ctx, appID, req.ClientSecret, strings.Fields(req.Scope))
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(o.tokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// client находит приложение по client_id. Пока client_id это просто id приложения
+func (o *OAuth) client(ctx context.Context, clientID string) (models.App, error) {
+	appID, err := strconv.Atoi(clientID)
+	if err != nil || appID <= 0 {
+		return models.App{}, ErrInvalidClient
+	}
+
+	app, err := o.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, ErrInvalidClient
+		}
+		return models.App{}, err
+	}
+	// Выключенное приложение для OAuth выглядит так же как несуществующее
+	if app.DisabledAt != nil {
+		return models.App{}, ErrInvalidClient
+	}
+
+	return app, nil
+}
+
+// checkClientSecret проверяет секрет у конфиденциальных клиентов из динамической регистрации.
+// Остальные клиенты публичные, их защищает PKCE
+func checkClientSecret(app models.App, clientSecret string) error {
+	if app.TokenEndpointAuthMethod != AuthMethodClientSecretBasic && app.TokenEndpointAuthMethod != AuthMethodClientSecretPost {
+		return nil
+	}
+
+	if bcrypt.CompareHashAndPassword(app.ClientSecretHash, []byte(clientSecret)) != nil {
+		return ErrInvalidClient
+	}
+	return nil
+}
+
+// checkScopes проверяет что клиент просит у пользователя только то что объявил
+func checkScopes(app models.App, scope string) error {
+	for _, s := range strings.Fields(scope) {
+		if !app.AllowsUserScope(s) {
+			return ErrInvalidScope
+		}
+	}
+	return nil
+}
+
+func matchRedirectURI(app models.App, redirectURI string) (string, error) {
+	if redirectURI == "" {
+		if len(app.RedirectURIs) == 1 {
+			return app.RedirectURIs[0], nil
+		}
+		return "", ErrInvalidRedirectURI
+	}
+
+	if !slices.Contains(app.RedirectURIs, redirectURI) {
+		return "", ErrInvalidRedirectURI
+	}
+
+	return redirectURI, nil
+}
+
+// RedirectURL добавляет параметры к redirect_uri не трогая те что там уже есть. Пустые значения пропускает
+func RedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, v := range values {
+			if v != "" {
+				query.Add(key, v)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, codeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
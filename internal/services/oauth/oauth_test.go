@@ -0,0 +1,425 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/services/auth"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	mu          sync.Mutex
+	apps        map[int]models.App
+	codes       map[string]models.AuthCode
+	deviceCodes map[string]*fakeDeviceCode
+}
+
+type fakeDeviceCode struct {
+	code       models.DeviceCode
+	lastPolled time.Time
+}
+
+func (s *fakeStorage) App(_ context.Context, appID int) (models.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, storage.ErrAppNotFound
+	}
+	return app, nil
+}
+
+func (s *fakeStorage) SaveApp(_ context.Context, app models.App) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apps {
+		if existing.Name == app.Name {
+			return 0, storage.ErrAppExists
+		}
+	}
+	app.ID = len(s.apps) + 100
+	s.apps[app.ID] = app
+	return app.ID, nil
+}
+
+func (s *fakeStorage) UpdateApp(_ context.Context, app models.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[app.ID]; !ok {
+		return storage.ErrAppNotFound
+	}
+	s.apps[app.ID] = app
+	return nil
+}
+
+func (s *fakeStorage) DeleteApp(_ context.Context, appID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appID]; !ok {
+		return storage.ErrAppNotFound
+	}
+	delete(s.apps, appID)
+	return nil
+}
+
+func (s *fakeStorage) SaveAuthCode(_ context.Context, codeHash string, code models.AuthCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[codeHash] = code
+	return nil
+}
+
+func (s *fakeStorage) UseAuthCode(_ context.Context, codeHash string) (models.AuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeHash]
+	if !ok || time.Now().After(code.ExpiresAt) {
+		return models.AuthCode{}, storage.ErrAuthCodeNotFound
+	}
+	delete(s.codes, codeHash)
+	return code, nil
+}
+
+func (s *fakeStorage) SaveDeviceCode(_ context.Context, deviceCodeHash string, code models.DeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.deviceCodes {
+		if c.code.UserCode == code.UserCode {
+			return storage.ErrDeviceCodeExists
+		}
+	}
+	s.deviceCodes[deviceCodeHash] = &fakeDeviceCode{code: code}
+	return nil
+}
+
+func (s *fakeStorage) PendingDeviceCode(_ context.Context, userCode string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.deviceCodes {
+		if c.code.UserCode == userCode && c.code.Status == models.DeviceCodePending && time.Now().Before(c.code.ExpiresAt) {
+			return c.code, nil
+		}
+	}
+	return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+}
+
+func (s *fakeStorage) ResolveDeviceCode(_ context.Context, userCode string, userID int64, status string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.deviceCodes {
+		if c.code.UserCode == userCode && c.code.Status == models.DeviceCodePending && time.Now().Before(c.code.ExpiresAt) {
+			c.code.Status = status
+			c.code.UserID = userID
+			return c.code, nil
+		}
+	}
+	return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+}
+
+func (s *fakeStorage) PollDeviceCode(_ context.Context, deviceCodeHash string) (models.DeviceCode, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.deviceCodes[deviceCodeHash]
+	if !ok {
+		return models.DeviceCode{}, false, storage.ErrDeviceCodeNotFound
+	}
+
+	slowDown := !c.lastPolled.IsZero() && time.Since(c.lastPolled) < c.code.Interval
+	if slowDown {
+		c.code.Interval += 5 * time.Second
+	}
+	c.lastPolled = time.Now()
+
+	return c.code, slowDown, nil
+}
+
+func (s *fakeStorage) DeleteDeviceCode(_ context.Context, deviceCodeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deviceCodes[deviceCodeHash]; !ok {
+		return storage.ErrDeviceCodeNotFound
+	}
+	delete(s.deviceCodes, deviceCodeHash)
+	return nil
+}
+
+func (s *fakeStorage) UserByID(_ context.Context, userID int64) (models.User, error) {
+	return models.User{ID: userID, Email: "alice@example.com"}, nil
+}
+
+type fakeAuth struct{}
+
+func (fakeAuth) Authenticate(_ context.Context, email string, password string, _ int) (models.User, error) {
+	if email != "alice@example.com" || password != "secret" {
+		return models.User{}, auth.ErrInvalidCredentials
+	}
+	return models.User{ID: 7, Email: email}, nil
+}
+
+// consentFailingUserID это пользователь у которого согласие не сохраняется
+const consentFailingUserID = 13
+
+// CheckConsent считает что раньше пользователь ни на что не соглашался
+func (fakeAuth) CheckConsent(_ context.Context, userID int64, _ int, scopes []string, grant bool) error {
+	if grant && userID == consentFailingUserID {
+		return errors.New("consent storage is down")
+	}
+	if len(scopes) > 0 && !grant {
+		return auth.ErrConsentRequired
+	}
+	return nil
+}
+
+func (fakeAuth) LoginUser(_ context.Context, user models.User, appID int, _ []string, _ models.ClientInfo) (string, error) {
+	return "token-for-user", nil
+}
+
+func (fakeAuth) ClientToken(_ context.Context, appID int, clientSecret string, scopes []string) (string, []string, error) {
+	if appID != 1 || clientSecret != "client-secret" {
+		return "", nil, auth.ErrInvalidClient
+	}
+	return "service-token", scopes, nil
+}
+
+func (fakeAuth) VerifyToken(_ context.Context, token string) (*jwtT.Claims, error) {
+	switch token {
+	case "token-for-user":
+		return &jwtT.Claims{UID: 7, AppID: 1, Scopes: []string{"openid"}}, nil
+	case "token-with-email":
+		return &jwtT.Claims{UID: 7, AppID: 1, Scopes: []string{"openid", "email", "profile"}}, nil
+	case "service-token":
+		return &jwtT.Claims{AppID: 1}, nil
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+const (
+	redirectURI = "https://game.example.com/callback"
+	verifier    = "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func newTestOAuth(t *testing.T) *OAuth {
+	t.Helper()
+
+	o, _ := newTestOAuthWithStorage(t)
+	return o
+}
+
+func newTestOAuthWithStorage(t *testing.T) (*OAuth, *fakeStorage) {
+	t.Helper()
+
+	st := &fakeStorage{
+		apps:        map[int]models.App{1: {ID: 1, Name: "game", RedirectURIs: []string{redirectURI}, Scopes: []string{"matches:read"}}},
+		codes:       make(map[string]models.AuthCode),
+		deviceCodes: make(map[string]*fakeDeviceCode),
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return New(log, st, st, st, fakeAuth{}, fakeAuth{}, fakeAuth{}, st, st, DeviceConfig{
+		VerificationURI: "https://example.com/device",
+		TTL:             10 * time.Minute,
+		Interval:        time.Second,
+	}, ProviderConfig{
+		Issuer:     "https://sso.example.com",
+		SigningKey: testSigningKey(t),
+	}, RegistrationConfig{
+		InitialAccessTokens: []string{"initial-token"},
+	}, time.Hour), st
+}
+
+var (
+	signingKey     *rsa.PrivateKey
+	signingKeyOnce sync.Once
+)
+
+// testSigningKey генерируется один раз на все тесты, RSA ключ это небыстро
+func testSigningKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	signingKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		signingKey = key
+	})
+	return signingKey
+}
+
+func authorizeRequest() AuthorizeRequest {
+	return AuthorizeRequest{
+		ClientID:            "1",
+		RedirectURI:         redirectURI,
+		ResponseType:        ResponseTypeCode,
+		State:               "xyz",
+		CodeChallenge:       oidc.S256Challenge(verifier),
+		CodeChallengeMethod: ChallengeMethodS256,
+	}
+}
+
+func authorize(t *testing.T, o *OAuth) string {
+	t.Helper()
+
+	location, err := o.Authorize(context.Background(), authorizeRequest(), "alice@example.com", "secret", false)
+	require.NoError(t, err)
+
+	u, err := url.Parse(location)
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+
+	return u.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	o := newTestOAuth(t)
+	code := authorize(t, o)
+
+	req := TokenRequest{
+		GrantType:    GrantTypeAuthorization,
+		ClientID:     "1",
+		Code:         code,
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+	}
+
+	resp, err := o.Exchange(context.Background(), req, models.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-for-user", resp.AccessToken)
+	assert.Equal(t, TokenTypeBearer, resp.TokenType)
+	assert.Equal(t, int64(3600), resp.ExpiresIn)
+
+	// Код одноразовый
+	_, err = o.Exchange(context.Background(), req, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+}
+
+func TestExchange_Rejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(req *TokenRequest)
+		err    error
+	}{
+		{name: "wrong verifier", modify: func(req *TokenRequest) { req.CodeVerifier = "another-verifier-another-verifier-another-v" }, err: ErrInvalidGrant},
+		{name: "wrong redirect uri", modify: func(req *TokenRequest) { req.RedirectURI = "https://evil.example.com/callback" }, err: ErrInvalidGrant},
+		{name: "unknown client", modify: func(req *TokenRequest) { req.ClientID = "2" }, err: ErrInvalidClient},
+		{name: "missing verifier", modify: func(req *TokenRequest) { req.CodeVerifier = "" }, err: ErrInvalidRequest},
+		{name: "unsupported grant", modify: func(req *TokenRequest) { req.GrantType = "password" }, err: ErrUnsupportedGrantType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOAuth(t)
+
+			req := TokenRequest{
+				GrantType:    GrantTypeAuthorization,
+				ClientID:     "1",
+				Code:         authorize(t, o),
+				RedirectURI:  redirectURI,
+				CodeVerifier: verifier,
+			}
+			tt.modify(&req)
+
+			_, err := o.Exchange(context.Background(), req, models.ClientInfo{})
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestValidateAuthorize(t *testing.T) {
+	o := newTestOAuth(t)
+
+	tests := []struct {
+		name     string
+		modify   func(req *AuthorizeRequest)
+		redirect string
+		err      error
+	}{
+		{name: "valid", modify: func(*AuthorizeRequest) {}, redirect: redirectURI},
+		{name: "default redirect uri", modify: func(req *AuthorizeRequest) { req.RedirectURI = "" }, redirect: redirectURI},
+		{name: "unregistered redirect uri", modify: func(req *AuthorizeRequest) { req.RedirectURI = redirectURI + "/../evil" }, err: ErrInvalidRedirectURI},
+		{name: "unknown client", modify: func(req *AuthorizeRequest) { req.ClientID = "abc" }, err: ErrInvalidClient},
+		{name: "implicit flow", modify: func(req *AuthorizeRequest) { req.ResponseType = "token" }, redirect: redirectURI, err: ErrUnsupportedResponseType},
+		{name: "plain pkce", modify: func(req *AuthorizeRequest) { req.CodeChallengeMethod = "plain" }, redirect: redirectURI, err: ErrInvalidRequest},
+		{name: "no pkce", modify: func(req *AuthorizeRequest) { req.CodeChallenge = "" }, redirect: redirectURI, err: ErrInvalidRequest},
+		{name: "declared scope", modify: func(req *AuthorizeRequest) { req.Scope = "openid matches:read" }, redirect: redirectURI},
+		{name: "undeclared scope", modify: func(req *AuthorizeRequest) { req.Scope = "openid admin" }, redirect: redirectURI, err: ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authorizeRequest()
+			tt.modify(&req)
+
+			redirect, err := o.ValidateAuthorize(context.Background(), req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.redirect, redirect)
+		})
+	}
+}
+
+func TestAuthorize_InvalidCredentials(t *testing.T) {
+	o := newTestOAuth(t)
+
+	_, err := o.Authorize(context.Background(), authorizeRequest(), "alice@example.com", "wrong", false)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestAuthorize_ConsentRequired(t *testing.T) {
+	o := newTestOAuth(t)
+
+	req := authorizeRequest()
+	req.Scope = "openid matches:read"
+
+	_, err := o.Authorize(context.Background(), req, "alice@example.com", "secret", false)
+	assert.ErrorIs(t, err, auth.ErrConsentRequired)
+
+	_, err = o.Authorize(context.Background(), req, "alice@example.com", "secret", true)
+	assert.NoError(t, err)
+}
+
+func TestClientCredentials(t *testing.T) {
+	o := newTestOAuth(t)
+
+	resp, err := o.Exchange(context.Background(), TokenRequest{
+		GrantType:    GrantTypeClient,
+		ClientID:     "1",
+		ClientSecret: "client-secret",
+		Scope:        "matches:read leaderboard:write",
+	}, models.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "service-token", resp.AccessToken)
+	assert.Equal(t, "matches:read leaderboard:write", resp.Scope)
+
+	_, err = o.Exchange(context.Background(), TokenRequest{GrantType: GrantTypeClient, ClientID: "1"}, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, err = o.Exchange(context.Background(), TokenRequest{GrantType: GrantTypeClient, ClientID: "1", ClientSecret: "wrong"}, models.ClientInfo{})
+	assert.ErrorIs(t, err, auth.ErrInvalidClient)
+}
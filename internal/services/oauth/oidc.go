@@ -0,0 +1,150 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// Scope из OpenID Connect
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+// Пути эндпоинтов, их же публикуем в discovery
+const (
+	AuthorizePath           = "/authorize"
+	TokenPath               = "/token"
+	UserInfoPath            = "/userinfo"
+	JWKSPath                = "/jwks.json"
+	DeviceAuthorizationPath = "/device_authorization"
+	RegistrationPath        = "/register"
+)
+
+// ProviderConfig это настройки OpenID Connect провайдера. Issuer должен совпадать с адресом
+// по которому клиенты ходят к нам, они сверяют его с iss в ID токене
+type ProviderConfig struct {
+	Issuer     string
+	SigningKey *rsa.PrivateKey
+}
+
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (*jwtT.Claims, error)
+}
+
+// UserInfo это ответ /userinfo
+type UserInfo struct {
+	Subject           string
+	Email             string
+	PreferredUsername string
+}
+
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Discovery это документ /.well-known/openid-configuration
+func (o *OAuth) Discovery() oidc.Metadata {
+	issuer := strings.TrimSuffix(o.provider.Issuer, "/")
+
+	// Эндпоинт регистрации публикуем только если она включена
+	var registrationEndpoint string
+	if len(o.registration.InitialAccessTokens) > 0 {
+		registrationEndpoint = issuer + RegistrationPath
+	}
+
+	return oidc.Metadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + AuthorizePath,
+		TokenEndpoint:                     issuer + TokenPath,
+		JWKSURI:                           issuer + JWKSPath,
+		UserinfoEndpoint:                  issuer + UserInfoPath,
+		DeviceAuthorizationEndpoint:       issuer + DeviceAuthorizationPath,
+		RegistrationEndpoint:              registrationEndpoint,
+		ResponseTypesSupported:            []string{ResponseTypeCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   []string{ScopeOpenID, ScopeEmail, ScopeProfile},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "preferred_username"},
+		GrantTypesSupported:               []string{GrantTypeAuthorization, GrantTypeClient, GrantTypeDeviceCode},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{ChallengeMethodS256},
+	}
+}
+
+// JWKS это публичные ключи которыми проверяются наши ID токены
+func (o *OAuth) JWKS() oidc.JWKS {
+	return oidc.JWKS{
+		Keys: []oidc.JWK{oidc.PublicJWK(o.keyID, &o.provider.SigningKey.PublicKey)},
+	}
+}
+
+// UserInfo отдает данные пользователя по его access токену
+func (o *OAuth) UserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
+	const op = "oauth.UserInfo"
+
+	claims, err := o.verifier.VerifyToken(ctx, accessToken)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	// У сервисного токена нет пользователя
+	if claims.IsService() {
+		return UserInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	user, err := o.usrProvider.UserByID(ctx, claims.UID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return UserInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Отдаем только то на что у токена есть scope, как и в id_token
+	info := UserInfo{Subject: strconv.FormatInt(user.ID, 10)}
+	if slices.Contains(claims.Scopes, ScopeEmail) {
+		info.Email = user.Email
+	}
+	if slices.Contains(claims.Scopes, ScopeProfile) {
+		info.PreferredUsername = user.Email
+	}
+
+	return info, nil
+}
+
+// idToken выдается вместе с access токеном если при авторизации был запрошен scope openid.
+// Claims кладем только те на которые есть scope
+func (o *OAuth) idToken(user models.User, code models.AuthCode) (string, error) {
+	scopes := strings.Fields(code.Scope)
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return "", nil
+	}
+
+	claims := jwtT.IDTokenClaims{
+		Issuer:    strings.TrimSuffix(o.provider.Issuer, "/"),
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Audience:  strconv.Itoa(code.AppID),
+		Nonce:     code.Nonce,
+		AuthTime:  code.AuthTime,
+		ExpiresAt: time.Now().Add(o.tokenTTL),
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims.Email = user.Email
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims.PreferredUsername = user.Email
+	}
+
+	return jwtT.NewIDToken(o.provider.SigningKey, o.keyID, claims)
+}
@@ -0,0 +1,108 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDToken(t *testing.T) {
+	o := newTestOAuth(t)
+
+	req := authorizeRequest()
+	req.Scope = "openid email"
+	req.Nonce = "n-0S6_WzA2Mj"
+
+	location, err := o.Authorize(context.Background(), req, "alice@example.com", "secret", true)
+	require.NoError(t, err)
+	u, err := url.Parse(location)
+	require.NoError(t, err)
+
+	resp, err := o.Exchange(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorization,
+		ClientID:     "1",
+		Code:         u.Query().Get("code"),
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+	}, models.ClientInfo{})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.IDToken)
+
+	// Проверяем так же как проверил бы сторонний клиент: ключ берем из JWKS по kid
+	keys := o.JWKS().Keys
+	require.Len(t, keys, 1)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(resp.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, keys[0].Kid, token.Header["kid"])
+		return keys[0].RSAPublicKey()
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(o.Discovery().Issuer),
+		jwt.WithAudience("1"),
+		jwt.WithExpirationRequired(),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "7", claims["sub"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.NotContains(t, claims, "preferred_username", "profile scope was not requested")
+	assert.InDelta(t, time.Now().Unix(), claims["auth_time"], 5)
+}
+
+func TestIDToken_NotIssuedWithoutOpenIDScope(t *testing.T) {
+	o := newTestOAuth(t)
+
+	resp, err := o.Exchange(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorization,
+		ClientID:     "1",
+		Code:         authorize(t, o),
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+	}, models.ClientInfo{})
+	require.NoError(t, err)
+	assert.Empty(t, resp.IDToken)
+}
+
+func TestUserInfo(t *testing.T) {
+	o := newTestOAuth(t)
+
+	info, err := o.UserInfo(context.Background(), "token-with-email")
+	require.NoError(t, err)
+	assert.Equal(t, "7", info.Subject)
+	assert.Equal(t, "alice@example.com", info.Email)
+	assert.Equal(t, "alice@example.com", info.PreferredUsername)
+
+	// Без scope email и profile отдаем только sub
+	info, err = o.UserInfo(context.Background(), "token-for-user")
+	require.NoError(t, err)
+	assert.Equal(t, "7", info.Subject)
+	assert.Empty(t, info.Email)
+	assert.Empty(t, info.PreferredUsername)
+
+	_, err = o.UserInfo(context.Background(), "service-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = o.UserInfo(context.Background(), "garbage")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestDiscovery(t *testing.T) {
+	o := newTestOAuth(t)
+
+	metadata := o.Discovery()
+	assert.Equal(t, "https://sso.example.com", metadata.Issuer)
+	assert.Equal(t, "https://sso.example.com/token", metadata.TokenEndpoint)
+	assert.Equal(t, "https://sso.example.com/jwks.json", metadata.JWKSURI)
+	assert.Contains(t, metadata.ScopesSupported, ScopeOpenID)
+
+	assert.Equal(t, oidc.KeyID(&testSigningKey(t).PublicKey), o.JWKS().Keys[0].Kid)
+}
@@ -0,0 +1,392 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/lib/logger/sl"
+	"github.com/skinkvi/STTAuth/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Способы аутентификации клиента на /token
+const (
+	AuthMethodNone              = "none"
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+)
+
+type ClientRegistry interface {
+	SaveApp(ctx context.Context, app models.App) (int, error)
+	UpdateApp(ctx context.Context, app models.App) error
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+// RegistrationConfig настройки динамической регистрации клиентов (RFC 7591). Зарегистрироваться
+// может только тот у кого есть один из InitialAccessTokens, без них регистрация выключена
+type RegistrationConfig struct {
+	InitialAccessTokens []string
+}
+
+// ClientMetadata это то что клиент сообщает о себе при регистрации
+type ClientMetadata struct {
+	ClientName              string
+	RedirectURIs            []string
+	GrantTypes              []string
+	ResponseTypes           []string
+	TokenEndpointAuthMethod string
+	Scope                   string
+}
+
+// RegisteredClient это ответ на регистрацию. ClientSecret есть только в ответе на создание,
+// у нас хранится только его хеш
+type RegisteredClient struct {
+	ClientMetadata
+	ClientID                string
+	ClientSecret            string
+	ClientIDIssuedAt        int64
+	RegistrationAccessToken string
+	RegistrationClientURI   string
+}
+
+// Ошибки из RFC 7591 3.2.2
+var (
+	ErrInvalidClientMetadata    = errors.New("invalid client metadata")
+	ErrInvalidClientRedirectURI = errors.New("invalid client redirect uri")
+	ErrRegistrationDisabled     = errors.New("client registration is disabled")
+)
+
+// RegisterClient регистрирует новое приложение. Ключ подписи токенов, client_secret и
+// registration access token генерируются тут, клиенту отдаются только последние два
+func (o *OAuth) RegisterClient(ctx context.Context, initialAccessToken string, metadata ClientMetadata) (RegisteredClient, error) {
+	const op = "oauth.RegisterClient"
+
+	log := o.log.With(slog.String("op", op))
+
+	if err := o.checkInitialAccessToken(initialAccessToken); err != nil {
+		log.Warn("invalid initial access token")
+
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := appFromMetadata(metadata)
+	if err != nil {
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if app.Name == "" {
+		suffix, err := randomToken()
+		if err != nil {
+			return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+		}
+		app.Name = "client-" + suffix[:12]
+	}
+
+	app.Secret, err = randomToken()
+	if err != nil {
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	registrationToken, err := randomToken()
+	if err != nil {
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.RegistrationTokenHash = hashToken(registrationToken)
+
+	// Публичному клиенту секрет не нужен, он все равно не смог бы его сохранить
+	var clientSecret string
+	if app.TokenEndpointAuthMethod != AuthMethodNone {
+		clientSecret, err = randomToken()
+		if err != nil {
+			return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		app.ClientSecretHash, err = bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+		if err != nil {
+			return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	app.ID, err = o.registry.SaveApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return RegisteredClient{}, fmt.Errorf("%s: %w: client_name is already taken", op, ErrInvalidClientMetadata)
+		}
+		log.Error("falied to save app", sl.Err(err))
+
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.CreatedAt = time.Now()
+
+	log.Info("client registered", slog.Int("app_id", app.ID))
+
+	client := o.registeredClient(app)
+	client.ClientSecret = clientSecret
+	client.RegistrationAccessToken = registrationToken
+
+	return client, nil
+}
+
+// ClientConfiguration отдает текущую регистрацию клиента (RFC 7592 2.1)
+func (o *OAuth) ClientConfiguration(ctx context.Context, clientID string, registrationToken string) (RegisteredClient, error) {
+	const op = "oauth.ClientConfiguration"
+
+	app, err := o.registeredApp(ctx, clientID, registrationToken)
+	if err != nil {
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return o.registeredClient(app), nil
+}
+
+// UpdateClient заменяет метаданные клиента целиком (RFC 7592 2.2). Не переданные поля
+// получают значения по умолчанию как при регистрации
+func (o *OAuth) UpdateClient(ctx context.Context, clientID string, registrationToken string, metadata ClientMetadata) (RegisteredClient, error) {
+	const op = "oauth.UpdateClient"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("client_id", clientID),
+	)
+
+	app, err := o.registeredApp(ctx, clientID, registrationToken)
+	if err != nil {
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := appFromMetadata(metadata)
+	if err != nil {
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Секрет выдается только при регистрации, так что публичный клиент не может стать конфиденциальным
+	if (updated.TokenEndpointAuthMethod == AuthMethodNone) != (len(app.ClientSecretHash) == 0) {
+		return RegisteredClient{}, fmt.Errorf("%s: %w: token_endpoint_auth_method cannot be changed", op, ErrInvalidClientMetadata)
+	}
+
+	if updated.Name != "" {
+		app.Name = updated.Name
+	}
+	app.RedirectURIs = updated.RedirectURIs
+	app.Scopes = updated.Scopes
+	app.GrantTypes = updated.GrantTypes
+	app.TokenEndpointAuthMethod = updated.TokenEndpointAuthMethod
+
+	if err := o.registry.UpdateApp(ctx, app); err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return RegisteredClient{}, fmt.Errorf("%s: %w: client_name is already taken", op, ErrInvalidClientMetadata)
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return RegisteredClient{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("falied to update app", sl.Err(err))
+
+		return RegisteredClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client registration updated")
+
+	return o.registeredClient(app), nil
+}
+
+// DeleteClient удаляет приложение вместе со всем что к нему привязано (RFC 7592 2.3)
+func (o *OAuth) DeleteClient(ctx context.Context, clientID string, registrationToken string) error {
+	const op = "oauth.DeleteClient"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("client_id", clientID),
+	)
+
+	app, err := o.registeredApp(ctx, clientID, registrationToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.registry.DeleteApp(ctx, app.ID); err != nil && !errors.Is(err, storage.ErrAppNotFound) {
+		log.Error("falied to delete app", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client deleted")
+
+	return nil
+}
+
+func (o *OAuth) checkInitialAccessToken(token string) error {
+	if len(o.registration.InitialAccessTokens) == 0 {
+		return ErrRegistrationDisabled
+	}
+
+	for _, allowed := range o.registration.InitialAccessTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return nil
+		}
+	}
+
+	return ErrInvalidToken
+}
+
+// registeredApp находит приложение по client_id и проверяет registration access token.
+// Неизвестный client_id и неверный токен неотличимы, как и требует RFC 7592
+func (o *OAuth) registeredApp(ctx context.Context, clientID string, registrationToken string) (models.App, error) {
+	app, err := o.client(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidClient) {
+			return models.App{}, ErrInvalidToken
+		}
+		return models.App{}, err
+	}
+
+	// У приложений заведенных руками токена нет, управлять ими через этот API нельзя
+	if app.RegistrationTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashToken(registrationToken)), []byte(app.RegistrationTokenHash)) != 1 {
+		return models.App{}, ErrInvalidToken
+	}
+
+	return app, nil
+}
+
+func (o *OAuth) registeredClient(app models.App) RegisteredClient {
+	clientID := strconv.Itoa(app.ID)
+
+	return RegisteredClient{
+		ClientMetadata: ClientMetadata{
+			ClientName:              app.Name,
+			RedirectURIs:            app.RedirectURIs,
+			GrantTypes:              app.GrantTypes,
+			ResponseTypes:           responseTypes(app.GrantTypes),
+			TokenEndpointAuthMethod: app.TokenEndpointAuthMethod,
+			Scope:                   strings.Join(app.Scopes, " "),
+		},
+		ClientID:              clientID,
+		ClientIDIssuedAt:      app.CreatedAt.Unix(),
+		RegistrationClientURI: strings.TrimSuffix(o.provider.Issuer, "/") + RegistrationPath + "/" + clientID,
+	}
+}
+
+// appFromMetadata проверяет метаданные и подставляет значения по умолчанию из RFC 7591 2
+func appFromMetadata(metadata ClientMetadata) (models.App, error) {
+	grantTypes := metadata.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{GrantTypeAuthorization}
+	}
+	for _, grantType := range grantTypes {
+		if !slices.Contains([]string{GrantTypeAuthorization, GrantTypeClient, GrantTypeDeviceCode}, grantType) {
+			return models.App{}, fmt.Errorf("%w: unsupported grant_type %q", ErrInvalidClientMetadata, grantType)
+		}
+	}
+
+	for _, responseType := range metadata.ResponseTypes {
+		if responseType != ResponseTypeCode {
+			return models.App{}, fmt.Errorf("%w: unsupported response_type %q", ErrInvalidClientMetadata, responseType)
+		}
+	}
+	if len(metadata.ResponseTypes) > 0 && !slices.Contains(grantTypes, GrantTypeAuthorization) {
+		return models.App{}, fmt.Errorf("%w: response_type code requires authorization_code grant", ErrInvalidClientMetadata)
+	}
+
+	authMethod := metadata.TokenEndpointAuthMethod
+	if authMethod == "" {
+		authMethod = AuthMethodClientSecretBasic
+	}
+	if !slices.Contains([]string{AuthMethodNone, AuthMethodClientSecretBasic, AuthMethodClientSecretPost}, authMethod) {
+		return models.App{}, fmt.Errorf("%w: unsupported token_endpoint_auth_method %q", ErrInvalidClientMetadata, authMethod)
+	}
+	if authMethod == AuthMethodNone && slices.Contains(grantTypes, GrantTypeClient) {
+		return models.App{}, fmt.Errorf("%w: client_credentials requires a client secret", ErrInvalidClientMetadata)
+	}
+
+	if slices.Contains(grantTypes, GrantTypeAuthorization) && len(metadata.RedirectURIs) == 0 {
+		return models.App{}, fmt.Errorf("%w: redirect_uris are required", ErrInvalidClientRedirectURI)
+	}
+	for _, redirectURI := range metadata.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return models.App{}, err
+		}
+	}
+
+	// Стандартные scope OpenID Connect доступны всем, объявлять их не нужно
+	var scopes []string
+	for _, scope := range strings.Fields(metadata.Scope) {
+		if !validScopeToken(scope) {
+			return models.App{}, fmt.Errorf("%w: invalid scope %q", ErrInvalidClientMetadata, scope)
+		}
+		if !slices.Contains(models.IdentityScopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return models.App{
+		Name:                    strings.TrimSpace(metadata.ClientName),
+		RedirectURIs:            metadata.RedirectURIs,
+		Scopes:                  scopes,
+		GrantTypes:              grantTypes,
+		TokenEndpointAuthMethod: authMethod,
+	}, nil
+}
+
+// validateRedirectURI пропускает https, http только на loopback для нативных приложений
+// и собственные схемы вида com.example.app:/callback (RFC 8252 7)
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("%w: %q is not an absolute uri", ErrInvalidClientRedirectURI, redirectURI)
+	}
+	if u.Fragment != "" || strings.Contains(redirectURI, "#") {
+		return fmt.Errorf("%w: %q must not contain a fragment", ErrInvalidClientRedirectURI, redirectURI)
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("%w: %q has no host", ErrInvalidClientRedirectURI, redirectURI)
+		}
+	case "http":
+		if !isLoopback(u.Hostname()) {
+			return fmt.Errorf("%w: http is allowed only for loopback, got %q", ErrInvalidClientRedirectURI, redirectURI)
+		}
+	default:
+		if !strings.Contains(u.Scheme, ".") {
+			return fmt.Errorf("%w: scheme of %q must be https or reverse domain name", ErrInvalidClientRedirectURI, redirectURI)
+		}
+	}
+
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validScopeToken проверяет символы scope по RFC 6749 3.3
+func validScopeToken(scope string) bool {
+	for _, r := range scope {
+		if r < 0x21 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return scope != ""
+}
+
+func responseTypes(grantTypes []string) []string {
+	if slices.Contains(grantTypes, GrantTypeAuthorization) {
+		return []string{ResponseTypeCode}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterClient(t *testing.T) {
+	o, st := newTestOAuthWithStorage(t)
+	ctx := context.Background()
+
+	metadata := ClientMetadata{
+		ClientName:   "arcade",
+		RedirectURIs: []string{"https://arcade.example.com/callback", "http://127.0.0.1:8400/cb", "com.example.arcade:/cb"},
+		Scope:        "openid matches:read",
+	}
+
+	_, err := o.RegisterClient(ctx, "wrong-token", metadata)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	client, err := o.RegisterClient(ctx, "initial-token", metadata)
+	require.NoError(t, err)
+	assert.NotEmpty(t, client.ClientSecret)
+	assert.NotEmpty(t, client.RegistrationAccessToken)
+	assert.Equal(t, []string{GrantTypeAuthorization}, client.GrantTypes)
+	assert.Equal(t, AuthMethodClientSecretBasic, client.TokenEndpointAuthMethod)
+	assert.Equal(t, "matches:read", client.Scope, "identity scopes are not stored")
+	assert.Equal(t, "https://sso.example.com/register/"+client.ClientID, client.RegistrationClientURI)
+
+	_, err = o.RegisterClient(ctx, "initial-token", metadata)
+	assert.ErrorIs(t, err, ErrInvalidClientMetadata, "client_name is unique")
+
+	// Зарегистрированный клиент конфиденциальный, без секрета код на токен не поменять
+	location, err := o.Authorize(ctx, AuthorizeRequest{
+		ClientID:            client.ClientID,
+		RedirectURI:         "https://arcade.example.com/callback",
+		ResponseType:        ResponseTypeCode,
+		CodeChallenge:       authorizeRequest().CodeChallenge,
+		CodeChallengeMethod: ChallengeMethodS256,
+	}, "alice@example.com", "secret", false)
+	require.NoError(t, err)
+	u, err := url.Parse(location)
+	require.NoError(t, err)
+
+	req := TokenRequest{
+		GrantType:    GrantTypeAuthorization,
+		ClientID:     client.ClientID,
+		Code:         u.Query().Get("code"),
+		RedirectURI:  "https://arcade.example.com/callback",
+		CodeVerifier: verifier,
+	}
+	_, err = o.Exchange(ctx, req, models.ClientInfo{})
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	// Код сгорел на прошлой попытке, берем новый
+	location, err = o.Authorize(ctx, AuthorizeRequest{
+		ClientID:            client.ClientID,
+		RedirectURI:         "https://arcade.example.com/callback",
+		ResponseType:        ResponseTypeCode,
+		CodeChallenge:       authorizeRequest().CodeChallenge,
+		CodeChallengeMethod: ChallengeMethodS256,
+	}, "alice@example.com", "secret", false)
+	require.NoError(t, err)
+	u, err = url.Parse(location)
+	require.NoError(t, err)
+
+	req.Code = u.Query().Get("code")
+	req.ClientSecret = client.ClientSecret
+	_, err = o.Exchange(ctx, req, models.ClientInfo{})
+	assert.NoError(t, err)
+
+	assert.Len(t, st.apps, 2)
+}
+
+func TestRegisterClient_InvalidMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata ClientMetadata
+		err      error
+	}{
+		{name: "no redirect uris", metadata: ClientMetadata{}, err: ErrInvalidClientRedirectURI},
+		{name: "plain http", metadata: ClientMetadata{RedirectURIs: []string{"http://arcade.example.com/cb"}}, err: ErrInvalidClientRedirectURI},
+		{name: "fragment", metadata: ClientMetadata{RedirectURIs: []string{"https://arcade.example.com/cb#x"}}, err: ErrInvalidClientRedirectURI},
+		{name: "relative", metadata: ClientMetadata{RedirectURIs: []string{"/cb"}}, err: ErrInvalidClientRedirectURI},
+		{name: "javascript", metadata: ClientMetadata{RedirectURIs: []string{"javascript:alert(1)"}}, err: ErrInvalidClientRedirectURI},
+		{name: "implicit", metadata: ClientMetadata{RedirectURIs: []string{"https://a.example.com/cb"}, ResponseTypes: []string{"token"}}, err: ErrInvalidClientMetadata},
+		{name: "password grant", metadata: ClientMetadata{GrantTypes: []string{"password"}}, err: ErrInvalidClientMetadata},
+		{name: "public machine client", metadata: ClientMetadata{GrantTypes: []string{GrantTypeClient}, TokenEndpointAuthMethod: AuthMethodNone}, err: ErrInvalidClientMetadata},
+		{name: "bad scope", metadata: ClientMetadata{GrantTypes: []string{GrantTypeClient}, Scope: `a"b`}, err: ErrInvalidClientMetadata},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOAuth(t)
+
+			_, err := o.RegisterClient(context.Background(), "initial-token", tt.metadata)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestClientConfiguration(t *testing.T) {
+	o := newTestOAuth(t)
+	ctx := context.Background()
+
+	client, err := o.RegisterClient(ctx, "initial-token", ClientMetadata{
+		ClientName:              "tv",
+		GrantTypes:              []string{GrantTypeDeviceCode},
+		TokenEndpointAuthMethod: AuthMethodNone,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, client.ClientSecret, "public client gets no secret")
+
+	_, err = o.ClientConfiguration(ctx, client.ClientID, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = o.ClientConfiguration(ctx, "1", client.RegistrationAccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "manually created apps are not managed through registration")
+
+	read, err := o.ClientConfiguration(ctx, client.ClientID, client.RegistrationAccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "tv", read.ClientName)
+	assert.Empty(t, read.RegistrationAccessToken)
+
+	updated, err := o.UpdateClient(ctx, client.ClientID, client.RegistrationAccessToken, ClientMetadata{
+		ClientName:              "tv-app",
+		GrantTypes:              []string{GrantTypeDeviceCode},
+		TokenEndpointAuthMethod: AuthMethodNone,
+		Scope:                   "matches:read",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tv-app", updated.ClientName)
+	assert.Equal(t, "matches:read", updated.Scope)
+
+	_, err = o.UpdateClient(ctx, client.ClientID, client.RegistrationAccessToken, ClientMetadata{
+		GrantTypes: []string{GrantTypeDeviceCode},
+	})
+	assert.ErrorIs(t, err, ErrInvalidClientMetadata, "public client cannot become confidential")
+
+	require.NoError(t, o.DeleteClient(ctx, client.ClientID, client.RegistrationAccessToken))
+	_, err = o.ClientConfiguration(ctx, client.ClientID, client.RegistrationAccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRegisterClient_Disabled(t *testing.T) {
+	o := newTestOAuth(t)
+	o.registration = RegistrationConfig{}
+
+	_, err := o.RegisterClient(context.Background(), "", ClientMetadata{RedirectURIs: []string{"https://a.example.com/cb"}})
+	assert.ErrorIs(t, err, ErrRegistrationDisabled)
+	assert.Empty(t, o.Discovery().RegistrationEndpoint)
+}
@@ -0,0 +1,116 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey, tokenHash string) (int64, error) {
+	const op = "storage.postgre.SaveAPIKey"
+
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys(user_id, app_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		key.UserID, key.AppID, key.Name, key.Prefix, tokenHash, pq.Array(key.Scopes), key.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return 0, storage.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// APIKeyByHash отдает ключ даже если он отозван или истек, это проверяет сервис
+func (s *Storage) APIKeyByHash(ctx context.Context, tokenHash string) (models.APIKey, error) {
+	const op = "storage.postgre.APIKeyByHash"
+
+	var key models.APIKey
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, app_id, name, prefix, scopes, expires_at, last_used_at, created_at, revoked_at
+		FROM api_keys WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(&key.ID, &key.UserID, &key.AppID, &key.Name, &key.Prefix, pq.Array(&key.Scopes),
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, storage.ErrAPIKeyNotFound
+		}
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// APIKeys возвращает не отозванные ключи пользователя, истекшие тоже, что бы было видно почему скрипт перестал работать
+func (s *Storage) APIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const op = "storage.postgre.APIKeys"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, app_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(&key.ID, &key.UserID, &key.AppID, &key.Name, &key.Prefix, pq.Array(&key.Scopes),
+			&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error {
+	const op = "storage.postgre.RevokeAPIKey"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		keyID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, keyID int64) error {
+	const op = "storage.postgre.TouchAPIKey"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = NOW() WHERE id = $1", keyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// appColumns это общая часть выборки приложений, порядок совпадает со scanApp
+const appColumns = `id, name, secret, register_mode, allowed_domains, redirect_uris, client_secret_hash, scopes,
+	grant_types, token_endpoint_auth_method, registration_token_hash, previous_secret, previous_secret_expires_at,
+	disabled_at, created_at`
+
+func scanApp(row interface{ Scan(dest ...any) error }) (models.App, error) {
+	var app models.App
+	err := row.Scan(
+		&app.ID, &app.Name, &app.Secret, &app.RegisterMode, pq.Array(&app.AllowedDomains),
+		pq.Array(&app.RedirectURIs), &app.ClientSecretHash, pq.Array(&app.Scopes),
+		pq.Array(&app.GrantTypes), &app.TokenEndpointAuthMethod, &app.RegistrationTokenHash,
+		&app.PreviousSecret, &app.PreviousSecretExpiresAt, &app.DisabledAt, &app.CreatedAt,
+	)
+	return app, err
+}
+
+// SaveApp заводит новое приложение и возвращает его id, он же client_id.
+// Пустой RegisterMode значит открытая регистрация
+func (s *Storage) SaveApp(ctx context.Context, app models.App) (int, error) {
+	const op = "storage.postgre.SaveApp"
+
+	var id int
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO apps(name, secret, redirect_uris, client_secret_hash, scopes,
+			grant_types, token_endpoint_auth_method, registration_token_hash, register_mode, allowed_domains)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'open'), $10) RETURNING id`,
+		app.Name, app.Secret, pq.Array(app.RedirectURIs), app.ClientSecretHash, pq.Array(app.Scopes),
+		pq.Array(app.GrantTypes), app.TokenEndpointAuthMethod, app.RegistrationTokenHash,
+		app.RegisterMode, pq.Array(app.AllowedDomains),
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, storage.ErrAppExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UpdateApp меняет метаданные клиента. Ключ подписи и секреты тут не трогаются
+func (s *Storage) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "storage.postgre.UpdateApp"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE apps SET name = $2, redirect_uris = $3, scopes = $4, grant_types = $5, token_endpoint_auth_method = $6
+		WHERE id = $1`,
+		app.ID, app.Name, pq.Array(app.RedirectURIs), pq.Array(app.Scopes), pq.Array(app.GrantTypes), app.TokenEndpointAuthMethod,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return storage.ErrAppExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrAppNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteApp(ctx context.Context, appID int) error {
+	const op = "storage.postgre.DeleteApp"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM apps WHERE id = $1", appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrAppNotFound
+	}
+
+	return nil
+}
+
+// Apps отдает все приложения вместе с выключенными, секреты вычищает уже сервис
+func (s *Storage) Apps(ctx context.Context) ([]models.App, error) {
+	const op = "storage.postgre.Apps"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+appColumns+" FROM apps ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// RotateAppSecret ставит новый ключ подписи, а текущий становится предыдущим до previousExpiresAt.
+// Ключ который был предыдущим до этого пропадает сразу
+func (s *Storage) RotateAppSecret(ctx context.Context, appID int, secret string, previousExpiresAt time.Time) error {
+	const op = "storage.postgre.RotateAppSecret"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE apps SET previous_secret = secret, previous_secret_expires_at = $3, secret = $2
+		WHERE id = $1`,
+		appID, secret, previousExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, res)
+}
+
+func (s *Storage) SetAppDisabled(ctx context.Context, appID int, disabled bool) error {
+	const op = "storage.postgre.SetAppDisabled"
+
+	query := "UPDATE apps SET disabled_at = NULL WHERE id = $1"
+	if disabled {
+		query = "UPDATE apps SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = $1"
+	}
+
+	res, err := s.db.ExecContext(ctx, query, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, res)
+}
+
+func appAffected(op string, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrAppNotFound
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) Consent(ctx context.Context, userID int64, appID int) (models.Consent, error) {
+	const op = "storage.postgre.Consent"
+
+	var consent models.Consent
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT c.user_id, c.app_id, a.name, c.scopes, c.granted_at, c.updated_at
+		FROM consents c JOIN apps a ON a.id = c.app_id
+		WHERE c.user_id = $1 AND c.app_id = $2`,
+		userID, appID,
+	).Scan(&consent.UserID, &consent.AppID, &consent.AppName, pq.Array(&consent.Scopes), &consent.GrantedAt, &consent.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Consent{}, storage.ErrConsentNotFound
+		}
+		return models.Consent{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consent, nil
+}
+
+// SaveConsent дописывает scope к уже выданному согласию, ранее выданные не теряются
+func (s *Storage) SaveConsent(ctx context.Context, userID int64, appID int, scopes []string) error {
+	const op = "storage.postgre.SaveConsent"
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO consents(user_id, app_id, scopes) VALUES($1, $2, $3)
+		ON CONFLICT (user_id, app_id) DO UPDATE SET
+			scopes = ARRAY(SELECT DISTINCT unnest(consents.scopes || EXCLUDED.scopes) ORDER BY 1),
+			updated_at = NOW()`,
+		userID, appID, pq.Array(scopes),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Consents(ctx context.Context, userID int64) ([]models.Consent, error) {
+	const op = "storage.postgre.Consents"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT c.user_id, c.app_id, a.name, c.scopes, c.granted_at, c.updated_at
+		FROM consents c JOIN apps a ON a.id = c.app_id
+		WHERE c.user_id = $1
+		ORDER BY c.updated_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var consents []models.Consent
+	for rows.Next() {
+		var consent models.Consent
+		if err := rows.Scan(&consent.UserID, &consent.AppID, &consent.AppName, pq.Array(&consent.Scopes), &consent.GrantedAt, &consent.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		consents = append(consents, consent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consents, nil
+}
+
+func (s *Storage) DeleteConsent(ctx context.Context, userID int64, appID int) error {
+	const op = "storage.postgre.DeleteConsent"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM consents WHERE user_id = $1 AND app_id = $2", userID, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrConsentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) SaveDeviceCode(ctx context.Context, deviceCodeHash string, code models.DeviceCode) error {
+	const op = "storage.postgre.SaveDeviceCode"
+
+	// Протухшие коды чистим тут же, иначе они будут занимать user_code
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM device_codes WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO device_codes(device_code_hash, user_code, app_id, scope, status, interval_seconds, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		deviceCodeHash, code.UserCode, code.AppID, code.Scope, code.Status, int(code.Interval.Seconds()), code.ExpiresAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return storage.ErrDeviceCodeExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PendingDeviceCode ищет еще не решенный и не протухший код, ничего в нем не меняя
+func (s *Storage) PendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "storage.postgre.PendingDeviceCode"
+
+	code, err := scanDeviceCode(s.db.QueryRowContext(ctx,
+		`SELECT user_code, app_id, scope, status, user_id, interval_seconds, expires_at FROM device_codes
+		WHERE user_code = $1 AND status = 'pending' AND expires_at > NOW()`,
+		userCode,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+		}
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// ResolveDeviceCode одобряет или отклоняет еще не решенный и не протухший код
+func (s *Storage) ResolveDeviceCode(ctx context.Context, userCode string, userID int64, status string) (models.DeviceCode, error) {
+	const op = "storage.postgre.ResolveDeviceCode"
+
+	code, err := scanDeviceCode(s.db.QueryRowContext(ctx,
+		`UPDATE device_codes SET status = $3, user_id = $2
+		WHERE user_code = $1 AND status = 'pending' AND expires_at > NOW()
+		RETURNING user_code, app_id, scope, status, user_id, interval_seconds, expires_at`,
+		userCode, userID, status,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+		}
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// PollDeviceCode запоминает время опроса и возвращает код. Если устройство опрашивает чаще
+// чем interval, то интервал увеличивается на 5 секунд и slowDown будет true (RFC 8628 3.5)
+func (s *Storage) PollDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, bool, error) {
+	const op = "storage.postgre.PollDeviceCode"
+
+	var code models.DeviceCode
+	var userID sql.NullInt64
+	var interval int
+	var slowDown bool
+
+	err := s.db.QueryRowContext(ctx,
+		`WITH prev AS (
+			SELECT device_code_hash, last_polled_at, interval_seconds FROM device_codes
+			WHERE device_code_hash = $1 FOR UPDATE
+		)
+		UPDATE device_codes d SET
+			last_polled_at = NOW(),
+			interval_seconds = CASE
+				WHEN prev.last_polled_at > NOW() - prev.interval_seconds * INTERVAL '1 second' THEN prev.interval_seconds + 5
+				ELSE prev.interval_seconds
+			END
+		FROM prev WHERE d.device_code_hash = prev.device_code_hash
+		RETURNING d.user_code, d.app_id, d.scope, d.status, d.user_id, d.interval_seconds, d.expires_at,
+			d.interval_seconds > prev.interval_seconds`,
+		deviceCodeHash,
+	).Scan(&code.UserCode, &code.AppID, &code.Scope, &code.Status, &userID, &interval, &code.ExpiresAt, &slowDown)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DeviceCode{}, false, storage.ErrDeviceCodeNotFound
+		}
+		return models.DeviceCode{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code.UserID = userID.Int64
+	code.Interval = time.Duration(interval) * time.Second
+
+	return code, slowDown, nil
+}
+
+func (s *Storage) DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	const op = "storage.postgre.DeleteDeviceCode"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM device_codes WHERE device_code_hash = $1", deviceCodeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrDeviceCodeNotFound
+	}
+
+	return nil
+}
+
+func scanDeviceCode(row *sql.Row) (models.DeviceCode, error) {
+	var code models.DeviceCode
+	var userID sql.NullInt64
+	var interval int
+
+	err := row.Scan(&code.UserCode, &code.AppID, &code.Scope, &code.Status, &userID, &interval, &code.ExpiresAt)
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	code.UserID = userID.Int64
+	code.Interval = time.Duration(interval) * time.Second
+
+	return code, nil
+}
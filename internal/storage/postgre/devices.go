@@ -0,0 +1,90 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// KnownDevice говорит видели ли мы уже у пользователя это устройство и эту сеть.
+// hasAny false значит что это вообще первый вход пользователя
+func (s *Storage) KnownDevice(ctx context.Context, userID int64, device string, ipPrefix string) (deviceSeen bool, prefixSeen bool, hasAny bool, err error) {
+	const op = "storage.postgre.KnownDevice"
+
+	err = s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(bool_or(device = $2), FALSE), COALESCE(bool_or(ip_prefix = $3), FALSE), COUNT(*) > 0
+		FROM known_devices WHERE user_id = $1`,
+		userID, device, ipPrefix,
+	).Scan(&deviceSeen, &prefixSeen, &hasAny)
+	if err != nil {
+		return false, false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deviceSeen, prefixSeen, hasAny, nil
+}
+
+func (s *Storage) SaveDevice(ctx context.Context, userID int64, device string, ipPrefix string) error {
+	const op = "storage.postgre.SaveDevice"
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO known_devices(user_id, device, ip_prefix) VALUES($1, $2, $3)
+		ON CONFLICT (user_id, device, ip_prefix) DO UPDATE SET last_seen_at = NOW()`,
+		userID, device, ipPrefix,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveLoginAlert(ctx context.Context, userID int64, tokenHash string, ip string, userAgent string, expiresAt time.Time) error {
+	const op = "storage.postgre.SaveLoginAlert"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO login_alerts(token_hash, user_id, ip, user_agent, expires_at) VALUES($1, $2, $3, $4, $5)",
+		tokenHash, userID, ip, userAgent, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseLoginAlert помечает ссылку из уведомления использованной и возвращает id пользователя.
+// Ссылка одноразовая, повторный переход вернет ErrAlertNotFound
+func (s *Storage) UseLoginAlert(ctx context.Context, tokenHash string) (int64, error) {
+	const op = "storage.postgre.UseLoginAlert"
+
+	var userID int64
+
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE login_alerts SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`,
+		tokenHash,
+	).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.ErrAlertNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+func (s *Storage) LockUser(ctx context.Context, userID int64) error {
+	const op = "storage.postgre.LockUser"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET locked_at = NOW() WHERE id = $1 AND locked_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const uniqueViolation = "23505"
+
+func (s *Storage) SaveFederationState(ctx context.Context, stateHash string, state models.FederationState) error {
+	const op = "storage.postgre.SaveFederationState"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO federation_states(state_hash, provider, app_id, nonce, code_verifier, expires_at) VALUES($1, $2, $3, $4, $5, $6)",
+		stateHash, state.Provider, state.AppID, state.Nonce, state.CodeVerifier, state.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseFederationState удаляет state и возвращает его, так что один state нельзя использовать дважды
+func (s *Storage) UseFederationState(ctx context.Context, stateHash string) (models.FederationState, error) {
+	const op = "storage.postgre.UseFederationState"
+
+	var state models.FederationState
+
+	err := s.db.QueryRowContext(ctx,
+		`DELETE FROM federation_states WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING provider, app_id, nonce, code_verifier, expires_at`,
+		stateHash,
+	).Scan(&state.Provider, &state.AppID, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.FederationState{}, storage.ErrStateNotFound
+		}
+		return models.FederationState{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return state, nil
+}
+
+func (s *Storage) Identity(ctx context.Context, provider string, subject string) (models.Identity, error) {
+	const op = "storage.postgre.Identity"
+
+	var identity models.Identity
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT provider, subject, user_id, email FROM user_identities WHERE provider = $1 AND subject = $2",
+		provider, subject,
+	).Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Identity{}, storage.ErrIdentityNotFound
+		}
+		return models.Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return identity, nil
+}
+
+func (s *Storage) SaveIdentity(ctx context.Context, identity models.Identity) error {
+	const op = "storage.postgre.SaveIdentity"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO user_identities(provider, subject, user_id, email) VALUES($1, $2, $3, $4)",
+		identity.Provider, identity.Subject, identity.UserID, identity.Email,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return storage.ErrIdentityExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
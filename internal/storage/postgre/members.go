@@ -0,0 +1,169 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) SaveMember(ctx context.Context, appID int, userID int64, status string) error {
+	const op = "storage.postgre.SaveMember"
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO app_members(app_id, user_id, status) VALUES($1, $2, $3)
+		ON CONFLICT (app_id, user_id) DO UPDATE SET status = EXCLUDED.status`,
+		appID, userID, status,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) MemberStatus(ctx context.Context, appID int, userID int64) (string, error) {
+	const op = "storage.postgre.MemberStatus"
+
+	var status string
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT status FROM app_members WHERE app_id = $1 AND user_id = $2",
+		appID, userID,
+	).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", storage.ErrMemberNotFound
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return status, nil
+}
+
+func (s *Storage) MembersByStatus(ctx context.Context, appID int, status string) ([]models.Member, error) {
+	const op = "storage.postgre.MembersByStatus"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.app_id, m.user_id, u.email, m.status, m.created_at
+		FROM app_members m JOIN users u ON u.id = m.user_id
+		WHERE m.app_id = $1 AND m.status = $2
+		ORDER BY m.created_at`,
+		appID, status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var members []models.Member
+	for rows.Next() {
+		var member models.Member
+		if err := rows.Scan(&member.AppID, &member.UserID, &member.Email, &member.Status, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+func (s *Storage) DeleteMember(ctx context.Context, appID int, userID int64) error {
+	const op = "storage.postgre.DeleteMember"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM app_members WHERE app_id = $1 AND user_id = $2", appID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrMemberNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveInvite(ctx context.Context, codeHash string, invite models.Invite) error {
+	const op = "storage.postgre.SaveInvite"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO invites(code_hash, app_id, created_by, max_uses, expires_at) VALUES($1, $2, $3, $4, $5)",
+		codeHash, invite.AppID, invite.CreatedBy, invite.MaxUses, invite.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RegisterMember в одной транзакции расходует инвайт, создает пользователя и делает его участником
+// приложения. Если email занят или вставка упала, инвайт остается нетронутым. Пустой inviteHash значит
+// что инвайт приложению не нужен
+func (s *Storage) RegisterMember(ctx context.Context, email string, passHash []byte, appID int, status string, inviteHash string) (int64, error) {
+	const op = "storage.postgre.RegisterMember"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if inviteHash != "" {
+		// Счетчик увеличивается атомарно, строка инвайта заблокирована до конца транзакции
+		res, err := tx.ExecContext(ctx,
+			`UPDATE invites SET uses = uses + 1
+			WHERE code_hash = $1 AND app_id = $2 AND uses < max_uses AND expires_at > NOW()`,
+			inviteHash, appID,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if affected == 0 {
+			return 0, storage.ErrInviteNotFound
+		}
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO users(email, pass_hash) VALUES($1, $2) RETURNING id",
+		email, passHash,
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, storage.ErrUserExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO app_members(app_id, user_id, status) VALUES($1, $2, $3)",
+		appID, id, status,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
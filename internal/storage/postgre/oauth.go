@@ -0,0 +1,46 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) SaveAuthCode(ctx context.Context, codeHash string, code models.AuthCode) error {
+	const op = "storage.postgre.SaveAuthCode"
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO oauth_codes(code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, auth_time, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		codeHash, code.AppID, code.UserID, code.RedirectURI, code.CodeChallenge, code.Scope, code.Nonce, code.AuthTime, code.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseAuthCode удаляет код и возвращает его, повторно обменять тот же код не получится
+func (s *Storage) UseAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error) {
+	const op = "storage.postgre.UseAuthCode"
+
+	var code models.AuthCode
+
+	err := s.db.QueryRowContext(ctx,
+		`DELETE FROM oauth_codes WHERE code_hash = $1 AND expires_at > NOW()
+		RETURNING app_id, user_id, redirect_uri, code_challenge, scope, nonce, auth_time, expires_at`,
+		codeHash,
+	).Scan(&code.AppID, &code.UserID, &code.RedirectURI, &code.CodeChallenge, &code.Scope, &code.Nonce, &code.AuthTime, &code.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.AuthCode{}, storage.ErrAuthCodeNotFound
+		}
+		return models.AuthCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
@@ -0,0 +1,231 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// SaveOrganization создает организацию и сразу делает создателя ее владельцем
+func (s *Storage) SaveOrganization(ctx context.Context, name string, ownerID int64) (int64, error) {
+	const op = "storage.postgre.SaveOrganization"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO organizations(name, created_by) VALUES($1, $2) RETURNING id",
+		name, ownerID,
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return 0, storage.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO org_members(org_id, user_id, role) VALUES($1, $2, $3)",
+		id, ownerID, models.OrgRoleOwner,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Organization(ctx context.Context, orgID int64) (models.Organization, error) {
+	const op = "storage.postgre.Organization"
+
+	var org models.Organization
+	var createdBy sql.NullInt64
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, name, created_by, created_at FROM organizations WHERE id = $1",
+		orgID,
+	).Scan(&org.ID, &org.Name, &createdBy, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Organization{}, storage.ErrOrgNotFound
+		}
+		return models.Organization{}, fmt.Errorf("%s: %w", op, err)
+	}
+	org.CreatedBy = createdBy.Int64
+
+	return org, nil
+}
+
+// UserOrganizations отдает членства пользователя, первыми самые старые
+func (s *Storage) UserOrganizations(ctx context.Context, userID int64) ([]models.OrgMember, error) {
+	const op = "storage.postgre.UserOrganizations"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.org_id, o.name, m.user_id, u.email, m.role, m.joined_at
+		FROM org_members m
+		JOIN organizations o ON o.id = m.org_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = $1
+		ORDER BY m.joined_at, m.org_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return collectOrgMembers(op, rows)
+}
+
+func (s *Storage) OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error) {
+	const op = "storage.postgre.OrgMembers"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.org_id, o.name, m.user_id, u.email, m.role, m.joined_at
+		FROM org_members m
+		JOIN organizations o ON o.id = m.org_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY m.joined_at, m.user_id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return collectOrgMembers(op, rows)
+}
+
+func (s *Storage) OrgMember(ctx context.Context, orgID int64, userID int64) (models.OrgMember, error) {
+	const op = "storage.postgre.OrgMember"
+
+	var m models.OrgMember
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT m.org_id, o.name, m.user_id, u.email, m.role, m.joined_at
+		FROM org_members m
+		JOIN organizations o ON o.id = m.org_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND m.user_id = $2`,
+		orgID, userID,
+	).Scan(&m.OrgID, &m.OrgName, &m.UserID, &m.Email, &m.Role, &m.JoinedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.OrgMember{}, storage.ErrOrgMemberNotFound
+		}
+		return models.OrgMember{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return m, nil
+}
+
+func (s *Storage) DeleteOrgMember(ctx context.Context, orgID int64, userID int64) error {
+	const op = "storage.postgre.DeleteOrgMember"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM org_members WHERE org_id = $1 AND user_id = $2", orgID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrOrgMemberNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveOrgInvite(ctx context.Context, tokenHash string, invite models.OrgInvite) error {
+	const op = "storage.postgre.SaveOrgInvite"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO org_invites(token_hash, org_id, email, role, invited_by, expires_at) VALUES($1, $2, $3, $4, $5, $6)",
+		tokenHash, invite.OrgID, invite.Email, invite.Role, invite.InvitedBy, invite.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AcceptOrgInvite одной транзакцией гасит приглашение и добавляет пользователя в организацию.
+// Приглашение действует только для того email на который его отправили
+func (s *Storage) AcceptOrgInvite(ctx context.Context, tokenHash string, userID int64, email string) (models.OrgInvite, error) {
+	const op = "storage.postgre.AcceptOrgInvite"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.OrgInvite{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var invite models.OrgInvite
+	var invitedBy sql.NullInt64
+
+	err = tx.QueryRowContext(ctx,
+		`DELETE FROM org_invites
+		WHERE token_hash = $1 AND lower(email) = lower($2) AND expires_at > NOW()
+		RETURNING org_id, email, role, invited_by, expires_at`,
+		tokenHash, email,
+	).Scan(&invite.OrgID, &invite.Email, &invite.Role, &invitedBy, &invite.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.OrgInvite{}, storage.ErrOrgInviteNotFound
+		}
+		return models.OrgInvite{}, fmt.Errorf("%s: %w", op, err)
+	}
+	invite.InvitedBy = invitedBy.Int64
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO org_members(org_id, user_id, role) VALUES($1, $2, $3)",
+		invite.OrgID, userID, invite.Role,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return models.OrgInvite{}, storage.ErrOrgMemberExists
+		}
+		return models.OrgInvite{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.OrgInvite{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return invite, nil
+}
+
+func collectOrgMembers(op string, rows *sql.Rows) ([]models.OrgMember, error) {
+	defer rows.Close()
+
+	var members []models.OrgMember
+	for rows.Next() {
+		var m models.OrgMember
+		if err := rows.Scan(&m.OrgID, &m.OrgName, &m.UserID, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
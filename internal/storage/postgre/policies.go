@@ -0,0 +1,103 @@
+package postgre
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) SavePolicy(ctx context.Context, policy models.Policy) (int64, error) {
+	const op = "storage.postgre.SavePolicy"
+
+	var id int64
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO app_policies(app_id, name, target, expression, enabled)
+		VALUES($1, $2, $3, $4, $5) RETURNING id`,
+		policy.AppID, policy.Name, policy.Target, policy.Expression, policy.Enabled,
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, storage.ErrPolicyExists
+		}
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return 0, storage.ErrAppNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Policies отдает политики приложения вместе с выключенными, упорядочены по имени
+// что бы причина отказа не зависела от порядка в базе
+func (s *Storage) Policies(ctx context.Context, appID int) ([]models.Policy, error) {
+	const op = "storage.postgre.Policies"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, app_id, name, target, expression, enabled, created_at
+		FROM app_policies WHERE app_id = $1 ORDER BY name`,
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var policies []models.Policy
+	for rows.Next() {
+		var p models.Policy
+		if err := rows.Scan(&p.ID, &p.AppID, &p.Name, &p.Target, &p.Expression, &p.Enabled, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return policies, nil
+}
+
+func (s *Storage) SetPolicyEnabled(ctx context.Context, policyID int64, enabled bool) error {
+	const op = "storage.postgre.SetPolicyEnabled"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE app_policies SET enabled = $2 WHERE id = $1", policyID, enabled)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrPolicyNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) DeletePolicy(ctx context.Context, policyID int64) error {
+	const op = "storage.postgre.DeletePolicy"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM app_policies WHERE id = $1", policyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrPolicyNotFound
+	}
+
+	return nil
+}
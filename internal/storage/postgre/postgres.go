@@ -1,14 +1,13 @@
 package postgre
 
 import (
-	"STTAuth/internal/domain/models"
-	"STTAuth/internal/storage"
 	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 
-	_ "github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
 )
 
 type Storage struct {
@@ -50,7 +49,7 @@ func (s *Storage) SaveUser(ctx context.Context, email string, pass_hash []byte)
 	var id int64
 	var exists bool
 
-	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1", email).Scan(&id, &exists)
+	err = tx.QueryRowContext(ctx, "SELECT id, TRUE FROM users WHERE email = $1", email).Scan(&id, &exists)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Пользователь не найден, можно вставить нового пользователя
@@ -89,7 +88,7 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 
 	var user models.User
 
-	err := s.db.QueryRowContext(ctx, "SELECT id, email, pass_hash FROM users WHERE email = $1", email).Scan(&user.ID, &user.Email, &user.PassHash)
+	err := s.db.QueryRowContext(ctx, "SELECT id, email, pass_hash, locked_at, email_verified_at FROM users WHERE email = $1", email).Scan(&user.ID, &user.Email, &user.PassHash, &user.LockedAt, &user.EmailVerifiedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.User{}, storage.ErrUserNotFound
@@ -100,27 +99,103 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	return user, nil
 }
 
-func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
-	const op = "storage.postgre.IsAdmin"
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.postgre.UserByID"
 
-	var isAdmin bool
+	var user models.User
 
-	err := s.db.QueryRowContext(ctx, "SELECT is_admin FROM users WHERE id = $1", userID).Scan(&isAdmin)
+	err := s.db.QueryRowContext(ctx, "SELECT id, email, pass_hash, locked_at, email_verified_at FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Email, &user.PassHash, &user.LockedAt, &user.EmailVerifiedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return false, storage.ErrUserNotFound
+			return models.User{}, storage.ErrUserNotFound
 		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// IsAdmin оставлен для совместимости: админ это тот у кого есть глобальная роль admin,
+// напрямую или через наследование
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	const op = "storage.postgre.IsAdmin"
+
+	var userExists, isAdmin bool
+
+	err := s.db.QueryRowContext(ctx,
+		`WITH RECURSIVE effective AS (
+			SELECT r.id, r.name, r.app_id, r.inherits_id
+			FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = $1 AND r.app_id IS NULL
+			UNION
+			SELECT p.id, p.name, p.app_id, p.inherits_id
+			FROM roles p JOIN effective e ON p.id = e.inherits_id
+		)
+		SELECT
+			EXISTS (SELECT 1 FROM users WHERE id = $1),
+			EXISTS (SELECT 1 FROM effective WHERE name = $2 AND app_id IS NULL)`,
+		userID, models.RoleAdmin,
+	).Scan(&userExists, &isAdmin)
+	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
+	if !userExists {
+		return false, storage.ErrUserNotFound
+	}
+
 	return isAdmin, nil
 }
 
+// SetAdmin выдает или забирает глобальную роль admin
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const op = "storage.postgre.SetAdmin"
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return storage.ErrUserNotFound
+	}
+
+	query := `DELETE FROM user_roles WHERE user_id = $1
+		AND role_id IN (SELECT id FROM roles WHERE name = $2 AND app_id IS NULL)`
+	if isAdmin {
+		query = `INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM roles WHERE name = $2 AND app_id IS NULL
+		ON CONFLICT DO NOTHING`
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, userID, models.RoleAdmin); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SetClientSecret(ctx context.Context, appID int, secretHash []byte) error {
+	const op = "storage.postgre.SetClientSecret"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE apps SET client_secret_hash = $2 WHERE id = $1", appID, secretHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrAppNotFound
+	}
+
+	return nil
+}
+
 func (s *Storage) App(ctx context.Context, appID int) (models.App, error) {
 	const op = "storage.postgre.App"
 
-	var app models.App
-
-	err := s.db.QueryRowContext(ctx, "SELECT * FROM apps WHERE id = $1", appID).Scan(&app.ID, &app.Name, &app.Secret)
+	app, err := scanApp(s.db.QueryRowContext(ctx, "SELECT "+appColumns+" FROM apps WHERE id = $1", appID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.App{}, storage.ErrAppNotFound
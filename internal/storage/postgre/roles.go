@@ -0,0 +1,255 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+const foreignKeyViolation = "23503"
+
+// roleColumns это общая часть выборки ролей, разрешения собираются в массив
+const roleColumns = `r.id, r.name, COALESCE(r.app_id, 0), COALESCE(r.inherits_id, 0), r.created_at,
+	COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')`
+
+func scanRole(row interface{ Scan(dest ...any) error }) (models.Role, error) {
+	var role models.Role
+	err := row.Scan(&role.ID, &role.Name, &role.AppID, &role.Inherits, &role.CreatedAt, pq.Array(&role.Permissions))
+	return role, err
+}
+
+func (s *Storage) SaveRole(ctx context.Context, role models.Role) (int64, error) {
+	const op = "storage.postgre.SaveRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO roles(name, app_id, inherits_id) VALUES($1, NULLIF($2, 0), NULLIF($3, 0)) RETURNING id",
+		role.Name, role.AppID, role.Inherits,
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, storage.ErrRoleExists
+		}
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return 0, storage.ErrRoleNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := savePermissions(ctx, tx, id, role.Permissions); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Role(ctx context.Context, roleID int64) (models.Role, error) {
+	const op = "storage.postgre.Role"
+
+	role, err := scanRole(s.db.QueryRowContext(ctx,
+		`SELECT `+roleColumns+`
+		FROM roles r LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		WHERE r.id = $1
+		GROUP BY r.id`,
+		roleID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Role{}, storage.ErrRoleNotFound
+		}
+		return models.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return role, nil
+}
+
+// Roles отдает роли приложения, а при appID = 0 глобальные роли
+func (s *Storage) Roles(ctx context.Context, appID int) ([]models.Role, error) {
+	const op = "storage.postgre.Roles"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+roleColumns+`
+		FROM roles r LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		WHERE COALESCE(r.app_id, 0) = $1
+		GROUP BY r.id
+		ORDER BY r.name`,
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return collectRoles(op, rows)
+}
+
+func (s *Storage) DeleteRole(ctx context.Context, roleID int64) error {
+	const op = "storage.postgre.DeleteRole"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM roles WHERE id = $1", roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrRoleNotFound
+	}
+
+	return nil
+}
+
+// SetRolePermissions заменяет разрешения роли целиком
+func (s *Storage) SetRolePermissions(ctx context.Context, roleID int64, permissions []string) error {
+	const op = "storage.postgre.SetRolePermissions"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Блокируем роль что бы параллельная замена не смешала два набора разрешений
+	var id int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM roles WHERE id = $1 FOR UPDATE", roleID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.ErrRoleNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_id = $1", roleID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := savePermissions(ctx, tx, roleID, permissions); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.postgre.AssignRole"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO user_roles(user_id, role_id) VALUES($1, $2) ON CONFLICT DO NOTHING",
+		userID, roleID,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			if pqErr.Constraint == "user_roles_user_id_fkey" {
+				return storage.ErrUserNotFound
+			}
+			return storage.ErrRoleNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.postgre.UnassignRole"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2", userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrRoleNotAssigned
+	}
+
+	return nil
+}
+
+// UserRoles отдает роли которые действуют для пользователя в приложении: глобальные и роли
+// этого приложения, вместе с теми что получены по наследованию
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	const op = "storage.postgre.UserRoles"
+
+	// UNION а не UNION ALL, так что даже при цикле в наследовании рекурсия остановится
+	rows, err := s.db.QueryContext(ctx,
+		`WITH RECURSIVE effective AS (
+			SELECT r.id
+			FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = $1 AND (r.app_id IS NULL OR r.app_id = $2)
+			UNION
+			SELECT p.inherits_id
+			FROM roles p JOIN effective e ON p.id = e.id
+			WHERE p.inherits_id IS NOT NULL
+		)
+		SELECT `+roleColumns+`
+		FROM effective e
+		JOIN roles r ON r.id = e.id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		GROUP BY r.id
+		ORDER BY r.name`,
+		userID, appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return collectRoles(op, rows)
+}
+
+func collectRoles(op string, rows *sql.Rows) ([]models.Role, error) {
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func savePermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO role_permissions(role_id, permission) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING",
+		roleID, pq.Array(permissions),
+	)
+	return err
+}
@@ -0,0 +1,123 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.postgre.SaveSession"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions(id, user_id, app_id, user_agent, ip, created_at, last_seen_at) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		session.ID, session.UserID, session.AppID, session.UserAgent, session.IP, session.CreatedAt, session.LastSeenAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, sessionID string) (models.Session, error) {
+	const op = "storage.postgre.Session"
+
+	var session models.Session
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, user_id, app_id, user_agent, ip, created_at, last_seen_at, revoked_at FROM sessions WHERE id = $1",
+		sessionID,
+	).Scan(&session.ID, &session.UserID, &session.AppID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Session{}, storage.ErrSessionNotFound
+		}
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// Sessions возвращает только активные (не отозванные) сессии пользователя
+func (s *Storage) Sessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "storage.postgre.Sessions"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, user_id, app_id, user_agent, ip, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND revoked_at IS NULL ORDER BY last_seen_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.AppID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) TouchSession(ctx context.Context, sessionID string) error {
+	const op = "storage.postgre.TouchSession"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = NOW() WHERE id = $1", sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "storage.postgre.RevokeSession"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeAllSessions(ctx context.Context, userID int64) (int64, error) {
+	const op = "storage.postgre.RevokeAllSessions"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,124 @@
+package postgre
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+)
+
+// WriteTuples записывает кортежи одной транзакцией, уже существующие пропускаются
+func (s *Storage) WriteTuples(ctx context.Context, tuples []models.RelationTuple) error {
+	const op = "storage.postgre.WriteTuples"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range tuples {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO relation_tuples(namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation)
+			VALUES($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`,
+			t.Namespace, t.ObjectID, t.Relation, t.Subject.Namespace, t.Subject.ObjectID, t.Subject.Relation,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteTuples удаляет кортежи одной транзакцией, отсутствующие не считаются ошибкой
+func (s *Storage) DeleteTuples(ctx context.Context, tuples []models.RelationTuple) error {
+	const op = "storage.postgre.DeleteTuples"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range tuples {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM relation_tuples
+			WHERE namespace = $1 AND object_id = $2 AND relation = $3
+				AND subject_namespace = $4 AND subject_object_id = $5 AND subject_relation = $6`,
+			t.Namespace, t.ObjectID, t.Relation, t.Subject.Namespace, t.Subject.ObjectID, t.Subject.Relation,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Subjects отдает субъектов у которых отношение к объекту записано напрямую
+func (s *Storage) Subjects(ctx context.Context, namespace string, objectID string, relation string) ([]models.Subject, error) {
+	const op = "storage.postgre.Subjects"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT subject_namespace, subject_object_id, subject_relation
+		FROM relation_tuples
+		WHERE namespace = $1 AND object_id = $2 AND relation = $3
+		ORDER BY subject_namespace, subject_object_id, subject_relation`,
+		namespace, objectID, relation,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var subjects []models.Subject
+	for rows.Next() {
+		var subject models.Subject
+		if err := rows.Scan(&subject.Namespace, &subject.ObjectID, &subject.Relation); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		subjects = append(subjects, subject)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return subjects, nil
+}
+
+// Objects отдает id всех объектов namespace о которых есть хоть один кортеж
+func (s *Storage) Objects(ctx context.Context, namespace string) ([]string, error) {
+	const op = "storage.postgre.Objects"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT DISTINCT object_id FROM relation_tuples WHERE namespace = $1 ORDER BY object_id",
+		namespace,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var objects []string
+	for rows.Next() {
+		var objectID string
+		if err := rows.Scan(&objectID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		objects = append(objects, objectID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return objects, nil
+}
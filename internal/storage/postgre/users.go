@@ -0,0 +1,159 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	"github.com/skinkvi/STTAuth/internal/storage"
+)
+
+// userInfoQuery считает is_admin так же как IsAdmin: глобальная роль admin напрямую или через наследование
+const userInfoQuery = `WITH RECURSIVE effective AS (
+		SELECT ur.user_id, r.id, r.name, r.inherits_id
+		FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE r.app_id IS NULL
+		UNION
+		SELECT e.user_id, p.id, p.name, p.inherits_id
+		FROM roles p JOIN effective e ON p.id = e.inherits_id
+	)
+	SELECT u.id, u.email, u.locked_at,
+		EXISTS (SELECT 1 FROM effective e WHERE e.user_id = u.id AND e.name = $1) AS is_admin
+	FROM users u`
+
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.UserInfo, error) {
+	const op = "storage.postgre.ListUsers"
+
+	args := []interface{}{models.RoleAdmin, filter.AfterID}
+	where := []string{"u.id > $2"}
+
+	if filter.EmailPrefix != "" {
+		args = append(args, escapeLike(filter.EmailPrefix)+"%")
+		where = append(where, fmt.Sprintf("u.email ILIKE $%d", len(args)))
+	}
+	if filter.Locked != nil {
+		if *filter.Locked {
+			where = append(where, "u.locked_at IS NOT NULL")
+		} else {
+			where = append(where, "u.locked_at IS NULL")
+		}
+	}
+	if filter.AdminsOnly {
+		where = append(where, "EXISTS (SELECT 1 FROM effective e WHERE e.user_id = u.id AND e.name = $1)")
+	}
+
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf("%s WHERE %s ORDER BY u.id LIMIT $%d", userInfoQuery, strings.Join(where, " AND "), len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.UserInfo
+	for rows.Next() {
+		var user models.UserInfo
+		if err := rows.Scan(&user.ID, &user.Email, &user.LockedAt, &user.IsAdmin); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+func (s *Storage) UserInfo(ctx context.Context, userID int64) (models.UserInfo, error) {
+	const op = "storage.postgre.UserInfo"
+
+	var user models.UserInfo
+	err := s.db.QueryRowContext(ctx, userInfoQuery+" WHERE u.id = $2", models.RoleAdmin, userID).
+		Scan(&user.ID, &user.Email, &user.LockedAt, &user.IsAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserInfo{}, storage.ErrUserNotFound
+		}
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Storage) UpdateUserEmail(ctx context.Context, userID int64, email string) error {
+	const op = "storage.postgre.UpdateUserEmail"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET email = $2, email_verified_at = NULL WHERE id = $1", userID, email)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return storage.ErrUserExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userAffected(op, res)
+}
+
+// MarkEmailVerified отмечает email подтвержденным. Время первого подтверждения не перезаписывается
+func (s *Storage) MarkEmailVerified(ctx context.Context, userID int64) error {
+	const op = "storage.postgre.MarkEmailVerified"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userAffected(op, res)
+}
+
+// SetUserLocked в отличие от LockUser умеет и снимать блокировку. Время первой блокировки не перезаписывается
+func (s *Storage) SetUserLocked(ctx context.Context, userID int64, locked bool) error {
+	const op = "storage.postgre.SetUserLocked"
+
+	query := "UPDATE users SET locked_at = NULL WHERE id = $1"
+	if locked {
+		query = "UPDATE users SET locked_at = COALESCE(locked_at, NOW()) WHERE id = $1"
+	}
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userAffected(op, res)
+}
+
+// DeleteUser удаляет пользователя, сессии, ключи, роли и прочее уходят каскадом
+func (s *Storage) DeleteUser(ctx context.Context, userID int64) error {
+	const op = "storage.postgre.DeleteUser"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userAffected(op, res)
+}
+
+func userAffected(op string, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+	return nil
+}
+
+// escapeLike экранирует спецсимволы LIKE что бы префикс искался буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
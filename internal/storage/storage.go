@@ -3,7 +3,29 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrAppNotFound  = errors.New("app not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrAppNotFound        = errors.New("app not found")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrAlertNotFound      = errors.New("login alert not found")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrInviteNotFound     = errors.New("invite not found")
+	ErrStateNotFound      = errors.New("federation state not found")
+	ErrIdentityExists     = errors.New("identity already linked")
+	ErrIdentityNotFound   = errors.New("identity not found")
+	ErrAuthCodeNotFound   = errors.New("authorization code not found")
+	ErrDeviceCodeExists   = errors.New("device code already exists")
+	ErrDeviceCodeNotFound = errors.New("device code not found")
+	ErrConsentNotFound    = errors.New("consent not found")
+	ErrAppExists          = errors.New("app already exists")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleNotAssigned    = errors.New("role is not assigned to user")
+	ErrPolicyExists       = errors.New("policy already exists")
+	ErrPolicyNotFound     = errors.New("policy not found")
+	ErrOrgNotFound        = errors.New("organization not found")
+	ErrOrgMemberExists    = errors.New("user is already a member of organization")
+	ErrOrgMemberNotFound  = errors.New("organization member not found")
+	ErrOrgInviteNotFound  = errors.New("organization invite not found")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
 )
@@ -0,0 +1,51 @@
+// Package sttauth нужен сервисам которые стоят за STTAuth: проверить токен пользователя,
+// достать из него claims и решить пускать ли в метод. Транспорт в подпакетах: grpcauth для gRPC, httpauth для net/http
+package sttauth
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Claims это проверенное содержимое токена STTAuth
+type Claims struct {
+	// UserID пустой у сервисных токенов, их получает само приложение а не пользователь
+	UserID    int64
+	Email     string
+	AppID     int
+	SessionID string
+	Scopes    []string
+	// Roles это роли пользователя в приложении на момент выдачи токена
+	Roles []string
+	// OrgID это организация от имени которой работает пользователь, 0 если ее нет
+	OrgID     int64
+	ExpiresAt time.Time
+}
+
+// IsService говорит что токен выдан приложению через client credentials, без пользователя
+func (c *Claims) IsService() bool {
+	return c.UserID == 0
+}
+
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+type claimsKey struct{}
+
+// NewContext кладет claims в контекст, так их получают обработчики после интерцептора
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext отдает claims вызывающего. false значит что токен не проверялся,
+// например метод в списке пропускаемых
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
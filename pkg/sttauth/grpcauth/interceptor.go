@@ -0,0 +1,137 @@
+// Package grpcauth это интерцепторы для gRPC сервисов за STTAuth. Они достают токен из
+// метаданных, проверяют его и кладут claims в контекст, откуда их берет sttauth.FromContext
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/pkg/sttauth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataAuthorization это ключ метаданных в котором клиент присылает "Bearer <token>"
+const MetadataAuthorization = "authorization"
+
+// HealthMethods это методы стандартного grpc.health.v1, их обычно дергает балансировщик без токена
+var HealthMethods = []string{
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/Watch",
+}
+
+type config struct {
+	requirements map[string]sttauth.Requirement
+	skip         map[string]struct{}
+}
+
+type Option func(c *config)
+
+// WithRequirements задает требования по полному имени метода, например "/leaderboard.Leaderboard/Submit".
+// Методам которых нет в списке хватает любого валидного токена
+func WithRequirements(requirements map[string]sttauth.Requirement) Option {
+	return func(c *config) {
+		for method, requirement := range requirements {
+			c.requirements[method] = requirement
+		}
+	}
+}
+
+// WithSkip пропускает методы без проверки токена, например HealthMethods
+func WithSkip(methods ...string) Option {
+	return func(c *config) {
+		for _, method := range methods {
+			c.skip[method] = struct{}{}
+		}
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		requirements: make(map[string]sttauth.Requirement),
+		skip:         make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// UnaryServerInterceptor проверяет токен до обработчика. Без токена в метод не попасть,
+// если метод не перечислен в WithSkip
+func UnaryServerInterceptor(verifier sttauth.Verifier, opts ...Option) grpc.UnaryServerInterceptor {
+	c := newConfig(opts)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := c.authorize(ctx, verifier, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor то же самое для стримов. Токен проверяется один раз при открытии стрима
+func StreamServerInterceptor(verifier sttauth.Verifier, opts ...Option) grpc.StreamServerInterceptor {
+	c := newConfig(opts)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := c.authorize(ss.Context(), verifier, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (c *config) authorize(ctx context.Context, verifier sttauth.Verifier, method string) (context.Context, error) {
+	if _, ok := c.skip[method]; ok {
+		return ctx, nil
+	}
+
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	}
+
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		if errors.Is(err, sttauth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "token expired or invalid")
+		}
+		return nil, status.Error(codes.Unavailable, "failed to verify token")
+	}
+
+	if err := c.requirements[method].Check(claims); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return sttauth.NewContext(ctx, claims), nil
+}
+
+// serverStream подменяет контекст стрима на контекст с claims
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataAuthorization)
+	if len(values) == 0 {
+		return ""
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,74 @@
+package grpcauth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/skinkvi/STTAuth/pkg/sttauth"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Introspector это часть ssov1.AuthClient которая нужна для проверки токена
+type Introspector interface {
+	Introspect(ctx context.Context, in *ssov1.IntrospectRequest, opts ...grpc.CallOption) (*ssov1.IntrospectResponce, error)
+}
+
+// TokenSource отдает сервисный токен приложения, обычно полученный через ClientCredentials и
+// закешированный до истечения
+type TokenSource func(ctx context.Context) (string, error)
+
+type introspectionVerifier struct {
+	client Introspector
+	source TokenSource
+	appID  int
+}
+
+// NewIntrospectionVerifier проверяет каждый токен через Introspect в STTAuth. Это на один запрос дороже
+// чем sttauth.NewSecretVerifier, зато отозванные сессии отклоняются сразу и работают личные API ключи.
+// Introspect принимает только сервисный токен приложения и отвечает active только для его токенов,
+// поэтому source должен отдавать токен того же приложения. appID дополнительно ограничивает токены
+// своим приложением, 0 не проверяет
+func NewIntrospectionVerifier(client Introspector, source TokenSource, appID int) sttauth.Verifier {
+	return &introspectionVerifier{
+		client: client,
+		source: source,
+		appID:  appID,
+	}
+}
+
+func (v *introspectionVerifier) Verify(ctx context.Context, token string) (*sttauth.Claims, error) {
+	if token == "" {
+		return nil, sttauth.ErrInvalidToken
+	}
+
+	serviceToken, err := v.source(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service token: %w", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+serviceToken)
+
+	resp, err := v.client.Introspect(ctx, &ssov1.IntrospectRequest{Token: token})
+	if err != nil {
+		return nil, fmt.Errorf("introspect: %w", err)
+	}
+	if !resp.GetActive() {
+		return nil, sttauth.ErrInvalidToken
+	}
+	if v.appID != 0 && int(resp.GetAppId()) != v.appID {
+		return nil, fmt.Errorf("%w: token issued for app %d", sttauth.ErrInvalidToken, resp.GetAppId())
+	}
+
+	return &sttauth.Claims{
+		UserID:    resp.GetUserId(),
+		Email:     resp.GetEmail(),
+		AppID:     int(resp.GetAppId()),
+		SessionID: resp.GetSessionId(),
+		Scopes:    resp.GetScopes(),
+		Roles:     resp.GetRoles(),
+		OrgID:     resp.GetOrgId(),
+		ExpiresAt: time.Unix(resp.GetExp(), 0),
+	}, nil
+}
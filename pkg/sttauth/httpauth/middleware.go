@@ -0,0 +1,170 @@
+// Package httpauth это net/http middleware для сервисов за STTAuth. Токен берется из заголовка
+// Authorization или из cookie, после проверки claims лежат в контексте запроса, см. sttauth.FromContext.
+// Ошибки отдаются как требует RFC 6750, с заголовком WWW-Authenticate
+package httpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/pkg/sttauth"
+)
+
+// Коды ошибок из RFC 6750 раздел 3.1
+const (
+	errInvalidRequest    = "invalid_request"
+	errInvalidToken      = "invalid_token"
+	errInsufficientScope = "insufficient_scope"
+)
+
+type config struct {
+	realm       string
+	cookie      string
+	requirement sttauth.Requirement
+}
+
+type Option func(c *config)
+
+// WithRealm добавляет realm в WWW-Authenticate
+func WithRealm(realm string) Option {
+	return func(c *config) {
+		c.realm = realm
+	}
+}
+
+// WithCookie разрешает брать токен из cookie с этим именем, если заголовка Authorization нет.
+// Браузер шлет cookie сам, так что сервису с таким входом нужна своя защита от CSRF
+func WithCookie(name string) Option {
+	return func(c *config) {
+		c.cookie = name
+	}
+}
+
+// WithRequirement задает роли и scopes нужные для обработчика. Без него хватает любого валидного токена
+func WithRequirement(requirement sttauth.Requirement) Option {
+	return func(c *config) {
+		c.requirement = requirement
+	}
+}
+
+// Middleware пропускает к next только запросы с валидным токеном. Разные требования
+// для разных ручек делаются отдельным Middleware на каждую
+func Middleware(verifier sttauth.Verifier, opts ...Option) func(http.Handler) http.Handler {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := c.token(r)
+			if !ok {
+				c.challenge(w, http.StatusBadRequest, errInvalidRequest, "malformed authorization header")
+				return
+			}
+			if token == "" {
+				// RFC 6750: если клиент не прислал ничего, код ошибки не указываем
+				c.challenge(w, http.StatusUnauthorized, "", "")
+				return
+			}
+
+			claims, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				if errors.Is(err, sttauth.ErrInvalidToken) {
+					c.challenge(w, http.StatusUnauthorized, errInvalidToken, "token expired or invalid")
+					return
+				}
+				writeError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "failed to verify token")
+				return
+			}
+
+			if err := c.requirement.Check(claims); err != nil {
+				c.challenge(w, http.StatusForbidden, errInsufficientScope, err.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(sttauth.NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// FromRequest отдает claims запроса который прошел через Middleware
+func FromRequest(r *http.Request) (*sttauth.Claims, bool) {
+	return sttauth.FromContext(r.Context())
+}
+
+// token достает токен из запроса. false значит что заголовок Authorization со схемой Bearer есть,
+// но он кривой, тогда это invalid_request а не отсутствие токена
+func (c *config) token(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, _ := strings.Cut(header, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(token)
+			return token, token != "" && !strings.ContainsAny(token, " \t")
+		}
+		// Другие схемы, например Basic, не наши. Считаем что токена нет
+	}
+
+	if c.cookie != "" {
+		if cookie, err := r.Cookie(c.cookie); err == nil {
+			return cookie.Value, true
+		}
+	}
+
+	return "", true
+}
+
+// challenge отвечает ошибкой с заголовком WWW-Authenticate по RFC 6750 раздел 3
+func (c *config) challenge(w http.ResponseWriter, status int, code string, description string) {
+	var params []string
+	if c.realm != "" {
+		params = append(params, `realm="`+quote(c.realm)+`"`)
+	}
+	if code != "" {
+		params = append(params, `error="`+code+`"`)
+	}
+	if description != "" {
+		params = append(params, `error_description="`+quote(description)+`"`)
+	}
+	if code == errInsufficientScope && len(c.requirement.Scopes) > 0 {
+		params = append(params, `scope="`+quote(strings.Join(c.requirement.Scopes, " "))+`"`)
+	}
+
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+
+	if code == "" {
+		w.WriteHeader(status)
+		return
+	}
+	writeError(w, status, code, description)
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: code, ErrorDescription: description})
+}
+
+// quote выкидывает символы которые RFC 6750 не разрешает внутри значений параметров: кавычку,
+// обратный слеш и все что вне печатного ASCII
+func quote(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, s)
+}
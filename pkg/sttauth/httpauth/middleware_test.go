@@ -0,0 +1,116 @@
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/skinkvi/STTAuth/pkg/sttauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type brokenVerifier struct{}
+
+func (brokenVerifier) Verify(context.Context, string) (*sttauth.Claims, error) {
+	return nil, errors.New("connection refused")
+}
+
+func newToken(t *testing.T, scopes []string) string {
+	t.Helper()
+
+	token, err := jwtT.NewToken(models.User{ID: 7, Email: "student@school.ru"}, models.App{ID: 3, Secret: "secret"}, time.Hour,
+		jwtT.WithScopes(scopes),
+		jwtT.WithRoles([]string{"student"}),
+	)
+	require.NoError(t, err)
+	return token
+}
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	var got *sttauth.Claims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromRequest(r)
+	})
+
+	handler := Middleware(sttauth.NewSecretVerifier(3, "secret"),
+		WithRealm("leaderboard"),
+		WithCookie("stt_session"),
+		WithRequirement(sttauth.Requirement{Scopes: []string{"leaderboard:write"}}),
+	)(next)
+
+	t.Run("no token", func(t *testing.T) {
+		rec := serve(handler, httptest.NewRequest(http.MethodPost, "/scores", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, `Bearer realm="leaderboard"`, rec.Header().Get("WWW-Authenticate"))
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("malformed header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/scores", nil)
+		req.Header.Set("Authorization", "Bearer")
+		rec := serve(handler, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_request"`)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/scores", nil)
+		req.Header.Set("Authorization", "Bearer not-a-jwt")
+		rec := serve(handler, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, `Bearer realm="leaderboard", error="invalid_token", error_description="token expired or invalid"`,
+			rec.Header().Get("WWW-Authenticate"))
+		assert.JSONEq(t, `{"error":"invalid_token","error_description":"token expired or invalid"}`, rec.Body.String())
+	})
+
+	t.Run("insufficient scope", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/scores", nil)
+		req.Header.Set("Authorization", "Bearer "+newToken(t, []string{"leaderboard:read"}))
+		rec := serve(handler, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `scope="leaderboard:write"`)
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/scores", nil)
+		req.Header.Set("Authorization", "bearer "+newToken(t, []string{"leaderboard:write"}))
+		rec := serve(handler, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, got)
+		assert.Equal(t, int64(7), got.UserID)
+	})
+
+	t.Run("session cookie", func(t *testing.T) {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/scores", nil)
+		req.AddCookie(&http.Cookie{Name: "stt_session", Value: newToken(t, []string{"leaderboard:write"})})
+		rec := serve(handler, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, got)
+		assert.Equal(t, []string{"student"}, got.Roles)
+	})
+}
+
+func TestMiddleware_VerifierUnavailable(t *testing.T) {
+	handler := Middleware(brokenVerifier{})(http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/scores", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := serve(handler, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+}
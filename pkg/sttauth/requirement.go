@@ -0,0 +1,44 @@
+package sttauth
+
+import "fmt"
+
+// Requirement это что нужно токену что бы попасть в метод. Пустой Requirement пускает любой валидный токен
+type Requirement struct {
+	// Roles достаточно любой из перечисленных ролей
+	Roles []string
+	// Scopes нужны все перечисленные
+	Scopes []string
+	// AllowService пускает сервисные токены без проверки ролей, ролей у них все равно нет
+	AllowService bool
+}
+
+// Check возвращает ErrForbidden если claims не подходят под требование
+func (r Requirement) Check(claims *Claims) error {
+	if claims.IsService() && r.AllowService {
+		return r.checkScopes(claims)
+	}
+
+	if len(r.Roles) > 0 {
+		allowed := false
+		for _, role := range r.Roles {
+			if claims.HasRole(role) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: one of roles %v is required", ErrForbidden, r.Roles)
+		}
+	}
+
+	return r.checkScopes(claims)
+}
+
+func (r Requirement) checkScopes(claims *Claims) error {
+	for _, scope := range r.Scopes {
+		if !claims.HasScope(scope) {
+			return fmt.Errorf("%w: scope %q is required", ErrForbidden, scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package sttjwt разбирает access токены STTAuth. Он публичный, потому что подпись своих токенов
+// проверяют и сами сервисы через sttauth.NewSecretVerifier, а internal пакеты им недоступны
+package sttjwt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Имена claims в access токене
+const (
+	UIDKey       = "uid"
+	EmailKey     = "email"
+	ExpKey       = "exp"
+	IssuedAtKey  = "iat"
+	AppIDKey     = "app_id"
+	SessionIDKey = "sid"
+	ScopeKey     = "scope"
+	RolesKey     = "roles"
+	OrgIDKey     = "org_id"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims это содержимое access токена после проверки подписи
+type Claims struct {
+	// UID пустой у сервисных токенов, их получает само приложение а не пользователь
+	UID       int64
+	Email     string
+	AppID     int
+	SessionID string
+	Scopes    []string
+	Roles     []string
+	// OrgID это организация от имени которой пользователь работает, 0 если ее нет
+	OrgID     int64
+	ExpiresAt time.Time
+	// IssuedAt пустой у токенов выпущенных до того как в них появился iat
+	IssuedAt time.Time
+}
+
+// Parse проверяет подпись и срок жизни токена. Токен подписан секретом приложения, поэтому
+// сначала достаем app_id без проверки а потом через secretsFunc получаем его секреты.
+// Секретов может быть несколько, например во время ротации. Подпись подходит если совпала с любым
+func Parse(tokenString string, secretsFunc func(appID int) ([]string, error)) (*Claims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		appID, ok := claims[AppIDKey].(float64)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		secrets, err := secretsFunc(int(appID))
+		if err != nil {
+			return nil, err
+		}
+
+		keys := jwt.VerificationKeySet{}
+		for _, secret := range secrets {
+			keys.Keys = append(keys.Keys, []byte(secret))
+		}
+
+		return keys, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	return claimsFromMap(mapClaims)
+}
+
+func claimsFromMap(mapClaims jwt.MapClaims) (*Claims, error) {
+	// У сервисных токенов uid нет, но тогда обязательно должен быть app_id
+	uid, _ := mapClaims[UIDKey].(float64)
+	appID, ok := mapClaims[AppIDKey].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	email, _ := mapClaims[EmailKey].(string)
+	sessionID, _ := mapClaims[SessionIDKey].(string)
+	scope, _ := mapClaims[ScopeKey].(string)
+	orgID, _ := mapClaims[OrgIDKey].(float64)
+
+	var roles []string
+	if raw, ok := mapClaims[RolesKey].([]interface{}); ok {
+		for _, r := range raw {
+			if role, ok := r.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	exp, err := mapClaims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, ErrInvalidToken
+	}
+
+	var issuedAt time.Time
+	if iat, err := mapClaims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	return &Claims{
+		UID:       int64(uid),
+		Email:     email,
+		AppID:     int(appID),
+		SessionID: sessionID,
+		Scopes:    strings.Fields(scope),
+		Roles:     roles,
+		OrgID:     int64(orgID),
+		ExpiresAt: exp.Time,
+		IssuedAt:  issuedAt,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package sttauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skinkvi/STTAuth/pkg/sttauth/sttjwt"
+)
+
+var (
+	// ErrInvalidToken значит что токена нет, он просрочен, подделан или выдан другому приложению
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrForbidden значит что токен валидный, но ролей или scopes для метода не хватает
+	ErrForbidden = errors.New("forbidden")
+)
+
+// apiKeyPrefix это начало личных API ключей. Их подпись локально не проверить, они есть только в базе STTAuth
+const apiKeyPrefix = "stt_"
+
+// Verifier проверяет токен и отдает его claims. Ошибка ErrInvalidToken это ответ клиенту,
+// любая другая ошибка значит что проверить не получилось, например STTAuth недоступен
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
+type secretVerifier struct {
+	appID   int
+	secrets []string
+}
+
+// NewSecretVerifier проверяет подпись токенов своего приложения локально, без похода в STTAuth.
+// Секретов можно передать несколько, тогда во время ротации примутся токены со старым и новым.
+// Отзыв сессий и личные API ключи так не видны, если это важно используйте grpcauth.NewIntrospectionVerifier
+func NewSecretVerifier(appID int, secrets ...string) Verifier {
+	return &secretVerifier{
+		appID:   appID,
+		secrets: secrets,
+	}
+}
+
+func (v *secretVerifier) Verify(_ context.Context, token string) (*Claims, error) {
+	if token == "" || strings.HasPrefix(token, apiKeyPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	claims, err := sttjwt.Parse(token, func(appID int) ([]string, error) {
+		// Токены других приложений подписаны чужим секретом, но лучше отказать явно
+		if appID != v.appID {
+			return nil, fmt.Errorf("token issued for app %d", appID)
+		}
+		return v.secrets, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return &Claims{
+		UserID:    claims.UID,
+		Email:     claims.Email,
+		AppID:     claims.AppID,
+		SessionID: claims.SessionID,
+		Scopes:    claims.Scopes,
+		Roles:     claims.Roles,
+		OrgID:     claims.OrgID,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
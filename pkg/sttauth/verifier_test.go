@@ -0,0 +1,81 @@
+package sttauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skinkvi/STTAuth/internal/domain/models"
+	jwtT "github.com/skinkvi/STTAuth/internal/lib/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretVerifier(t *testing.T) {
+	ctx := context.Background()
+	user := models.User{ID: 7, Email: "student@school.ru"}
+	app := models.App{ID: 3, Secret: "new-secret"}
+
+	token, err := jwtT.NewToken(user, app, time.Hour,
+		jwtT.WithSessionID("sid"),
+		jwtT.WithScopes([]string{"leaderboard:read"}),
+		jwtT.WithRoles([]string{"teacher"}),
+	)
+	require.NoError(t, err)
+
+	verifier := NewSecretVerifier(3, "new-secret", "old-secret")
+	claims, err := verifier.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), claims.UserID)
+	assert.Equal(t, 3, claims.AppID)
+	assert.Equal(t, "sid", claims.SessionID)
+	assert.True(t, claims.HasRole("teacher"))
+	assert.True(t, claims.HasScope("leaderboard:read"))
+
+	// Токен подписанный старым секретом во время ротации тоже принимается
+	old, err := jwtT.NewToken(user, models.App{ID: 3, Secret: "old-secret"}, time.Hour)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, old)
+	require.NoError(t, err)
+
+	other, err := jwtT.NewToken(user, models.App{ID: 4, Secret: "new-secret"}, time.Hour)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, other)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := jwtT.NewToken(user, app, -time.Minute)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, expired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = verifier.Verify(ctx, "stt_0123abcd_secret")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRequirementCheck(t *testing.T) {
+	teacher := &Claims{UserID: 1, Roles: []string{"teacher"}, Scopes: []string{"leaderboard:read", "leaderboard:write"}}
+	student := &Claims{UserID: 2, Roles: []string{"student"}, Scopes: []string{"leaderboard:read"}}
+	service := &Claims{AppID: 3, Scopes: []string{"leaderboard:write"}}
+
+	assert.NoError(t, Requirement{}.Check(student))
+	assert.NoError(t, Requirement{}.Check(service))
+
+	submit := Requirement{Roles: []string{"teacher", "admin"}, Scopes: []string{"leaderboard:write"}}
+	assert.NoError(t, submit.Check(teacher))
+	assert.ErrorIs(t, submit.Check(student), ErrForbidden)
+	assert.ErrorIs(t, submit.Check(service), ErrForbidden)
+
+	submit.AllowService = true
+	assert.NoError(t, submit.Check(service))
+	assert.ErrorIs(t, Requirement{AllowService: true, Scopes: []string{"leaderboard:read"}}.Check(service), ErrForbidden)
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	claims := &Claims{UserID: 1}
+	got, ok := FromContext(NewContext(context.Background(), claims))
+	require.True(t, ok)
+	assert.Same(t, claims, got)
+}
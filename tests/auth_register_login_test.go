@@ -1,12 +1,12 @@
 package tests
 
 import (
-	"STTAuth/tests/suite"
 	"testing"
 	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/skinkvi/STTAuth/tests/suite"
 	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
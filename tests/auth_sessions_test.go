@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/skinkvi/STTAuth/tests/suite"
+	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    email,
+		Password: pass,
+	})
+	require.NoError(t, err)
+
+	// Логинимся два раза, как будто с ноутбука и с телефона
+	first, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	second, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	respList, err := st.AuthClient.ListSessions(ctx, &ssov1.ListSessionsRequest{Token: second.GetToken()})
+	require.NoError(t, err)
+	require.Len(t, respList.GetSessions(), 2)
+
+	var stolen string
+	for _, session := range respList.GetSessions() {
+		if !session.GetCurrent() {
+			stolen = session.GetId()
+		}
+	}
+	require.NotEmpty(t, stolen)
+
+	_, err = st.AuthClient.RevokeSession(ctx, &ssov1.RevokeSessionRequest{
+		Token:     second.GetToken(),
+		SessionId: stolen,
+	})
+	require.NoError(t, err)
+
+	// Токен отозванной сессии больше не принимается
+	_, err = st.AuthClient.ListSessions(ctx, &ssov1.ListSessionsRequest{Token: first.GetToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	respAll, err := st.AuthClient.RevokeAllSessions(ctx, &ssov1.RevokeAllSessionsRequest{Token: second.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), respAll.GetRevoked())
+}
+
+func TestLogout_TokenBecomesInactive(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    email,
+		Password: pass,
+	})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	// Introspect доступен только приложению со своим сервисным токеном
+	respService, err := st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+		AppId:        appID,
+		ClientSecret: appSecret,
+	})
+	require.NoError(t, err)
+	serviceCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+respService.GetToken())
+
+	respIntrospect, err := st.AuthClient.Introspect(serviceCtx, &ssov1.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	require.True(t, respIntrospect.GetActive())
+
+	_, err = st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+
+	respIntrospect, err = st.AuthClient.Introspect(serviceCtx, &ssov1.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+}
@@ -1,12 +1,12 @@
 package suite
 
 import (
-	"STTAuth/internal/config"
 	"context"
 	"net"
 	"strconv"
 	"testing"
 
+	"github.com/skinkvi/STTAuth/internal/config"
 	ssov1 "github.com/skinkvi/protosSTT/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"